@@ -25,17 +25,20 @@ const (
 type Verdict int32
 
 const (
-	Verdict_VERDICT_PENDING               Verdict = 0
-	Verdict_VERDICT_JUDGING               Verdict = 1
-	Verdict_VERDICT_ACCEPTED              Verdict = 2
-	Verdict_VERDICT_WRONG_ANSWER          Verdict = 3
-	Verdict_VERDICT_TIME_LIMIT_EXCEEDED   Verdict = 4
-	Verdict_VERDICT_MEMORY_LIMIT_EXCEEDED Verdict = 5
-	Verdict_VERDICT_RUNTIME_ERROR         Verdict = 6
-	Verdict_VERDICT_COMPILATION_ERROR     Verdict = 7
-	Verdict_VERDICT_SYSTEM_ERROR          Verdict = 8
-	Verdict_VERDICT_INTERNAL_ERROR        Verdict = 9
-	Verdict_VERDICT_SKIPPED               Verdict = 10
+	Verdict_VERDICT_PENDING                 Verdict = 0
+	Verdict_VERDICT_JUDGING                 Verdict = 1
+	Verdict_VERDICT_ACCEPTED                Verdict = 2
+	Verdict_VERDICT_WRONG_ANSWER            Verdict = 3
+	Verdict_VERDICT_TIME_LIMIT_EXCEEDED     Verdict = 4
+	Verdict_VERDICT_MEMORY_LIMIT_EXCEEDED   Verdict = 5
+	Verdict_VERDICT_RUNTIME_ERROR           Verdict = 6
+	Verdict_VERDICT_COMPILATION_ERROR       Verdict = 7
+	Verdict_VERDICT_SYSTEM_ERROR            Verdict = 8
+	Verdict_VERDICT_INTERNAL_ERROR          Verdict = 9
+	Verdict_VERDICT_SKIPPED                 Verdict = 10
+	Verdict_VERDICT_OUTPUT_LIMIT_EXCEEDED   Verdict = 11
+	Verdict_VERDICT_IDLENESS_LIMIT_EXCEEDED Verdict = 12
+	Verdict_VERDICT_SECURITY_VIOLATION      Verdict = 13
 )
 
 // Enum value maps for Verdict.
@@ -52,19 +55,25 @@ var (
 		8:  "VERDICT_SYSTEM_ERROR",
 		9:  "VERDICT_INTERNAL_ERROR",
 		10: "VERDICT_SKIPPED",
+		11: "VERDICT_OUTPUT_LIMIT_EXCEEDED",
+		12: "VERDICT_IDLENESS_LIMIT_EXCEEDED",
+		13: "VERDICT_SECURITY_VIOLATION",
 	}
 	Verdict_value = map[string]int32{
-		"VERDICT_PENDING":               0,
-		"VERDICT_JUDGING":               1,
-		"VERDICT_ACCEPTED":              2,
-		"VERDICT_WRONG_ANSWER":          3,
-		"VERDICT_TIME_LIMIT_EXCEEDED":   4,
-		"VERDICT_MEMORY_LIMIT_EXCEEDED": 5,
-		"VERDICT_RUNTIME_ERROR":         6,
-		"VERDICT_COMPILATION_ERROR":     7,
-		"VERDICT_SYSTEM_ERROR":          8,
-		"VERDICT_INTERNAL_ERROR":        9,
-		"VERDICT_SKIPPED":               10,
+		"VERDICT_PENDING":                 0,
+		"VERDICT_JUDGING":                 1,
+		"VERDICT_ACCEPTED":                2,
+		"VERDICT_WRONG_ANSWER":            3,
+		"VERDICT_TIME_LIMIT_EXCEEDED":     4,
+		"VERDICT_MEMORY_LIMIT_EXCEEDED":   5,
+		"VERDICT_RUNTIME_ERROR":           6,
+		"VERDICT_COMPILATION_ERROR":       7,
+		"VERDICT_SYSTEM_ERROR":            8,
+		"VERDICT_INTERNAL_ERROR":          9,
+		"VERDICT_SKIPPED":                 10,
+		"VERDICT_OUTPUT_LIMIT_EXCEEDED":   11,
+		"VERDICT_IDLENESS_LIMIT_EXCEEDED": 12,
+		"VERDICT_SECURITY_VIOLATION":      13,
 	}
 )
 
@@ -457,7 +466,7 @@ const file_submission_proto_rawDesc = "" +
 	"\x06_inputB\x12\n" +
 	"\x10_expected_outputB\x10\n" +
 	"\x0e_actual_outputB\x10\n" +
-	"\x0e_error_message*\xac\x02\n" +
+	"\x0e_error_message*\x94\x03\n" +
 	"\aVerdict\x12\x13\n" +
 	"\x0fVERDICT_PENDING\x10\x00\x12\x13\n" +
 	"\x0fVERDICT_JUDGING\x10\x01\x12\x14\n" +
@@ -470,7 +479,10 @@ const file_submission_proto_rawDesc = "" +
 	"\x14VERDICT_SYSTEM_ERROR\x10\b\x12\x1a\n" +
 	"\x16VERDICT_INTERNAL_ERROR\x10\t\x12\x13\n" +
 	"\x0fVERDICT_SKIPPED\x10\n" +
-	"B)Z'github.com/jjudge-oj/api/proto;jjudgepbb\x06proto3"
+	"\x12!\n" +
+	"\x1dVERDICT_OUTPUT_LIMIT_EXCEEDED\x10\v\x12#\n" +
+	"\x1fVERDICT_IDLENESS_LIMIT_EXCEEDED\x10\f\x12\x1e\n" +
+	"\x1aVERDICT_SECURITY_VIOLATION\x10\rB)Z'github.com/jjudge-oj/api/proto;jjudgepbb\x06proto3"
 
 var (
 	file_submission_proto_rawDescOnce sync.Once
@@ -53,6 +53,7 @@ type ContestSubmission struct {
 	Username        string           `json:"username,omitempty"`
 	Code            string           `json:"code"`
 	Language        string           `json:"language"`
+	Files           []SourceFile     `json:"files,omitempty"`
 	Verdict         Verdict          `json:"verdict"`
 	Score           int              `json:"score"`
 	CPUTime         int64            `json:"cpu_time"`
@@ -61,7 +62,11 @@ type ContestSubmission struct {
 	TestsPassed     int              `json:"tests_passed"`
 	TestsTotal      int              `json:"tests_total"`
 	TestcaseResults []TestcaseResult `json:"testcase_results"`
-	SubmittedAt     time.Time        `json:"submitted_at"`
+	Judge           *JudgeInfo       `json:"judge,omitempty"`
+	// SampleOnly marks a sample-tests-only check; it is not counted as an
+	// attempt on the leaderboard.
+	SampleOnly  bool      `json:"sample_only"`
+	SubmittedAt time.Time `json:"submitted_at"`
 	UpdatedAt       time.Time        `json:"updated_at"`
 }
 
@@ -69,6 +74,7 @@ type ContestSubmission struct {
 type ContestSubmissionJob struct {
 	ContestSubmission ContestSubmission `json:"contest_submission"`
 	Problem           Problem           `json:"problem"`
+	OutputsKey        string            `json:"outputs_key,omitempty"`
 }
 
 // ContestProblemResult holds per-problem standing data for one user.
@@ -28,11 +28,44 @@ type Problem struct {
 	// expressed in bytes.
 	MemoryLimit int64 `json:"memory_limit" db:"memory_limit"`
 
+	// OutputLimit is the maximum output a submission may write per test
+	// case, expressed in bytes. Zero means the judge's default.
+	OutputLimit int64 `json:"output_limit" db:"output_limit"`
+
+	// MaxProcesses is the maximum number of processes and threads a
+	// submission may run at once. Zero means the language's default.
+	MaxProcesses int `json:"max_processes" db:"max_processes"`
+
+	// CPUs is the number of CPUs a submission runs on. Zero means one.
+	CPUs int `json:"cpus" db:"cpus"`
+
+	// TimeAccounting selects which time TimeLimit applies to: "cpu", the
+	// default, sums the CPU time of all threads; "wall" measures elapsed
+	// time, for problems that reward parallel speedup.
+	TimeAccounting TimeAccounting `json:"time_accounting" db:"time_accounting"`
+
+	// Type selects how submissions are judged: "batch" runs the submitted
+	// program on each test case, "output_only" grades uploaded output files.
+	Type ProblemType `json:"type" db:"type"`
+
+	// InputFile, when set, names the file in the work directory the test
+	// input is written to; the program's stdin is then empty.
+	InputFile string `json:"input_file,omitempty" db:"input_file"`
+
+	// OutputFile, when set, names the file in the work directory the
+	// program's output is read from after execution instead of stdout.
+	OutputFile string `json:"output_file,omitempty" db:"output_file"`
+
 	// TestcaseGroups is the ordered list of test case groups associated with
 	// this problem. Each group contains one or more test cases and contributes
 	// a fixed number of points toward the final score.
 	TestcaseGroups []TestcaseGroup `json:"testcase_groups" db:"testcase_groups"`
 
+	// GraderFiles are setter-provided files, such as an IOI-style grader and
+	// the header of the function contestants implement, placed next to the
+	// submission and compiled with it. They are loaded with the test cases.
+	GraderFiles []GraderFile `json:"grader_files,omitempty" db:"-"`
+
 	// Tags are free-form labels associated with the problem, used for
 	// categorization, filtering, and search.
 	Tags []string `json:"tags" db:"tags"`
@@ -54,6 +87,94 @@ type Problem struct {
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// ProblemType selects how submissions to a problem are judged.
+type ProblemType string
+
+const (
+	// ProblemTypeBatch problems compile and run the submitted code on every
+	// test case. It is the default.
+	ProblemTypeBatch ProblemType = "batch"
+
+	// ProblemTypeOutputOnly problems take a ZIP of output files named
+	// <subtask>_<testcase>.out, one per test case, and grade them with the
+	// checker without executing anything.
+	ProblemTypeOutputOnly ProblemType = "output_only"
+)
+
+// TimeAccounting selects how the time of a test case run is measured.
+type TimeAccounting string
+
+const (
+	// TimeAccountingCPU measures the CPU time summed over all threads and
+	// processes of the run. It is the default.
+	TimeAccountingCPU TimeAccounting = "cpu"
+
+	// TimeAccountingWall measures the elapsed wall clock time of the run.
+	TimeAccountingWall TimeAccounting = "wall"
+)
+
+// CPUCount returns the number of CPUs submissions to the problem run on.
+func (p Problem) CPUCount() int {
+	if p.CPUs < 1 {
+		return 1
+	}
+	return p.CPUs
+}
+
+// LanguageOutputOnly is the language recorded for submissions to
+// output-only problems.
+const LanguageOutputOnly = "output"
+
+// IsOutputOnly reports whether submissions to the problem are output files.
+func (p Problem) IsOutputOnly() bool {
+	return p.Type == ProblemTypeOutputOnly
+}
+
+// SampleTestcases returns a copy of the problem that keeps only the
+// non-hidden test cases. Groups left without test cases are dropped.
+func (p Problem) SampleTestcases() Problem {
+	groups := make([]TestcaseGroup, 0, len(p.TestcaseGroups))
+	for _, group := range p.TestcaseGroups {
+		samples := make([]Testcase, 0, len(group.Testcases))
+		for _, tc := range group.Testcases {
+			if !tc.IsHidden {
+				samples = append(samples, tc)
+			}
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		group.Testcases = samples
+		groups = append(groups, group)
+	}
+	p.TestcaseGroups = groups
+	return p
+}
+
+// GraderFile is a file shipped with a problem for one language and judged
+// together with every submission in that language.
+type GraderFile struct {
+	// Language is the submission language the file applies to.
+	Language string `json:"language" db:"language"`
+
+	// Name is the file name in the work directory, e.g. "grader.cpp".
+	Name string `json:"name" db:"name"`
+
+	// Key is the object storage key of the file contents.
+	Key string `json:"key" db:"object_key"`
+}
+
+// GraderFilesFor returns the grader files of the problem for language.
+func (p Problem) GraderFilesFor(language string) []GraderFile {
+	var files []GraderFile
+	for _, f := range p.GraderFiles {
+		if f.Language == language {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
 // TestcaseGroup represents a logical grouping of test cases within a problem.
 // Groups are evaluated together and may contribute a fixed number of points
 // toward the final score.
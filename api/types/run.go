@@ -0,0 +1,92 @@
+package types
+
+import "time"
+
+// RunStatus is the state of a custom invocation.
+type RunStatus string
+
+// Supported run statuses.
+const (
+	RunPending               RunStatus = "PENDING"
+	RunRunning               RunStatus = "RUNNING"
+	RunOK                    RunStatus = "OK"
+	RunCompilationError      RunStatus = "CE"
+	RunTimeLimitExceeded     RunStatus = "TLE"
+	RunMemoryLimitExceeded   RunStatus = "MLE"
+	RunRuntimeError          RunStatus = "RE"
+	RunSystemError           RunStatus = "SE"
+	RunOutputLimitExceeded   RunStatus = "OLE"
+	RunIdlenessLimitExceeded RunStatus = "ILE"
+	RunSecurityViolation     RunStatus = "SV"
+)
+
+// Finished reports whether the run has reached a final status.
+func (s RunStatus) Finished() bool {
+	return s != RunPending && s != RunRunning
+}
+
+// Run is a custom invocation: user code executed once against user-provided
+// input without any grading. Runs are not submissions and never affect
+// scores or leaderboards.
+type Run struct {
+	// ID is the unique identifier of the run.
+	ID int64 `json:"id" db:"id"`
+
+	// UserID identifies the user who requested the run.
+	UserID int `json:"user_id" db:"user_id"`
+
+	// ProblemID optionally identifies the problem whose limits apply.
+	// Zero means the default limits are used.
+	ProblemID int `json:"problem_id,omitempty" db:"problem_id"`
+
+	// Language is the identifier of the programming language used.
+	Language string `json:"language" db:"language"`
+
+	// Code is the source code to execute.
+	Code string `json:"code" db:"code"`
+
+	// Stdin is the input fed to the program.
+	Stdin string `json:"stdin" db:"stdin"`
+
+	// TimeLimit is the CPU time limit applied to the run, in milliseconds.
+	TimeLimit int64 `json:"time_limit" db:"time_limit"`
+
+	// MemoryLimit is the memory limit applied to the run, in bytes.
+	MemoryLimit int64 `json:"memory_limit" db:"memory_limit"`
+
+	// Status is the current state or outcome of the run.
+	Status RunStatus `json:"status" db:"status"`
+
+	// Stdout is the (possibly truncated) standard output of the program.
+	Stdout string `json:"stdout" db:"stdout"`
+
+	// Stderr is the (possibly truncated) standard error of the program,
+	// or the compiler output when compilation failed.
+	Stderr string `json:"stderr" db:"stderr"`
+
+	// ExitCode is the exit code of the program.
+	ExitCode int `json:"exit_code" db:"exit_code"`
+
+	// CPUTime is the CPU time consumed, expressed in milliseconds.
+	CPUTime int64 `json:"cpu_time" db:"cpu_time"`
+
+	// WallTime is the wall-clock time elapsed, expressed in milliseconds.
+	WallTime int64 `json:"wall_time" db:"wall_time"`
+
+	// Memory is the peak memory usage, expressed in bytes.
+	Memory int64 `json:"memory" db:"memory"`
+
+	// Message contains system messages, if any.
+	Message string `json:"message" db:"message"`
+
+	// CreatedAt is the timestamp when the run was requested.
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+
+	// UpdatedAt is the timestamp when the run was last updated.
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// RunJob is the message queue payload for a custom invocation.
+type RunJob struct {
+	Run Run `json:"run"`
+}
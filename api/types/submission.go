@@ -32,6 +32,10 @@ type Submission struct {
 	// Language is the identifier of the programming language used.
 	Language string `json:"language" db:"language"`
 
+	// Files holds the source files of a multi-file submission. When set,
+	// Code is only a combined view for display and the files are judged.
+	Files []SourceFile `json:"files,omitempty" db:"files"`
+
 	// Verdict is the final outcome of judging the submission.
 	Verdict Verdict `json:"verdict" db:"verdict"`
 
@@ -56,6 +60,10 @@ type Submission struct {
 	// TestsTotal is the total number of test cases executed.
 	TestsTotal int `json:"tests_total" db:"tests_total"`
 
+	// SampleOnly marks a pre-submission check judged only on the sample
+	// (non-hidden) test cases. Such submissions are not graded attempts.
+	SampleOnly bool `json:"sample_only" db:"sample_only"`
+
 	// CreatedAt is the timestamp when the submission was created.
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 
@@ -65,6 +73,35 @@ type Submission struct {
 	// TestcaseResults holds per-test-case execution results when available.
 	// This field may be omitted for summary or list views.
 	TestcaseResults []TestcaseResult `json:"testcase_results" db:"testcase_results"`
+
+	// Judge identifies the worker that judged the submission and how its
+	// timings were measured. It is nil until the submission is judged.
+	Judge *JudgeInfo `json:"judge,omitempty" db:"judge"`
+}
+
+// JudgeInfo records where a submission was judged, so that timings can be
+// compared across workers of different speed.
+type JudgeInfo struct {
+	// Worker is the identifier of the worker that judged the submission.
+	Worker string `json:"worker"`
+
+	// SpeedFactor is the mean calibrated speed of the sandbox slots that
+	// ran the test cases, relative to the reference machine. It is zero
+	// when the slots have not been calibrated.
+	SpeedFactor float64 `json:"speed_factor,omitempty"`
+
+	// NormalizedTime reports whether CPU times were scaled by the slot's
+	// speed factor to reference-machine time.
+	NormalizedTime bool `json:"normalized_time,omitempty"`
+}
+
+// SourceFile is one file of a multi-file submission.
+type SourceFile struct {
+	// Name is the file name in the work directory, without any directory.
+	Name string `json:"name"`
+
+	// Content is the file's source code.
+	Content string `json:"content"`
 }
 
 // SubmissionJob represents the payload sent to the judge queue.
@@ -74,6 +111,10 @@ type SubmissionJob struct {
 
 	// Problem includes full problem metadata and test cases.
 	Problem Problem `json:"problem"`
+
+	// OutputsKey is the object storage key of the uploaded output archive
+	// for submissions to output-only problems.
+	OutputsKey string `json:"outputs_key,omitempty"`
 }
 
 // TestcaseResult represents the result of executing a single test case
@@ -110,6 +151,92 @@ type TestcaseResult struct {
 
 	// ErrorMessage contains runtime or system error messages, if any.
 	ErrorMessage string `json:"error_message,omitempty" db:"error_message,omitempty"`
+
+	// Termination explains why the program stopped when it did not exit
+	// normally. It is nil for runs that exited with status zero.
+	Termination *Termination `json:"termination,omitempty" db:"-"`
+
+	// Slot is the sandbox slot of the worker that ran this test case.
+	Slot *int `json:"slot,omitempty" db:"-"`
+
+	// SpeedFactor is the calibrated speed of Slot at the time of the run.
+	SpeedFactor float64 `json:"speed_factor,omitempty" db:"-"`
+}
+
+// TerminationReason is the cause of an abnormal end of a test case run.
+type TerminationReason string
+
+// Supported termination reasons.
+const (
+	// TerminationCPUTimeLimit means the program used more CPU time than the
+	// time limit allows.
+	TerminationCPUTimeLimit TerminationReason = "cpu_time_limit"
+
+	// TerminationWallTimeLimit means the program ran past the wall clock
+	// limit, e.g. because it slept or waited for input.
+	TerminationWallTimeLimit TerminationReason = "wall_time_limit"
+
+	// TerminationMemoryLimit means the program exceeded the memory limit.
+	TerminationMemoryLimit TerminationReason = "memory_limit"
+
+	// TerminationOutputLimit means the program wrote more than the output
+	// limit.
+	TerminationOutputLimit TerminationReason = "output_limit"
+
+	// TerminationSignal means the program was killed by a signal, such as
+	// SIGSEGV, SIGFPE or SIGABRT.
+	TerminationSignal TerminationReason = "signal"
+
+	// TerminationNonZeroExit means the program exited with a non-zero
+	// status.
+	TerminationNonZeroExit TerminationReason = "nonzero_exit"
+
+	// TerminationSeccompViolation means the sandbox killed the program for
+	// making a forbidden system call.
+	TerminationSeccompViolation TerminationReason = "seccomp_violation"
+)
+
+// Termination describes how a test case run ended.
+type Termination struct {
+	// Reason is the cause of the termination.
+	Reason TerminationReason `json:"reason"`
+
+	// Signal is the name of the signal that killed the program, such as
+	// "SIGSEGV", when Reason is TerminationSignal.
+	Signal string `json:"signal,omitempty"`
+
+	// ExitCode is the exit status when Reason is TerminationNonZeroExit.
+	ExitCode int `json:"exit_code,omitempty"`
+
+	// Syscall is the name of the blocked system call, such as "socket",
+	// when Reason is TerminationSeccompViolation.
+	Syscall string `json:"syscall,omitempty"`
+}
+
+// String returns a short human-readable description of the termination,
+// such as "Runtime error (SIGSEGV)".
+func (t Termination) String() string {
+	switch t.Reason {
+	case TerminationCPUTimeLimit:
+		return "CPU time limit exceeded"
+	case TerminationWallTimeLimit:
+		return "Wall time limit exceeded"
+	case TerminationMemoryLimit:
+		return "Memory limit exceeded"
+	case TerminationOutputLimit:
+		return "Output limit exceeded"
+	case TerminationSignal:
+		return fmt.Sprintf("Runtime error (%s)", t.Signal)
+	case TerminationNonZeroExit:
+		return fmt.Sprintf("Runtime error (exit code %d)", t.ExitCode)
+	case TerminationSeccompViolation:
+		if t.Syscall != "" {
+			return fmt.Sprintf("Security violation (blocked %s)", t.Syscall)
+		}
+		return "Security violation (forbidden system call)"
+	default:
+		return string(t.Reason)
+	}
 }
 
 // Verdict represents the outcome of judging a submission or test case.
@@ -150,6 +277,18 @@ const (
 
 	// VerdictSkipped indicates the submission or test case was skipped.
 	VerdictSkipped
+
+	// VerdictOutputLimitExceeded indicates the submission wrote more output
+	// than the problem allows.
+	VerdictOutputLimitExceeded
+
+	// VerdictIdlenessLimitExceeded indicates the submission was stopped by
+	// the wall clock while barely using the CPU, e.g. blocked on input.
+	VerdictIdlenessLimitExceeded
+
+	// VerdictSecurityViolation indicates the sandbox stopped the submission
+	// for making a system call its language profile forbids.
+	VerdictSecurityViolation
 )
 
 // String returns the compact string representation of the verdict
@@ -178,6 +317,12 @@ func (v Verdict) String() string {
 		return "IE"
 	case VerdictSkipped:
 		return "SKIPPED"
+	case VerdictOutputLimitExceeded:
+		return "OLE"
+	case VerdictIdlenessLimitExceeded:
+		return "ILE"
+	case VerdictSecurityViolation:
+		return "SV"
 	default:
 		return "UNKNOWN"
 	}
@@ -199,6 +344,9 @@ var verdictFromString = map[string]Verdict{
 	"SE":      VerdictSystemError,
 	"IE":      VerdictInternalError,
 	"SKIPPED": VerdictSkipped,
+	"OLE":     VerdictOutputLimitExceeded,
+	"ILE":     VerdictIdlenessLimitExceeded,
+	"SV":      VerdictSecurityViolation,
 }
 
 func (v *Verdict) UnmarshalJSON(data []byte) error {
@@ -0,0 +1,101 @@
+package types
+
+import "time"
+
+// ReferenceSolution is a solution attached by a problem setter and judged
+// against the problem's testcases to validate them. The main solution is
+// expected to be accepted; "wrong" solutions are expected to fail with a
+// specific verdict such as WA or TLE.
+type ReferenceSolution struct {
+	// ID is the unique identifier of the reference solution.
+	ID int64 `json:"id" db:"id"`
+
+	// ProblemID identifies the problem this solution validates.
+	ProblemID int `json:"problem_id" db:"problem_id"`
+
+	// Name is a short human-readable label, e.g. "main" or "slow-bruteforce".
+	Name string `json:"name" db:"name"`
+
+	// Code is the source code of the solution.
+	Code string `json:"code" db:"code"`
+
+	// Language is the identifier of the programming language used.
+	Language string `json:"language" db:"language"`
+
+	// ExpectedVerdict is the verdict the setter expects the solution to get.
+	ExpectedVerdict Verdict `json:"expected_verdict" db:"expected_verdict"`
+
+	// Verdict is the outcome of the most recent judging run.
+	Verdict Verdict `json:"verdict" db:"verdict"`
+
+	// CPUTime is the maximum CPU time over all test cases,
+	// expressed in milliseconds.
+	CPUTime int64 `json:"cpu_time" db:"cpu_time"`
+
+	// Memory is the peak memory usage over all test cases,
+	// expressed in bytes.
+	Memory int64 `json:"memory" db:"memory"`
+
+	// Message contains additional information about the verdict,
+	// such as compilation errors or system messages.
+	Message string `json:"message" db:"message"`
+
+	// TestsPassed is the number of test cases successfully passed.
+	TestsPassed int `json:"tests_passed" db:"tests_passed"`
+
+	// TestsTotal is the total number of test cases executed.
+	TestsTotal int `json:"tests_total" db:"tests_total"`
+
+	// TestcaseResults holds per-test-case results of the most recent run.
+	TestcaseResults []TestcaseResult `json:"testcase_results" db:"testcase_results"`
+
+	// Revision is incremented every time the solution is re-queued so that
+	// results from an outdated run are discarded.
+	Revision int `json:"revision" db:"revision"`
+
+	// CreatedAt is the timestamp when the solution was attached.
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+
+	// UpdatedAt is the timestamp when the solution was last judged.
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Judged reports whether the most recent run has finished.
+func (s ReferenceSolution) Judged() bool {
+	return s.Verdict != VerdictPending && s.Verdict != VerdictJudging
+}
+
+// Matches reports whether the solution was judged with its expected verdict.
+func (s ReferenceSolution) Matches() bool {
+	return s.Judged() && s.Verdict == s.ExpectedVerdict
+}
+
+// ReferenceSolutionJob is the message queue payload for judging a reference solution.
+type ReferenceSolutionJob struct {
+	ReferenceSolution ReferenceSolution `json:"reference_solution"`
+	Problem           Problem           `json:"problem"`
+}
+
+// ValidationStatus summarises the reference solution runs of a problem.
+type ValidationStatus string
+
+const (
+	// ValidationNone means no reference solutions are attached.
+	ValidationNone ValidationStatus = "none"
+	// ValidationPending means at least one solution has not been judged yet.
+	ValidationPending ValidationStatus = "pending"
+	// ValidationPassed means every solution got its expected verdict.
+	ValidationPassed ValidationStatus = "passed"
+	// ValidationFailed means a solution got an unexpected verdict or no
+	// solution is expected to be accepted.
+	ValidationFailed ValidationStatus = "failed"
+)
+
+// ValidationReport is the result of judging a problem's reference solutions
+// against its current testcases.
+type ValidationReport struct {
+	ProblemID int                 `json:"problem_id"`
+	Status    ValidationStatus    `json:"status"`
+	Solutions []ReferenceSolution `json:"solutions"`
+	Issues    []string            `json:"issues"`
+}
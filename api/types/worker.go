@@ -0,0 +1,107 @@
+package types
+
+import "time"
+
+// WorkerState is the state of a judge worker.
+type WorkerState string
+
+// Worker states. Workers report all but WorkerOffline themselves; the API
+// server marks a worker offline when its heartbeats stop.
+const (
+	WorkerRunning   WorkerState = "running"
+	WorkerPaused    WorkerState = "paused"
+	WorkerDraining  WorkerState = "draining"
+	WorkerUnhealthy WorkerState = "unhealthy"
+	WorkerStopped   WorkerState = "stopped"
+	WorkerOffline   WorkerState = "offline"
+)
+
+// WorkerJobKind identifies what a worker job judges.
+type WorkerJobKind string
+
+// Kinds of worker jobs.
+const (
+	WorkerJobSubmission        WorkerJobKind = "submission"
+	WorkerJobContestSubmission WorkerJobKind = "contest_submission"
+	WorkerJobReferenceSolution WorkerJobKind = "reference_solution"
+	WorkerJobRun               WorkerJobKind = "run"
+)
+
+// WorkerJob is a job a worker is currently processing.
+type WorkerJob struct {
+	// Kind is what the job judges; ID identifies it among jobs of its kind.
+	Kind WorkerJobKind `json:"kind"`
+	ID   int64         `json:"id"`
+
+	// ProblemID is the problem judged against, or zero for runs without
+	// a problem.
+	ProblemID int `json:"problem_id,omitempty"`
+
+	// Language is the language of the judged code.
+	Language string `json:"language"`
+
+	// StartedAt is when the worker took the job.
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Worker is a judge worker as described by its latest heartbeat.
+type Worker struct {
+	// ID is the worker's unique identifier (WORKER_ID).
+	ID string `json:"id" db:"id"`
+
+	// Host is the hostname of the machine the worker runs on.
+	Host string `json:"host" db:"host"`
+
+	// Version is the worker's build version.
+	Version string `json:"version" db:"version"`
+
+	// Queue is the job queue the worker consumes.
+	Queue string `json:"queue" db:"queue"`
+
+	// Languages lists the languages the worker can judge.
+	Languages []string `json:"languages" db:"languages"`
+
+	// Slots is the number of sandbox slots; FreeSlots of them were idle
+	// when the heartbeat was sent.
+	Slots     int `json:"slots" db:"slots"`
+	FreeSlots int `json:"free_slots" db:"free_slots"`
+
+	// SpeedFactor is the mean calibrated speed factor of the worker's
+	// slots, or zero when they are not calibrated.
+	SpeedFactor float64 `json:"speed_factor" db:"speed_factor"`
+
+	// State is the worker's state.
+	State WorkerState `json:"state" db:"state"`
+
+	// Jobs are the jobs in progress.
+	Jobs []WorkerJob `json:"jobs" db:"jobs"`
+
+	// StartedAt is when the worker process started.
+	StartedAt time.Time `json:"started_at" db:"started_at"`
+
+	// LastSeenAt is when the API server received the latest heartbeat.
+	LastSeenAt time.Time `json:"last_seen_at" db:"last_seen_at"`
+}
+
+// WorkerCommandType is an instruction an administrator sends a worker.
+type WorkerCommandType string
+
+// Worker commands.
+const (
+	// WorkerPause stops the worker from taking new jobs; jobs in progress
+	// finish.
+	WorkerPause WorkerCommandType = "pause"
+
+	// WorkerResume undoes WorkerPause.
+	WorkerResume WorkerCommandType = "resume"
+
+	// WorkerDrain stops the worker from taking new jobs and makes it exit
+	// once the jobs in progress are done, as on SIGTERM.
+	WorkerDrain WorkerCommandType = "drain"
+)
+
+// WorkerCommand is the message queue payload of a worker command.
+type WorkerCommand struct {
+	Command  WorkerCommandType `json:"command"`
+	IssuedAt time.Time         `json:"issued_at"`
+}
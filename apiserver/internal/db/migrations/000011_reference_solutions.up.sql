@@ -0,0 +1,22 @@
+-- Reference solutions judged against a problem's testcases to validate them.
+
+CREATE TABLE IF NOT EXISTS reference_solutions (
+    id               BIGSERIAL   PRIMARY KEY,
+    problem_id       INTEGER     NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+    name             TEXT        NOT NULL,
+    code             TEXT        NOT NULL,
+    language         TEXT        NOT NULL,
+    expected_verdict INTEGER     NOT NULL,
+    verdict          INTEGER     NOT NULL DEFAULT 0,
+    cpu_time         BIGINT      NOT NULL DEFAULT 0,
+    memory           BIGINT      NOT NULL DEFAULT 0,
+    message          TEXT        NOT NULL DEFAULT '',
+    tests_passed     INTEGER     NOT NULL DEFAULT 0,
+    tests_total      INTEGER     NOT NULL DEFAULT 0,
+    testcase_results JSONB       NOT NULL DEFAULT '[]'::jsonb,
+    revision         INTEGER     NOT NULL DEFAULT 0,
+    created_at       TIMESTAMPTZ NOT NULL,
+    updated_at       TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS reference_solutions_problem_id_idx ON reference_solutions(problem_id);
@@ -0,0 +1,24 @@
+-- Custom invocations: user code executed against user-provided input.
+
+CREATE TABLE IF NOT EXISTS runs (
+    id           BIGSERIAL   PRIMARY KEY,
+    user_id      INTEGER     NOT NULL REFERENCES users(id)    ON DELETE CASCADE,
+    problem_id   INTEGER              REFERENCES problems(id) ON DELETE SET NULL,
+    language     TEXT        NOT NULL,
+    code         TEXT        NOT NULL,
+    stdin        TEXT        NOT NULL DEFAULT '',
+    time_limit   BIGINT      NOT NULL,
+    memory_limit BIGINT      NOT NULL,
+    status       TEXT        NOT NULL DEFAULT 'PENDING',
+    stdout       TEXT        NOT NULL DEFAULT '',
+    stderr       TEXT        NOT NULL DEFAULT '',
+    exit_code    INTEGER     NOT NULL DEFAULT 0,
+    cpu_time     BIGINT      NOT NULL DEFAULT 0,
+    wall_time    BIGINT      NOT NULL DEFAULT 0,
+    memory       BIGINT      NOT NULL DEFAULT 0,
+    message      TEXT        NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS runs_user_id_idx ON runs(user_id);
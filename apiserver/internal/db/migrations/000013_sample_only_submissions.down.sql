@@ -0,0 +1,2 @@
+ALTER TABLE contest_submissions DROP COLUMN IF EXISTS sample_only;
+ALTER TABLE submissions         DROP COLUMN IF EXISTS sample_only;
@@ -0,0 +1,4 @@
+-- Sample-tests-only pre-submission checks are stored alongside regular
+-- submissions but never count as graded attempts.
+ALTER TABLE submissions         ADD COLUMN IF NOT EXISTS sample_only BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE contest_submissions ADD COLUMN IF NOT EXISTS sample_only BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- Output-only problems are graded from uploaded output files instead of
+-- executing submitted code.
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS type TEXT NOT NULL DEFAULT 'batch';
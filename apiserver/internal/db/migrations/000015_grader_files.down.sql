@@ -0,0 +1,3 @@
+ALTER TABLE contest_submissions DROP COLUMN IF EXISTS files;
+ALTER TABLE submissions         DROP COLUMN IF EXISTS files;
+DROP TABLE IF EXISTS problem_grader_files;
@@ -0,0 +1,15 @@
+-- Per-language grader files (e.g. grader.cpp and the header contestants
+-- implement) compiled together with submissions, and multi-file submissions.
+
+CREATE TABLE IF NOT EXISTS problem_grader_files (
+    id         BIGSERIAL   PRIMARY KEY,
+    problem_id INTEGER     NOT NULL REFERENCES problems(id) ON DELETE CASCADE,
+    language   TEXT        NOT NULL,
+    name       TEXT        NOT NULL,
+    object_key TEXT        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (problem_id, language, name)
+);
+
+ALTER TABLE submissions         ADD COLUMN IF NOT EXISTS files JSONB NOT NULL DEFAULT '[]'::jsonb;
+ALTER TABLE contest_submissions ADD COLUMN IF NOT EXISTS files JSONB NOT NULL DEFAULT '[]'::jsonb;
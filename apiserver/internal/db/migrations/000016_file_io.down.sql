@@ -0,0 +1,2 @@
+ALTER TABLE problems DROP COLUMN IF EXISTS output_file;
+ALTER TABLE problems DROP COLUMN IF EXISTS input_file;
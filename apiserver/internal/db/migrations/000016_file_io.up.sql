@@ -0,0 +1,4 @@
+-- File-based I/O: when set, the test input is written to input_file in the
+-- work directory and the output is read back from output_file.
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS input_file  TEXT NOT NULL DEFAULT '';
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS output_file TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Per-test output limit in bytes; 0 falls back to the judge's default.
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS output_limit BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE contest_submissions DROP COLUMN IF EXISTS judge;
+ALTER TABLE submissions DROP COLUMN IF EXISTS judge;
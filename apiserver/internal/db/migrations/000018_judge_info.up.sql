@@ -0,0 +1,3 @@
+-- Worker and sandbox speed that judged each submission.
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS judge JSONB;
+ALTER TABLE contest_submissions ADD COLUMN IF NOT EXISTS judge JSONB;
@@ -0,0 +1,3 @@
+ALTER TABLE problems DROP COLUMN IF EXISTS time_accounting;
+ALTER TABLE problems DROP COLUMN IF EXISTS cpus;
+ALTER TABLE problems DROP COLUMN IF EXISTS max_processes;
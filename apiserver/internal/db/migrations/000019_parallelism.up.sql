@@ -0,0 +1,4 @@
+-- Process, CPU and time accounting settings for multi-threaded problems.
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS max_processes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS cpus INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS time_accounting TEXT NOT NULL DEFAULT 'cpu';
@@ -0,0 +1,16 @@
+-- Judge workers as described by their latest heartbeat.
+
+CREATE TABLE IF NOT EXISTS workers (
+    id           TEXT             PRIMARY KEY,
+    host         TEXT             NOT NULL DEFAULT '',
+    version      TEXT             NOT NULL DEFAULT '',
+    queue        TEXT             NOT NULL DEFAULT '',
+    languages    JSONB            NOT NULL DEFAULT '[]'::jsonb,
+    slots        INTEGER          NOT NULL DEFAULT 0,
+    free_slots   INTEGER          NOT NULL DEFAULT 0,
+    speed_factor DOUBLE PRECISION NOT NULL DEFAULT 0,
+    state        TEXT             NOT NULL,
+    jobs         JSONB            NOT NULL DEFAULT '[]'::jsonb,
+    started_at   TIMESTAMPTZ      NOT NULL,
+    last_seen_at TIMESTAMPTZ      NOT NULL
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS cs_unfinished_idx;
+DROP INDEX IF EXISTS submissions_unfinished_idx;
+ALTER TABLE contest_submissions DROP COLUMN IF EXISTS judge_requeues;
+ALTER TABLE submissions DROP COLUMN IF EXISTS judge_requeues;
@@ -0,0 +1,7 @@
+-- Times the stuck-submission reaper re-enqueued each submission.
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS judge_requeues INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE contest_submissions ADD COLUMN IF NOT EXISTS judge_requeues INTEGER NOT NULL DEFAULT 0;
+
+-- The reaper scans unfinished (PENDING and JUDGING) submissions by age.
+CREATE INDEX IF NOT EXISTS submissions_unfinished_idx ON submissions(updated_at) WHERE verdict IN (0, 1);
+CREATE INDEX IF NOT EXISTS cs_unfinished_idx ON contest_submissions(updated_at) WHERE verdict IN (0, 1);
@@ -0,0 +1,14 @@
+-- Messages written in the same transaction as the records they concern and
+-- published to the message queue afterwards by the outbox relay.
+CREATE TABLE IF NOT EXISTS outbox (
+    id              BIGSERIAL PRIMARY KEY,
+    queue           TEXT        NOT NULL,
+    payload         BYTEA       NOT NULL,
+    attributes      JSONB       NOT NULL DEFAULT '{}',
+    attempts        INTEGER     NOT NULL DEFAULT 0,
+    last_error      TEXT        NOT NULL DEFAULT '',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS outbox_next_attempt_at_idx ON outbox(next_attempt_at);
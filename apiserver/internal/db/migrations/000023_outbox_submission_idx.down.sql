@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS outbox_contest_submission_id_idx;
+DROP INDEX IF EXISTS outbox_submission_id_idx;
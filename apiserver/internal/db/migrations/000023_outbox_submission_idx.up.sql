@@ -0,0 +1,3 @@
+-- The reaper skips PENDING submissions whose job is still in the outbox.
+CREATE INDEX IF NOT EXISTS outbox_submission_id_idx ON outbox ((attributes->>'submission_id'));
+CREATE INDEX IF NOT EXISTS outbox_contest_submission_id_idx ON outbox ((attributes->>'contest_submission_id'));
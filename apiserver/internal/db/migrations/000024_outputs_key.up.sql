@@ -0,0 +1,4 @@
+-- Object storage key of an output-only submission's output archive. Rows
+-- from before this column use the key derived from their ID.
+ALTER TABLE submissions ADD COLUMN IF NOT EXISTS outputs_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE contest_submissions ADD COLUMN IF NOT EXISTS outputs_key TEXT NOT NULL DEFAULT '';
@@ -7,26 +7,30 @@ import (
 	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jjudge-oj/api/types"
 	"github.com/jjudge-oj/apiserver/internal/services"
 	"github.com/jjudge-oj/apiserver/internal/store"
 )
 
 // ApprovalHandler handles admin approval workflows for problems and contests.
 type ApprovalHandler struct {
-	problemService *services.ProblemService
-	contestService *services.ContestService
-	userService    *services.UserService
+	problemService           *services.ProblemService
+	contestService           *services.ContestService
+	userService              *services.UserService
+	referenceSolutionService *services.ReferenceSolutionService
 }
 
 func NewApprovalHandler(
 	problemService *services.ProblemService,
 	contestService *services.ContestService,
 	userService *services.UserService,
+	referenceSolutionService *services.ReferenceSolutionService,
 ) *ApprovalHandler {
 	return &ApprovalHandler{
-		problemService: problemService,
-		contestService: contestService,
-		userService:    userService,
+		problemService:           problemService,
+		contestService:           contestService,
+		userService:              userService,
+		referenceSolutionService: referenceSolutionService,
 	}
 }
 
@@ -36,9 +40,10 @@ func ApprovalRouter(
 	problemService *services.ProblemService,
 	contestService *services.ContestService,
 	userService *services.UserService,
+	referenceSolutionService *services.ReferenceSolutionService,
 	authMiddleware func(http.Handler) http.Handler,
 ) {
-	h := NewApprovalHandler(problemService, contestService, userService)
+	h := NewApprovalHandler(problemService, contestService, userService, referenceSolutionService)
 
 	requireAdmin := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -66,6 +71,7 @@ func ApprovalRouter(
 
 	if authMiddleware != nil {
 		r.With(authMiddleware, requireAdmin).Get("/problems", h.ListPendingProblems)
+		r.With(authMiddleware, requireAdmin).Get("/problems/{problemID}/validation", h.GetProblemValidation)
 		r.With(authMiddleware, requireAdmin).Post("/problems/{problemID}/approve", h.ApproveProblem)
 		r.With(authMiddleware, requireAdmin).Post("/problems/{problemID}/reject", h.RejectProblem)
 		r.With(authMiddleware, requireAdmin).Get("/contests", h.ListPendingContests)
@@ -73,6 +79,7 @@ func ApprovalRouter(
 		r.With(authMiddleware, requireAdmin).Post("/contests/{contestID}/reject", h.RejectContest)
 	} else {
 		r.With(requireAdmin).Get("/problems", h.ListPendingProblems)
+		r.With(requireAdmin).Get("/problems/{problemID}/validation", h.GetProblemValidation)
 		r.With(requireAdmin).Post("/problems/{problemID}/approve", h.ApproveProblem)
 		r.With(requireAdmin).Post("/problems/{problemID}/reject", h.RejectProblem)
 		r.With(requireAdmin).Get("/contests", h.ListPendingContests)
@@ -107,6 +114,18 @@ func (h *ApprovalHandler) ApproveProblem(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Build the report first: once the approval is committed the request
+	// must not fail.
+	report, err := h.referenceSolutionService.Report(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "problem not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to build validation report")
+		return
+	}
+
 	if err := h.problemService.Approve(r.Context(), id); err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			writeError(w, http.StatusNotFound, "problem not found")
@@ -116,7 +135,39 @@ func (h *ApprovalHandler) ApproveProblem(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	writeJSON(w, http.StatusOK, map[string]string{"status": "approved"})
+	writeJSON(w, http.StatusOK, ProblemApprovalResponse{
+		Status:     "approved",
+		Validation: report,
+	})
+}
+
+// ProblemApprovalResponse is returned after approving a problem and includes
+// the reference solution validation report the decision was based on.
+type ProblemApprovalResponse struct {
+	Status     string                 `json:"status"`
+	Validation types.ValidationReport `json:"validation"`
+}
+
+// GetProblemValidation returns the reference solution validation report of a
+// problem awaiting approval.
+func (h *ApprovalHandler) GetProblemValidation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "problemID"))
+	if err != nil || id < 1 {
+		writeError(w, http.StatusBadRequest, "invalid problem id")
+		return
+	}
+
+	report, err := h.referenceSolutionService.Report(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "problem not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to build validation report")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
 }
 
 func (h *ApprovalHandler) RejectProblem(w http.ResponseWriter, r *http.Request) {
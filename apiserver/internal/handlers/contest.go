@@ -151,6 +151,11 @@ type ContestProblemReorderRequest struct {
 type ContestSubmissionCreateRequest struct {
 	Code     string `json:"code"`
 	Language string `json:"language"`
+	// Files replaces Code for multi-file submissions.
+	Files []types.SourceFile `json:"files,omitempty"`
+	// SampleOnly judges the code on the sample testcases only. Such checks
+	// are not counted as attempts on the leaderboard.
+	SampleOnly bool `json:"sample_only"`
 }
 
 // ContestSubmissionCreateResponse wraps the created contest submission.
@@ -633,32 +638,54 @@ func (h *ContestHandler) CreateContestSubmission(w http.ResponseWriter, r *http.
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxSubmissionBytes)
 	var req ContestSubmissionCreateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid request")
-		return
-	}
+	var outputs []byte
+	if problem.IsOutputOnly() {
+		outputs, req.SampleOnly, err = parseOutputsForm(w, r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else if isMultipartForm(r) {
+		form, err := parseSourceFilesForm(w, r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Language, req.Files, req.SampleOnly = form.Language, form.Files, form.SampleOnly
+	} else {
+		r.Body = http.MaxBytesReader(w, r.Body, maxSubmissionBytes)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request")
+			return
+		}
 
-	req.Code = strings.TrimSpace(req.Code)
-	req.Language = strings.TrimSpace(req.Language)
-	if req.Code == "" || req.Language == "" {
-		writeError(w, http.StatusBadRequest, "missing required fields")
-		return
+		req.Code = strings.TrimSpace(req.Code)
+		req.Language = strings.TrimSpace(req.Language)
+		if (req.Code == "" && len(req.Files) == 0) || req.Language == "" {
+			writeError(w, http.StatusBadRequest, "missing required fields")
+			return
+		}
 	}
 
 	cs := types.ContestSubmission{
-		ContestID: contestID,
-		ProblemID: problemID,
-		UserID:    userID,
-		Code:      req.Code,
-		Language:  req.Language,
-		Verdict:   types.VerdictPending,
+		ContestID:  contestID,
+		ProblemID:  problemID,
+		UserID:     userID,
+		Code:       req.Code,
+		Language:   req.Language,
+		Files:      req.Files,
+		Verdict:    types.VerdictPending,
+		SampleOnly: req.SampleOnly,
 	}
 
-	created, artifactKey, err := h.contestService.CreateAndEnqueueContestSubmission(r.Context(), cs, problem, contest)
+	created, artifactKey, err := h.contestService.CreateAndEnqueueContestSubmission(r.Context(), cs, problem, contest, outputs)
 	if err != nil {
 		switch {
+		case errors.Is(err, services.ErrNoSampleTestcases):
+			writeError(w, http.StatusBadRequest, "problem has no sample testcases")
+		case errors.Is(err, services.ErrInvalidOutputArchive), errors.Is(err, services.ErrInvalidSourceFiles):
+			writeError(w, http.StatusBadRequest, err.Error())
 		case errors.Is(err, services.ErrNotRegistered):
 			writeError(w, http.StatusForbidden, "you must register for the contest before submitting")
 		case errors.Is(err, services.ErrContestNotActive):
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jjudge-oj/apiserver/internal/services"
+	"github.com/jjudge-oj/apiserver/internal/store"
+)
+
+// ListGraderFiles returns the grader files of a problem for every language.
+func (h *ProblemHandler) ListGraderFiles(w http.ResponseWriter, r *http.Request) {
+	id, err := parseProblemID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	files, err := h.problemService.ListGraderFiles(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "problem not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to list grader files")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, files)
+}
+
+// SetGraderFiles replaces the grader files of a problem for one language
+// with the "files" uploads of a multipart form. They are placed next to
+// every submission in that language and compiled with it.
+func (h *ProblemHandler) SetGraderFiles(w http.ResponseWriter, r *http.Request) {
+	id, err := parseProblemID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 2*maxSubmissionBytes)
+	if err := r.ParseMultipartForm(2 * maxSubmissionBytes); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid multipart form")
+		return
+	}
+	uploads := r.MultipartForm.File[formFieldFiles]
+	if len(uploads) == 0 {
+		writeError(w, http.StatusBadRequest, "grader files are required")
+		return
+	}
+	sources, err := readSourceUploads(uploads)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	files := make(map[string][]byte, len(sources))
+	for _, f := range sources {
+		if _, dup := files[f.Name]; dup {
+			writeError(w, http.StatusBadRequest, "duplicate grader file "+f.Name)
+			return
+		}
+		files[f.Name] = []byte(f.Content)
+	}
+
+	h.replaceGraderFiles(w, r, id, files)
+}
+
+// DeleteGraderFiles removes the grader files of a problem for one language.
+func (h *ProblemHandler) DeleteGraderFiles(w http.ResponseWriter, r *http.Request) {
+	id, err := parseProblemID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.replaceGraderFiles(w, r, id, nil)
+}
+
+func (h *ProblemHandler) replaceGraderFiles(w http.ResponseWriter, r *http.Request, id int, files map[string][]byte) {
+	updated, err := h.problemService.SetGraderFiles(r.Context(), id, chi.URLParam(r, "language"), files)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(w, http.StatusNotFound, "problem not found")
+		case errors.Is(err, services.ErrInvalidSourceFiles):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to update grader files")
+		}
+		return
+	}
+
+	h.revalidateReferenceSolutions(r, id)
+
+	if files == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
@@ -2,9 +2,19 @@ package handlers
 
 import "net/http"
 
-// Healthz responds with a basic ok to indicate liveness.
-func Healthz(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte("ok"))
+// Healthz responds with a basic ok while the message queue connection,
+// checked by broker, is up, and with 503 and the reason while it is down.
+// Submissions are still accepted during a broker outage; their jobs wait in
+// the outbox.
+func Healthz(broker func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := broker(); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
 	"strconv"
@@ -26,19 +27,25 @@ const (
 	managerRole           = "manager"
 	formFieldMetadata     = "metadata"
 	formFieldTestcasesZip = "testcases_zip"
+	maxProblemProcesses   = 256
+	maxProblemCPUs        = 16
 )
 
 // ProblemHandler provides HTTP handlers for problems.
 type ProblemHandler struct {
-	problemService *services.ProblemService
-	userService    *services.UserService
+	problemService           *services.ProblemService
+	userService              *services.UserService
+	referenceSolutionService *services.ReferenceSolutionService
 }
 
 // NewProblemHandler constructs a handler with the provided store.
-func NewProblemHandler(problemService *services.ProblemService, userService *services.UserService) *ProblemHandler {
+// referenceSolutionService may be nil, in which case testcase changes do not
+// trigger re-validation.
+func NewProblemHandler(problemService *services.ProblemService, userService *services.UserService, referenceSolutionService *services.ReferenceSolutionService) *ProblemHandler {
 	return &ProblemHandler{
-		problemService: problemService,
-		userService:    userService,
+		problemService:           problemService,
+		userService:              userService,
+		referenceSolutionService: referenceSolutionService,
 	}
 }
 
@@ -47,10 +54,11 @@ func ProblemRouter(
 	r chi.Router,
 	problemService *services.ProblemService,
 	userService *services.UserService,
+	referenceSolutionService *services.ReferenceSolutionService,
 	authMiddleware func(http.Handler) http.Handler,
 	optionalAuthMiddleware func(http.Handler) http.Handler,
 ) {
-	handler := NewProblemHandler(problemService, userService)
+	handler := NewProblemHandler(problemService, userService, referenceSolutionService)
 
 	if optionalAuthMiddleware != nil {
 		r.With(optionalAuthMiddleware).Get("/", handler.ListProblems)
@@ -60,9 +68,11 @@ func ProblemRouter(
 	if authMiddleware != nil {
 		r.With(authMiddleware, handler.requireAdminOrManager).Post("/", handler.CreateProblem)
 		r.With(authMiddleware, handler.requireAdminOrManager).Post("/zip", handler.CreateProblemFromZip)
+		r.With(authMiddleware, handler.requireAdminOrManager).Post("/import", handler.ImportProblemPackage)
 	} else {
 		r.With(handler.requireAdminOrManager).Post("/", handler.CreateProblem)
 		r.With(handler.requireAdminOrManager).Post("/zip", handler.CreateProblemFromZip)
+		r.With(handler.requireAdminOrManager).Post("/import", handler.ImportProblemPackage)
 	}
 	r.Route("/{problemID}", func(r chi.Router) {
 		if optionalAuthMiddleware != nil {
@@ -73,10 +83,18 @@ func ProblemRouter(
 		if authMiddleware != nil {
 			r.With(authMiddleware, handler.requireAdminOrProblemCreator).Put("/", handler.UpdateProblem)
 			r.With(authMiddleware, handler.requireAdminOrProblemCreator).Put("/zip", handler.UpdateProblemFromZip)
+			r.With(authMiddleware, handler.requireAdminOrProblemCreator).Get("/export", handler.ExportProblemPackage)
+			r.With(authMiddleware, handler.requireAdminOrProblemCreator).Get("/grader-files", handler.ListGraderFiles)
+			r.With(authMiddleware, handler.requireAdminOrProblemCreator).Put("/grader-files/{language}", handler.SetGraderFiles)
+			r.With(authMiddleware, handler.requireAdminOrProblemCreator).Delete("/grader-files/{language}", handler.DeleteGraderFiles)
 			r.With(authMiddleware, handler.requireAdmin).Delete("/", handler.DeleteProblem)
 		} else {
 			r.With(handler.requireAdminOrProblemCreator).Put("/", handler.UpdateProblem)
 			r.With(handler.requireAdminOrProblemCreator).Put("/zip", handler.UpdateProblemFromZip)
+			r.With(handler.requireAdminOrProblemCreator).Get("/export", handler.ExportProblemPackage)
+			r.With(handler.requireAdminOrProblemCreator).Get("/grader-files", handler.ListGraderFiles)
+			r.With(handler.requireAdminOrProblemCreator).Put("/grader-files/{language}", handler.SetGraderFiles)
+			r.With(handler.requireAdminOrProblemCreator).Delete("/grader-files/{language}", handler.DeleteGraderFiles)
 			r.With(handler.requireAdmin).Delete("/", handler.DeleteProblem)
 		}
 	})
@@ -163,7 +181,14 @@ func (h *ProblemHandler) CreateProblem(w http.ResponseWriter, r *http.Request) {
 		Difficulty:     req.Metadata.Difficulty,
 		TimeLimit:      req.Metadata.TimeLimit,
 		MemoryLimit:    req.Metadata.MemoryLimit,
+		OutputLimit:    req.Metadata.OutputLimit,
+		MaxProcesses:   req.Metadata.MaxProcesses,
+		CPUs:           req.Metadata.CPUs,
+		TimeAccounting: req.Metadata.TimeAccounting,
 		Tags:           req.Metadata.Tags,
+		Type:           req.Metadata.Type,
+		InputFile:      req.Metadata.InputFile,
+		OutputFile:     req.Metadata.OutputFile,
 		Visibility:     req.Metadata.Visibility,
 		CreatorID:      userID,
 		ApprovalStatus: approvalStatus,
@@ -237,6 +262,11 @@ func (h *ProblemHandler) UpdateProblem(w http.ResponseWriter, r *http.Request) {
 		approvalStatus = req.Metadata.ApprovalStatus
 	}
 
+	problemType := req.Metadata.Type
+	if problemType == "" {
+		problemType = existing.Type
+	}
+
 	updated, err := h.problemService.Update(r.Context(), types.Problem{
 		ID:             id,
 		Title:          req.Metadata.Title,
@@ -244,7 +274,14 @@ func (h *ProblemHandler) UpdateProblem(w http.ResponseWriter, r *http.Request) {
 		Difficulty:     req.Metadata.Difficulty,
 		TimeLimit:      req.Metadata.TimeLimit,
 		MemoryLimit:    req.Metadata.MemoryLimit,
+		OutputLimit:    req.Metadata.OutputLimit,
+		MaxProcesses:   req.Metadata.MaxProcesses,
+		CPUs:           req.Metadata.CPUs,
+		TimeAccounting: req.Metadata.TimeAccounting,
 		Tags:           req.Metadata.Tags,
+		Type:           problemType,
+		InputFile:      req.Metadata.InputFile,
+		OutputFile:     req.Metadata.OutputFile,
 		Visibility:     req.Metadata.Visibility,
 		CreatorID:      existing.CreatorID,
 		ApprovalStatus: approvalStatus,
@@ -258,6 +295,14 @@ func (h *ProblemHandler) UpdateProblem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	limitsChanged := updated.TimeLimit != existing.TimeLimit || updated.MemoryLimit != existing.MemoryLimit ||
+		updated.OutputLimit != existing.OutputLimit || updated.MaxProcesses != existing.MaxProcesses ||
+		updated.CPUs != existing.CPUs || updated.TimeAccounting != existing.TimeAccounting
+	ioChanged := updated.InputFile != existing.InputFile || updated.OutputFile != existing.OutputFile
+	if len(req.TestcaseFiles) > 0 || limitsChanged || ioChanged {
+		h.revalidateReferenceSolutions(r, id)
+	}
+
 	writeJSON(w, http.StatusOK, updated)
 }
 
@@ -378,10 +423,55 @@ func parseMetadata(r *http.Request) (types.Problem, error) {
 	if metadata.Description == "" {
 		return types.Problem{}, errors.New("description is required")
 	}
+	switch metadata.Type {
+	case "", types.ProblemTypeBatch, types.ProblemTypeOutputOnly:
+	default:
+		return types.Problem{}, errors.New("invalid problem type")
+	}
+	if metadata.OutputLimit < 0 {
+		return types.Problem{}, errors.New("output_limit must not be negative")
+	}
+	if err := validateParallelism(metadata); err != nil {
+		return types.Problem{}, err
+	}
+	if err := validateFileIO(metadata); err != nil {
+		return types.Problem{}, err
+	}
 
 	return metadata, nil
 }
 
+// validateParallelism checks the process, CPU and time accounting settings
+// of a problem.
+func validateParallelism(p types.Problem) error {
+	if p.MaxProcesses < 0 || p.MaxProcesses > maxProblemProcesses {
+		return fmt.Errorf("max_processes must be between 0 and %d", maxProblemProcesses)
+	}
+	if p.CPUs < 0 || p.CPUs > maxProblemCPUs {
+		return fmt.Errorf("cpus must be between 0 and %d", maxProblemCPUs)
+	}
+	switch p.TimeAccounting {
+	case "", types.TimeAccountingCPU, types.TimeAccountingWall:
+	default:
+		return errors.New("invalid time_accounting")
+	}
+	return nil
+}
+
+// validateFileIO checks the file names of a problem using file-based I/O.
+func validateFileIO(p types.Problem) error {
+	if p.InputFile != "" && !services.ValidFileName(p.InputFile) {
+		return errors.New("invalid input_file")
+	}
+	if p.OutputFile != "" && !services.ValidFileName(p.OutputFile) {
+		return errors.New("invalid output_file")
+	}
+	if p.InputFile != "" && p.InputFile == p.OutputFile {
+		return errors.New("input_file and output_file must differ")
+	}
+	return nil
+}
+
 func parseTestcaseFiles(form *multipart.Form, groups []types.TestcaseGroup, requireTestcases bool) (map[string][]byte, error) {
 	if form == nil {
 		return nil, errors.New("missing form data")
@@ -522,7 +612,14 @@ func (h *ProblemHandler) CreateProblemFromZip(w http.ResponseWriter, r *http.Req
 		Difficulty:     req.Metadata.Difficulty,
 		TimeLimit:      req.Metadata.TimeLimit,
 		MemoryLimit:    req.Metadata.MemoryLimit,
+		OutputLimit:    req.Metadata.OutputLimit,
+		MaxProcesses:   req.Metadata.MaxProcesses,
+		CPUs:           req.Metadata.CPUs,
+		TimeAccounting: req.Metadata.TimeAccounting,
 		Tags:           req.Metadata.Tags,
+		Type:           req.Metadata.Type,
+		InputFile:      req.Metadata.InputFile,
+		OutputFile:     req.Metadata.OutputFile,
 		Visibility:     req.Metadata.Visibility,
 		CreatorID:      userID,
 		ApprovalStatus: approvalStatus,
@@ -588,6 +685,11 @@ func (h *ProblemHandler) UpdateProblemFromZip(w http.ResponseWriter, r *http.Req
 		approvalStatus = req.Metadata.ApprovalStatus
 	}
 
+	problemType := req.Metadata.Type
+	if problemType == "" {
+		problemType = existing.Type
+	}
+
 	updated, err := h.problemService.Update(r.Context(), types.Problem{
 		ID:             id,
 		Title:          req.Metadata.Title,
@@ -595,7 +697,14 @@ func (h *ProblemHandler) UpdateProblemFromZip(w http.ResponseWriter, r *http.Req
 		Difficulty:     req.Metadata.Difficulty,
 		TimeLimit:      req.Metadata.TimeLimit,
 		MemoryLimit:    req.Metadata.MemoryLimit,
+		OutputLimit:    req.Metadata.OutputLimit,
+		MaxProcesses:   req.Metadata.MaxProcesses,
+		CPUs:           req.Metadata.CPUs,
+		TimeAccounting: req.Metadata.TimeAccounting,
 		Tags:           req.Metadata.Tags,
+		Type:           problemType,
+		InputFile:      req.Metadata.InputFile,
+		OutputFile:     req.Metadata.OutputFile,
 		Visibility:     req.Metadata.Visibility,
 		CreatorID:      existing.CreatorID,
 		ApprovalStatus: approvalStatus,
@@ -609,9 +718,23 @@ func (h *ProblemHandler) UpdateProblemFromZip(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	h.revalidateReferenceSolutions(r, id)
+
 	writeJSON(w, http.StatusOK, updated)
 }
 
+// revalidateReferenceSolutions re-queues the problem's reference solutions
+// after its testcases or limits changed. Failures are logged rather than
+// returned since the update itself has already succeeded.
+func (h *ProblemHandler) revalidateReferenceSolutions(r *http.Request, problemID int) {
+	if h.referenceSolutionService == nil {
+		return
+	}
+	if err := h.referenceSolutionService.Revalidate(r.Context(), problemID); err != nil {
+		log.Printf("problem %d: failed to revalidate reference solutions: %v", problemID, err)
+	}
+}
+
 // isCallerAdmin returns true if the request context contains a valid user with admin role.
 func (h *ProblemHandler) isCallerAdmin(r *http.Request) bool {
 	userID, err := userIDFromContext(r.Context())
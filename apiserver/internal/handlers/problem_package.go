@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/problempkg"
+	"github.com/jjudge-oj/apiserver/internal/services"
+	"github.com/jjudge-oj/apiserver/internal/store"
+)
+
+const (
+	formFieldPackage = "package"
+	formFieldFormat  = "format"
+)
+
+// ProblemImportResponse is returned after importing a problem package.
+type ProblemImportResponse struct {
+	Problem  types.Problem     `json:"problem"`
+	Format   problempkg.Format `json:"format"`
+	Warnings []string          `json:"warnings"`
+}
+
+// ImportProblemPackage creates a problem from a Polygon, Kattis, CMS or jjudge
+// package. The multipart form carries the archive in "package", an optional
+// "format" (detected when omitted) and optional "metadata" JSON whose non-empty
+// fields override the values read from the package.
+func (h *ProblemHandler) ImportProblemPackage(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid multipart form")
+		return
+	}
+
+	format, err := problempkg.ParseFormat(r.FormValue(formFieldFormat))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var overrides types.Problem
+	if raw := strings.TrimSpace(r.FormValue(formFieldMetadata)); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid metadata")
+			return
+		}
+	}
+
+	files := r.MultipartForm.File[formFieldPackage]
+	if len(files) != 1 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("exactly one %s file is required", formFieldPackage))
+		return
+	}
+	f, err := files[0].Open()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read package file")
+		return
+	}
+	data, err := readFileLimited(f, maxBundleBytes)
+	_ = f.Close()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	pkg, err := problempkg.Parse(data, format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	problem := applyProblemOverrides(pkg.Problem, overrides)
+	if err := validateParallelism(problem); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateFileIO(problem); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if strings.TrimSpace(problem.Description) == "" {
+		writeError(w, http.StatusBadRequest, "package has no text statement; provide a description in metadata")
+		return
+	}
+
+	problem.CreatorID, _ = userIDFromContext(r.Context())
+	problem.ApprovalStatus = "approved"
+	if !h.isCallerAdmin(r) {
+		problem.ApprovalStatus = "pending"
+	}
+
+	created, err := h.problemService.ImportPackage(r.Context(), pkg, problem)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSourceFiles) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to import problem")
+		return
+	}
+
+	warnings := pkg.Warnings
+	if warnings == nil {
+		warnings = []string{}
+	}
+	writeJSON(w, http.StatusCreated, ProblemImportResponse{
+		Problem:  created,
+		Format:   pkg.Format,
+		Warnings: warnings,
+	})
+}
+
+// ExportProblemPackage downloads a problem as a native jjudge package.
+func (h *ProblemHandler) ExportProblemPackage(w http.ResponseWriter, r *http.Request) {
+	id, err := parseProblemID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := h.problemService.ExportPackage(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "problem not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to export problem")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"problem-%d.zip\"", id))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// applyProblemOverrides returns base with every non-empty field of overrides applied.
+func applyProblemOverrides(base, overrides types.Problem) types.Problem {
+	if v := strings.TrimSpace(overrides.Title); v != "" {
+		base.Title = v
+	}
+	if v := strings.TrimSpace(overrides.Description); v != "" {
+		base.Description = v
+	}
+	if overrides.Difficulty != 0 {
+		base.Difficulty = overrides.Difficulty
+	}
+	if overrides.TimeLimit > 0 {
+		base.TimeLimit = overrides.TimeLimit
+	}
+	if overrides.MemoryLimit > 0 {
+		base.MemoryLimit = overrides.MemoryLimit
+	}
+	if overrides.OutputLimit > 0 {
+		base.OutputLimit = overrides.OutputLimit
+	}
+	if overrides.MaxProcesses > 0 {
+		base.MaxProcesses = overrides.MaxProcesses
+	}
+	if overrides.CPUs > 0 {
+		base.CPUs = overrides.CPUs
+	}
+	if overrides.TimeAccounting != "" {
+		base.TimeAccounting = overrides.TimeAccounting
+	}
+	if len(overrides.Tags) > 0 {
+		base.Tags = overrides.Tags
+	}
+	if overrides.Type == types.ProblemTypeBatch || overrides.Type == types.ProblemTypeOutputOnly {
+		base.Type = overrides.Type
+	}
+	if overrides.InputFile != "" {
+		base.InputFile = overrides.InputFile
+	}
+	if overrides.OutputFile != "" {
+		base.OutputFile = overrides.OutputFile
+	}
+	if overrides.Visibility != "" {
+		base.Visibility = overrides.Visibility
+	}
+	return base
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// userRateLimiter is an in-memory sliding-window limiter keyed by user ID.
+// Limits are enforced per apiserver instance.
+type userRateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[int][]time.Time
+}
+
+func newUserRateLimiter(limit int, window time.Duration) *userRateLimiter {
+	return &userRateLimiter{
+		limit:  limit,
+		window: window,
+		hits:   make(map[int][]time.Time),
+	}
+}
+
+// allow records a request by userID at now and reports whether it is within
+// the limit. When it is not, the returned duration is how long until the
+// oldest request in the window expires.
+func (l *userRateLimiter) allow(userID int, now time.Time) (bool, time.Duration) {
+	if l.limit <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-l.window)
+	hits := l.hits[userID]
+	kept := hits[:0]
+	for _, t := range hits {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+
+	if len(kept) >= l.limit {
+		l.hits[userID] = kept
+		return false, kept[0].Sub(cutoff)
+	}
+
+	l.hits[userID] = append(kept, now)
+	// Drop idle users so the map does not grow without bound.
+	if len(l.hits) > 10000 {
+		for id, ts := range l.hits {
+			if len(ts) == 0 || !ts[len(ts)-1].After(cutoff) {
+				delete(l.hits, id)
+			}
+		}
+	}
+	return true, 0
+}
+
+// middleware rejects requests from users over the limit with 429. It must run
+// after the auth middleware.
+func (l *userRateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := userIDFromContext(r.Context())
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		ok, retryAfter := l.allow(userID, time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())+1))
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/services"
+	"github.com/jjudge-oj/apiserver/internal/store"
+)
+
+// ReferenceSolutionHandler provides HTTP handlers for a problem's reference
+// solutions and its validation report.
+type ReferenceSolutionHandler struct {
+	referenceSolutionService *services.ReferenceSolutionService
+}
+
+// NewReferenceSolutionHandler constructs a handler with the provided service.
+func NewReferenceSolutionHandler(referenceSolutionService *services.ReferenceSolutionService) *ReferenceSolutionHandler {
+	return &ReferenceSolutionHandler{referenceSolutionService: referenceSolutionService}
+}
+
+// ReferenceSolutionRouter registers reference solution routes. Routes are
+// restricted to admins and the problem's creator.
+func ReferenceSolutionRouter(
+	r chi.Router,
+	referenceSolutionService *services.ReferenceSolutionService,
+	problemService *services.ProblemService,
+	userService *services.UserService,
+	authMiddleware func(http.Handler) http.Handler,
+) {
+	handler := NewReferenceSolutionHandler(referenceSolutionService)
+	requireAccess := NewProblemHandler(problemService, userService, nil).requireAdminOrProblemCreator
+
+	if authMiddleware != nil {
+		r.With(authMiddleware, requireAccess).Get("/", handler.GetValidationReport)
+		r.With(authMiddleware, requireAccess).Post("/", handler.CreateReferenceSolution)
+		r.With(authMiddleware, requireAccess).Post("/revalidate", handler.Revalidate)
+		r.With(authMiddleware, requireAccess).Delete("/{solutionID}", handler.DeleteReferenceSolution)
+	} else {
+		r.With(requireAccess).Get("/", handler.GetValidationReport)
+		r.With(requireAccess).Post("/", handler.CreateReferenceSolution)
+		r.With(requireAccess).Post("/revalidate", handler.Revalidate)
+		r.With(requireAccess).Delete("/{solutionID}", handler.DeleteReferenceSolution)
+	}
+}
+
+// ReferenceSolutionCreateRequest represents the payload for attaching a reference solution.
+type ReferenceSolutionCreateRequest struct {
+	Name            string        `json:"name"`
+	Code            string        `json:"code"`
+	Language        string        `json:"language"`
+	ExpectedVerdict types.Verdict `json:"expected_verdict"`
+}
+
+// GetValidationReport returns the reference solutions of a problem together
+// with the outcome of their latest runs.
+func (h *ReferenceSolutionHandler) GetValidationReport(w http.ResponseWriter, r *http.Request) {
+	problemID, err := parseProblemID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.referenceSolutionService.Report(r.Context(), problemID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "problem not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to build validation report")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// CreateReferenceSolution attaches a solution with its expected verdict and
+// queues it for judging.
+func (h *ReferenceSolutionHandler) CreateReferenceSolution(w http.ResponseWriter, r *http.Request) {
+	problemID, err := parseProblemID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSubmissionBytes)
+	var req ReferenceSolutionCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Code = strings.TrimSpace(req.Code)
+	req.Language = strings.TrimSpace(req.Language)
+	if req.Name == "" || req.Code == "" || req.Language == "" {
+		writeError(w, http.StatusBadRequest, "missing required fields")
+		return
+	}
+	if !services.IsExpectableVerdict(req.ExpectedVerdict) {
+		writeError(w, http.StatusBadRequest, "expected_verdict must be one of AC, WA, TLE")
+		return
+	}
+
+	created, err := h.referenceSolutionService.CreateAndEnqueue(r.Context(), types.ReferenceSolution{
+		ProblemID:       problemID,
+		Name:            req.Name,
+		Code:            req.Code,
+		Language:        req.Language,
+		ExpectedVerdict: req.ExpectedVerdict,
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "problem not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to add reference solution")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// Revalidate re-judges every reference solution against the current testcases.
+func (h *ReferenceSolutionHandler) Revalidate(w http.ResponseWriter, r *http.Request) {
+	problemID, err := parseProblemID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.referenceSolutionService.Revalidate(r.Context(), problemID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "problem not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to revalidate problem")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "queued"})
+}
+
+func (h *ReferenceSolutionHandler) DeleteReferenceSolution(w http.ResponseWriter, r *http.Request) {
+	problemID, err := parseProblemID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	id, err := strconv.ParseInt(chi.URLParam(r, "solutionID"), 10, 64)
+	if err != nil || id < 1 {
+		writeError(w, http.StatusBadRequest, "invalid reference solution id")
+		return
+	}
+
+	rs, err := h.referenceSolutionService.Get(r.Context(), id)
+	if err != nil || rs.ProblemID != problemID {
+		if err == nil || errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "reference solution not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch reference solution")
+		return
+	}
+
+	if err := h.referenceSolutionService.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "reference solution not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to delete reference solution")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
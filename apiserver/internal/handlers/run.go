@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/services"
+	"github.com/jjudge-oj/apiserver/internal/store"
+)
+
+// maxRunStdinBytes bounds the custom input of a run.
+const maxRunStdinBytes = 1 << 20
+
+// RunHandler provides HTTP handlers for custom invocations.
+type RunHandler struct {
+	runService     *services.RunService
+	problemService *services.ProblemService
+	userService    *services.UserService
+}
+
+// NewRunHandler constructs a handler with the provided services.
+func NewRunHandler(runService *services.RunService, problemService *services.ProblemService, userService *services.UserService) *RunHandler {
+	return &RunHandler{
+		runService:     runService,
+		problemService: problemService,
+		userService:    userService,
+	}
+}
+
+// RunRouter registers custom invocation routes. Creating runs is limited to
+// rateLimit requests per user per rateWindow; a non-positive rateLimit
+// disables the limit.
+func RunRouter(
+	r chi.Router,
+	runService *services.RunService,
+	problemService *services.ProblemService,
+	userService *services.UserService,
+	rateLimit int,
+	rateWindow time.Duration,
+	authMiddleware func(http.Handler) http.Handler,
+) {
+	handler := NewRunHandler(runService, problemService, userService)
+	limiter := newUserRateLimiter(rateLimit, rateWindow)
+
+	if authMiddleware != nil {
+		r.With(authMiddleware, limiter.middleware).Post("/", handler.CreateRun)
+		r.With(authMiddleware).Get("/{runID}", handler.GetRun)
+	} else {
+		r.With(limiter.middleware).Post("/", handler.CreateRun)
+		r.Get("/{runID}", handler.GetRun)
+	}
+}
+
+// RunCreateRequest represents the payload for a custom invocation.
+type RunCreateRequest struct {
+	Code      string `json:"code"`
+	Language  string `json:"language"`
+	Stdin     string `json:"stdin"`
+	ProblemID int    `json:"problem_id"`
+}
+
+// CreateRun queues the code for a single execution on the given input. The
+// run is judged asynchronously; poll GET /run/{runID} for the result.
+func (h *RunHandler) CreateRun(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSubmissionBytes+maxRunStdinBytes)
+	var req RunCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+
+	req.Code = strings.TrimSpace(req.Code)
+	req.Language = strings.TrimSpace(req.Language)
+	if req.Code == "" || req.Language == "" {
+		writeError(w, http.StatusBadRequest, "missing required fields")
+		return
+	}
+	if len(req.Code) > maxSubmissionBytes {
+		writeError(w, http.StatusBadRequest, "source code too large")
+		return
+	}
+	if len(req.Stdin) > maxRunStdinBytes {
+		writeError(w, http.StatusBadRequest, "stdin too large")
+		return
+	}
+
+	var problem types.Problem
+	if req.ProblemID > 0 {
+		problem, err = h.problemService.Get(r.Context(), req.ProblemID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				writeError(w, http.StatusNotFound, "problem not found")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "failed to fetch problem")
+			return
+		}
+		if !h.canSeeProblem(r, userID, problem) {
+			writeError(w, http.StatusNotFound, "problem not found")
+			return
+		}
+	}
+
+	created, err := h.runService.CreateAndEnqueue(r.Context(), types.Run{
+		UserID:   userID,
+		Language: req.Language,
+		Code:     req.Code,
+		Stdin:    req.Stdin,
+	}, problem)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to queue run")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, created)
+}
+
+// GetRun returns a run with its output once finished. Runs are only visible
+// to the user who requested them.
+func (h *RunHandler) GetRun(w http.ResponseWriter, r *http.Request) {
+	userID, err := userIDFromContext(r.Context())
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "runID"), 10, 64)
+	if err != nil || id < 1 {
+		writeError(w, http.StatusBadRequest, "invalid run id")
+		return
+	}
+
+	run, err := h.runService.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "run not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch run")
+		return
+	}
+	if run.UserID != userID {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, run)
+}
+
+// canSeeProblem applies the same visibility rules as GetProblem.
+func (h *RunHandler) canSeeProblem(r *http.Request, userID int, problem types.Problem) bool {
+	if problem.CreatorID == userID {
+		return true
+	}
+	if u, err := h.userService.GetByID(r.Context(), userID); err == nil && strings.EqualFold(u.Role, adminRole) {
+		return true
+	}
+	return problem.Visibility != "private" && problem.ApprovalStatus == "approved"
+}
@@ -52,6 +52,11 @@ func SubmissionRouter(
 type SubmissionCreateRequest struct {
 	Code     string `json:"code"`
 	Language string `json:"language"`
+	// Files replaces Code for multi-file submissions.
+	Files []types.SourceFile `json:"files,omitempty"`
+	// SampleOnly judges the code on the sample testcases only, as a check
+	// before submitting for real.
+	SampleOnly bool `json:"sample_only"`
 }
 
 // SubmissionCreateResponse is the create submission response payload.
@@ -61,6 +66,8 @@ type SubmissionCreateResponse struct {
 }
 
 // CreateSubmission accepts source code for a problem and enqueues a judge job.
+// Multi-file submissions come as a "files" list in JSON or as a multipart
+// form; output-only problems take a multipart form with an outputs archive.
 func (h *SubmissionHandler) CreateSubmission(w http.ResponseWriter, r *http.Request) {
 	userID, err := userIDFromContext(r.Context())
 	if err != nil {
@@ -102,30 +109,56 @@ func (h *SubmissionHandler) CreateSubmission(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxSubmissionBytes)
 	var req SubmissionCreateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid request")
-		return
-	}
+	var outputs []byte
+	if problem.IsOutputOnly() {
+		outputs, req.SampleOnly, err = parseOutputsForm(w, r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	} else if isMultipartForm(r) {
+		form, err := parseSourceFilesForm(w, r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		req.Language, req.Files, req.SampleOnly = form.Language, form.Files, form.SampleOnly
+	} else {
+		r.Body = http.MaxBytesReader(w, r.Body, maxSubmissionBytes)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request")
+			return
+		}
 
-	req.Code = strings.TrimSpace(req.Code)
-	req.Language = strings.TrimSpace(req.Language)
-	if req.Code == "" || req.Language == "" {
-		writeError(w, http.StatusBadRequest, "missing required fields")
-		return
+		req.Code = strings.TrimSpace(req.Code)
+		req.Language = strings.TrimSpace(req.Language)
+		if (req.Code == "" && len(req.Files) == 0) || req.Language == "" {
+			writeError(w, http.StatusBadRequest, "missing required fields")
+			return
+		}
 	}
 
 	submission := types.Submission{
-		ProblemID: problemID,
-		UserID:    userID,
-		Code:      req.Code,
-		Language:  req.Language,
-		Verdict:   types.VerdictPending,
+		ProblemID:  problemID,
+		UserID:     userID,
+		Code:       req.Code,
+		Language:   req.Language,
+		Files:      req.Files,
+		Verdict:    types.VerdictPending,
+		SampleOnly: req.SampleOnly,
 	}
 
-	created, artifactKey, err := h.submissionService.CreateAndEnqueue(r.Context(), submission, problem)
+	created, artifactKey, err := h.submissionService.CreateAndEnqueue(r.Context(), submission, problem, outputs)
 	if err != nil {
+		if errors.Is(err, services.ErrNoSampleTestcases) {
+			writeError(w, http.StatusBadRequest, "problem has no sample testcases")
+			return
+		}
+		if errors.Is(err, services.ErrInvalidOutputArchive) || errors.Is(err, services.ErrInvalidSourceFiles) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to submit")
 		return
 	}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jjudge-oj/api/types"
+)
+
+const (
+	formFieldOutputs      = "outputs"
+	formFieldSampleOnly   = "sample_only"
+	formFieldLanguage     = "language"
+	formFieldFiles        = "files"
+	formFieldArchive      = "archive"
+	maxOutputArchiveBytes = 64 << 20
+)
+
+// isMultipartForm reports whether the request body is multipart/form-data.
+func isMultipartForm(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// parseSampleOnlyField reads the optional "sample_only" form flag.
+func parseSampleOnlyField(r *http.Request) (bool, error) {
+	raw := strings.TrimSpace(r.FormValue(formFieldSampleOnly))
+	if raw == "" {
+		return false, nil
+	}
+	sampleOnly, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s", formFieldSampleOnly)
+	}
+	return sampleOnly, nil
+}
+
+// parseOutputsForm reads a submission to an output-only problem: a multipart
+// form with the ZIP of output files in "outputs" and an optional
+// "sample_only" flag.
+func parseOutputsForm(w http.ResponseWriter, r *http.Request) ([]byte, bool, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxOutputArchiveBytes+maxSubmissionBytes)
+	if err := r.ParseMultipartForm(maxOutputArchiveBytes); err != nil {
+		return nil, false, errors.New("output-only problems take a multipart form with an outputs archive")
+	}
+
+	sampleOnly, err := parseSampleOnlyField(r)
+	if err != nil {
+		return nil, false, err
+	}
+
+	files := r.MultipartForm.File[formFieldOutputs]
+	if len(files) != 1 {
+		return nil, false, fmt.Errorf("exactly one %s file is required", formFieldOutputs)
+	}
+	f, err := files[0].Open()
+	if err != nil {
+		return nil, false, errors.New("failed to read outputs file")
+	}
+	defer f.Close()
+
+	data, err := readFileLimited(f, maxOutputArchiveBytes)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, sampleOnly, nil
+}
+
+// sourceFilesForm is a multi-file submission read from a multipart form.
+type sourceFilesForm struct {
+	Language   string
+	Files      []types.SourceFile
+	SampleOnly bool
+}
+
+// parseSourceFilesForm reads a multi-file submission from a multipart form
+// with a "language", an optional "sample_only" flag and the sources either
+// as one or more "files" uploads or as a ZIP in "archive".
+func parseSourceFilesForm(w http.ResponseWriter, r *http.Request) (sourceFilesForm, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, 2*maxSubmissionBytes)
+	if err := r.ParseMultipartForm(2 * maxSubmissionBytes); err != nil {
+		return sourceFilesForm{}, errors.New("invalid multipart form")
+	}
+
+	var form sourceFilesForm
+	var err error
+	form.Language = strings.TrimSpace(r.FormValue(formFieldLanguage))
+	if form.Language == "" {
+		return sourceFilesForm{}, errors.New("missing required fields")
+	}
+	if form.SampleOnly, err = parseSampleOnlyField(r); err != nil {
+		return sourceFilesForm{}, err
+	}
+
+	uploads := r.MultipartForm.File[formFieldFiles]
+	archives := r.MultipartForm.File[formFieldArchive]
+	switch {
+	case len(archives) == 1 && len(uploads) == 0:
+		form.Files, err = readSourceArchive(archives[0])
+	case len(archives) == 0 && len(uploads) > 0:
+		form.Files, err = readSourceUploads(uploads)
+	default:
+		err = fmt.Errorf("provide either %s uploads or one %s zip", formFieldFiles, formFieldArchive)
+	}
+	if err != nil {
+		return sourceFilesForm{}, err
+	}
+	return form, nil
+}
+
+func readSourceUploads(uploads []*multipart.FileHeader) ([]types.SourceFile, error) {
+	files := make([]types.SourceFile, 0, len(uploads))
+	var total int64
+	for _, fh := range uploads {
+		f, err := fh.Open()
+		if err != nil {
+			return nil, errors.New("failed to read uploaded file")
+		}
+		data, err := readFileLimited(f, maxSubmissionBytes)
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+		total += int64(len(data))
+		if total > maxSubmissionBytes {
+			return nil, errors.New("submission too large")
+		}
+		files = append(files, types.SourceFile{Name: path.Base(fh.Filename), Content: string(data)})
+	}
+	return files, nil
+}
+
+func readSourceArchive(fh *multipart.FileHeader) ([]types.SourceFile, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, errors.New("failed to read archive")
+	}
+	data, err := readFileLimited(f, maxSubmissionBytes)
+	_ = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.New("invalid zip archive")
+	}
+
+	var files []types.SourceFile
+	var total int64
+	for _, entry := range zr.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zip entry %s", entry.Name)
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, maxSubmissionBytes-total+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zip entry %s", entry.Name)
+		}
+		total += int64(len(content))
+		if total > maxSubmissionBytes {
+			return nil, errors.New("submission too large")
+		}
+		files = append(files, types.SourceFile{Name: path.Base(entry.Name), Content: string(content)})
+	}
+	if len(files) == 0 {
+		return nil, errors.New("archive contains no files")
+	}
+	return files, nil
+}
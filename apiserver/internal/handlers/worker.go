@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/services"
+	"github.com/jjudge-oj/apiserver/internal/store"
+)
+
+// WorkerHandler handles the admin view of the judge worker fleet.
+type WorkerHandler struct {
+	workerService *services.WorkerService
+}
+
+func NewWorkerHandler(workerService *services.WorkerService) *WorkerHandler {
+	return &WorkerHandler{workerService: workerService}
+}
+
+// WorkerRouter registers judge fleet routes. All routes are admin-only.
+func WorkerRouter(
+	r chi.Router,
+	workerService *services.WorkerService,
+	userService *services.UserService,
+	authMiddleware func(http.Handler) http.Handler,
+) {
+	h := NewWorkerHandler(workerService)
+
+	requireAdmin := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, err := userIDFromContext(r.Context())
+			if err != nil {
+				writeError(w, http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			user, err := userService.GetByID(r.Context(), userID)
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					writeError(w, http.StatusUnauthorized, "unauthorized")
+					return
+				}
+				writeError(w, http.StatusInternalServerError, "failed to load user")
+				return
+			}
+			if !strings.EqualFold(user.Role, adminRole) {
+				writeError(w, http.StatusForbidden, "admin access required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	r.Group(func(r chi.Router) {
+		if authMiddleware != nil {
+			r.Use(authMiddleware)
+		}
+		r.Use(requireAdmin)
+		r.Get("/", h.ListWorkers)
+		r.Get("/{workerID}", h.GetWorker)
+		r.Delete("/{workerID}", h.DeleteWorker)
+		r.Get("/{workerID}/jobs", h.ListWorkerJobs)
+		r.Post("/{workerID}/pause", h.command(types.WorkerPause))
+		r.Post("/{workerID}/resume", h.command(types.WorkerResume))
+		r.Post("/{workerID}/drain", h.command(types.WorkerDrain))
+	})
+}
+
+func (h *WorkerHandler) ListWorkers(w http.ResponseWriter, r *http.Request) {
+	workers, err := h.workerService.List(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to list workers")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": workers,
+		"total": len(workers),
+	})
+}
+
+func (h *WorkerHandler) GetWorker(w http.ResponseWriter, r *http.Request) {
+	worker, err := h.workerService.Get(r.Context(), chi.URLParam(r, "workerID"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "worker not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get worker")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, worker)
+}
+
+// ListWorkerJobs returns the submissions, reference solutions and runs a
+// worker is judging, as of its latest heartbeat.
+func (h *WorkerHandler) ListWorkerJobs(w http.ResponseWriter, r *http.Request) {
+	worker, err := h.workerService.Get(r.Context(), chi.URLParam(r, "workerID"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "worker not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get worker")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": worker.Jobs,
+		"total": len(worker.Jobs),
+	})
+}
+
+// DeleteWorker removes a worker from the registry, e.g. one that is gone
+// for good. A running worker reappears with its next heartbeat.
+func (h *WorkerHandler) DeleteWorker(w http.ResponseWriter, r *http.Request) {
+	if err := h.workerService.Delete(r.Context(), chi.URLParam(r, "workerID")); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "worker not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to delete worker")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// command returns a handler that sends cmd to the worker in the URL. The
+// worker applies it asynchronously; its next heartbeats show the result.
+func (h *WorkerHandler) command(cmd types.WorkerCommandType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.workerService.Command(r.Context(), chi.URLParam(r, "workerID"), cmd); err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				writeError(w, http.StatusNotFound, "worker not found")
+			case errors.Is(err, services.ErrWorkerOffline):
+				writeError(w, http.StatusConflict, "worker is offline")
+			default:
+				writeError(w, http.StatusInternalServerError, "failed to send command")
+			}
+			return
+		}
+
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": string(cmd) + " requested"})
+	}
+}
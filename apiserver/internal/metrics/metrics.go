@@ -0,0 +1,110 @@
+// Package metrics defines the API server's Prometheus metrics. They are
+// registered with the default registry and served on /metrics.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "jjudge_apiserver"
+
+var (
+	// HTTPRequests counts handled requests by route pattern and status.
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration is the latency of handled requests by route pattern.
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// DBQueryDuration is the latency of repository methods.
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database latency by repository method.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"repository", "method"})
+
+	// MQPublished counts published messages by queue and outcome.
+	MQPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mq_published_total",
+		Help:      "Messages published by queue and result (ok, error).",
+	}, []string{"queue", "result"})
+
+	// MQConsumed counts consumed messages by queue and outcome.
+	MQConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mq_consumed_total",
+		Help:      "Messages consumed by queue and result (ack, nack).",
+	}, []string{"queue", "result"})
+
+	// MQConsumeLag is the time from publishing a message to consuming it.
+	MQConsumeLag = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mq_consume_lag_seconds",
+		Help:      "Time from publishing a message to the consumer receiving it.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"queue"})
+
+	// ReapedSubmissions counts stuck submissions the reaper handled.
+	ReapedSubmissions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reaped_submissions_total",
+		Help:      "Stuck submissions by kind (submission, contest_submission) and action (requeued, failed).",
+	}, []string{"kind", "action"})
+)
+
+// Middleware records HTTP request counts and latency. Requests are labelled
+// with the matched chi route pattern rather than the path, so IDs in URLs do
+// not create new series; unmatched requests use the label "unmatched".
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := RoutePattern(r)
+		HTTPRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		HTTPDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// RoutePattern returns the chi route pattern matched by r, or "unmatched".
+func RoutePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return "unmatched"
+}
+
+// ObserveQuery starts timing a repository method and returns the function
+// that records it:
+//
+//	defer metrics.ObserveQuery("submissions", "Get")()
+func ObserveQuery(repository, method string) func() {
+	start := time.Now()
+	return func() {
+		DBQueryDuration.WithLabelValues(repository, method).Observe(time.Since(start).Seconds())
+	}
+}
@@ -1,12 +1,31 @@
 package mq
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jjudge-oj/apiserver/config"
+	"github.com/jjudge-oj/apiserver/internal/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/jjudge-oj/apiserver/internal/mq")
 
 // Message represents a broker-agnostic payload delivered to subscribers.
 type Message struct {
 	ID         string
 	Data       []byte
 	Attributes map[string]string
+
+	// PublishedAt is when the message was published, if the publisher
+	// recorded it.
+	PublishedAt time.Time
 }
 
 // Handler processes a message. Return an error to signal a retry/nack.
@@ -16,6 +35,13 @@ type Handler func(ctx context.Context, msg Message) error
 type Backend interface {
 	Publish(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error)
 	Subscribe(ctx context.Context, channel string, handler Handler) error
+	// PublishTransient sends a message to a channel its single subscriber
+	// declares for itself, such as a worker's command queue. The message
+	// is dropped while nobody subscribes, and nothing is created for it.
+	PublishTransient(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error)
+	// Health returns nil while the backend can reach its broker, and
+	// otherwise why not.
+	Health() error
 	Close() error
 }
 
@@ -29,14 +55,110 @@ func New(backend Backend) *MQ {
 	return &MQ{backend: backend}
 }
 
-// Publish sends a message to the named channel.
+// NewMQFromConfig constructs an MQ wrapper for the backend selected by
+// cfg.MQBackend.
+func NewMQFromConfig(ctx context.Context, cfg *config.Config) (*MQ, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.MQBackend)) {
+	case "", "rabbitmq":
+		client, err := NewRabbitMQClient(cfg.RabbitMQ)
+		if err != nil {
+			return nil, err
+		}
+		return New(client), nil
+	case "pubsub":
+		client, err := NewPubSubClient(ctx, cfg.PubSub)
+		if err != nil {
+			return nil, err
+		}
+		return New(client), nil
+	case "nats":
+		client, err := NewNATSClient(ctx, cfg.NATS)
+		if err != nil {
+			return nil, err
+		}
+		return New(client), nil
+	default:
+		return nil, fmt.Errorf("unknown message queue backend %q", cfg.MQBackend)
+	}
+}
+
+// Publish sends a message to the named channel. The trace context of ctx is
+// added to the message attributes so consumers continue the same trace.
 func (m *MQ) Publish(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error) {
-	return m.backend.Publish(ctx, channel, data, attrs)
+	return m.publish(ctx, channel, data, attrs, m.backend.Publish)
 }
 
-// Subscribe consumes messages from the named channel.
+// PublishTransient sends a message to a transient channel, traced like
+// Publish.
+func (m *MQ) PublishTransient(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error) {
+	return m.publish(ctx, channel, data, attrs, m.backend.PublishTransient)
+}
+
+func (m *MQ) publish(ctx context.Context, channel string, data []byte, attrs map[string]string, send func(context.Context, string, []byte, map[string]string) (string, error)) (string, error) {
+	ctx, span := tracer.Start(ctx, "publish "+channel,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("messaging.destination.name", channel)),
+	)
+	defer span.End()
+
+	id, err := send(ctx, channel, data, InjectTraceContext(ctx, attrs))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		metrics.MQPublished.WithLabelValues(channel, "error").Inc()
+		return "", err
+	}
+	span.SetAttributes(attribute.String("messaging.message.id", id))
+	metrics.MQPublished.WithLabelValues(channel, "ok").Inc()
+	return id, nil
+}
+
+// Subscribe consumes messages from the named channel. Each message is
+// handled in a span that continues the trace carried in its attributes.
 func (m *MQ) Subscribe(ctx context.Context, channel string, handler Handler) error {
-	return m.backend.Subscribe(ctx, channel, handler)
+	return m.backend.Subscribe(ctx, channel, func(ctx context.Context, msg Message) error {
+		if !msg.PublishedAt.IsZero() {
+			metrics.MQConsumeLag.WithLabelValues(channel).Observe(time.Since(msg.PublishedAt).Seconds())
+		}
+		ctx = ExtractTraceContext(ctx, msg.Attributes)
+		ctx, span := tracer.Start(ctx, "process "+channel,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("messaging.destination.name", channel),
+				attribute.String("messaging.message.id", msg.ID),
+			),
+		)
+		defer span.End()
+
+		if err := handler(ctx, msg); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			metrics.MQConsumed.WithLabelValues(channel, "nack").Inc()
+			return err
+		}
+		metrics.MQConsumed.WithLabelValues(channel, "ack").Inc()
+		return nil
+	})
+}
+
+// InjectTraceContext returns a copy of attrs with the trace context of ctx
+// added. Messages stored to be published later, like those in the outbox,
+// carry it so their publishing continues the trace.
+func InjectTraceContext(ctx context.Context, attrs map[string]string) map[string]string {
+	carrier := make(propagation.MapCarrier, len(attrs)+2)
+	for key, value := range attrs {
+		carrier[key] = value
+	}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
+
+// ExtractTraceContext returns ctx with the trace context carried in attrs.
+func ExtractTraceContext(ctx context.Context, attrs map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(attrs))
+}
+
+// Health returns nil while the broker is reachable, and otherwise why not.
+func (m *MQ) Health() error {
+	return m.backend.Health()
 }
 
 // Close closes the underlying backend.
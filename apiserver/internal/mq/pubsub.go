@@ -0,0 +1,302 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"github.com/jjudge-oj/apiserver/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errPubSubClosed = errors.New("pubsub client closed")
+
+// PubSubClient implements Backend with Google Cloud Pub/Sub. Each channel is
+// a topic of the same name with one subscription, named after the channel
+// plus the configured suffix, shared by all its consumers. Topics and
+// subscriptions are created on first use. Set PUBSUB_EMULATOR_HOST to use
+// the Pub/Sub emulator.
+type PubSubClient struct {
+	client             *pubsub.Client
+	subscriptionSuffix string
+
+	mu         sync.Mutex
+	publishers map[string]*pubsub.Publisher
+	ensured    map[string]bool // channels whose topic and subscription exist
+	lastErr    error
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPubSubClient constructs a Pub/Sub client from config.
+func NewPubSubClient(ctx context.Context, cfg *config.PubSubConfig) (*PubSubClient, error) {
+	if strings.TrimSpace(cfg.ProjectID) == "" {
+		return nil, errors.New("pubsub project id is required")
+	}
+	if strings.TrimSpace(cfg.SubscriptionSuffix) == "" {
+		return nil, errors.New("pubsub subscription suffix is required")
+	}
+
+	var opts []option.ClientOption
+	if strings.TrimSpace(cfg.CredentialsFile) != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+
+	client, err := pubsub.NewClient(ctx, cfg.ProjectID, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PubSubClient{
+		client:             client,
+		subscriptionSuffix: cfg.SubscriptionSuffix,
+		publishers:         map[string]*pubsub.Publisher{},
+		ensured:            map[string]bool{},
+		closed:             make(chan struct{}),
+	}, nil
+}
+
+// Health returns nil unless the latest publish or subscription attempt
+// failed. Pub/Sub has no connection to watch, so a failure is only noticed
+// when the broker is used.
+func (p *PubSubClient) Health() error {
+	select {
+	case <-p.closed:
+		return errPubSubClosed
+	default:
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.lastErr != nil {
+		return fmt.Errorf("pubsub unavailable: %w", p.lastErr)
+	}
+	return nil
+}
+
+// Publish sends a message to the topic named channel and waits for the
+// broker to accept it. The channel's subscription is created first, so
+// messages published before any consumer subscribes are kept as they are in
+// a RabbitMQ queue.
+func (p *PubSubClient) Publish(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error) {
+	if strings.TrimSpace(channel) == "" {
+		return "", errors.New("pubsub channel is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultPublishTimeout)
+	defer cancel()
+	publisher, err := p.publisher(ctx, channel)
+	if err != nil {
+		return "", p.track(err)
+	}
+
+	id, err := publisher.Publish(ctx, &pubsub.Message{
+		Data:       data,
+		Attributes: attrs,
+	}).Get(ctx)
+	if err != nil {
+		return "", p.track(fmt.Errorf("pubsub: publish to %q: %w", channel, err))
+	}
+	p.track(nil)
+	return id, nil
+}
+
+// PublishTransient sends a message to the topic of a channel a worker
+// created for itself. Nothing is created, so the message is dropped when
+// the worker is gone.
+func (p *PubSubClient) PublishTransient(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error) {
+	if strings.TrimSpace(channel) == "" {
+		return "", errors.New("pubsub channel is required")
+	}
+	select {
+	case <-p.closed:
+		return "", errPubSubClosed
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultPublishTimeout)
+	defer cancel()
+	publisher := p.client.Publisher(channel)
+	defer publisher.Stop()
+
+	id, err := publisher.Publish(ctx, &pubsub.Message{
+		Data:       data,
+		Attributes: attrs,
+	}).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", p.track(fmt.Errorf("pubsub: publish to %q: %w", channel, err))
+	}
+	p.track(nil)
+	return id, nil
+}
+
+// Subscribe receives messages from the channel's subscription until ctx is
+// done or the client is closed. Messages are handled one at a time, and a
+// handler error nacks the message so that it is redelivered. Receive errors
+// are retried with backoff.
+func (p *PubSubClient) Subscribe(ctx context.Context, channel string, handler Handler) error {
+	if strings.TrimSpace(channel) == "" {
+		return errors.New("pubsub channel is required")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := reconnectMinBackoff
+	for {
+		receiving, err := p.receive(ctx, channel, handler)
+		select {
+		case <-p.closed:
+			return errPubSubClosed
+		default:
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		p.track(err)
+		if receiving {
+			backoff = reconnectMinBackoff
+		}
+		log.Printf("pubsub: subscription to %q stopped: %v; resubscribing in %s", channel, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, reconnectMaxBackoff)
+	}
+}
+
+// receive runs one Receive call on the channel's subscription. It reports
+// whether receiving started, and returns when ctx is done or Receive fails.
+func (p *PubSubClient) receive(ctx context.Context, channel string, handler Handler) (bool, error) {
+	if err := p.ensure(ctx, channel); err != nil {
+		return false, err
+	}
+	p.track(nil)
+
+	subscriber := p.client.Subscriber(channel + p.subscriptionSuffix)
+	// One message at a time, like a RabbitMQ consumer; the library extends
+	// its ack deadline while the handler runs.
+	subscriber.ReceiveSettings.MaxOutstandingMessages = 1
+	subscriber.ReceiveSettings.NumGoroutines = 1
+
+	err := subscriber.Receive(ctx, func(msgCtx context.Context, msg *pubsub.Message) {
+		message := Message{
+			ID:          msg.ID,
+			Data:        msg.Data,
+			PublishedAt: msg.PublishTime,
+			Attributes:  msg.Attributes,
+		}
+		// Receive waits for the handler before returning, and acks sent
+		// after ctx is done are still delivered.
+		if err := handler(msgCtx, message); err != nil {
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+	})
+	if err == nil && ctx.Err() == nil {
+		err = errors.New("pubsub receive returned")
+	}
+	return true, err
+}
+
+// publisher returns the cached publisher for channel, creating the topic
+// and subscription first if needed.
+func (p *PubSubClient) publisher(ctx context.Context, channel string) (*pubsub.Publisher, error) {
+	if err := p.ensure(ctx, channel); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.closed:
+		return nil, errPubSubClosed
+	default:
+	}
+	publisher, ok := p.publishers[channel]
+	if !ok {
+		publisher = p.client.Publisher(channel)
+		p.publishers[channel] = publisher
+	}
+	return publisher, nil
+}
+
+// ensure creates the topic and subscription of channel unless they exist.
+func (p *PubSubClient) ensure(ctx context.Context, channel string) error {
+	p.mu.Lock()
+	ok := p.ensured[channel]
+	p.mu.Unlock()
+	if ok {
+		return nil
+	}
+
+	project := p.client.Project()
+	topic := fmt.Sprintf("projects/%s/topics/%s", project, channel)
+	_, err := p.client.TopicAdminClient.CreateTopic(ctx, &pubsubpb.Topic{Name: topic})
+	if err != nil && status.Code(err) != codes.AlreadyExists {
+		return fmt.Errorf("pubsub: create topic %q: %w", channel, err)
+	}
+
+	subscription := fmt.Sprintf("projects/%s/subscriptions/%s%s", project, channel, p.subscriptionSuffix)
+	_, err = p.client.SubscriptionAdminClient.CreateSubscription(ctx, &pubsubpb.Subscription{
+		Name:  subscription,
+		Topic: topic,
+	})
+	if err != nil && status.Code(err) != codes.AlreadyExists {
+		return fmt.Errorf("pubsub: create subscription %q: %w", channel+p.subscriptionSuffix, err)
+	}
+
+	p.mu.Lock()
+	p.ensured[channel] = true
+	p.mu.Unlock()
+	return nil
+}
+
+// track records err as the latest broker error, or clears it if nil, and
+// returns it.
+func (p *PubSubClient) track(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	p.mu.Lock()
+	p.lastErr = err
+	p.mu.Unlock()
+	return err
+}
+
+// Close stops the publishers and subscriptions and closes the client.
+func (p *PubSubClient) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		close(p.closed)
+		p.mu.Lock()
+		publishers := p.publishers
+		p.publishers = map[string]*pubsub.Publisher{}
+		p.mu.Unlock()
+		for _, publisher := range publishers {
+			publisher.Stop()
+		}
+		err = p.client.Close()
+	})
+	return err
+}
@@ -0,0 +1,182 @@
+package problempkg
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxUncompressedBytes bounds the total size of the files extracted from a
+// package so a small archive cannot expand without limit. Extracted files
+// are held in memory until imported, so it matches the upload limit of
+// package archives.
+const maxUncompressedBytes = 256 << 20
+
+// readArchive extracts a ZIP or tar.gz archive (detected by magic bytes) into
+// a map of cleaned slash-separated paths to file contents.
+func readArchive(data []byte) (map[string][]byte, error) {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		return readTarGz(data)
+	}
+	return readZip(data)
+}
+
+func readZip(data []byte) (map[string][]byte, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip file: %w", err)
+	}
+
+	files := make(map[string][]byte, len(r.File))
+	var total int64
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name, ok := cleanEntryName(f.Name)
+		if !ok {
+			return nil, fmt.Errorf("invalid archive entry name %q", f.Name)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zip entry %s: %w", f.Name, err)
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, maxUncompressedBytes-total+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zip entry %s: %w", f.Name, err)
+		}
+		total += int64(len(content))
+		if total > maxUncompressedBytes {
+			return nil, errors.New("package is too large when extracted")
+		}
+		files[name] = content
+	}
+	return files, nil
+}
+
+func readTarGz(data []byte) (map[string][]byte, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip stream: %w", err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	files := make(map[string][]byte)
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading tar archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, ok := cleanEntryName(hdr.Name)
+		if !ok {
+			return nil, fmt.Errorf("invalid archive entry name %q", hdr.Name)
+		}
+
+		content, err := io.ReadAll(io.LimitReader(tr, maxUncompressedBytes-total+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar entry %s: %w", hdr.Name, err)
+		}
+		total += int64(len(content))
+		if total > maxUncompressedBytes {
+			return nil, errors.New("package is too large when extracted")
+		}
+		files[name] = content
+	}
+	return files, nil
+}
+
+func cleanEntryName(name string) (string, bool) {
+	clean := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	clean = strings.TrimPrefix(clean, "./")
+	if clean == "." || clean == "" || strings.HasPrefix(clean, "/") || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false
+	}
+	return clean, true
+}
+
+// stripCommonRoot removes a single top-level directory shared by every file,
+// which is how most judges wrap their packages when zipping a problem folder.
+func stripCommonRoot(files map[string][]byte) map[string][]byte {
+	if Detect(files) != "" {
+		return files
+	}
+
+	root := ""
+	for name := range files {
+		slash := strings.Index(name, "/")
+		if slash < 0 {
+			return files
+		}
+		if root == "" {
+			root = name[:slash+1]
+		} else if !strings.HasPrefix(name, root) {
+			return files
+		}
+	}
+	if root == "" {
+		return files
+	}
+
+	stripped := make(map[string][]byte, len(files))
+	for name, content := range files {
+		stripped[strings.TrimPrefix(name, root)] = content
+	}
+	return stripped
+}
+
+// sortNatural orders names so that embedded numbers compare numerically,
+// e.g. "test2" before "test10".
+func sortNatural(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		return naturalLess(names[i], names[j])
+	})
+}
+
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := leadingDigits(a), leadingDigits(b)
+		if da != "" && db != "" {
+			na, _ := strconv.ParseUint(da, 10, 64)
+			nb, _ := strconv.ParseUint(db, 10, 64)
+			if na != nb {
+				return na < nb
+			}
+			if len(da) != len(db) {
+				return len(da) < len(db)
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
@@ -0,0 +1,190 @@
+package problempkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cmsTask mirrors the parts of a CMS Italian-format task.yaml that jjudge uses.
+type cmsTask struct {
+	Name            string  `yaml:"name"`
+	Title           string  `yaml:"title"`
+	TimeLimit       float64 `yaml:"time_limit"`
+	MemoryLimit     int64   `yaml:"memory_limit"`
+	NInput          int     `yaml:"n_input"`
+	PublicTestcases string  `yaml:"public_testcases"`
+	Infile          string  `yaml:"infile"`
+	Outfile         string  `yaml:"outfile"`
+}
+
+var cmsStatementCandidates = []string{
+	"statement/statement.en.md",
+	"statement/statement.md",
+	"statement/statement.txt",
+	"testo/testo.md",
+	"testo/testo.txt",
+}
+
+// cmsCheckerCandidates are the checkers of the Italian format, compiled or as
+// source: the current check/checker and the older cor/correttore. Other files
+// in those directories, such as Makefiles and headers, do not make a checker.
+var cmsCheckerCandidates = []string{
+	"check/checker",
+	"check/checker.cpp",
+	"check/checker.c",
+	"cor/correttore",
+	"cor/correttore.cpp",
+	"cor/correttore.c",
+}
+
+func parseCMS(files map[string][]byte) (*Package, error) {
+	var task cmsTask
+	if err := yaml.Unmarshal(files["task.yaml"], &task); err != nil {
+		return nil, fmt.Errorf("invalid task.yaml: %w", err)
+	}
+
+	pkg := &Package{}
+	pkg.Problem.Title = task.Title
+	if pkg.Problem.Title == "" {
+		pkg.Problem.Title = task.Name
+	}
+	pkg.Problem.TimeLimit = int64(math.Round(task.TimeLimit * 1000))
+	pkg.Problem.MemoryLimit = task.MemoryLimit << 20
+
+	if name, ok := firstExisting(files, cmsStatementCandidates...); ok {
+		description, err := readStatement(files, name)
+		if err != nil {
+			return nil, err
+		}
+		pkg.Problem.Description = description
+	} else if len(filesUnder(files, "statement")) > 0 || len(filesUnder(files, "testo")) > 0 {
+		pkg.warnf("statement is only available as a document; provide a description in the import metadata")
+	}
+
+	// An empty infile/outfile means standard input/output in CMS too.
+	pkg.Problem.InputFile = task.Infile
+	pkg.Problem.OutputFile = task.Outfile
+	if name, ok := firstExisting(files, cmsCheckerCandidates...); ok {
+		pkg.warnf("custom checker %q is not supported; outputs are compared token by token", name)
+	}
+
+	n := task.NInput
+	if n <= 0 {
+		for has(files, fmt.Sprintf("input/input%d.txt", n)) {
+			n++
+		}
+	}
+	public, err := cmsPublicTestcases(task.PublicTestcases, n)
+	if err != nil {
+		return nil, err
+	}
+
+	tests := make([]Test, 0, n)
+	for i := 0; i < n; i++ {
+		inName := fmt.Sprintf("input/input%d.txt", i)
+		outName := fmt.Sprintf("output/output%d.txt", i)
+		input, ok := files[inName]
+		if !ok {
+			return nil, fmt.Errorf("missing input file %s", inName)
+		}
+		output, ok := files[outName]
+		if !ok {
+			return nil, fmt.Errorf("missing output file %s", outName)
+		}
+		tests = append(tests, Test{Input: input, Output: output, Sample: public[i]})
+	}
+
+	groups, err := cmsSubtasks(files["gen/GEN"], tests)
+	if err != nil {
+		return nil, err
+	}
+	pkg.Groups = groups
+	return pkg, nil
+}
+
+// cmsPublicTestcases parses the comma separated public_testcases list, which
+// may also be "all".
+func cmsPublicTestcases(raw string, n int) (map[int]bool, error) {
+	public := make(map[int]bool)
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return public, nil
+	}
+	if raw == "all" {
+		for i := 0; i < n; i++ {
+			public[i] = true
+		}
+		return public, nil
+	}
+	for _, part := range strings.Split(raw, ",") {
+		idx, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || idx < 0 || idx >= n {
+			return nil, fmt.Errorf("invalid public testcase %q", part)
+		}
+		public[idx] = true
+	}
+	return public, nil
+}
+
+// cmsSubtasks splits tests into subtasks following gen/GEN, where a
+// "# ST: <points>" line starts a new subtask and every other non-comment line
+// (or "#COPY:" directive) produces the next testcase. Without subtask markers
+// all tests form a single group.
+func cmsSubtasks(gen []byte, tests []Test) ([]Group, error) {
+	if gen == nil {
+		return []Group{{Name: "tests", Tests: tests}}, nil
+	}
+
+	groups := make([]Group, 0)
+	next := 0
+	scanner := bufio.NewScanner(bytes.NewReader(gen))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		isTest := true
+		if strings.HasPrefix(line, "#") {
+			directive := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			switch {
+			case strings.HasPrefix(directive, "ST:"):
+				points, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(directive, "ST:")), 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid subtask line %q in gen/GEN", line)
+				}
+				groups = append(groups, Group{
+					Name:   fmt.Sprintf("subtask %d", len(groups)+1),
+					Points: int(math.Round(points)),
+				})
+				continue
+			case strings.HasPrefix(directive, "COPY:"):
+			default:
+				isTest = false
+			}
+		}
+		if !isTest {
+			continue
+		}
+		if next >= len(tests) {
+			return nil, fmt.Errorf("gen/GEN describes more than the %d testcases in the package", len(tests))
+		}
+		if len(groups) == 0 {
+			groups = append(groups, Group{Name: "tests"})
+		}
+		groups[len(groups)-1].Tests = append(groups[len(groups)-1].Tests, tests[next])
+		next++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read gen/GEN: %w", err)
+	}
+	if next != len(tests) {
+		return nil, fmt.Errorf("gen/GEN describes %d testcases but the package has %d", next, len(tests))
+	}
+	return groups, nil
+}
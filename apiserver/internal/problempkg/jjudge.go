@@ -0,0 +1,212 @@
+package problempkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/jjudge-oj/api/types"
+)
+
+// The native jjudge package is a ZIP archive laid out as:
+//
+//	problem.json          metadata, limits and testcase groups
+//	statement.md          problem description
+//	tests/<g>_<t>.in      input of testcase t in group g
+//	tests/<g>_<t>.out     expected output of testcase t in group g
+//	graders/<lang>/<name> grader file name for language lang
+//
+// Test file names follow the same <subtask>_<testcase> convention accepted by
+// the testcase ZIP upload.
+const (
+	jjudgeManifest  = "problem.json"
+	jjudgeStatement = "statement.md"
+	jjudgeTestsDir  = "tests"
+	jjudgeGraderDir = "graders"
+)
+
+type jjudgeProblem struct {
+	Title          string               `json:"title"`
+	Type           types.ProblemType    `json:"type,omitempty"`
+	Difficulty     int                  `json:"difficulty"`
+	TimeLimit      int64                `json:"time_limit"`
+	MemoryLimit    int64                `json:"memory_limit"`
+	OutputLimit    int64                `json:"output_limit,omitempty"`
+	MaxProcesses   int                  `json:"max_processes,omitempty"`
+	CPUs           int                  `json:"cpus,omitempty"`
+	TimeAccounting types.TimeAccounting `json:"time_accounting,omitempty"`
+	InputFile      string               `json:"input_file,omitempty"`
+	OutputFile     string               `json:"output_file,omitempty"`
+	Visibility     string               `json:"visibility,omitempty"`
+	Tags           []string             `json:"tags"`
+	TestcaseGroups []jjudgeGroup        `json:"testcase_groups"`
+	GraderFiles    []jjudgeGraderFile   `json:"grader_files,omitempty"`
+}
+
+type jjudgeGroup struct {
+	Name      string           `json:"name"`
+	Points    int              `json:"points"`
+	Testcases []jjudgeTestcase `json:"testcases"`
+}
+
+type jjudgeTestcase struct {
+	IsHidden bool `json:"is_hidden"`
+}
+
+type jjudgeGraderFile struct {
+	Language string `json:"language"`
+	Name     string `json:"name"`
+}
+
+func parseJJudge(files map[string][]byte) (*Package, error) {
+	var manifest jjudgeProblem
+	if err := json.Unmarshal(files[jjudgeManifest], &manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", jjudgeManifest, err)
+	}
+
+	pkg := &Package{}
+	pkg.Problem.Title = manifest.Title
+	pkg.Problem.Type = manifest.Type
+	pkg.Problem.Difficulty = manifest.Difficulty
+	pkg.Problem.TimeLimit = manifest.TimeLimit
+	pkg.Problem.MemoryLimit = manifest.MemoryLimit
+	pkg.Problem.OutputLimit = manifest.OutputLimit
+	pkg.Problem.MaxProcesses = manifest.MaxProcesses
+	pkg.Problem.CPUs = manifest.CPUs
+	pkg.Problem.TimeAccounting = manifest.TimeAccounting
+	pkg.Problem.InputFile = manifest.InputFile
+	pkg.Problem.OutputFile = manifest.OutputFile
+	pkg.Problem.Visibility = manifest.Visibility
+	pkg.Problem.Tags = manifest.Tags
+
+	if has(files, jjudgeStatement) {
+		description, err := readStatement(files, jjudgeStatement)
+		if err != nil {
+			return nil, err
+		}
+		pkg.Problem.Description = description
+	}
+
+	for gi, g := range manifest.TestcaseGroups {
+		group := Group{Name: g.Name, Points: g.Points}
+		for ti, tc := range g.Testcases {
+			inName, outName := jjudgeTestNames(gi, ti)
+			input, ok := files[inName]
+			if !ok {
+				return nil, fmt.Errorf("missing input file %s", inName)
+			}
+			output, ok := files[outName]
+			if !ok {
+				return nil, fmt.Errorf("missing output file %s", outName)
+			}
+			group.Tests = append(group.Tests, Test{Input: input, Output: output, Sample: !tc.IsHidden})
+		}
+		pkg.Groups = append(pkg.Groups, group)
+	}
+
+	for _, f := range manifest.GraderFiles {
+		name := jjudgeGraderName(f.Language, f.Name)
+		data, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("missing grader file %s", name)
+		}
+		pkg.GraderFiles = append(pkg.GraderFiles, GraderFile{Language: f.Language, Name: f.Name, Data: data})
+	}
+	return pkg, nil
+}
+
+// Export writes pkg as a native jjudge package. The archive is deterministic
+// so exporting an unchanged problem twice yields identical bytes.
+func Export(pkg *Package) ([]byte, error) {
+	manifest := jjudgeProblem{
+		Title:          pkg.Problem.Title,
+		Type:           pkg.Problem.Type,
+		Difficulty:     pkg.Problem.Difficulty,
+		TimeLimit:      pkg.Problem.TimeLimit,
+		MemoryLimit:    pkg.Problem.MemoryLimit,
+		OutputLimit:    pkg.Problem.OutputLimit,
+		MaxProcesses:   pkg.Problem.MaxProcesses,
+		CPUs:           pkg.Problem.CPUs,
+		TimeAccounting: pkg.Problem.TimeAccounting,
+		InputFile:      pkg.Problem.InputFile,
+		OutputFile:     pkg.Problem.OutputFile,
+		Visibility:     pkg.Problem.Visibility,
+		Tags:           pkg.Problem.Tags,
+		TestcaseGroups: make([]jjudgeGroup, 0, len(pkg.Groups)),
+	}
+	if manifest.Tags == nil {
+		manifest.Tags = []string{}
+	}
+	for _, g := range pkg.Groups {
+		group := jjudgeGroup{Name: g.Name, Points: g.Points, Testcases: make([]jjudgeTestcase, 0, len(g.Tests))}
+		for _, t := range g.Tests {
+			group.Testcases = append(group.Testcases, jjudgeTestcase{IsHidden: !t.Sample})
+		}
+		manifest.TestcaseGroups = append(manifest.TestcaseGroups, group)
+	}
+	for _, f := range pkg.GraderFiles {
+		manifest.GraderFiles = append(manifest.GraderFiles, jjudgeGraderFile{Language: f.Language, Name: f.Name})
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal %s: %w", jjudgeManifest, err)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name string, data []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: time.Unix(0, 0).UTC(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", name, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		return nil
+	}
+
+	if err := write(jjudgeManifest, append(manifestJSON, '\n')); err != nil {
+		return nil, err
+	}
+	if err := write(jjudgeStatement, []byte(pkg.Problem.Description+"\n")); err != nil {
+		return nil, err
+	}
+	for gi, g := range pkg.Groups {
+		for ti, t := range g.Tests {
+			inName, outName := jjudgeTestNames(gi, ti)
+			if err := write(inName, t.Input); err != nil {
+				return nil, err
+			}
+			if err := write(outName, t.Output); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, f := range pkg.GraderFiles {
+		if err := write(jjudgeGraderName(f.Language, f.Name), f.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close zip writer: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func jjudgeTestNames(group, testcase int) (string, string) {
+	base := fmt.Sprintf("%s/%d_%d", jjudgeTestsDir, group, testcase)
+	return base + ".in", base + ".out"
+}
+
+func jjudgeGraderName(language, name string) string {
+	return path.Join(jjudgeGraderDir, language, name)
+}
@@ -0,0 +1,200 @@
+package problempkg
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kattisProblem mirrors the parts of a Kattis problem.yaml that jjudge uses.
+// Both the legacy and the 2023-07 problem format layouts are accepted.
+type kattisProblem struct {
+	Name       yaml.Node `yaml:"name"`
+	Type       string    `yaml:"type"`
+	Validation string    `yaml:"validation"`
+	Keywords   yaml.Node `yaml:"keywords"`
+	Limits     struct {
+		TimeLimit float64 `yaml:"time_limit"`
+		Memory    int64   `yaml:"memory"`
+	} `yaml:"limits"`
+}
+
+type kattisTestdata struct {
+	AcceptScore *float64 `yaml:"accept_score"`
+	Range       string   `yaml:"range"`
+}
+
+const kattisDefaultMemoryMiB = 2048
+
+var kattisStatementCandidates = []string{
+	"statement/problem.en.md",
+	"problem_statement/problem.en.md",
+	"problem_statement/problem.md",
+	"statement/problem.en.tex",
+	"problem_statement/problem.en.tex",
+	"problem_statement/problem.tex",
+}
+
+func parseKattis(files map[string][]byte) (*Package, error) {
+	var doc kattisProblem
+	if err := yaml.Unmarshal(files["problem.yaml"], &doc); err != nil {
+		return nil, fmt.Errorf("invalid problem.yaml: %w", err)
+	}
+
+	pkg := &Package{}
+	pkg.Problem.Title = kattisName(doc.Name)
+	pkg.Problem.Tags = kattisKeywords(doc.Keywords)
+
+	if name, ok := firstExisting(files, kattisStatementCandidates...); ok {
+		description, err := readStatement(files, name)
+		if err != nil {
+			return nil, err
+		}
+		pkg.Problem.Description = description
+	}
+
+	switch {
+	case doc.Limits.TimeLimit > 0:
+		pkg.Problem.TimeLimit = int64(math.Round(doc.Limits.TimeLimit * 1000))
+	default:
+		if name, ok := firstExisting(files, ".timelimit", "timelimit"); ok {
+			seconds, err := strconv.ParseFloat(strings.TrimSpace(string(files[name])), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			pkg.Problem.TimeLimit = int64(math.Round(seconds * 1000))
+		}
+	}
+	memoryMiB := doc.Limits.Memory
+	if memoryMiB <= 0 {
+		memoryMiB = kattisDefaultMemoryMiB
+	}
+	pkg.Problem.MemoryLimit = memoryMiB << 20
+
+	if strings.Contains(doc.Validation, "custom") || len(subdirsUnder(files, "output_validators")) > 0 {
+		pkg.warnf("output validators are not supported; outputs are compared token by token")
+	}
+	if strings.Contains(doc.Type, "interactive") || strings.Contains(doc.Validation, "interactive") {
+		pkg.warnf("interactive problems are not supported; the interaction was ignored")
+	}
+
+	if err := kattisGroups(pkg, files); err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+// kattisName accepts either a plain string or a language map, preferring English.
+func kattisName(node yaml.Node) string {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value
+	case yaml.MappingNode:
+		var names map[string]string
+		if err := node.Decode(&names); err != nil {
+			return ""
+		}
+		if en, ok := names["en"]; ok {
+			return en
+		}
+		for _, n := range names {
+			return n
+		}
+	}
+	return ""
+}
+
+// kattisKeywords accepts the legacy space-separated string or a list.
+func kattisKeywords(node yaml.Node) []string {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return strings.Fields(node.Value)
+	case yaml.SequenceNode:
+		var list []string
+		if err := node.Decode(&list); err != nil {
+			return nil
+		}
+		return list
+	}
+	return nil
+}
+
+// kattisGroups maps data/sample to a visible group and data/secret to one
+// group, or one group per subdirectory when the secret data is grouped.
+func kattisGroups(pkg *Package, files map[string][]byte) error {
+	samples, err := kattisTests(files, "data/sample", true)
+	if err != nil {
+		return err
+	}
+	if len(samples) > 0 {
+		pkg.Groups = append(pkg.Groups, Group{Name: "sample", Tests: samples})
+	}
+
+	secret, err := kattisTests(files, "data/secret", false)
+	if err != nil {
+		return err
+	}
+	if len(secret) > 0 {
+		pkg.Groups = append(pkg.Groups, Group{Name: "secret", Tests: secret})
+	}
+
+	for _, dir := range subdirsUnder(files, "data/secret") {
+		tests, err := kattisTests(files, dir, false)
+		if err != nil {
+			return err
+		}
+		if len(tests) == 0 {
+			continue
+		}
+		points, err := kattisGroupPoints(files, dir)
+		if err != nil {
+			return err
+		}
+		pkg.Groups = append(pkg.Groups, Group{Name: path.Base(dir), Points: points, Tests: tests})
+	}
+	return nil
+}
+
+func kattisTests(files map[string][]byte, dir string, sample bool) ([]Test, error) {
+	tests := make([]Test, 0)
+	for _, name := range filesUnder(files, dir) {
+		if path.Ext(name) != ".in" {
+			continue
+		}
+		ansName := trimExt(name) + ".ans"
+		answer, ok := files[ansName]
+		if !ok {
+			return nil, fmt.Errorf("missing answer file %s", ansName)
+		}
+		tests = append(tests, Test{Input: files[name], Output: answer, Sample: sample})
+	}
+	return tests, nil
+}
+
+// kattisGroupPoints reads the group score from testdata.yaml, using
+// accept_score or the upper bound of range.
+func kattisGroupPoints(files map[string][]byte, dir string) (int, error) {
+	name := dir + "/testdata.yaml"
+	if !has(files, name) {
+		return 0, nil
+	}
+	var td kattisTestdata
+	if err := yaml.Unmarshal(files[name], &td); err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if td.AcceptScore != nil {
+		return int(math.Round(*td.AcceptScore)), nil
+	}
+	if fields := strings.Fields(td.Range); len(fields) == 2 {
+		upper, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid range in %s: %w", name, err)
+		}
+		return int(math.Round(upper)), nil
+	}
+	return 0, nil
+}
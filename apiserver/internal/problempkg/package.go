@@ -0,0 +1,289 @@
+// Package problempkg converts between jjudge problems and the problem package
+// formats used by other judges: Codeforces Polygon, Kattis and CMS (Italian
+// task format). It also defines the native jjudge package produced by Export.
+package problempkg
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/jjudge-oj/api/types"
+)
+
+// Format identifies a problem package layout.
+type Format string
+
+const (
+	FormatJJudge  Format = "jjudge"
+	FormatPolygon Format = "polygon"
+	FormatKattis  Format = "kattis"
+	FormatCMS     Format = "cms"
+)
+
+const (
+	defaultTimeLimitMs    = 1000
+	defaultMemoryLimit    = 256 << 20
+	defaultTotalPoints    = 100
+	maxStatementFileBytes = 1 << 20
+)
+
+// ErrUnknownFormat is returned when a package layout cannot be recognised.
+var ErrUnknownFormat = errors.New("unrecognised problem package format")
+
+// Package is a problem package decoded into jjudge's model.
+type Package struct {
+	// Format is the layout the package was read from.
+	Format Format
+
+	// Problem holds the problem metadata (title, statement, limits, tags).
+	// TestcaseGroups and GraderFiles are left empty; the groups and grader
+	// files live with their data in Groups and GraderFiles.
+	Problem types.Problem
+
+	// Groups is the ordered list of testcase groups with their data.
+	Groups []Group
+
+	// GraderFiles are the grader files of the problem with their contents.
+	GraderFiles []GraderFile
+
+	// Warnings lists package features that could not be mapped onto jjudge,
+	// such as custom checkers or per-test scoring.
+	Warnings []string
+}
+
+// Group is a testcase group together with the testcase contents.
+type Group struct {
+	Name   string
+	Points int
+	Tests  []Test
+}
+
+// Test is a single input/answer pair.
+type Test struct {
+	Input  []byte
+	Output []byte
+	// Sample marks tests shown to contestants; they are imported as visible.
+	Sample bool
+}
+
+// GraderFile is a grader file for one language together with its contents.
+type GraderFile struct {
+	Language string
+	Name     string
+	Data     []byte
+}
+
+func (p *Package) warnf(format string, args ...any) {
+	p.Warnings = append(p.Warnings, fmt.Sprintf(format, args...))
+}
+
+// TestcaseGroups returns the package groups as jjudge testcase groups with
+// consecutive ordinals. Storage keys and hashes are left empty.
+func (p *Package) TestcaseGroups() []types.TestcaseGroup {
+	groups := make([]types.TestcaseGroup, 0, len(p.Groups))
+	for gi, g := range p.Groups {
+		testcases := make([]types.Testcase, 0, len(g.Tests))
+		for ti, t := range g.Tests {
+			testcases = append(testcases, types.Testcase{
+				Ordinal:  ti,
+				IsHidden: !t.Sample,
+			})
+		}
+		groups = append(groups, types.TestcaseGroup{
+			Ordinal:   gi,
+			Name:      g.Name,
+			Points:    g.Points,
+			Testcases: testcases,
+		})
+	}
+	return groups
+}
+
+// Parse decodes a ZIP or tar.gz problem package. If format is empty the layout
+// is detected from the marker file at the package root.
+func Parse(data []byte, format Format) (*Package, error) {
+	files, err := readArchive(data)
+	if err != nil {
+		return nil, err
+	}
+	files = stripCommonRoot(files)
+
+	if format == "" {
+		format = Detect(files)
+	}
+
+	var pkg *Package
+	switch format {
+	case FormatJJudge:
+		pkg, err = parseJJudge(files)
+	case FormatPolygon:
+		pkg, err = parsePolygon(files)
+	case FormatKattis:
+		pkg, err = parseKattis(files)
+	case FormatCMS:
+		pkg, err = parseCMS(files)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s package: %w", format, err)
+	}
+	pkg.Format = format
+
+	if err := pkg.validate(); err != nil {
+		return nil, fmt.Errorf("%s package: %w", format, err)
+	}
+	return pkg, nil
+}
+
+// Detect guesses the package format from the files at its root.
+func Detect(files map[string][]byte) Format {
+	switch {
+	case has(files, jjudgeManifest):
+		return FormatJJudge
+	case has(files, "problem.xml"):
+		return FormatPolygon
+	case has(files, "problem.yaml"):
+		return FormatKattis
+	case has(files, "task.yaml"):
+		return FormatCMS
+	default:
+		return ""
+	}
+}
+
+// ParseFormat validates a user-supplied format name. An empty name is allowed
+// and means "detect".
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(name))); f {
+	case "", FormatJJudge, FormatPolygon, FormatKattis, FormatCMS:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported package format: %q", name)
+	}
+}
+
+func (p *Package) validate() error {
+	p.Problem.Title = strings.TrimSpace(p.Problem.Title)
+	if p.Problem.Title == "" {
+		return errors.New("problem title is missing")
+	}
+	if len(p.Groups) == 0 {
+		return errors.New("package contains no tests")
+	}
+	for gi, g := range p.Groups {
+		if len(g.Tests) == 0 {
+			return fmt.Errorf("group %d (%s) contains no tests", gi, g.Name)
+		}
+	}
+	if p.Problem.TimeLimit <= 0 {
+		p.Problem.TimeLimit = defaultTimeLimitMs
+		p.warnf("no time limit in package, defaulting to %d ms", defaultTimeLimitMs)
+	}
+	if p.Problem.MemoryLimit <= 0 {
+		p.Problem.MemoryLimit = defaultMemoryLimit
+		p.warnf("no memory limit in package, defaulting to %d MiB", defaultMemoryLimit>>20)
+	}
+	p.distributeDefaultPoints()
+	return nil
+}
+
+// distributeDefaultPoints spreads defaultTotalPoints evenly over the non-sample
+// groups when the package does not score its groups at all, so IOI contests
+// still award points for a full solve.
+func (p *Package) distributeDefaultPoints() {
+	scored := make([]int, 0, len(p.Groups))
+	for i, g := range p.Groups {
+		if g.Points != 0 {
+			return
+		}
+		if !allSamples(g) {
+			scored = append(scored, i)
+		}
+	}
+	if len(scored) == 0 {
+		return
+	}
+	share := defaultTotalPoints / len(scored)
+	for _, i := range scored {
+		p.Groups[i].Points = share
+	}
+	p.Groups[scored[len(scored)-1]].Points += defaultTotalPoints - share*len(scored)
+}
+
+func allSamples(g Group) bool {
+	for _, t := range g.Tests {
+		if !t.Sample {
+			return false
+		}
+	}
+	return true
+}
+
+func has(files map[string][]byte, name string) bool {
+	_, ok := files[name]
+	return ok
+}
+
+// firstExisting returns the first name in candidates present in files.
+func firstExisting(files map[string][]byte, candidates ...string) (string, bool) {
+	for _, name := range candidates {
+		if has(files, name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// readStatement returns the trimmed statement stored at name, rejecting
+// statements that are unreasonably large for a problem description.
+func readStatement(files map[string][]byte, name string) (string, error) {
+	data := files[name]
+	if len(data) > maxStatementFileBytes {
+		return "", fmt.Errorf("statement %s is too large", name)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// filesUnder returns the sorted names of files directly inside dir.
+func filesUnder(files map[string][]byte, dir string) []string {
+	dir = strings.TrimSuffix(dir, "/") + "/"
+	names := make([]string, 0)
+	for name := range files {
+		if strings.HasPrefix(name, dir) && !strings.Contains(name[len(dir):], "/") {
+			names = append(names, name)
+		}
+	}
+	sortNatural(names)
+	return names
+}
+
+// subdirsUnder returns the sorted names of the immediate subdirectories of dir.
+func subdirsUnder(files map[string][]byte, dir string) []string {
+	dir = strings.TrimSuffix(dir, "/") + "/"
+	seen := make(map[string]struct{})
+	names := make([]string, 0)
+	for name := range files {
+		if !strings.HasPrefix(name, dir) {
+			continue
+		}
+		rest := name[len(dir):]
+		slash := strings.Index(rest, "/")
+		if slash < 0 {
+			continue
+		}
+		sub := dir + rest[:slash]
+		if _, ok := seen[sub]; !ok {
+			seen[sub] = struct{}{}
+			names = append(names, sub)
+		}
+	}
+	sortNatural(names)
+	return names
+}
+
+func trimExt(name string) string {
+	return strings.TrimSuffix(name, path.Ext(name))
+}
@@ -0,0 +1,268 @@
+package problempkg_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/problempkg"
+)
+
+// zipFixture archives testdata/<name> under a top-level directory, as judges
+// usually export it, leaving out the files in skip.
+func zipFixture(t *testing.T, name string, skip ...string) []byte {
+	t.Helper()
+	root := filepath.Join("testdata", name)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, s := range skip {
+			if rel == s {
+				return nil
+			}
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		w, err := zw.Create(path.Join(name, rel))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("zip %s: %v", root, err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip %s: %v", root, err)
+	}
+	return buf.Bytes()
+}
+
+type wantGroup struct {
+	name    string
+	points  int
+	tests   int
+	samples int
+}
+
+func checkGroups(t *testing.T, pkg *problempkg.Package, want []wantGroup) {
+	t.Helper()
+	got := make([]wantGroup, 0, len(pkg.Groups))
+	for _, g := range pkg.Groups {
+		samples := 0
+		for _, tc := range g.Tests {
+			if tc.Sample {
+				samples++
+			}
+		}
+		got = append(got, wantGroup{name: g.Name, points: g.Points, tests: len(g.Tests), samples: samples})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groups = %+v, want %+v", got, want)
+	}
+}
+
+func checkWarnings(t *testing.T, pkg *problempkg.Package, want ...string) {
+	t.Helper()
+	if len(pkg.Warnings) != len(want) {
+		t.Fatalf("warnings = %q, want %d matching %q", pkg.Warnings, len(want), want)
+	}
+	for i, w := range want {
+		if !strings.Contains(pkg.Warnings[i], w) {
+			t.Errorf("warning %d = %q, want it to mention %q", i, pkg.Warnings[i], w)
+		}
+	}
+}
+
+func TestParsePolygon(t *testing.T) {
+	pkg, err := problempkg.Parse(zipFixture(t, "polygon"), "")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if pkg.Format != problempkg.FormatPolygon {
+		t.Errorf("format = %q, want %q", pkg.Format, problempkg.FormatPolygon)
+	}
+	p := pkg.Problem
+	if p.Title != "A Plus B" || p.TimeLimit != 2000 || p.MemoryLimit != 256<<20 {
+		t.Errorf("problem = %q, %d ms, %d bytes", p.Title, p.TimeLimit, p.MemoryLimit)
+	}
+	if !reflect.DeepEqual(p.Tags, []string{"math", "implementation"}) {
+		t.Errorf("tags = %q", p.Tags)
+	}
+	for _, part := range []string{"Print the sum", "## Input\n\nTwo integers", "## Output\n\nTheir sum."} {
+		if !strings.Contains(p.Description, part) {
+			t.Errorf("description %q does not contain %q", p.Description, part)
+		}
+	}
+	// The "large" group has no tests and is dropped.
+	checkGroups(t, pkg, []wantGroup{
+		{name: "samples", points: 0, tests: 1, samples: 1},
+		{name: "small", points: 40, tests: 2},
+	})
+	if got := string(pkg.Groups[1].Tests[1].Output); got != "12\n" {
+		t.Errorf("last answer = %q, want %q", got, "12\n")
+	}
+	checkWarnings(t, pkg, `custom checker "check.cpp"`, "interactor", `group "small" scores each test`)
+}
+
+func TestParsePolygonMissingTest(t *testing.T) {
+	_, err := problempkg.Parse(zipFixture(t, "polygon", "tests/03"), problempkg.FormatPolygon)
+	if err == nil || !strings.Contains(err.Error(), "tests/03") {
+		t.Fatalf("Parse without tests/03: got %v", err)
+	}
+}
+
+func TestParseKattis(t *testing.T) {
+	pkg, err := problempkg.Parse(zipFixture(t, "kattis"), "")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	p := pkg.Problem
+	if p.Title != "A Plus B" || p.TimeLimit != 2500 || p.MemoryLimit != 2048<<20 {
+		t.Errorf("problem = %q, %d ms, %d bytes", p.Title, p.TimeLimit, p.MemoryLimit)
+	}
+	if !reflect.DeepEqual(p.Tags, []string{"math", "easy"}) {
+		t.Errorf("tags = %q", p.Tags)
+	}
+	checkGroups(t, pkg, []wantGroup{
+		{name: "sample", tests: 1, samples: 1},
+		{name: "group1", points: 30, tests: 1},
+		{name: "group2", points: 70, tests: 2},
+	})
+	checkWarnings(t, pkg, "output validators")
+}
+
+func TestParseCMS(t *testing.T) {
+	pkg, err := problempkg.Parse(zipFixture(t, "cms"), "")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	p := pkg.Problem
+	if p.Title != "Somma" || p.TimeLimit != 1500 || p.MemoryLimit != 512<<20 {
+		t.Errorf("problem = %q, %d ms, %d bytes", p.Title, p.TimeLimit, p.MemoryLimit)
+	}
+	if p.InputFile != "input.txt" || p.OutputFile != "output.txt" {
+		t.Errorf("file I/O = %q/%q, want input.txt/output.txt", p.InputFile, p.OutputFile)
+	}
+	checkGroups(t, pkg, []wantGroup{
+		{name: "subtask 1", points: 0, tests: 1, samples: 1},
+		{name: "subtask 2", points: 40, tests: 1},
+		{name: "subtask 3", points: 60, tests: 1},
+	})
+	checkWarnings(t, pkg, `custom checker "check/checker.cpp"`)
+}
+
+func TestParseCMSWithoutChecker(t *testing.T) {
+	// A Makefile alone does not make a checker.
+	pkg, err := problempkg.Parse(zipFixture(t, "cms", "check/checker.cpp"), problempkg.FormatCMS)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	checkWarnings(t, pkg)
+}
+
+func TestParseCMSWithoutGen(t *testing.T) {
+	pkg, err := problempkg.Parse(zipFixture(t, "cms", "gen/GEN"), problempkg.FormatCMS)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	// Ungraded packages get the default points on their scored groups.
+	checkGroups(t, pkg, []wantGroup{{name: "tests", points: 100, tests: 3, samples: 1}})
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	want := &problempkg.Package{
+		Format: problempkg.FormatJJudge,
+		Problem: types.Problem{
+			Title:          "Parallel Sum",
+			Description:    "Sum the numbers in input.txt.",
+			Difficulty:     1600,
+			TimeLimit:      3000,
+			MemoryLimit:    128 << 20,
+			OutputLimit:    1 << 20,
+			MaxProcesses:   8,
+			CPUs:           4,
+			TimeAccounting: types.TimeAccountingWall,
+			Type:           types.ProblemTypeBatch,
+			InputFile:      "input.txt",
+			OutputFile:     "output.txt",
+			Visibility:     "private",
+			Tags:           []string{"parallel"},
+		},
+		Groups: []problempkg.Group{
+			{Name: "samples", Tests: []problempkg.Test{{Input: []byte("1 2\n"), Output: []byte("3\n"), Sample: true}}},
+			{Name: "all", Points: 100, Tests: []problempkg.Test{
+				{Input: []byte("2 2\n"), Output: []byte("4\n")},
+				{Input: []byte("5 7\n"), Output: []byte("12\n")},
+			}},
+		},
+		GraderFiles: []problempkg.GraderFile{
+			{Language: "cpp", Name: "grader.cpp", Data: []byte("int main() { return solve(); }\n")},
+			{Language: "cpp", Name: "sum.h", Data: []byte("int solve();\n")},
+		},
+	}
+
+	data, err := problempkg.Export(want)
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	again, err := problempkg.Export(want)
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Error("exporting twice produced different archives")
+	}
+
+	got, err := problempkg.Parse(data, "")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !reflect.DeepEqual(got.Problem, want.Problem) {
+		t.Errorf("problem = %+v\nwant %+v", got.Problem, want.Problem)
+	}
+	if !reflect.DeepEqual(got.Groups, want.Groups) {
+		t.Errorf("groups = %+v\nwant %+v", got.Groups, want.Groups)
+	}
+	if !reflect.DeepEqual(got.GraderFiles, want.GraderFiles) {
+		t.Errorf("grader files = %+v\nwant %+v", got.GraderFiles, want.GraderFiles)
+	}
+	checkWarnings(t, got)
+}
+
+func TestParseJJudgeDefaults(t *testing.T) {
+	data, err := problempkg.Export(&problempkg.Package{
+		Problem: types.Problem{Title: "No Limits"},
+		Groups:  []problempkg.Group{{Name: "tests", Tests: []problempkg.Test{{Input: []byte("1\n"), Output: []byte("1\n")}}}},
+	})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	pkg, err := problempkg.Parse(data, problempkg.FormatJJudge)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if pkg.Problem.TimeLimit != 1000 || pkg.Problem.MemoryLimit != 256<<20 {
+		t.Errorf("limits = %d ms, %d bytes, want the defaults", pkg.Problem.TimeLimit, pkg.Problem.MemoryLimit)
+	}
+	checkGroups(t, pkg, []wantGroup{{name: "tests", points: 100, tests: 1}})
+	checkWarnings(t, pkg, "no time limit", "no memory limit")
+}
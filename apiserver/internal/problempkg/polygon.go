@@ -0,0 +1,259 @@
+package problempkg
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// polygonProblem mirrors the parts of a Polygon problem.xml that jjudge uses.
+type polygonProblem struct {
+	Names []struct {
+		Language string `xml:"language,attr"`
+		Value    string `xml:"value,attr"`
+	} `xml:"names>name"`
+	Testsets []polygonTestset `xml:"judging>testset"`
+	Checker  struct {
+		Name string `xml:"name,attr"`
+	} `xml:"assets>checker"`
+	Interactor *struct{} `xml:"assets>interactor"`
+	Tags       []struct {
+		Value string `xml:"value,attr"`
+	} `xml:"tags>tag"`
+}
+
+type polygonTestset struct {
+	Name              string `xml:"name,attr"`
+	TimeLimit         int64  `xml:"time-limit"`
+	MemoryLimit       int64  `xml:"memory-limit"`
+	TestCount         int    `xml:"test-count"`
+	InputPathPattern  string `xml:"input-path-pattern"`
+	AnswerPathPattern string `xml:"answer-path-pattern"`
+	Tests             []struct {
+		Sample bool    `xml:"sample,attr"`
+		Group  string  `xml:"group,attr"`
+		Points float64 `xml:"points,attr"`
+	} `xml:"tests>test"`
+	Groups []struct {
+		Name         string  `xml:"name,attr"`
+		Points       float64 `xml:"points,attr"`
+		PointsPolicy string  `xml:"points-policy,attr"`
+	} `xml:"groups>group"`
+}
+
+// polygonStatementSections lists the statement-sections files in the order
+// they are concatenated into the jjudge description.
+var polygonStatementSections = []struct {
+	file    string
+	heading string
+}{
+	{"legend.tex", ""},
+	{"input.tex", "Input"},
+	{"output.tex", "Output"},
+	{"interaction.tex", "Interaction"},
+	{"scoring.tex", "Scoring"},
+	{"notes.tex", "Notes"},
+}
+
+func parsePolygon(files map[string][]byte) (*Package, error) {
+	var doc polygonProblem
+	if err := xml.Unmarshal(files["problem.xml"], &doc); err != nil {
+		return nil, fmt.Errorf("invalid problem.xml: %w", err)
+	}
+
+	pkg := &Package{}
+
+	language := "english"
+	for _, n := range doc.Names {
+		if n.Language == "english" {
+			pkg.Problem.Title = n.Value
+			break
+		}
+	}
+	if pkg.Problem.Title == "" && len(doc.Names) > 0 {
+		pkg.Problem.Title = doc.Names[0].Value
+		language = doc.Names[0].Language
+	}
+
+	for _, t := range doc.Tags {
+		if v := strings.TrimSpace(t.Value); v != "" {
+			pkg.Problem.Tags = append(pkg.Problem.Tags, v)
+		}
+	}
+
+	description, err := polygonStatement(files, language)
+	if err != nil {
+		return nil, err
+	}
+	pkg.Problem.Description = description
+
+	testset, err := pickPolygonTestset(doc.Testsets)
+	if err != nil {
+		return nil, err
+	}
+	pkg.Problem.TimeLimit = testset.TimeLimit
+	pkg.Problem.MemoryLimit = testset.MemoryLimit
+
+	if name := doc.Checker.Name; name != "" && !strings.HasPrefix(name, "std::") {
+		pkg.warnf("custom checker %q is not supported; outputs are compared token by token", name)
+	}
+	if doc.Interactor != nil {
+		pkg.warnf("interactor is not supported and was ignored")
+	}
+
+	if err := polygonGroups(pkg, files, testset); err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+func pickPolygonTestset(testsets []polygonTestset) (polygonTestset, error) {
+	if len(testsets) == 0 {
+		return polygonTestset{}, errors.New("problem.xml has no testset")
+	}
+	for _, ts := range testsets {
+		if ts.Name == "tests" {
+			return ts, nil
+		}
+	}
+	return testsets[0], nil
+}
+
+// polygonStatement builds a description from statement-sections/<language>,
+// falling back to the problem-properties.json found in full packages.
+func polygonStatement(files map[string][]byte, language string) (string, error) {
+	dir := "statement-sections/" + language + "/"
+	parts := make([]string, 0, len(polygonStatementSections))
+	for _, section := range polygonStatementSections {
+		if !has(files, dir+section.file) {
+			continue
+		}
+		text, err := readStatement(files, dir+section.file)
+		if err != nil {
+			return "", err
+		}
+		if text == "" {
+			continue
+		}
+		if section.heading != "" {
+			text = "## " + section.heading + "\n\n" + text
+		}
+		parts = append(parts, text)
+	}
+	if len(parts) > 0 {
+		return strings.Join(parts, "\n\n"), nil
+	}
+
+	propsPath := "statements/" + language + "/problem-properties.json"
+	if !has(files, propsPath) {
+		return "", nil
+	}
+	var props struct {
+		Legend      string `json:"legend"`
+		Input       string `json:"input"`
+		Output      string `json:"output"`
+		Interaction string `json:"interaction"`
+		Notes       string `json:"notes"`
+	}
+	if err := json.Unmarshal(files[propsPath], &props); err != nil {
+		return "", fmt.Errorf("invalid %s: %w", propsPath, err)
+	}
+	sections := []struct{ heading, text string }{
+		{"", props.Legend},
+		{"Input", props.Input},
+		{"Output", props.Output},
+		{"Interaction", props.Interaction},
+		{"Notes", props.Notes},
+	}
+	for _, s := range sections {
+		text := strings.TrimSpace(s.text)
+		if text == "" {
+			continue
+		}
+		if s.heading != "" {
+			text = "## " + s.heading + "\n\n" + text
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// polygonGroups loads the testset data. Tests are grouped by their group
+// attribute in the order groups are declared; packages without groups get a
+// single group holding every test.
+func polygonGroups(pkg *Package, files map[string][]byte, ts polygonTestset) error {
+	count := ts.TestCount
+	if count == 0 {
+		count = len(ts.Tests)
+	}
+	if count == 0 {
+		return errors.New("testset has no tests")
+	}
+	if ts.InputPathPattern == "" || ts.AnswerPathPattern == "" {
+		return errors.New("testset is missing input or answer path pattern")
+	}
+
+	groupIndex := make(map[string]int)
+	for _, g := range ts.Groups {
+		groupIndex[g.Name] = len(pkg.Groups)
+		points := int(math.Round(g.Points))
+		if g.PointsPolicy == "each-test" {
+			pkg.warnf("group %q scores each test separately; jjudge awards its points only when every test passes", g.Name)
+		}
+		pkg.Groups = append(pkg.Groups, Group{Name: g.Name, Points: points})
+	}
+
+	var testPoints float64
+	for i := 1; i <= count; i++ {
+		inName := fmt.Sprintf(ts.InputPathPattern, i)
+		ansName := fmt.Sprintf(ts.AnswerPathPattern, i)
+		input, ok := files[inName]
+		if !ok {
+			return fmt.Errorf("missing input file %s (generated tests must be included in the package)", inName)
+		}
+		answer, ok := files[ansName]
+		if !ok {
+			return fmt.Errorf("missing answer file %s", ansName)
+		}
+
+		var sample bool
+		var group string
+		if i <= len(ts.Tests) {
+			sample = ts.Tests[i-1].Sample
+			group = ts.Tests[i-1].Group
+			testPoints += ts.Tests[i-1].Points
+		}
+
+		idx, ok := groupIndex[group]
+		if !ok {
+			idx = len(pkg.Groups)
+			groupIndex[group] = idx
+			name := group
+			if name == "" {
+				name = ts.Name
+			}
+			pkg.Groups = append(pkg.Groups, Group{Name: name})
+		}
+		pkg.Groups[idx].Tests = append(pkg.Groups[idx].Tests, Test{Input: input, Output: answer, Sample: sample})
+	}
+
+	// Ungrouped packages may still score individual tests; fold those points
+	// into the single group so the total is preserved.
+	if len(ts.Groups) == 0 && len(pkg.Groups) == 1 && testPoints > 0 {
+		pkg.Groups[0].Points = int(math.Round(testPoints))
+		pkg.warnf("per-test points were merged into a single group worth %d points", pkg.Groups[0].Points)
+	}
+
+	// Drop declared groups that no test refers to.
+	nonEmpty := pkg.Groups[:0]
+	for _, g := range pkg.Groups {
+		if len(g.Tests) > 0 {
+			nonEmpty = append(nonEmpty, g)
+		}
+	}
+	pkg.Groups = nonEmpty
+	return nil
+}
@@ -0,0 +1,2 @@
+#include <cstdio>
+int main() { return 42; }
@@ -18,23 +18,36 @@ import (
 	"github.com/jjudge-oj/apiserver/config"
 	"github.com/jjudge-oj/apiserver/internal/db"
 	"github.com/jjudge-oj/apiserver/internal/handlers"
+	"github.com/jjudge-oj/apiserver/internal/metrics"
 	"github.com/jjudge-oj/apiserver/internal/mq"
 	"github.com/jjudge-oj/apiserver/internal/services"
 	"github.com/jjudge-oj/apiserver/internal/storage"
 	"github.com/jjudge-oj/apiserver/internal/store"
+	"github.com/jjudge-oj/apiserver/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"golang.org/x/crypto/bcrypt"
 )
 
 // Server wraps the HTTP server and router.
 type Server struct {
 	httpServer *http.Server
-	router     *chi.Mux
-	db         *sql.DB
-	mq         *mq.MQ
+	// metricsServer serves /metrics on the internal metrics port; nil when
+	// metrics are disabled.
+	metricsServer *http.Server
+	router        *chi.Mux
+	db            *sql.DB
+	mq            *mq.MQ
+
+	shutdownTracing func(context.Context) error
 }
 
 // New constructs a Server with basic middleware and defaults.
 func New(ctx context.Context, cfg *config.Config) (*Server, error) {
+	shutdownTracing, err := tracing.Setup(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("set up tracing: %w", err)
+	}
+
 	dbConn, err := db.Open(ctx, cfg.Database)
 	if err != nil {
 		return nil, err
@@ -43,6 +56,10 @@ func New(ctx context.Context, cfg *config.Config) (*Server, error) {
 	problemRepo := store.NewProblemRepository(dbConn)
 	userRepo := store.NewUserRepository(dbConn)
 	submissionRepo := store.NewSubmissionRepository(dbConn)
+	referenceSolutionRepo := store.NewReferenceSolutionRepository(dbConn)
+	runRepo := store.NewRunRepository(dbConn)
+	workerRepo := store.NewWorkerRepository(dbConn)
+	outboxRepo := store.NewOutboxRepository(dbConn)
 
 	storageClient, err := storage.NewStorageFromConfig(ctx, cfg)
 	if err != nil {
@@ -54,21 +71,25 @@ func New(ctx context.Context, cfg *config.Config) (*Server, error) {
 		return nil, err
 	}
 
-	mqClient, err := mq.NewRabbitMQClient(cfg.RabbitMQ)
+	mqWrapper, err := mq.NewMQFromConfig(ctx, cfg)
 	if err != nil {
 		_ = dbConn.Close()
 		return nil, err
 	}
-	mqWrapper := mq.New(mqClient)
 
 	contestRepo := store.NewContestRepository(dbConn)
 	blogRepo := store.NewBlogRepository(dbConn)
 
 	problemService := services.NewProblemService(problemRepo, storageClient)
 	userService := services.NewUserService(userRepo)
-	submissionService := services.NewSubmissionService(submissionRepo, storageClient, mqWrapper)
-	contestService := services.NewContestService(contestRepo, storageClient, mqWrapper)
+	outboxRelay := services.NewOutboxRelay(outboxRepo, mqWrapper)
+	submissionService := services.NewSubmissionService(submissionRepo, storageClient, outboxRelay)
+	contestService := services.NewContestService(contestRepo, storageClient, mqWrapper, outboxRelay)
 	blogService := services.NewBlogService(blogRepo)
+	referenceSolutionService := services.NewReferenceSolutionService(referenceSolutionRepo, problemRepo, mqWrapper)
+	runService := services.NewRunService(runRepo, mqWrapper)
+	workerService := services.NewWorkerService(workerRepo, mqWrapper,
+		time.Duration(cfg.Workers.OfflineAfterSeconds)*time.Second)
 
 	if err := ensureAdminUser(ctx, userService, cfg); err != nil {
 		_ = dbConn.Close()
@@ -88,18 +109,27 @@ func New(ctx context.Context, cfg *config.Config) (*Server, error) {
 	router.Use(
 		middleware.RequestID,
 		middleware.RealIP,
+		tracing.Middleware,
+		metrics.Middleware,
 		middleware.Recoverer,
 		middleware.Logger,
 		handlers.CORSMiddleware,
 		middleware.Timeout(60*time.Second),
 	)
-	router.Get("/healthz", handlers.Healthz)
+	router.Get("/healthz", handlers.Healthz(mqWrapper.Health))
 	router.Route("/problems", func(r chi.Router) {
-		handlers.ProblemRouter(r, problemService, userService, authMiddleware, optionalAuthMiddleware)
+		handlers.ProblemRouter(r, problemService, userService, referenceSolutionService, authMiddleware, optionalAuthMiddleware)
 	})
 	router.Route("/problems/{problemID}/submissions", func(r chi.Router) {
 		handlers.SubmissionRouter(r, submissionService, problemService, userService, authMiddleware)
 	})
+	router.Route("/problems/{problemID}/reference-solutions", func(r chi.Router) {
+		handlers.ReferenceSolutionRouter(r, referenceSolutionService, problemService, userService, authMiddleware)
+	})
+	router.Route("/run", func(r chi.Router) {
+		handlers.RunRouter(r, runService, problemService, userService,
+			cfg.Run.RateLimit, time.Duration(cfg.Run.RateWindowSeconds)*time.Second, authMiddleware)
+	})
 	router.Route("/auth", func(r chi.Router) {
 		handlers.AuthRouter(r, userService, jwtSecret)
 	})
@@ -120,7 +150,11 @@ func New(ctx context.Context, cfg *config.Config) (*Server, error) {
 	})
 
 	router.Route("/admin/approvals", func(r chi.Router) {
-		handlers.ApprovalRouter(r, problemService, contestService, userService, authMiddleware)
+		handlers.ApprovalRouter(r, problemService, contestService, userService, referenceSolutionService, authMiddleware)
+	})
+
+	router.Route("/admin/workers", func(r chi.Router) {
+		handlers.WorkerRouter(r, workerService, userService, authMiddleware)
 	})
 
 	router.Route("/manager", func(r chi.Router) {
@@ -177,6 +211,94 @@ func New(ctx context.Context, cfg *config.Config) (*Server, error) {
 		}
 	}()
 
+	// Start background result consumer for reference solutions
+	go func() {
+		const referenceResultQueue = "reference-solution-results"
+		err := mqWrapper.Subscribe(ctx, referenceResultQueue, func(ctx context.Context, msg mq.Message) error {
+			var rs types.ReferenceSolution
+			if err := json.Unmarshal(msg.Data, &rs); err != nil {
+				log.Printf("reference result consumer: bad message, discarding: %v", err)
+				return nil // ack — malformed, retrying won't help
+			}
+			if _, err := referenceSolutionService.UpdateResult(ctx, rs); err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					log.Printf("reference result consumer: solution %d revision %d is gone or outdated, discarding", rs.ID, rs.Revision)
+					return nil // ack — permanent, retrying won't help
+				}
+				log.Printf("reference result consumer: failed to update solution %d: %v", rs.ID, err)
+				return err // nack+requeue — potentially transient
+			}
+			log.Printf("reference result consumer: updated solution %d verdict=%s", rs.ID, rs.Verdict)
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("reference result consumer exited: %v", err)
+		}
+	}()
+
+	// Start background result consumer for custom invocations
+	go func() {
+		const runResultQueue = "run-results"
+		err := mqWrapper.Subscribe(ctx, runResultQueue, func(ctx context.Context, msg mq.Message) error {
+			var run types.Run
+			if err := json.Unmarshal(msg.Data, &run); err != nil {
+				log.Printf("run result consumer: bad message, discarding: %v", err)
+				return nil // ack — malformed, retrying won't help
+			}
+			if _, err := runService.UpdateResult(ctx, run); err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					log.Printf("run result consumer: run %d not found, discarding", run.ID)
+					return nil // ack — permanent, retrying won't help
+				}
+				if errors.Is(err, store.ErrInvalidData) {
+					log.Printf("run result consumer: run %d result rejected, discarding: %v", run.ID, err)
+					return nil // ack — permanent, retrying won't help
+				}
+				log.Printf("run result consumer: failed to update run %d: %v", run.ID, err)
+				return err // nack+requeue — potentially transient
+			}
+			log.Printf("run result consumer: updated run %d status=%s", run.ID, run.Status)
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("run result consumer exited: %v", err)
+		}
+	}()
+
+	// Start background consumer for worker heartbeats
+	go func() {
+		err := mqWrapper.Subscribe(ctx, services.WorkerHeartbeatQueue, func(ctx context.Context, msg mq.Message) error {
+			var worker types.Worker
+			if err := json.Unmarshal(msg.Data, &worker); err != nil || worker.ID == "" {
+				log.Printf("heartbeat consumer: bad message, discarding: %v", err)
+				return nil // ack — malformed, retrying won't help
+			}
+			if err := workerService.Heartbeat(ctx, worker); err != nil {
+				log.Printf("heartbeat consumer: failed to record worker %q: %v", worker.ID, err)
+				return err // nack+requeue — potentially transient
+			}
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("heartbeat consumer exited: %v", err)
+		}
+	}()
+
+	outboxPoll := time.Duration(cfg.Outbox.PollIntervalMilliseconds) * time.Millisecond
+	if outboxPoll <= 0 {
+		outboxPoll = time.Second
+	}
+	go outboxRelay.Run(ctx, outboxPoll)
+
+	if interval := cfg.Reaper.IntervalSeconds; interval > 0 {
+		reaper := services.NewReaper(submissionRepo, contestRepo, problemRepo, workerService, outboxRelay, services.ReaperConfig{
+			PendingTimeout: time.Duration(cfg.Reaper.PendingTimeoutSeconds) * time.Second,
+			JudgingTimeout: time.Duration(cfg.Reaper.JudgingTimeoutSeconds) * time.Second,
+			MaxRequeues:    cfg.Reaper.MaxRequeues,
+		})
+		go reaper.Run(ctx, time.Duration(interval)*time.Second)
+	}
+
 	port := cfg.ServerPort
 	if port == 0 {
 		port = 8080
@@ -190,11 +312,25 @@ func New(ctx context.Context, cfg *config.Config) (*Server, error) {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	var metricsServer *http.Server
+	if cfg.MetricsPort > 0 {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", promhttp.Handler())
+		metricsServer = &http.Server{
+			Addr:        fmt.Sprintf(":%d", cfg.MetricsPort),
+			Handler:     metricsMux,
+			ReadTimeout: 15 * time.Second,
+		}
+	}
+
 	return &Server{
-		httpServer: httpServer,
-		router:     router,
-		db:         dbConn,
-		mq:         mqWrapper,
+		httpServer:    httpServer,
+		metricsServer: metricsServer,
+		router:        router,
+		db:            dbConn,
+		mq:            mqWrapper,
+
+		shutdownTracing: shutdownTracing,
 	}, nil
 }
 
@@ -203,8 +339,15 @@ func (s *Server) Router() *chi.Mux {
 	return s.router
 }
 
-// Start runs the HTTP server.
+// Start runs the HTTP server, and the metrics server in the background.
 func (s *Server) Start() error {
+	if s.metricsServer != nil {
+		go func() {
+			if err := s.metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("metrics server exited: %v", err)
+			}
+		}()
+	}
 	return s.httpServer.ListenAndServe()
 }
 
@@ -216,6 +359,14 @@ func (s *Server) Shutdown() error {
 	if s.mq != nil {
 		_ = s.mq.Close()
 	}
+	if s.shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = s.shutdownTracing(ctx)
+	}
+	if s.metricsServer != nil {
+		_ = s.metricsServer.Close()
+	}
 	return s.httpServer.Close()
 }
 
@@ -43,6 +43,7 @@ type ContestRepository interface {
 	ListRegistrations(ctx context.Context, contestID int) ([]types.ContestRegistration, error)
 
 	CreateContestSubmission(ctx context.Context, cs types.ContestSubmission) (types.ContestSubmission, error)
+	CreateContestSubmissionWithOutbox(ctx context.Context, cs types.ContestSubmission, outputsKey string, enqueue func(types.ContestSubmission) (store.OutboxMessage, error)) (types.ContestSubmission, error)
 	GetContestSubmission(ctx context.Context, id int64) (types.ContestSubmission, error)
 	UpdateContestSubmission(ctx context.Context, cs types.ContestSubmission) (types.ContestSubmission, error)
 	ListContestSubmissions(ctx context.Context, contestID, problemID, userID int) ([]types.ContestSubmission, error)
@@ -50,6 +51,7 @@ type ContestRepository interface {
 
 	GetLeaderboardRows(ctx context.Context, contestID int) ([]store.LeaderboardRow, error)
 	ListSubmissionsForContestProblem(ctx context.Context, contestID, problemID int) ([]types.ContestSubmission, error)
+	ContestSubmissionOutputsKey(ctx context.Context, id int64) (string, error)
 }
 
 const contestSubmissionQueue = "contest-submissions"
@@ -59,10 +61,11 @@ type ContestService struct {
 	repo    ContestRepository
 	storage *storage.Storage
 	mq      *mq.MQ
+	outbox  *OutboxRelay
 }
 
-func NewContestService(repo ContestRepository, storageClient *storage.Storage, mqClient *mq.MQ) *ContestService {
-	return &ContestService{repo: repo, storage: storageClient, mq: mqClient}
+func NewContestService(repo ContestRepository, storageClient *storage.Storage, mqClient *mq.MQ, outbox *OutboxRelay) *ContestService {
+	return &ContestService{repo: repo, storage: storageClient, mq: mqClient, outbox: outbox}
 }
 
 // ---------- Contest CRUD ----------
@@ -157,25 +160,49 @@ func (s *ContestService) UpdateContestSubmission(ctx context.Context, cs types.C
 	return s.repo.UpdateContestSubmission(ctx, cs)
 }
 
-// CreateAndEnqueueContestSubmission validates eligibility, persists the submission, uploads the
-// source artifact, and publishes a job to the contest-submissions queue.
+// CreateAndEnqueueContestSubmission validates eligibility, uploads the source artifact, then
+// persists the submission and queues a job for the contest-submissions queue through the outbox,
+// in one transaction. outputs carries the output archive for output-only problems and must be nil
+// otherwise.
 func (s *ContestService) CreateAndEnqueueContestSubmission(
 	ctx context.Context,
 	cs types.ContestSubmission,
 	problem types.Problem,
 	contest types.Contest,
+	outputs []byte,
 ) (types.ContestSubmission, string, error) {
 	if s.storage == nil {
 		return types.ContestSubmission{}, "", errors.New("object storage is not configured")
 	}
-	if s.mq == nil {
-		return types.ContestSubmission{}, "", errors.New("message queue is not configured")
+	if problem.IsOutputOnly() != (outputs != nil) {
+		return types.ContestSubmission{}, "", ErrOutputsRequired
+	}
+	if problem.IsOutputOnly() {
+		manifest, err := outputArchiveManifest(problem, outputs)
+		if err != nil {
+			return types.ContestSubmission{}, "", err
+		}
+		cs.Code = manifest
+		cs.Language = types.LanguageOutputOnly
+		cs.Files = nil
+	} else if len(cs.Files) > 0 {
+		code, err := combineSourceFiles(cs.Files, problem.GraderFilesFor(cs.Language))
+		if err != nil {
+			return types.ContestSubmission{}, "", err
+		}
+		cs.Code = code
 	}
 
 	cs.Code = strings.TrimSpace(cs.Code)
 	if cs.Code == "" {
 		return types.ContestSubmission{}, "", errors.New("source code is required")
 	}
+	if cs.SampleOnly {
+		problem = problem.SampleTestcases()
+		if len(problem.TestcaseGroups) == 0 {
+			return types.ContestSubmission{}, "", ErrNoSampleTestcases
+		}
+	}
 
 	// Check registration
 	registered, err := s.repo.IsRegistered(ctx, cs.ContestID, cs.UserID)
@@ -192,39 +219,46 @@ func (s *ContestService) CreateAndEnqueueContestSubmission(
 		return types.ContestSubmission{}, "", ErrContestNotActive
 	}
 
-	created, err := s.repo.CreateContestSubmission(ctx, cs)
-	if err != nil {
-		return types.ContestSubmission{}, "", err
+	// As in SubmissionService.CreateAndEnqueue, the artifact is uploaded
+	// under a content key before the transaction.
+	var artifactKey, outputsKey string
+	if outputs != nil {
+		artifactKey, err = s.uploadContestOutputs(ctx, outputs)
+		outputsKey = artifactKey
+	} else {
+		artifactKey, err = s.uploadContestSource(ctx, cs)
 	}
-
-	artifactKey, err := s.uploadContestSource(ctx, created)
 	if err != nil {
-		_ = s.repo.DeleteContestSubmission(ctx, created.ID)
 		return types.ContestSubmission{}, "", err
 	}
 
-	job := types.ContestSubmissionJob{
-		ContestSubmission: created,
-		Problem:           problem,
-	}
-	payload, err := json.Marshal(job)
-	if err != nil {
-		_ = s.storage.Delete(ctx, artifactKey)
-		_ = s.repo.DeleteContestSubmission(ctx, created.ID)
-		return types.ContestSubmission{}, "", err
-	}
+	created, err := s.repo.CreateContestSubmissionWithOutbox(ctx, cs, outputsKey, func(created types.ContestSubmission) (store.OutboxMessage, error) {
+		job := types.ContestSubmissionJob{
+			ContestSubmission: created,
+			Problem:           problem,
+			OutputsKey:        outputsKey,
+		}
+		payload, err := json.Marshal(job)
+		if err != nil {
+			return store.OutboxMessage{}, err
+		}
 
-	attrs := map[string]string{
-		"contest_submission_id": strconv.FormatInt(created.ID, 10),
-		"contest_id":            strconv.Itoa(created.ContestID),
-		"problem_id":            strconv.Itoa(created.ProblemID),
-		"user_id":               strconv.Itoa(created.UserID),
-	}
-	if _, err := s.mq.Publish(ctx, contestSubmissionQueue, payload, attrs); err != nil {
-		_ = s.storage.Delete(ctx, artifactKey)
-		_ = s.repo.DeleteContestSubmission(ctx, created.ID)
+		attrs := map[string]string{
+			"contest_submission_id": strconv.FormatInt(created.ID, 10),
+			"contest_id":            strconv.Itoa(created.ContestID),
+			"problem_id":            strconv.Itoa(created.ProblemID),
+			"user_id":               strconv.Itoa(created.UserID),
+		}
+		return store.OutboxMessage{
+			Queue:      contestSubmissionQueue,
+			Payload:    payload,
+			Attributes: mq.InjectTraceContext(ctx, attrs),
+		}, nil
+	})
+	if err != nil {
 		return types.ContestSubmission{}, "", err
 	}
+	s.outbox.Wake()
 
 	return created, artifactKey, nil
 }
@@ -235,6 +269,7 @@ func (s *ContestService) RejudgeContestProblem(ctx context.Context, contestID, p
 	if err != nil {
 		return err
 	}
+	samples := problem.SampleTestcases()
 
 	for _, sub := range submissions {
 		sub.Verdict = types.VerdictPending
@@ -255,6 +290,16 @@ func (s *ContestService) RejudgeContestProblem(ctx context.Context, contestID, p
 			ContestSubmission: updated,
 			Problem:           problem,
 		}
+		if updated.SampleOnly {
+			job.Problem = samples
+		}
+		if problem.IsOutputOnly() {
+			key, err := s.repo.ContestSubmissionOutputsKey(ctx, updated.ID)
+			if err != nil {
+				return fmt.Errorf("look up outputs of submission %d: %w", updated.ID, err)
+			}
+			job.OutputsKey = storedOutputsKey("contest-submissions", key, updated.ID)
+		}
 		payload, err := json.Marshal(job)
 		if err != nil {
 			return err
@@ -379,7 +424,7 @@ func (s *ContestService) uploadContestSource(ctx context.Context, cs types.Conte
 	codeBytes := []byte(cs.Code)
 	hash := sha256.Sum256(codeBytes)
 	digest := hex.EncodeToString(hash[:])
-	objectKey := fmt.Sprintf("contest-submissions/%d/source-%s.txt", cs.ID, digest)
+	objectKey := fmt.Sprintf("contest-submissions/sources/%s.txt", digest)
 
 	if err := s.storage.Put(ctx, objectKey, bytes.NewReader(codeBytes), int64(len(codeBytes)), "text/plain; charset=utf-8"); err != nil {
 		return "", fmt.Errorf("failed to upload contest submission source: %w", err)
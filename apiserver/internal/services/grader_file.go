@@ -0,0 +1,133 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jjudge-oj/api/types"
+)
+
+const (
+	// maxSourceFiles bounds the files of a multi-file submission and the
+	// grader files of one language.
+	maxSourceFiles = 32
+	maxFileName    = 128
+)
+
+// ErrInvalidSourceFiles is returned for grader files or multi-file
+// submissions with bad, duplicate or clashing file names.
+var ErrInvalidSourceFiles = errors.New("invalid source files")
+
+// ValidFileName reports whether name can be used as-is for a file in the
+// judge's work directory.
+func ValidFileName(name string) bool {
+	if name == "" || len(name) > maxFileName || strings.HasPrefix(name, ".") {
+		return false
+	}
+	return !strings.ContainsAny(name, "/\\\x00")
+}
+
+func validLanguage(language string) bool {
+	if language == "" || len(language) > 32 {
+		return false
+	}
+	for _, c := range language {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '+') {
+			return false
+		}
+	}
+	return true
+}
+
+// ListGraderFiles returns the grader files of a problem for every language.
+func (s *ProblemService) ListGraderFiles(ctx context.Context, problemID int) ([]types.GraderFile, error) {
+	if _, err := s.repo.Get(ctx, problemID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListGraderFiles(ctx, problemID)
+}
+
+// SetGraderFiles uploads files, keyed by name, as the grader files of a
+// problem for language and replaces any previous ones. Keys embed the
+// content digest so workers never reuse a stale cached copy. Passing no
+// files removes the grader for that language.
+func (s *ProblemService) SetGraderFiles(ctx context.Context, problemID int, language string, files map[string][]byte) ([]types.GraderFile, error) {
+	if s.storage == nil {
+		return nil, errors.New("object storage is not configured")
+	}
+	if !validLanguage(language) {
+		return nil, fmt.Errorf("%w: invalid language %q", ErrInvalidSourceFiles, language)
+	}
+	if len(files) > maxSourceFiles {
+		return nil, fmt.Errorf("%w: at most %d files per language", ErrInvalidSourceFiles, maxSourceFiles)
+	}
+	if _, err := s.repo.Get(ctx, problemID); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if !ValidFileName(name) {
+			return nil, fmt.Errorf("%w: invalid file name %q", ErrInvalidSourceFiles, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	graderFiles := make([]types.GraderFile, 0, len(names))
+	for _, name := range names {
+		data := files[name]
+		sum := sha256.Sum256(data)
+		key := fmt.Sprintf("graders/%d/%s/%s/%s", problemID, language, hex.EncodeToString(sum[:]), name)
+		if err := s.storage.Put(ctx, key, bytes.NewReader(data), int64(len(data)), "text/plain; charset=utf-8"); err != nil {
+			return nil, fmt.Errorf("failed to upload grader file %s: %w", name, err)
+		}
+		graderFiles = append(graderFiles, types.GraderFile{Language: language, Name: name, Key: key})
+	}
+
+	if err := s.repo.ReplaceGraderFiles(ctx, problemID, language, graderFiles); err != nil {
+		return nil, err
+	}
+	return graderFiles, nil
+}
+
+// combineSourceFiles validates the files of a multi-file submission against
+// the grader files of its language and returns the combined view stored as
+// the submission's code.
+func combineSourceFiles(files []types.SourceFile, graderFiles []types.GraderFile) (string, error) {
+	if len(files) > maxSourceFiles {
+		return "", fmt.Errorf("%w: at most %d files per submission", ErrInvalidSourceFiles, maxSourceFiles)
+	}
+
+	reserved := make(map[string]struct{}, len(graderFiles))
+	for _, f := range graderFiles {
+		reserved[f.Name] = struct{}{}
+	}
+
+	seen := make(map[string]struct{}, len(files))
+	var b strings.Builder
+	for i, f := range files {
+		if !ValidFileName(f.Name) {
+			return "", fmt.Errorf("%w: invalid file name %q", ErrInvalidSourceFiles, f.Name)
+		}
+		if _, dup := seen[f.Name]; dup {
+			return "", fmt.Errorf("%w: duplicate file %q", ErrInvalidSourceFiles, f.Name)
+		}
+		if _, clash := reserved[f.Name]; clash {
+			return "", fmt.Errorf("%w: %q is provided by the problem's grader", ErrInvalidSourceFiles, f.Name)
+		}
+		seen[f.Name] = struct{}{}
+
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "==> %s <==\n%s", f.Name, f.Content)
+	}
+	return b.String(), nil
+}
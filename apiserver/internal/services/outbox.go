@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jjudge-oj/apiserver/internal/mq"
+	"github.com/jjudge-oj/apiserver/internal/store"
+)
+
+const (
+	// outboxBatch is the most messages claimed at once.
+	outboxBatch = 100
+
+	// outboxLease is how long a claimed message is hidden from other
+	// relays; it must exceed the time a batch takes to publish.
+	outboxLease = time.Minute
+
+	// outboxMaxBackoff caps the delay between attempts to publish a
+	// message.
+	outboxMaxBackoff = 5 * time.Minute
+)
+
+// OutboxRepository defines persistence operations for the outbox.
+type OutboxRepository interface {
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]store.OutboxMessage, error)
+	Delete(ctx context.Context, id int64) error
+	Retry(ctx context.Context, id int64, at time.Time, lastError string) error
+}
+
+// OutboxRelay publishes messages from the outbox. Messages are written to
+// the outbox in the same transaction as the records they concern, so a job
+// is queued exactly when its submission is stored, even if the message
+// queue is down or the API server crashes in between. Delivery is at least
+// once: a relay that crashes after publishing publishes again.
+type OutboxRelay struct {
+	repo OutboxRepository
+	mq   *mq.MQ
+	wake chan struct{}
+}
+
+func NewOutboxRelay(repo OutboxRepository, mqClient *mq.MQ) *OutboxRelay {
+	return &OutboxRelay{repo: repo, mq: mqClient, wake: make(chan struct{}, 1)}
+}
+
+// Wake makes the relay publish now rather than at its next poll. Call it
+// after committing outbox messages. A nil relay ignores it.
+func (r *OutboxRelay) Wake() {
+	if r == nil {
+		return
+	}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run publishes outbox messages whenever woken and at least every interval,
+// until ctx is done. Several API server replicas may run it at once.
+func (r *OutboxRelay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := r.Flush(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("outbox relay: %v", err)
+			}
+			// A full batch suggests more are due.
+			if err != nil || n < outboxBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Flush publishes one batch of due messages and returns how many it
+// claimed. It stops at the first message that fails to publish, which is
+// retried with exponential backoff.
+func (r *OutboxRelay) Flush(ctx context.Context) (int, error) {
+	if r.mq == nil {
+		return 0, errors.New("message queue is not configured")
+	}
+	messages, err := r.repo.Claim(ctx, outboxBatch, outboxLease)
+	if err != nil {
+		return 0, err
+	}
+	for _, msg := range messages {
+		pubCtx := mq.ExtractTraceContext(ctx, msg.Attributes)
+		if _, err := r.mq.Publish(pubCtx, msg.Queue, msg.Payload, msg.Attributes); err != nil {
+			if ctx.Err() != nil {
+				return len(messages), ctx.Err()
+			}
+			delay := outboxBackoff(msg.Attempts)
+			if err := r.repo.Retry(ctx, msg.ID, time.Now().Add(delay), err.Error()); err != nil {
+				log.Printf("outbox relay: reschedule message %d: %v", msg.ID, err)
+			}
+			// The broker is likely down; the rest of the batch is claimed
+			// again when its lease expires rather than each waiting out
+			// the publish timeout.
+			return len(messages), fmt.Errorf("publish message %d to %q (attempt %d), retrying in %s: %w",
+				msg.ID, msg.Queue, msg.Attempts, delay, err)
+		}
+		if err := r.repo.Delete(ctx, msg.ID); err != nil {
+			// Published again once the lease expires.
+			log.Printf("outbox relay: delete published message %d: %v", msg.ID, err)
+		}
+	}
+	return len(messages), nil
+}
+
+// outboxBackoff returns the delay before the next attempt after attempts
+// failed ones: one second, doubling up to outboxMaxBackoff.
+func outboxBackoff(attempts int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempts && delay < outboxMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, outboxMaxBackoff)
+}
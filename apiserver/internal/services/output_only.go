@@ -0,0 +1,117 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jjudge-oj/api/types"
+)
+
+// ErrInvalidOutputArchive is returned when the outputs uploaded for an
+// output-only problem are not a ZIP of <subtask>_<testcase>.out files.
+var ErrInvalidOutputArchive = errors.New("invalid output archive")
+
+// ErrOutputsRequired is returned when an output-only problem receives source
+// code, or a batch problem receives an output archive.
+var ErrOutputsRequired = errors.New("output-only problems accept output archives only")
+
+// maxOutputsUncompressedBytes bounds the total size of the files in an
+// output archive once decompressed, so a small archive of highly
+// compressible outputs cannot make graders decompress gigabytes.
+const maxOutputsUncompressedBytes = 256 << 20
+
+// outputArchiveManifest validates an archive of outputs against the test
+// cases of problem and returns a listing of its files. The listing is stored
+// as the submission's code. Test cases without a file are judged as wrong
+// answers by the worker, so a partial archive is accepted.
+func outputArchiveManifest(problem types.Problem, data []byte) (string, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidOutputArchive, err)
+	}
+
+	known := make(map[string]struct{})
+	for _, group := range problem.TestcaseGroups {
+		for _, tc := range group.Testcases {
+			known[fmt.Sprintf("%d_%d", group.Ordinal, tc.Ordinal)] = struct{}{}
+		}
+	}
+
+	seen := make(map[string]struct{})
+	var (
+		lines []string
+		total uint64
+	)
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := path.Base(f.Name)
+		subtask, testcase, ext, ok := parseTestcaseFilename(name)
+		if !ok || ext != "out" {
+			return "", fmt.Errorf("%w: unexpected file %q (expected <subtask>_<testcase>.out)", ErrInvalidOutputArchive, name)
+		}
+		id := fmt.Sprintf("%d_%d", subtask, testcase)
+		if _, ok := known[id]; !ok {
+			return "", fmt.Errorf("%w: no testcase %s", ErrInvalidOutputArchive, id)
+		}
+		if _, dup := seen[id]; dup {
+			return "", fmt.Errorf("%w: duplicate output for testcase %s", ErrInvalidOutputArchive, id)
+		}
+		seen[id] = struct{}{}
+		total += f.UncompressedSize64
+		if total > maxOutputsUncompressedBytes {
+			return "", fmt.Errorf("%w: outputs exceed %d bytes uncompressed", ErrInvalidOutputArchive, maxOutputsUncompressedBytes)
+		}
+		lines = append(lines, fmt.Sprintf("%s.out (%d bytes)", id, f.UncompressedSize64))
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("%w: archive contains no output files", ErrInvalidOutputArchive)
+	}
+
+	sort.Strings(lines)
+	return strings.Join(lines, "\n"), nil
+}
+
+// outputsKey returns the object storage key of an output archive with the
+// given SHA-256 digest. prefix is "submissions" or "contest-submissions".
+// The key depends only on the content, so the archive is uploaded before the
+// submission is stored and identical uploads share one object.
+func outputsKey(prefix, digest string) string {
+	return fmt.Sprintf("%s/outputs/%s.zip", prefix, digest)
+}
+
+// storedOutputsKey returns key, the outputs key stored with submission id, or
+// the key its archive was uploaded under before keys were stored.
+func storedOutputsKey(prefix, key string, id int64) string {
+	if key != "" {
+		return key
+	}
+	return fmt.Sprintf("%s/%d/outputs.zip", prefix, id)
+}
+
+func (s *SubmissionService) uploadOutputs(ctx context.Context, data []byte) (string, error) {
+	hash := sha256.Sum256(data)
+	objectKey := outputsKey("submissions", hex.EncodeToString(hash[:]))
+	if err := s.storage.Put(ctx, objectKey, bytes.NewReader(data), int64(len(data)), "application/zip"); err != nil {
+		return "", fmt.Errorf("failed to upload submission outputs: %w", err)
+	}
+	return objectKey, nil
+}
+
+func (s *ContestService) uploadContestOutputs(ctx context.Context, data []byte) (string, error) {
+	hash := sha256.Sum256(data)
+	objectKey := outputsKey("contest-submissions", hex.EncodeToString(hash[:]))
+	if err := s.storage.Put(ctx, objectKey, bytes.NewReader(data), int64(len(data)), "application/zip"); err != nil {
+		return "", fmt.Errorf("failed to upload contest submission outputs: %w", err)
+	}
+	return objectKey, nil
+}
@@ -18,6 +18,8 @@ type ProblemRepository interface {
 	Update(ctx context.Context, problem types.Problem) (types.Problem, error)
 	Delete(ctx context.Context, id int) error
 	SaveTestcaseGroups(ctx context.Context, problemID int, groups []types.TestcaseGroup) error
+	ListGraderFiles(ctx context.Context, problemID int) ([]types.GraderFile, error)
+	ReplaceGraderFiles(ctx context.Context, problemID int, language string, files []types.GraderFile) error
 	Approve(ctx context.Context, id int) error
 	Reject(ctx context.Context, id int) error
 }
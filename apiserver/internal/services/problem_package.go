@@ -0,0 +1,151 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/problempkg"
+)
+
+// ImportPackage creates a problem from a parsed problem package. problem holds
+// the metadata to persist (usually pkg.Problem with caller overrides applied);
+// the testcase groups and data come from pkg. The problem is removed again if
+// its testcases cannot be stored.
+func (s *ProblemService) ImportPackage(ctx context.Context, pkg *problempkg.Package, problem types.Problem) (types.Problem, error) {
+	if s.storage == nil {
+		return types.Problem{}, errors.New("object storage is not configured")
+	}
+
+	created, err := s.repo.Create(ctx, problem)
+	if err != nil {
+		return types.Problem{}, err
+	}
+
+	groups, err := s.uploadPackageTestcases(ctx, created.ID, pkg)
+	if err != nil {
+		_ = s.repo.Delete(ctx, created.ID)
+		return types.Problem{}, err
+	}
+	if err := s.repo.SaveTestcaseGroups(ctx, created.ID, groups); err != nil {
+		_ = s.repo.Delete(ctx, created.ID)
+		return types.Problem{}, err
+	}
+	graderFiles, err := s.savePackageGraderFiles(ctx, created.ID, pkg)
+	if err != nil {
+		_ = s.repo.Delete(ctx, created.ID)
+		return types.Problem{}, err
+	}
+
+	created.TestcaseGroups = groups
+	created.GraderFiles = graderFiles
+	return created, nil
+}
+
+// savePackageGraderFiles stores the grader files of pkg, one language at a
+// time in the order they first appear.
+func (s *ProblemService) savePackageGraderFiles(ctx context.Context, problemID int, pkg *problempkg.Package) ([]types.GraderFile, error) {
+	byLanguage := make(map[string]map[string][]byte)
+	languages := make([]string, 0)
+	for _, f := range pkg.GraderFiles {
+		files, ok := byLanguage[f.Language]
+		if !ok {
+			files = make(map[string][]byte)
+			byLanguage[f.Language] = files
+			languages = append(languages, f.Language)
+		}
+		if _, dup := files[f.Name]; dup {
+			return nil, fmt.Errorf("%w: duplicate grader file %q", ErrInvalidSourceFiles, f.Name)
+		}
+		files[f.Name] = f.Data
+	}
+
+	var saved []types.GraderFile
+	for _, language := range languages {
+		files, err := s.SetGraderFiles(ctx, problemID, language, byLanguage[language])
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, files...)
+	}
+	return saved, nil
+}
+
+func (s *ProblemService) uploadPackageTestcases(ctx context.Context, problemID int, pkg *problempkg.Package) ([]types.TestcaseGroup, error) {
+	groups := pkg.TestcaseGroups()
+	for gi, group := range pkg.Groups {
+		for ti, test := range group.Tests {
+			inKey := fmt.Sprintf("testcases/%d/%d_%d_%d.in", problemID, problemID, gi, ti)
+			outKey := fmt.Sprintf("testcases/%d/%d_%d_%d.out", problemID, problemID, gi, ti)
+
+			if err := s.storage.Put(ctx, inKey, bytes.NewReader(test.Input), int64(len(test.Input)), "application/octet-stream"); err != nil {
+				return nil, fmt.Errorf("failed to upload %s: %w", inKey, err)
+			}
+			if err := s.storage.Put(ctx, outKey, bytes.NewReader(test.Output), int64(len(test.Output)), "application/octet-stream"); err != nil {
+				return nil, fmt.Errorf("failed to upload %s: %w", outKey, err)
+			}
+
+			tc := &groups[gi].Testcases[ti]
+			tc.InKey = inKey
+			tc.OutKey = outKey
+			tc.Hash = computeTestcaseHash(test.Input, test.Output)
+		}
+	}
+	return groups, nil
+}
+
+// ExportPackage builds a self-contained jjudge package for a problem,
+// including its statement, limits, groups, testcase data and grader files.
+func (s *ProblemService) ExportPackage(ctx context.Context, id int) ([]byte, error) {
+	if s.storage == nil {
+		return nil, errors.New("object storage is not configured")
+	}
+
+	problem, err := s.repo.GetWithTestcases(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &problempkg.Package{Format: problempkg.FormatJJudge, Problem: problem}
+	for _, group := range problem.TestcaseGroups {
+		g := problempkg.Group{Name: group.Name, Points: group.Points}
+		for _, tc := range group.Testcases {
+			input, err := s.readObject(ctx, tc.InKey)
+			if err != nil {
+				return nil, err
+			}
+			output, err := s.readObject(ctx, tc.OutKey)
+			if err != nil {
+				return nil, err
+			}
+			g.Tests = append(g.Tests, problempkg.Test{Input: input, Output: output, Sample: !tc.IsHidden})
+		}
+		pkg.Groups = append(pkg.Groups, g)
+	}
+	for _, f := range problem.GraderFiles {
+		data, err := s.readObject(ctx, f.Key)
+		if err != nil {
+			return nil, err
+		}
+		pkg.GraderFiles = append(pkg.GraderFiles, problempkg.GraderFile{Language: f.Language, Name: f.Name, Data: data})
+	}
+
+	return problempkg.Export(pkg)
+}
+
+func (s *ProblemService) readObject(ctx context.Context, key string) ([]byte, error) {
+	rc, err := s.storage.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", key, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", key, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/metrics"
+	"github.com/jjudge-oj/apiserver/internal/mq"
+	"github.com/jjudge-oj/apiserver/internal/store"
+)
+
+// reapBatch is the most submissions of each kind handled per sweep.
+const reapBatch = 100
+
+// StaleSubmissionRepository finds and recovers stuck submissions.
+type StaleSubmissionRepository interface {
+	ListStale(ctx context.Context, pendingBefore, judgingBefore time.Time, limit int) ([]store.StaleSubmission, error)
+	RequeueWithOutbox(ctx context.Context, submission types.Submission, enqueue func(types.Submission) (store.OutboxMessage, error)) (types.Submission, bool, error)
+	FailStale(ctx context.Context, submission types.Submission, message string) (bool, error)
+}
+
+// StaleContestSubmissionRepository finds and recovers stuck contest
+// submissions.
+type StaleContestSubmissionRepository interface {
+	ListStaleContestSubmissions(ctx context.Context, pendingBefore, judgingBefore time.Time, limit int) ([]store.StaleContestSubmission, error)
+	RequeueContestSubmissionWithOutbox(ctx context.Context, cs types.ContestSubmission, enqueue func(types.ContestSubmission) (store.OutboxMessage, error)) (types.ContestSubmission, bool, error)
+	FailStaleContestSubmission(ctx context.Context, cs types.ContestSubmission, message string) (bool, error)
+}
+
+// ReaperConfig controls when the reaper considers a submission stuck.
+type ReaperConfig struct {
+	// PendingTimeout is how long a submission may wait in PENDING. It must
+	// exceed the longest a job waits in the queue, or queued jobs are
+	// enqueued twice.
+	PendingTimeout time.Duration
+
+	// JudgingTimeout is how long a submission may stay in JUDGING without
+	// a worker holding it in its heartbeats.
+	JudgingTimeout time.Duration
+
+	// MaxRequeues is how often a stuck submission is re-enqueued before it
+	// is given up with INTERNAL_ERROR.
+	MaxRequeues int
+}
+
+// Reaper recovers submissions and contest submissions stuck in PENDING or
+// JUDGING, e.g. because the worker judging them crashed or their job was
+// lost. A submission listed in the heartbeat of a live worker holds a lease
+// and is never reaped. PENDING submissions are only reaped while a worker
+// consuming their queue has a free slot; otherwise they may simply be
+// waiting behind a backlog. Jobs are enqueued again through the outbox.
+type Reaper struct {
+	submissions StaleSubmissionRepository
+	contests    StaleContestSubmissionRepository
+	problems    ProblemRepository
+	workers     *WorkerService
+	outbox      *OutboxRelay
+	cfg         ReaperConfig
+}
+
+func NewReaper(
+	submissions StaleSubmissionRepository,
+	contests StaleContestSubmissionRepository,
+	problems ProblemRepository,
+	workers *WorkerService,
+	outbox *OutboxRelay,
+	cfg ReaperConfig,
+) *Reaper {
+	return &Reaper{
+		submissions: submissions,
+		contests:    contests,
+		problems:    problems,
+		workers:     workers,
+		outbox:      outbox,
+		cfg:         cfg,
+	}
+}
+
+// Run sweeps every interval until ctx is done. Several API server replicas
+// may run it at once; each stuck submission is handled by one of them.
+func (r *Reaper) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := r.Sweep(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("reaper: sweep failed: %v", err)
+		}
+	}
+}
+
+// Sweep re-enqueues stuck submissions, or fails those that were re-enqueued
+// MaxRequeues times already.
+func (r *Reaper) Sweep(ctx context.Context) error {
+	fleet, err := r.workers.fleetState(ctx)
+	if err != nil {
+		return fmt.Errorf("list worker leases: %w", err)
+	}
+	now := time.Now()
+	judgingBefore := now.Add(-r.cfg.JudgingTimeout)
+	problems := map[int]types.Problem{}
+
+	stale, err := r.submissions.ListStale(ctx, r.pendingBefore(now, fleet, submissionQueue), judgingBefore, reapBatch)
+	if err != nil {
+		return fmt.Errorf("list stale submissions: %w", err)
+	}
+	for _, s := range stale {
+		if fleet.leased[jobRef{kind: types.WorkerJobSubmission, id: int64(s.Submission.ID)}] {
+			continue
+		}
+		if err := r.reapSubmission(ctx, s, problems); err != nil {
+			log.Printf("reaper: submission %d: %v", s.Submission.ID, err)
+		}
+	}
+
+	staleContest, err := r.contests.ListStaleContestSubmissions(ctx, r.pendingBefore(now, fleet, contestSubmissionQueue), judgingBefore, reapBatch)
+	if err != nil {
+		return fmt.Errorf("list stale contest submissions: %w", err)
+	}
+	for _, s := range staleContest {
+		if fleet.leased[jobRef{kind: types.WorkerJobContestSubmission, id: s.Submission.ID}] {
+			continue
+		}
+		if err := r.reapContestSubmission(ctx, s, problems); err != nil {
+			log.Printf("reaper: contest submission %d: %v", s.Submission.ID, err)
+		}
+	}
+	// Publish the requeued jobs now rather than at the relay's next poll.
+	r.outbox.Wake()
+	return nil
+}
+
+// pendingBefore returns the time before which a submission PENDING on queue
+// counts as stuck. While no running worker consuming queue has a free slot,
+// the queue may be backed up and the zero time is returned, so no PENDING
+// submission is listed.
+func (r *Reaper) pendingBefore(now time.Time, fleet fleetState, queue string) time.Time {
+	if !fleet.idleQueues[queue] {
+		return time.Time{}
+	}
+	return now.Add(-r.cfg.PendingTimeout)
+}
+
+func (r *Reaper) reapSubmission(ctx context.Context, s store.StaleSubmission, problems map[int]types.Problem) error {
+	sub := s.Submission
+	if s.Requeues >= r.cfg.MaxRequeues {
+		return r.failSubmission(ctx, sub, r.giveUpMessage(sub.Verdict, s.Requeues))
+	}
+	problem, err := r.problem(ctx, sub.ProblemID, problems)
+	if errors.Is(err, store.ErrNotFound) {
+		return r.failSubmission(ctx, sub, "Judging could not be retried: the problem no longer exists.")
+	}
+	if err != nil {
+		return err
+	}
+
+	_, ok, err := r.submissions.RequeueWithOutbox(ctx, sub, func(requeued types.Submission) (store.OutboxMessage, error) {
+		job := types.SubmissionJob{
+			Submission: requeued,
+			Problem:    problem,
+		}
+		if requeued.SampleOnly {
+			job.Problem = problem.SampleTestcases()
+		}
+		if problem.IsOutputOnly() {
+			job.OutputsKey = storedOutputsKey("submissions", s.OutputsKey, int64(requeued.ID))
+		}
+		payload, err := json.Marshal(job)
+		if err != nil {
+			return store.OutboxMessage{}, err
+		}
+		attrs := map[string]string{
+			"submission_id": strconv.Itoa(requeued.ID),
+			"problem_id":    strconv.Itoa(requeued.ProblemID),
+			"user_id":       strconv.Itoa(requeued.UserID),
+		}
+		return store.OutboxMessage{
+			Queue:      submissionQueue,
+			Payload:    payload,
+			Attributes: mq.InjectTraceContext(ctx, attrs),
+		}, nil
+	})
+	if err != nil || !ok {
+		return err
+	}
+	metrics.ReapedSubmissions.WithLabelValues(string(types.WorkerJobSubmission), "requeued").Inc()
+	log.Printf("reaper: re-enqueued submission %d stuck in %s (requeue %d of %d)",
+		sub.ID, sub.Verdict, s.Requeues+1, r.cfg.MaxRequeues)
+	return nil
+}
+
+func (r *Reaper) failSubmission(ctx context.Context, sub types.Submission, message string) error {
+	ok, err := r.submissions.FailStale(ctx, sub, message)
+	if err != nil || !ok {
+		return err
+	}
+	metrics.ReapedSubmissions.WithLabelValues(string(types.WorkerJobSubmission), "failed").Inc()
+	log.Printf("reaper: failed submission %d stuck in %s: %s", sub.ID, sub.Verdict, message)
+	return nil
+}
+
+func (r *Reaper) reapContestSubmission(ctx context.Context, s store.StaleContestSubmission, problems map[int]types.Problem) error {
+	cs := s.Submission
+	if s.Requeues >= r.cfg.MaxRequeues {
+		return r.failContestSubmission(ctx, cs, r.giveUpMessage(cs.Verdict, s.Requeues))
+	}
+	problem, err := r.problem(ctx, cs.ProblemID, problems)
+	if errors.Is(err, store.ErrNotFound) {
+		return r.failContestSubmission(ctx, cs, "Judging could not be retried: the problem no longer exists.")
+	}
+	if err != nil {
+		return err
+	}
+
+	_, ok, err := r.contests.RequeueContestSubmissionWithOutbox(ctx, cs, func(requeued types.ContestSubmission) (store.OutboxMessage, error) {
+		job := types.ContestSubmissionJob{
+			ContestSubmission: requeued,
+			Problem:           problem,
+		}
+		if requeued.SampleOnly {
+			job.Problem = problem.SampleTestcases()
+		}
+		if problem.IsOutputOnly() {
+			job.OutputsKey = storedOutputsKey("contest-submissions", s.OutputsKey, requeued.ID)
+		}
+		payload, err := json.Marshal(job)
+		if err != nil {
+			return store.OutboxMessage{}, err
+		}
+		attrs := map[string]string{
+			"contest_submission_id": strconv.FormatInt(requeued.ID, 10),
+			"contest_id":            strconv.Itoa(requeued.ContestID),
+			"problem_id":            strconv.Itoa(requeued.ProblemID),
+			"user_id":               strconv.Itoa(requeued.UserID),
+		}
+		return store.OutboxMessage{
+			Queue:      contestSubmissionQueue,
+			Payload:    payload,
+			Attributes: mq.InjectTraceContext(ctx, attrs),
+		}, nil
+	})
+	if err != nil || !ok {
+		return err
+	}
+	metrics.ReapedSubmissions.WithLabelValues(string(types.WorkerJobContestSubmission), "requeued").Inc()
+	log.Printf("reaper: re-enqueued contest submission %d stuck in %s (requeue %d of %d)",
+		cs.ID, cs.Verdict, s.Requeues+1, r.cfg.MaxRequeues)
+	return nil
+}
+
+func (r *Reaper) failContestSubmission(ctx context.Context, cs types.ContestSubmission, message string) error {
+	ok, err := r.contests.FailStaleContestSubmission(ctx, cs, message)
+	if err != nil || !ok {
+		return err
+	}
+	metrics.ReapedSubmissions.WithLabelValues(string(types.WorkerJobContestSubmission), "failed").Inc()
+	log.Printf("reaper: failed contest submission %d stuck in %s: %s", cs.ID, cs.Verdict, message)
+	return nil
+}
+
+// problem returns the problem with its test cases, loading each problem
+// once per sweep.
+func (r *Reaper) problem(ctx context.Context, id int, problems map[int]types.Problem) (types.Problem, error) {
+	if problem, ok := problems[id]; ok {
+		return problem, nil
+	}
+	problem, err := r.problems.GetWithTestcases(ctx, id)
+	if err != nil {
+		return types.Problem{}, err
+	}
+	problems[id] = problem
+	return problem, nil
+}
+
+func (r *Reaper) giveUpMessage(verdict types.Verdict, requeues int) string {
+	timeout := r.cfg.PendingTimeout
+	if verdict == types.VerdictJudging {
+		timeout = r.cfg.JudgingTimeout
+	}
+	return fmt.Sprintf("Judging did not finish: the submission was stuck in %s for over %s after %d retries.",
+		verdict, timeout, requeues)
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/mq"
+)
+
+// referenceSolutionJobType marks reference solution jobs on the submissions
+// queue so workers can tell them apart from user submissions.
+const referenceSolutionJobType = "reference_solution"
+
+// ReferenceSolutionRepository defines persistence operations for reference solutions.
+type ReferenceSolutionRepository interface {
+	Get(ctx context.Context, id int64) (types.ReferenceSolution, error)
+	ListByProblem(ctx context.Context, problemID int) ([]types.ReferenceSolution, error)
+	Create(ctx context.Context, rs types.ReferenceSolution) (types.ReferenceSolution, error)
+	UpdateResult(ctx context.Context, rs types.ReferenceSolution) (types.ReferenceSolution, error)
+	ResetResults(ctx context.Context, problemID int) ([]types.ReferenceSolution, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+// ReferenceSolutionService judges setter-provided solutions against a
+// problem's testcases and summarises the outcome in a validation report.
+type ReferenceSolutionService struct {
+	repo     ReferenceSolutionRepository
+	problems ProblemRepository
+	mq       *mq.MQ
+}
+
+func NewReferenceSolutionService(repo ReferenceSolutionRepository, problemRepo ProblemRepository, mqClient *mq.MQ) *ReferenceSolutionService {
+	return &ReferenceSolutionService{repo: repo, problems: problemRepo, mq: mqClient}
+}
+
+// IsExpectableVerdict reports whether v may be used as the expected verdict
+// of a reference solution.
+func IsExpectableVerdict(v types.Verdict) bool {
+	switch v {
+	case types.VerdictAccepted, types.VerdictWrongAnswer, types.VerdictTimeLimitExceeded:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *ReferenceSolutionService) Get(ctx context.Context, id int64) (types.ReferenceSolution, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *ReferenceSolutionService) List(ctx context.Context, problemID int) ([]types.ReferenceSolution, error) {
+	return s.repo.ListByProblem(ctx, problemID)
+}
+
+func (s *ReferenceSolutionService) Delete(ctx context.Context, id int64) error {
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *ReferenceSolutionService) UpdateResult(ctx context.Context, rs types.ReferenceSolution) (types.ReferenceSolution, error) {
+	return s.repo.UpdateResult(ctx, rs)
+}
+
+// CreateAndEnqueue stores a reference solution and queues it for judging
+// against the problem's current testcases.
+func (s *ReferenceSolutionService) CreateAndEnqueue(ctx context.Context, rs types.ReferenceSolution) (types.ReferenceSolution, error) {
+	if s.mq == nil {
+		return types.ReferenceSolution{}, errors.New("message queue is not configured")
+	}
+
+	rs.Code = strings.TrimSpace(rs.Code)
+	if rs.Code == "" {
+		return types.ReferenceSolution{}, errors.New("source code is required")
+	}
+	if !IsExpectableVerdict(rs.ExpectedVerdict) {
+		return types.ReferenceSolution{}, fmt.Errorf("unsupported expected verdict %s", rs.ExpectedVerdict)
+	}
+
+	problem, err := s.problems.GetWithTestcases(ctx, rs.ProblemID)
+	if err != nil {
+		return types.ReferenceSolution{}, err
+	}
+
+	rs.Verdict = types.VerdictPending
+	created, err := s.repo.Create(ctx, rs)
+	if err != nil {
+		return types.ReferenceSolution{}, err
+	}
+
+	if err := s.enqueue(ctx, created, problem); err != nil {
+		_ = s.repo.Delete(ctx, created.ID)
+		return types.ReferenceSolution{}, err
+	}
+	return created, nil
+}
+
+// Revalidate re-queues every reference solution of a problem. It is called
+// whenever the problem's testcases or limits change.
+func (s *ReferenceSolutionService) Revalidate(ctx context.Context, problemID int) error {
+	if s.mq == nil {
+		return errors.New("message queue is not configured")
+	}
+
+	problem, err := s.problems.GetWithTestcases(ctx, problemID)
+	if err != nil {
+		return err
+	}
+
+	solutions, err := s.repo.ResetResults(ctx, problemID)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, rs := range solutions {
+		if err := s.enqueue(ctx, rs, problem); err != nil {
+			errs = append(errs, fmt.Errorf("enqueue reference solution %d: %w", rs.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *ReferenceSolutionService) enqueue(ctx context.Context, rs types.ReferenceSolution, problem types.Problem) error {
+	payload, err := json.Marshal(types.ReferenceSolutionJob{
+		ReferenceSolution: rs,
+		Problem:           problem,
+	})
+	if err != nil {
+		return err
+	}
+
+	attrs := map[string]string{
+		"job_type":              referenceSolutionJobType,
+		"reference_solution_id": strconv.FormatInt(rs.ID, 10),
+		"problem_id":            strconv.Itoa(rs.ProblemID),
+	}
+	_, err = s.mq.Publish(ctx, submissionQueue, payload, attrs)
+	return err
+}
+
+// Report builds the validation report of a problem from the latest results
+// of its reference solutions.
+func (s *ReferenceSolutionService) Report(ctx context.Context, problemID int) (types.ValidationReport, error) {
+	problem, err := s.problems.Get(ctx, problemID)
+	if err != nil {
+		return types.ValidationReport{}, err
+	}
+	solutions, err := s.repo.ListByProblem(ctx, problemID)
+	if err != nil {
+		return types.ValidationReport{}, err
+	}
+	return BuildValidationReport(problem, solutions), nil
+}
+
+// BuildValidationReport summarises reference solution results for problem.
+// A report passes only when every solution got its expected verdict and at
+// least one solution is expected to be accepted.
+func BuildValidationReport(problem types.Problem, solutions []types.ReferenceSolution) types.ValidationReport {
+	report := types.ValidationReport{
+		ProblemID: problem.ID,
+		Status:    types.ValidationPassed,
+		Solutions: solutions,
+		Issues:    []string{},
+	}
+	if report.Solutions == nil {
+		report.Solutions = []types.ReferenceSolution{}
+	}
+
+	if len(solutions) == 0 {
+		report.Status = types.ValidationNone
+		report.Issues = append(report.Issues, "no reference solutions attached")
+		return report
+	}
+
+	hasMain := false
+	pending := false
+	for _, rs := range solutions {
+		if rs.ExpectedVerdict == types.VerdictAccepted {
+			hasMain = true
+		}
+		if !rs.Judged() {
+			pending = true
+			continue
+		}
+		if !rs.Matches() {
+			report.Status = types.ValidationFailed
+			msg := fmt.Sprintf("solution %q: expected %s, got %s", rs.Name, rs.ExpectedVerdict, rs.Verdict)
+			if rs.Message != "" {
+				msg += ": " + rs.Message
+			}
+			report.Issues = append(report.Issues, msg)
+			continue
+		}
+		// A main solution using more than half the limit leaves little
+		// headroom for slower languages or judging machines.
+		if rs.ExpectedVerdict == types.VerdictAccepted && problem.TimeLimit > 0 && rs.CPUTime*2 > problem.TimeLimit {
+			report.Issues = append(report.Issues, fmt.Sprintf(
+				"solution %q: uses %d ms of the %d ms time limit", rs.Name, rs.CPUTime, problem.TimeLimit))
+		}
+	}
+
+	if !hasMain {
+		report.Status = types.ValidationFailed
+		report.Issues = append(report.Issues, "no solution is expected to be accepted")
+	}
+	if pending && report.Status == types.ValidationPassed {
+		report.Status = types.ValidationPending
+	}
+	return report
+}
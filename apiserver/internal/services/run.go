@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/mq"
+)
+
+const (
+	// runQueue is consumed by workers only when they have spare capacity, so
+	// custom invocations never delay graded submissions.
+	runQueue = "runs"
+
+	// Limits applied to runs that are not tied to a problem.
+	DefaultRunTimeLimit   = 2000      // milliseconds
+	DefaultRunMemoryLimit = 256 << 20 // bytes
+)
+
+// RunRepository defines persistence operations for custom invocations.
+type RunRepository interface {
+	Get(ctx context.Context, id int64) (types.Run, error)
+	Create(ctx context.Context, run types.Run) (types.Run, error)
+	UpdateResult(ctx context.Context, run types.Run) (types.Run, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+// RunService encapsulates custom invocation use-cases.
+type RunService struct {
+	repo RunRepository
+	mq   *mq.MQ
+}
+
+func NewRunService(repo RunRepository, mqClient *mq.MQ) *RunService {
+	return &RunService{repo: repo, mq: mqClient}
+}
+
+func (s *RunService) Get(ctx context.Context, id int64) (types.Run, error) {
+	return s.repo.Get(ctx, id)
+}
+
+func (s *RunService) UpdateResult(ctx context.Context, run types.Run) (types.Run, error) {
+	// PostgreSQL text cannot hold NUL bytes, which programs may well print.
+	run.Stdout = replaceNUL(run.Stdout)
+	run.Stderr = replaceNUL(run.Stderr)
+	run.Message = replaceNUL(run.Message)
+	return s.repo.UpdateResult(ctx, run)
+}
+
+// replaceNUL replaces NUL bytes with U+FFFD, as done for invalid UTF-8.
+func replaceNUL(s string) string {
+	return strings.ReplaceAll(s, "\x00", "\uFFFD")
+}
+
+// CreateAndEnqueue stores a run and queues it for execution. When problem has
+// an ID its time and memory limits apply, otherwise the defaults do.
+func (s *RunService) CreateAndEnqueue(ctx context.Context, run types.Run, problem types.Problem) (types.Run, error) {
+	if s.mq == nil {
+		return types.Run{}, errors.New("message queue is not configured")
+	}
+
+	run.Code = strings.TrimSpace(run.Code)
+	if run.Code == "" {
+		return types.Run{}, errors.New("source code is required")
+	}
+
+	run.ProblemID = problem.ID
+	run.TimeLimit = DefaultRunTimeLimit
+	run.MemoryLimit = DefaultRunMemoryLimit
+	if problem.ID > 0 {
+		if problem.TimeLimit > 0 {
+			run.TimeLimit = problem.TimeLimit
+		}
+		if problem.MemoryLimit > 0 {
+			run.MemoryLimit = problem.MemoryLimit
+		}
+	}
+	run.Status = types.RunPending
+
+	created, err := s.repo.Create(ctx, run)
+	if err != nil {
+		return types.Run{}, err
+	}
+
+	payload, err := json.Marshal(types.RunJob{Run: created})
+	if err != nil {
+		_ = s.repo.Delete(ctx, created.ID)
+		return types.Run{}, err
+	}
+
+	attrs := map[string]string{
+		"run_id":  strconv.FormatInt(created.ID, 10),
+		"user_id": strconv.Itoa(created.UserID),
+	}
+	if _, err := s.mq.Publish(ctx, runQueue, payload, attrs); err != nil {
+		_ = s.repo.Delete(ctx, created.ID)
+		return types.Run{}, err
+	}
+
+	return created, nil
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/jjudge-oj/api/types"
 	"github.com/jjudge-oj/apiserver/internal/mq"
 	"github.com/jjudge-oj/apiserver/internal/storage"
+	"github.com/jjudge-oj/apiserver/internal/store"
 )
 
 // SubmissionRepository defines persistence operations for submissions.
@@ -21,6 +22,7 @@ type SubmissionRepository interface {
 	Get(ctx context.Context, id int64) (types.Submission, error)
 	List(ctx context.Context, problemID, userID int) ([]types.Submission, error)
 	Create(ctx context.Context, submission types.Submission) (types.Submission, error)
+	CreateWithOutbox(ctx context.Context, submission types.Submission, outputsKey string, enqueue func(types.Submission) (store.OutboxMessage, error)) (types.Submission, error)
 	Update(ctx context.Context, submission types.Submission) (types.Submission, error)
 	Delete(ctx context.Context, id int64) error
 }
@@ -29,11 +31,11 @@ type SubmissionRepository interface {
 type SubmissionService struct {
 	repo    SubmissionRepository
 	storage *storage.Storage
-	mq      *mq.MQ
+	outbox  *OutboxRelay
 }
 
-func NewSubmissionService(repo SubmissionRepository, storageClient *storage.Storage, mqClient *mq.MQ) *SubmissionService {
-	return &SubmissionService{repo: repo, storage: storageClient, mq: mqClient}
+func NewSubmissionService(repo SubmissionRepository, storageClient *storage.Storage, outbox *OutboxRelay) *SubmissionService {
+	return &SubmissionService{repo: repo, storage: storageClient, outbox: outbox}
 }
 
 func (s *SubmissionService) Get(ctx context.Context, id int64) (types.Submission, error) {
@@ -48,57 +50,101 @@ func (s *SubmissionService) Create(ctx context.Context, submission types.Submiss
 	return s.repo.Create(ctx, submission)
 }
 
-func (s *SubmissionService) CreateAndEnqueue(ctx context.Context, submission types.Submission, problem types.Problem) (types.Submission, string, error) {
+// CreateAndEnqueue stores a submission and queues it for judging through the
+// outbox, in one transaction, so a stored submission is always judged. For
+// output-only problems outputs holds the uploaded ZIP of output files and the
+// submission's code is replaced by a listing of its files; outputs must be nil
+// for every other problem.
+func (s *SubmissionService) CreateAndEnqueue(ctx context.Context, submission types.Submission, problem types.Problem, outputs []byte) (types.Submission, string, error) {
 	if s.storage == nil {
 		return types.Submission{}, "", errors.New("object storage is not configured")
 	}
-	if s.mq == nil {
-		return types.Submission{}, "", errors.New("message queue is not configured")
+	if problem.IsOutputOnly() != (outputs != nil) {
+		return types.Submission{}, "", ErrOutputsRequired
+	}
+	if problem.IsOutputOnly() {
+		manifest, err := outputArchiveManifest(problem, outputs)
+		if err != nil {
+			return types.Submission{}, "", err
+		}
+		submission.Code = manifest
+		submission.Language = types.LanguageOutputOnly
+		submission.Files = nil
+	} else if len(submission.Files) > 0 {
+		code, err := combineSourceFiles(submission.Files, problem.GraderFilesFor(submission.Language))
+		if err != nil {
+			return types.Submission{}, "", err
+		}
+		submission.Code = code
 	}
 
 	submission.Code = strings.TrimSpace(submission.Code)
 	if submission.Code == "" {
 		return types.Submission{}, "", errors.New("source code is required")
 	}
-
-	created, err := s.repo.Create(ctx, submission)
-	if err != nil {
-		return types.Submission{}, "", err
+	if submission.SampleOnly {
+		problem = problem.SampleTestcases()
+		if len(problem.TestcaseGroups) == 0 {
+			return types.Submission{}, "", ErrNoSampleTestcases
+		}
 	}
 
-	artifactKey, err := s.uploadSource(ctx, created)
-	if err != nil {
-		_ = s.repo.Delete(ctx, int64(created.ID))
-		return types.Submission{}, "", err
+	// The artifact is uploaded before the transaction, under a key derived
+	// from its content, so no connection is held during the upload and the
+	// job is not published before the artifact exists. An artifact left
+	// behind by a failed insert is not deleted: an identical upload may share
+	// it.
+	var (
+		artifactKey string
+		outputsKey  string
+		err         error
+	)
+	if outputs != nil {
+		artifactKey, err = s.uploadOutputs(ctx, outputs)
+		outputsKey = artifactKey
+	} else {
+		artifactKey, err = s.uploadSource(ctx, submission)
 	}
-
-	job := types.SubmissionJob{
-		Submission: created,
-		Problem:    problem,
-	}
-	payload, err := json.Marshal(job)
 	if err != nil {
-		_ = s.storage.Delete(ctx, artifactKey)
-		_ = s.repo.Delete(ctx, int64(created.ID))
 		return types.Submission{}, "", err
 	}
 
-	attrs := map[string]string{
-		"submission_id": strconv.Itoa(created.ID),
-		"problem_id":    strconv.Itoa(created.ProblemID),
-		"user_id":       strconv.Itoa(created.UserID),
-	}
-	if _, err := s.mq.Publish(ctx, submissionQueue, payload, attrs); err != nil {
-		_ = s.storage.Delete(ctx, artifactKey)
-		_ = s.repo.Delete(ctx, int64(created.ID))
+	created, err := s.repo.CreateWithOutbox(ctx, submission, outputsKey, func(created types.Submission) (store.OutboxMessage, error) {
+		job := types.SubmissionJob{
+			Submission: created,
+			Problem:    problem,
+			OutputsKey: outputsKey,
+		}
+		payload, err := json.Marshal(job)
+		if err != nil {
+			return store.OutboxMessage{}, err
+		}
+
+		attrs := map[string]string{
+			"submission_id": strconv.Itoa(created.ID),
+			"problem_id":    strconv.Itoa(created.ProblemID),
+			"user_id":       strconv.Itoa(created.UserID),
+		}
+		return store.OutboxMessage{
+			Queue:      submissionQueue,
+			Payload:    payload,
+			Attributes: mq.InjectTraceContext(ctx, attrs),
+		}, nil
+	})
+	if err != nil {
 		return types.Submission{}, "", err
 	}
+	s.outbox.Wake()
 
 	return created, artifactKey, nil
 }
 
 const submissionQueue = "submissions"
 
+// ErrNoSampleTestcases is returned for a sample-only check on a problem
+// without any non-hidden testcases.
+var ErrNoSampleTestcases = errors.New("problem has no sample testcases")
+
 func (s *SubmissionService) Update(ctx context.Context, submission types.Submission) (types.Submission, error) {
 	return s.repo.Update(ctx, submission)
 }
@@ -111,7 +157,7 @@ func (s *SubmissionService) uploadSource(ctx context.Context, submission types.S
 	codeBytes := []byte(submission.Code)
 	hash := sha256.Sum256(codeBytes)
 	digest := hex.EncodeToString(hash[:])
-	objectKey := fmt.Sprintf("submissions/%d/source-%s.txt", submission.ID, digest)
+	objectKey := fmt.Sprintf("submissions/sources/%s.txt", digest)
 
 	if err := s.storage.Put(ctx, objectKey, bytes.NewReader(codeBytes), int64(len(codeBytes)), "text/plain; charset=utf-8"); err != nil {
 		return "", fmt.Errorf("failed to upload submission source: %w", err)
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/mq"
+)
+
+const (
+	// WorkerHeartbeatQueue carries the heartbeats workers publish.
+	WorkerHeartbeatQueue = "worker-heartbeats"
+
+	// workerCommandQueuePrefix is followed by a worker ID to name the
+	// transient queue the worker receives commands on.
+	workerCommandQueuePrefix = "worker-commands-"
+)
+
+// ErrWorkerOffline is returned when commanding a worker that has stopped
+// sending heartbeats.
+var ErrWorkerOffline = errors.New("worker is offline")
+
+// WorkerRepository defines persistence operations for the worker registry.
+type WorkerRepository interface {
+	Upsert(ctx context.Context, worker types.Worker) error
+	Get(ctx context.Context, id string) (types.Worker, error)
+	List(ctx context.Context) ([]types.Worker, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// WorkerService keeps the registry of judge workers and relays
+// administrator commands to them.
+type WorkerService struct {
+	repo WorkerRepository
+	mq   *mq.MQ
+
+	// offlineAfter is how long after its last heartbeat a worker is
+	// considered offline.
+	offlineAfter time.Duration
+}
+
+func NewWorkerService(repo WorkerRepository, mqClient *mq.MQ, offlineAfter time.Duration) *WorkerService {
+	return &WorkerService{repo: repo, mq: mqClient, offlineAfter: offlineAfter}
+}
+
+// Heartbeat records a worker's heartbeat as received now.
+func (s *WorkerService) Heartbeat(ctx context.Context, worker types.Worker) error {
+	if worker.ID == "" {
+		return errors.New("worker id is required")
+	}
+	worker.LastSeenAt = time.Now()
+	return s.repo.Upsert(ctx, worker)
+}
+
+// List returns all registered workers. Workers whose heartbeats stopped are
+// reported offline, with no jobs.
+func (s *WorkerService) List(ctx context.Context) ([]types.Worker, error) {
+	workers, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range workers {
+		workers[i] = s.withLiveness(workers[i])
+	}
+	return workers, nil
+}
+
+func (s *WorkerService) Get(ctx context.Context, id string) (types.Worker, error) {
+	worker, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return types.Worker{}, err
+	}
+	return s.withLiveness(worker), nil
+}
+
+func (s *WorkerService) Delete(ctx context.Context, id string) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// Command sends cmd to a worker. The worker applies it when it next reads
+// its command queue, normally within a second.
+func (s *WorkerService) Command(ctx context.Context, id string, cmd types.WorkerCommandType) error {
+	if s.mq == nil {
+		return errors.New("message queue is not configured")
+	}
+	worker, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if worker.State == types.WorkerOffline || worker.State == types.WorkerStopped {
+		return ErrWorkerOffline
+	}
+
+	payload, err := json.Marshal(types.WorkerCommand{Command: cmd, IssuedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = s.mq.PublishTransient(ctx, workerCommandQueuePrefix+id, payload, nil)
+	return err
+}
+
+func (s *WorkerService) withLiveness(worker types.Worker) types.Worker {
+	if worker.State != types.WorkerStopped && time.Since(worker.LastSeenAt) > s.offlineAfter {
+		worker.State = types.WorkerOffline
+	}
+	if worker.State == types.WorkerOffline || worker.State == types.WorkerStopped {
+		worker.Jobs = []types.WorkerJob{}
+		worker.FreeSlots = 0
+	}
+	return worker
+}
+
+// jobRef identifies a job across job kinds.
+type jobRef struct {
+	kind types.WorkerJobKind
+	id   int64
+}
+
+// fleetState is what the reaper needs to know about the live workers.
+type fleetState struct {
+	// leased are the jobs held by workers that are still sending
+	// heartbeats. Such jobs are being judged, however long they take.
+	leased map[jobRef]bool
+
+	// idleQueues are the queues a running worker with a free slot
+	// consumes. Jobs on other queues may be waiting behind a backlog.
+	idleQueues map[string]bool
+}
+
+func (s *WorkerService) fleetState(ctx context.Context) (fleetState, error) {
+	workers, err := s.List(ctx)
+	if err != nil {
+		return fleetState{}, err
+	}
+	fleet := fleetState{leased: make(map[jobRef]bool), idleQueues: make(map[string]bool)}
+	for _, worker := range workers {
+		for _, job := range worker.Jobs {
+			fleet.leased[jobRef{kind: job.Kind, id: job.ID}] = true
+		}
+		if worker.State == types.WorkerRunning && worker.FreeSlots > 0 {
+			fleet.idleQueues[worker.Queue] = true
+		}
+	}
+	return fleet, nil
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/metrics"
 )
 
 // BlogRepository handles persistence for blog posts.
@@ -62,6 +63,7 @@ func scanBlogPost(row interface{ Scan(...any) error }) (types.BlogPost, error) {
 
 // List returns blog posts. If publishedOnly is true only published posts are returned.
 func (r *BlogRepository) List(ctx context.Context, offset, limit int, publishedOnly bool) ([]types.BlogPost, int, error) {
+	defer metrics.ObserveQuery("blog", "List")()
 	var countQuery string
 	var listQuery string
 
@@ -111,6 +113,7 @@ func (r *BlogRepository) List(ctx context.Context, offset, limit int, publishedO
 
 // Get returns a single blog post by slug.
 func (r *BlogRepository) Get(ctx context.Context, slug string) (types.BlogPost, error) {
+	defer metrics.ObserveQuery("blog", "Get")()
 	const query = `
 		SELECT ` + blogSelectCols + `
 		FROM blog_posts bp
@@ -129,6 +132,7 @@ func (r *BlogRepository) Get(ctx context.Context, slug string) (types.BlogPost,
 
 // SlugExists reports whether a slug is already taken (optionally excluding one post by id).
 func (r *BlogRepository) SlugExists(ctx context.Context, slug string, excludeID int) (bool, error) {
+	defer metrics.ObserveQuery("blog", "SlugExists")()
 	const query = `SELECT EXISTS(SELECT 1 FROM blog_posts WHERE slug = $1 AND id != $2)`
 	var exists bool
 	if err := r.db.QueryRowContext(ctx, query, slug, excludeID).Scan(&exists); err != nil {
@@ -139,6 +143,7 @@ func (r *BlogRepository) SlugExists(ctx context.Context, slug string, excludeID
 
 // Create inserts a new blog post and returns it with its assigned ID.
 func (r *BlogRepository) Create(ctx context.Context, post types.BlogPost) (types.BlogPost, error) {
+	defer metrics.ObserveQuery("blog", "Create")()
 	now := time.Now()
 	post.CreatedAt = now
 	post.UpdatedAt = now
@@ -171,6 +176,7 @@ func (r *BlogRepository) Create(ctx context.Context, post types.BlogPost) (types
 
 // Update modifies an existing blog post.
 func (r *BlogRepository) Update(ctx context.Context, post types.BlogPost) (types.BlogPost, error) {
+	defer metrics.ObserveQuery("blog", "Update")()
 	post.UpdatedAt = time.Now()
 
 	tagsRaw, err := json.Marshal(post.Tags)
@@ -214,6 +220,7 @@ func (r *BlogRepository) Update(ctx context.Context, post types.BlogPost) (types
 
 // Delete removes a blog post by slug.
 func (r *BlogRepository) Delete(ctx context.Context, slug string) error {
+	defer metrics.ObserveQuery("blog", "Delete")()
 	const query = `DELETE FROM blog_posts WHERE slug = $1`
 	result, err := r.db.ExecContext(ctx, query, slug)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/metrics"
 )
 
 // ContestRepository handles persistence for contests.
@@ -23,6 +24,7 @@ func NewContestRepository(db *sql.DB) *ContestRepository {
 // ---------- Contest CRUD ----------
 
 func (r *ContestRepository) ListContests(ctx context.Context, offset, limit int, publicOnly bool) ([]types.Contest, int, error) {
+	defer metrics.ObserveQuery("contest", "ListContests")()
 	var countQuery string
 	if publicOnly {
 		countQuery = `SELECT COUNT(*) FROM contests WHERE approval_status = 'approved'`
@@ -73,6 +75,7 @@ func (r *ContestRepository) ListContests(ctx context.Context, offset, limit int,
 }
 
 func (r *ContestRepository) ListPendingContests(ctx context.Context, offset, limit int) ([]types.Contest, int, error) {
+	defer metrics.ObserveQuery("contest", "ListPendingContests")()
 	const countQuery = `SELECT COUNT(*) FROM contests WHERE approval_status = 'pending'`
 	var total int
 	if err := r.db.QueryRowContext(ctx, countQuery).Scan(&total); err != nil {
@@ -108,6 +111,7 @@ func (r *ContestRepository) ListPendingContests(ctx context.Context, offset, lim
 }
 
 func (r *ContestRepository) ListContestsByOwner(ctx context.Context, ownerID, offset, limit int) ([]types.Contest, int, error) {
+	defer metrics.ObserveQuery("contest", "ListContestsByOwner")()
 	const countQuery = `SELECT COUNT(*) FROM contests WHERE owner_id = $1`
 	var total int
 	if err := r.db.QueryRowContext(ctx, countQuery, ownerID).Scan(&total); err != nil {
@@ -143,6 +147,7 @@ func (r *ContestRepository) ListContestsByOwner(ctx context.Context, ownerID, of
 }
 
 func (r *ContestRepository) GetContest(ctx context.Context, id int) (types.Contest, error) {
+	defer metrics.ObserveQuery("contest", "GetContest")()
 	const query = `
 		SELECT id, title, description, start_time, end_time,
 		       scoring_type, visibility, owner_id, created_at, updated_at, approval_status
@@ -164,6 +169,7 @@ func (r *ContestRepository) GetContest(ctx context.Context, id int) (types.Conte
 }
 
 func (r *ContestRepository) GetContestWithProblems(ctx context.Context, id int) (types.Contest, error) {
+	defer metrics.ObserveQuery("contest", "GetContestWithProblems")()
 	contest, err := r.GetContest(ctx, id)
 	if err != nil {
 		return types.Contest{}, err
@@ -178,6 +184,7 @@ func (r *ContestRepository) GetContestWithProblems(ctx context.Context, id int)
 }
 
 func (r *ContestRepository) CreateContest(ctx context.Context, c types.Contest) (types.Contest, error) {
+	defer metrics.ObserveQuery("contest", "CreateContest")()
 	now := time.Now()
 	c.CreatedAt = now
 	c.UpdatedAt = now
@@ -200,6 +207,7 @@ func (r *ContestRepository) CreateContest(ctx context.Context, c types.Contest)
 }
 
 func (r *ContestRepository) UpdateContest(ctx context.Context, c types.Contest) (types.Contest, error) {
+	defer metrics.ObserveQuery("contest", "UpdateContest")()
 	c.UpdatedAt = time.Now()
 
 	if c.ApprovalStatus == "" {
@@ -229,6 +237,7 @@ func (r *ContestRepository) UpdateContest(ctx context.Context, c types.Contest)
 }
 
 func (r *ContestRepository) ApproveContest(ctx context.Context, id int) error {
+	defer metrics.ObserveQuery("contest", "ApproveContest")()
 	const query = `UPDATE contests SET approval_status = 'approved', updated_at = $1 WHERE id = $2`
 	result, err := r.db.ExecContext(ctx, query, time.Now(), id)
 	if err != nil {
@@ -245,6 +254,7 @@ func (r *ContestRepository) ApproveContest(ctx context.Context, id int) error {
 }
 
 func (r *ContestRepository) RejectContest(ctx context.Context, id int) error {
+	defer metrics.ObserveQuery("contest", "RejectContest")()
 	const query = `UPDATE contests SET approval_status = 'rejected', updated_at = $1 WHERE id = $2`
 	result, err := r.db.ExecContext(ctx, query, time.Now(), id)
 	if err != nil {
@@ -261,6 +271,7 @@ func (r *ContestRepository) RejectContest(ctx context.Context, id int) error {
 }
 
 func (r *ContestRepository) DeleteContest(ctx context.Context, id int) error {
+	defer metrics.ObserveQuery("contest", "DeleteContest")()
 	const query = `DELETE FROM contests WHERE id = $1`
 	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
@@ -279,9 +290,10 @@ func (r *ContestRepository) DeleteContest(ctx context.Context, id int) error {
 // ---------- Contest Problems ----------
 
 func (r *ContestRepository) ListContestProblems(ctx context.Context, contestID int) ([]types.ContestProblem, error) {
+	defer metrics.ObserveQuery("contest", "ListContestProblems")()
 	const query = `
 		SELECT cp.contest_id, cp.problem_id, cp.ordinal, cp.max_points,
-		       p.id, p.title, p.description, p.difficulty, p.time_limit, p.memory_limit, p.tags, p.created_at, p.updated_at
+		       p.id, p.title, p.description, p.difficulty, p.time_limit, p.memory_limit, p.output_limit, p.max_processes, p.cpus, p.time_accounting, p.type, p.input_file, p.output_file, p.tags, p.created_at, p.updated_at
 		FROM contest_problems cp
 		JOIN problems p ON p.id = cp.problem_id
 		WHERE cp.contest_id = $1
@@ -299,7 +311,7 @@ func (r *ContestRepository) ListContestProblems(ctx context.Context, contestID i
 		var tagsJSON []byte
 		if err := rows.Scan(
 			&cp.ContestID, &cp.ProblemID, &cp.Ordinal, &cp.MaxPoints,
-			&p.ID, &p.Title, &p.Description, &p.Difficulty, &p.TimeLimit, &p.MemoryLimit, &tagsJSON, &p.CreatedAt, &p.UpdatedAt,
+			&p.ID, &p.Title, &p.Description, &p.Difficulty, &p.TimeLimit, &p.MemoryLimit, &p.OutputLimit, &p.MaxProcesses, &p.CPUs, &p.TimeAccounting, &p.Type, &p.InputFile, &p.OutputFile, &tagsJSON, &p.CreatedAt, &p.UpdatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -311,6 +323,7 @@ func (r *ContestRepository) ListContestProblems(ctx context.Context, contestID i
 }
 
 func (r *ContestRepository) AddContestProblem(ctx context.Context, cp types.ContestProblem) (types.ContestProblem, error) {
+	defer metrics.ObserveQuery("contest", "AddContestProblem")()
 	const query = `
 		INSERT INTO contest_problems (contest_id, problem_id, ordinal, max_points)
 		VALUES ($1, $2, $3, $4)
@@ -321,6 +334,7 @@ func (r *ContestRepository) AddContestProblem(ctx context.Context, cp types.Cont
 }
 
 func (r *ContestRepository) RemoveContestProblem(ctx context.Context, contestID, problemID int) error {
+	defer metrics.ObserveQuery("contest", "RemoveContestProblem")()
 	const query = `DELETE FROM contest_problems WHERE contest_id = $1 AND problem_id = $2`
 	result, err := r.db.ExecContext(ctx, query, contestID, problemID)
 	if err != nil {
@@ -338,6 +352,7 @@ func (r *ContestRepository) RemoveContestProblem(ctx context.Context, contestID,
 
 // ReorderContestProblems updates ordinals for multiple problems in a single transaction.
 func (r *ContestRepository) ReorderContestProblems(ctx context.Context, contestID int, ordinals map[int]int) error {
+	defer metrics.ObserveQuery("contest", "ReorderContestProblems")()
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -362,6 +377,7 @@ func (r *ContestRepository) ReorderContestProblems(ctx context.Context, contestI
 // ---------- Registrations ----------
 
 func (r *ContestRepository) Register(ctx context.Context, contestID, userID int) error {
+	defer metrics.ObserveQuery("contest", "Register")()
 	const query = `
 		INSERT INTO contest_registrations (contest_id, user_id, registered_at)
 		VALUES ($1, $2, $3)
@@ -371,6 +387,7 @@ func (r *ContestRepository) Register(ctx context.Context, contestID, userID int)
 }
 
 func (r *ContestRepository) Unregister(ctx context.Context, contestID, userID int) error {
+	defer metrics.ObserveQuery("contest", "Unregister")()
 	const query = `DELETE FROM contest_registrations WHERE contest_id = $1 AND user_id = $2`
 	result, err := r.db.ExecContext(ctx, query, contestID, userID)
 	if err != nil {
@@ -387,6 +404,7 @@ func (r *ContestRepository) Unregister(ctx context.Context, contestID, userID in
 }
 
 func (r *ContestRepository) IsRegistered(ctx context.Context, contestID, userID int) (bool, error) {
+	defer metrics.ObserveQuery("contest", "IsRegistered")()
 	const query = `SELECT 1 FROM contest_registrations WHERE contest_id = $1 AND user_id = $2`
 	var dummy int
 	err := r.db.QueryRowContext(ctx, query, contestID, userID).Scan(&dummy)
@@ -400,6 +418,7 @@ func (r *ContestRepository) IsRegistered(ctx context.Context, contestID, userID
 }
 
 func (r *ContestRepository) ListRegistrations(ctx context.Context, contestID int) ([]types.ContestRegistration, error) {
+	defer metrics.ObserveQuery("contest", "ListRegistrations")()
 	const query = `
 		SELECT cr.contest_id, cr.user_id, u.username, cr.registered_at
 		FROM contest_registrations cr
@@ -426,6 +445,45 @@ func (r *ContestRepository) ListRegistrations(ctx context.Context, contestID int
 // ---------- Contest Submissions ----------
 
 func (r *ContestRepository) CreateContestSubmission(ctx context.Context, cs types.ContestSubmission) (types.ContestSubmission, error) {
+	defer metrics.ObserveQuery("contest", "CreateContestSubmission")()
+	return insertContestSubmission(ctx, r.db, cs, "")
+}
+
+// CreateContestSubmissionWithOutbox inserts cs, recording outputsKey as the
+// key of its output archive, and, in the same transaction, the outbox message
+// enqueue returns for the created submission. Nothing is stored if enqueue
+// fails.
+func (r *ContestRepository) CreateContestSubmissionWithOutbox(ctx context.Context, cs types.ContestSubmission, outputsKey string, enqueue func(types.ContestSubmission) (OutboxMessage, error)) (types.ContestSubmission, error) {
+	defer metrics.ObserveQuery("contest", "CreateContestSubmissionWithOutbox")()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.ContestSubmission{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	created, err := insertContestSubmission(ctx, tx, cs, outputsKey)
+	if err != nil {
+		return types.ContestSubmission{}, err
+	}
+	msg, err := enqueue(created)
+	if err != nil {
+		return types.ContestSubmission{}, err
+	}
+	if err = insertOutbox(ctx, tx, msg); err != nil {
+		return types.ContestSubmission{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return types.ContestSubmission{}, err
+	}
+	return created, nil
+}
+
+// insertContestSubmission inserts cs through q, a database or transaction.
+func insertContestSubmission(ctx context.Context, q rowQuerier, cs types.ContestSubmission, outputsKey string) (types.ContestSubmission, error) {
 	now := time.Now()
 	cs.SubmittedAt = now
 	cs.UpdatedAt = now
@@ -434,19 +492,28 @@ func (r *ContestRepository) CreateContestSubmission(ctx context.Context, cs type
 	if err != nil {
 		return types.ContestSubmission{}, err
 	}
+	files := cs.Files
+	if files == nil {
+		files = []types.SourceFile{}
+	}
+	filesJSON, err := json.Marshal(files)
+	if err != nil {
+		return types.ContestSubmission{}, err
+	}
 
 	const query = `
 		INSERT INTO contest_submissions (
 			contest_id, problem_id, user_id, code, language, verdict, score,
 			cpu_time, memory, message, tests_passed, tests_total,
-			testcase_results, submitted_at, updated_at
+			testcase_results, sample_only, submitted_at, updated_at, files, outputs_key
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
 		RETURNING id`
-	if err := r.db.QueryRowContext(ctx, query,
+	if err := q.QueryRowContext(ctx, query,
 		cs.ContestID, cs.ProblemID, cs.UserID, cs.Code, cs.Language,
 		cs.Verdict, cs.Score, cs.CPUTime, cs.Memory, cs.Message,
-		cs.TestsPassed, cs.TestsTotal, resultsJSON, cs.SubmittedAt, cs.UpdatedAt,
+		cs.TestsPassed, cs.TestsTotal, resultsJSON, cs.SampleOnly, cs.SubmittedAt, cs.UpdatedAt,
+		filesJSON, outputsKey,
 	).Scan(&cs.ID); err != nil {
 		return types.ContestSubmission{}, err
 	}
@@ -454,21 +521,22 @@ func (r *ContestRepository) CreateContestSubmission(ctx context.Context, cs type
 }
 
 func (r *ContestRepository) GetContestSubmission(ctx context.Context, id int64) (types.ContestSubmission, error) {
+	defer metrics.ObserveQuery("contest", "GetContestSubmission")()
 	const query = `
 		SELECT cs.id, cs.contest_id, cs.problem_id, cs.user_id, u.username,
 		       cs.code, cs.language, cs.verdict, cs.score,
 		       cs.cpu_time, cs.memory, cs.message, cs.tests_passed, cs.tests_total,
-		       cs.testcase_results, cs.submitted_at, cs.updated_at
+		       cs.testcase_results, cs.sample_only, cs.submitted_at, cs.updated_at, cs.files, cs.judge
 		FROM contest_submissions cs
 		LEFT JOIN users u ON u.id = cs.user_id
 		WHERE cs.id = $1`
 	var cs types.ContestSubmission
-	var resultsJSON []byte
+	var resultsJSON, filesJSON, judgeJSON []byte
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&cs.ID, &cs.ContestID, &cs.ProblemID, &cs.UserID, &cs.Username,
 		&cs.Code, &cs.Language, &cs.Verdict, &cs.Score,
 		&cs.CPUTime, &cs.Memory, &cs.Message, &cs.TestsPassed, &cs.TestsTotal,
-		&resultsJSON, &cs.SubmittedAt, &cs.UpdatedAt,
+		&resultsJSON, &cs.SampleOnly, &cs.SubmittedAt, &cs.UpdatedAt, &filesJSON, &judgeJSON,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -477,25 +545,33 @@ func (r *ContestRepository) GetContestSubmission(ctx context.Context, id int64)
 		return types.ContestSubmission{}, err
 	}
 	_ = json.Unmarshal(resultsJSON, &cs.TestcaseResults)
+	_ = json.Unmarshal(filesJSON, &cs.Files)
+	_ = json.Unmarshal(judgeJSON, &cs.Judge)
 	return cs, nil
 }
 
 func (r *ContestRepository) UpdateContestSubmission(ctx context.Context, cs types.ContestSubmission) (types.ContestSubmission, error) {
+	defer metrics.ObserveQuery("contest", "UpdateContestSubmission")()
 	cs.UpdatedAt = time.Now()
 
 	resultsJSON, err := json.Marshal(cs.TestcaseResults)
 	if err != nil {
 		return types.ContestSubmission{}, err
 	}
+	judgeJSON, err := json.Marshal(cs.Judge)
+	if err != nil {
+		return types.ContestSubmission{}, err
+	}
 
 	const query = `
 		UPDATE contest_submissions
 		SET verdict = $1, score = $2, cpu_time = $3, memory = $4, message = $5,
-		    tests_passed = $6, tests_total = $7, updated_at = $8, testcase_results = $9
-		WHERE id = $10`
+		    tests_passed = $6, tests_total = $7, updated_at = $8, testcase_results = $9,
+		    judge = $10
+		WHERE id = $11`
 	result, err := r.db.ExecContext(ctx, query,
 		cs.Verdict, cs.Score, cs.CPUTime, cs.Memory, cs.Message,
-		cs.TestsPassed, cs.TestsTotal, cs.UpdatedAt, resultsJSON, cs.ID,
+		cs.TestsPassed, cs.TestsTotal, cs.UpdatedAt, resultsJSON, judgeJSON, cs.ID,
 	)
 	if err != nil {
 		return types.ContestSubmission{}, err
@@ -511,11 +587,12 @@ func (r *ContestRepository) UpdateContestSubmission(ctx context.Context, cs type
 }
 
 func (r *ContestRepository) ListContestSubmissions(ctx context.Context, contestID, problemID, userID int) ([]types.ContestSubmission, error) {
+	defer metrics.ObserveQuery("contest", "ListContestSubmissions")()
 	query := `
 		SELECT cs.id, cs.contest_id, cs.problem_id, cs.user_id, u.username,
 		       cs.code, cs.language, cs.verdict, cs.score,
 		       cs.cpu_time, cs.memory, cs.message, cs.tests_passed, cs.tests_total,
-		       cs.submitted_at, cs.updated_at
+		       cs.sample_only, cs.submitted_at, cs.updated_at
 		FROM contest_submissions cs
 		LEFT JOIN users u ON u.id = cs.user_id
 		WHERE cs.contest_id = $1`
@@ -547,7 +624,7 @@ func (r *ContestRepository) ListContestSubmissions(ctx context.Context, contestI
 			&cs.ID, &cs.ContestID, &cs.ProblemID, &cs.UserID, &cs.Username,
 			&cs.Code, &cs.Language, &cs.Verdict, &cs.Score,
 			&cs.CPUTime, &cs.Memory, &cs.Message, &cs.TestsPassed, &cs.TestsTotal,
-			&cs.SubmittedAt, &cs.UpdatedAt,
+			&cs.SampleOnly, &cs.SubmittedAt, &cs.UpdatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -557,6 +634,7 @@ func (r *ContestRepository) ListContestSubmissions(ctx context.Context, contestI
 }
 
 func (r *ContestRepository) DeleteContestSubmission(ctx context.Context, id int64) error {
+	defer metrics.ObserveQuery("contest", "DeleteContestSubmission")()
 	const query = `DELETE FROM contest_submissions WHERE id = $1`
 	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
@@ -572,6 +650,122 @@ func (r *ContestRepository) DeleteContestSubmission(ctx context.Context, id int6
 	return nil
 }
 
+// StaleContestSubmission is an unfinished contest submission that has not
+// progressed for too long, with the number of times it was already
+// re-enqueued.
+type StaleContestSubmission struct {
+	Submission types.ContestSubmission
+	Requeues   int
+	// OutputsKey is the stored key of the output archive, as in
+	// StaleSubmission.
+	OutputsKey string
+}
+
+// ListStaleContestSubmissions returns up to limit contest submissions
+// PENDING since before pendingBefore or JUDGING since before judgingBefore,
+// oldest first. As with ListStale, PENDING submissions whose job is still in
+// the outbox are left out. Only the fields needed to judge them again are
+// loaded.
+func (r *ContestRepository) ListStaleContestSubmissions(ctx context.Context, pendingBefore, judgingBefore time.Time, limit int) ([]StaleContestSubmission, error) {
+	defer metrics.ObserveQuery("contest", "ListStaleContestSubmissions")()
+	const query = `
+		SELECT id, contest_id, problem_id, user_id, code, language, verdict, sample_only,
+		       submitted_at, updated_at, files, judge_requeues, outputs_key
+		FROM contest_submissions
+		WHERE (verdict = $1 AND updated_at < $2 AND NOT EXISTS (
+		           SELECT 1 FROM outbox WHERE attributes->>'contest_submission_id' = contest_submissions.id::text))
+		   OR (verdict = $3 AND updated_at < $4)
+		ORDER BY updated_at
+		LIMIT $5`
+	rows, err := r.db.QueryContext(ctx, query,
+		types.VerdictPending, pendingBefore, types.VerdictJudging, judgingBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stale []StaleContestSubmission
+	for rows.Next() {
+		var s StaleContestSubmission
+		var filesJSON []byte
+		cs := &s.Submission
+		if err := rows.Scan(
+			&cs.ID, &cs.ContestID, &cs.ProblemID, &cs.UserID, &cs.Code, &cs.Language,
+			&cs.Verdict, &cs.SampleOnly, &cs.SubmittedAt, &cs.UpdatedAt, &filesJSON, &s.Requeues,
+			&s.OutputsKey,
+		); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(filesJSON, &cs.Files)
+		stale = append(stale, s)
+	}
+	return stale, rows.Err()
+}
+
+// RequeueContestSubmissionWithOutbox resets a stale contest submission to
+// PENDING, counts the requeue and, in the same transaction, adds the outbox
+// message enqueue returns for the reset submission. It reports false,
+// changing nothing, if the submission progressed since it was listed.
+func (r *ContestRepository) RequeueContestSubmissionWithOutbox(ctx context.Context, cs types.ContestSubmission, enqueue func(types.ContestSubmission) (OutboxMessage, error)) (types.ContestSubmission, bool, error) {
+	defer metrics.ObserveQuery("contest", "RequeueContestSubmissionWithOutbox")()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.ContestSubmission{}, false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+	const query = `
+		UPDATE contest_submissions
+		SET verdict = $1, message = '', judge_requeues = judge_requeues + 1, updated_at = $2
+		WHERE id = $3 AND verdict = $4 AND updated_at = $5`
+	result, err := tx.ExecContext(ctx, query,
+		types.VerdictPending, now, cs.ID, cs.Verdict, cs.UpdatedAt)
+	if err != nil {
+		return types.ContestSubmission{}, false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return types.ContestSubmission{}, false, err
+	}
+	cs.Verdict = types.VerdictPending
+	cs.Message = ""
+	cs.UpdatedAt = now
+
+	msg, err := enqueue(cs)
+	if err != nil {
+		return types.ContestSubmission{}, false, err
+	}
+	if err := insertOutbox(ctx, tx, msg); err != nil {
+		return types.ContestSubmission{}, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return types.ContestSubmission{}, false, err
+	}
+	return cs, true, nil
+}
+
+// FailStaleContestSubmission gives a stale contest submission the verdict
+// INTERNAL_ERROR with message. It reports false if the submission progressed
+// since it was listed.
+func (r *ContestRepository) FailStaleContestSubmission(ctx context.Context, cs types.ContestSubmission, message string) (bool, error) {
+	defer metrics.ObserveQuery("contest", "FailStaleContestSubmission")()
+	const query = `
+		UPDATE contest_submissions
+		SET verdict = $1, message = $2, updated_at = $3
+		WHERE id = $4 AND verdict = $5 AND updated_at = $6`
+	result, err := r.db.ExecContext(ctx, query,
+		types.VerdictInternalError, message, time.Now(), cs.ID, cs.Verdict, cs.UpdatedAt)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
 // ---------- Leaderboard ----------
 
 // LeaderboardRow is a raw aggregate row returned by GetLeaderboardRows.
@@ -585,7 +779,10 @@ type LeaderboardRow struct {
 	AcceptSeconds *float64 // nil if never accepted
 }
 
+// GetLeaderboardRows aggregates graded contest submissions per user and
+// problem. Sample-only checks are not attempts and are left out.
 func (r *ContestRepository) GetLeaderboardRows(ctx context.Context, contestID int) ([]LeaderboardRow, error) {
+	defer metrics.ObserveQuery("contest", "GetLeaderboardRows")()
 	const query = `
 		SELECT cs.user_id, u.username, cs.problem_id,
 		       COUNT(*) AS attempts,
@@ -596,7 +793,7 @@ func (r *ContestRepository) GetLeaderboardRows(ctx context.Context, contestID in
 		FROM contest_submissions cs
 		JOIN users u ON u.id = cs.user_id
 		JOIN contests c ON c.id = cs.contest_id
-		WHERE cs.contest_id = $1
+		WHERE cs.contest_id = $1 AND NOT cs.sample_only
 		GROUP BY cs.user_id, u.username, cs.problem_id`
 
 	rows, err := r.db.QueryContext(ctx, query, contestID)
@@ -619,12 +816,27 @@ func (r *ContestRepository) GetLeaderboardRows(ctx context.Context, contestID in
 	return result, rows.Err()
 }
 
+// ContestSubmissionOutputsKey returns the stored key of the output archive of
+// contest submission id; it is empty for submissions that are not
+// output-only or predate the key.
+func (r *ContestRepository) ContestSubmissionOutputsKey(ctx context.Context, id int64) (string, error) {
+	defer metrics.ObserveQuery("contest", "ContestSubmissionOutputsKey")()
+	const query = `SELECT outputs_key FROM contest_submissions WHERE id = $1`
+	var key string
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return key, err
+}
+
 // ListSubmissionsForContestProblem returns all contest submissions for a given contest+problem.
 func (r *ContestRepository) ListSubmissionsForContestProblem(ctx context.Context, contestID, problemID int) ([]types.ContestSubmission, error) {
+	defer metrics.ObserveQuery("contest", "ListSubmissionsForContestProblem")()
 	const query = `
 		SELECT id, contest_id, problem_id, user_id, code, language,
 		       verdict, score, cpu_time, memory, message, tests_passed, tests_total,
-		       testcase_results, submitted_at, updated_at
+		       testcase_results, sample_only, submitted_at, updated_at, files
 		FROM contest_submissions
 		WHERE contest_id = $1 AND problem_id = $2
 		ORDER BY submitted_at`
@@ -637,15 +849,17 @@ func (r *ContestRepository) ListSubmissionsForContestProblem(ctx context.Context
 	var submissions []types.ContestSubmission
 	for rows.Next() {
 		var cs types.ContestSubmission
-		var resultsJSON []byte
+		var resultsJSON, filesJSON []byte
 		if err := rows.Scan(
 			&cs.ID, &cs.ContestID, &cs.ProblemID, &cs.UserID, &cs.Code, &cs.Language,
 			&cs.Verdict, &cs.Score, &cs.CPUTime, &cs.Memory, &cs.Message,
-			&cs.TestsPassed, &cs.TestsTotal, &resultsJSON, &cs.SubmittedAt, &cs.UpdatedAt,
+			&cs.TestsPassed, &cs.TestsTotal, &resultsJSON, &cs.SampleOnly, &cs.SubmittedAt, &cs.UpdatedAt,
+			&filesJSON,
 		); err != nil {
 			return nil, err
 		}
 		_ = json.Unmarshal(resultsJSON, &cs.TestcaseResults)
+		_ = json.Unmarshal(filesJSON, &cs.Files)
 		submissions = append(submissions, cs)
 	}
 	return submissions, rows.Err()
@@ -1,6 +1,25 @@
 package store
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
 
 // ErrNotFound is returned when a record does not exist.
 var ErrNotFound = errors.New("not found")
+
+// ErrInvalidData is returned when the database rejects a value it was given,
+// such as text containing a NUL byte. Retrying the same write fails again.
+var ErrInvalidData = errors.New("invalid data")
+
+// dataError wraps PostgreSQL data exceptions (SQLSTATE class 22) in
+// ErrInvalidData and returns other errors unchanged.
+func dataError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Class() == "22" {
+		return fmt.Errorf("%w: %w", ErrInvalidData, err)
+	}
+	return err
+}
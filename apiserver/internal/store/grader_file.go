@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/metrics"
+)
+
+// ListGraderFiles returns the grader files of a problem for every language.
+func (r *ProblemRepository) ListGraderFiles(ctx context.Context, problemID int) ([]types.GraderFile, error) {
+	defer metrics.ObserveQuery("problem", "ListGraderFiles")()
+	const query = `
+		SELECT language, name, object_key
+		FROM problem_grader_files
+		WHERE problem_id = $1
+		ORDER BY language, name`
+	rows, err := r.db.QueryContext(ctx, query, problemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make([]types.GraderFile, 0)
+	for rows.Next() {
+		var f types.GraderFile
+		if err := rows.Scan(&f.Language, &f.Name, &f.Key); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// ReplaceGraderFiles swaps the grader files of a problem for one language.
+// An empty files slice removes them.
+func (r *ProblemRepository) ReplaceGraderFiles(ctx context.Context, problemID int, language string, files []types.GraderFile) error {
+	defer metrics.ObserveQuery("problem", "ReplaceGraderFiles")()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM problem_grader_files WHERE problem_id = $1 AND language = $2`, problemID, language); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, f := range files {
+		if _, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO problem_grader_files (problem_id, language, name, object_key, created_at) VALUES ($1, $2, $3, $4, $5)`,
+			problemID,
+			language,
+			f.Name,
+			f.Key,
+			now,
+		); err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	return err
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/jjudge-oj/apiserver/internal/metrics"
+)
+
+// OutboxMessage is a message waiting in the outbox to be published.
+type OutboxMessage struct {
+	ID         int64
+	Queue      string
+	Payload    []byte
+	Attributes map[string]string
+
+	// Attempts counts the claims of the message, including the current one.
+	Attempts  int
+	CreatedAt time.Time
+}
+
+// OutboxRepository handles the outbox of messages to publish.
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// rowQuerier is implemented by *sql.DB and *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// insertOutbox adds msg to the outbox as part of tx.
+func insertOutbox(ctx context.Context, tx *sql.Tx, msg OutboxMessage) error {
+	attrs := msg.Attributes
+	if attrs == nil {
+		attrs = map[string]string{}
+	}
+	attrsJSON, err := json.Marshal(attrs)
+	if err != nil {
+		return err
+	}
+	const query = `INSERT INTO outbox (queue, payload, attributes) VALUES ($1, $2, $3)`
+	_, err = tx.ExecContext(ctx, query, msg.Queue, msg.Payload, attrsJSON)
+	return err
+}
+
+// Claim returns up to limit messages due for publishing, oldest first, and
+// hides them from other claims for lease. A claimed message that is neither
+// deleted nor rescheduled within lease, e.g. because its relay crashed, is
+// claimed again.
+func (r *OutboxRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]OutboxMessage, error) {
+	defer metrics.ObserveQuery("outbox", "Claim")()
+	const query = `
+		UPDATE outbox
+		SET next_attempt_at = $1, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE next_attempt_at <= $2
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, queue, payload, attributes, attempts, created_at`
+	now := time.Now()
+	rows, err := r.db.QueryContext(ctx, query, now.Add(lease), now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+	for rows.Next() {
+		var msg OutboxMessage
+		var attrsJSON []byte
+		if err := rows.Scan(&msg.ID, &msg.Queue, &msg.Payload, &attrsJSON, &msg.Attempts, &msg.CreatedAt); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(attrsJSON, &msg.Attributes)
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// RETURNING does not follow the subquery's order.
+	sort.Slice(messages, func(i, j int) bool { return messages[i].ID < messages[j].ID })
+	return messages, nil
+}
+
+// Delete removes a published message.
+func (r *OutboxRepository) Delete(ctx context.Context, id int64) error {
+	defer metrics.ObserveQuery("outbox", "Delete")()
+	_, err := r.db.ExecContext(ctx, `DELETE FROM outbox WHERE id = $1`, id)
+	return err
+}
+
+// Retry reschedules a message that failed to publish for at.
+func (r *OutboxRepository) Retry(ctx context.Context, id int64, at time.Time, lastError string) error {
+	defer metrics.ObserveQuery("outbox", "Retry")()
+	const query = `UPDATE outbox SET next_attempt_at = $1, last_error = $2 WHERE id = $3`
+	_, err := r.db.ExecContext(ctx, query, at, lastError, id)
+	return err
+}
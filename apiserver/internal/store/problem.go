@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/metrics"
 )
 
 // ProblemRepository handles persistence for problems.
@@ -20,6 +21,7 @@ func NewProblemRepository(db *sql.DB) *ProblemRepository {
 }
 
 func (r *ProblemRepository) List(ctx context.Context, offset, limit int, callerID int, isAdmin bool) ([]types.Problem, int, error) {
+	defer metrics.ObserveQuery("problem", "List")()
 	if offset < 0 {
 		offset = 0
 	}
@@ -42,7 +44,7 @@ func (r *ProblemRepository) List(ctx context.Context, offset, limit int, callerI
 		return nil, 0, err
 	}
 
-	const cols = `SELECT id, title, description, difficulty, time_limit, memory_limit, tags, creator_id, approval_status, visibility, created_at, updated_at FROM problems`
+	const cols = `SELECT id, title, description, difficulty, time_limit, memory_limit, output_limit, max_processes, cpus, time_accounting, type, input_file, output_file, tags, creator_id, approval_status, visibility, created_at, updated_at FROM problems`
 	var listQuery string
 	var listArgs []any
 	if isAdmin {
@@ -73,6 +75,13 @@ func (r *ProblemRepository) List(ctx context.Context, offset, limit int, callerI
 			&problem.Difficulty,
 			&problem.TimeLimit,
 			&problem.MemoryLimit,
+			&problem.OutputLimit,
+			&problem.MaxProcesses,
+			&problem.CPUs,
+			&problem.TimeAccounting,
+			&problem.Type,
+			&problem.InputFile,
+			&problem.OutputFile,
 			&tagsJSON,
 			&creatorID,
 			&problem.ApprovalStatus,
@@ -97,6 +106,7 @@ func (r *ProblemRepository) List(ctx context.Context, offset, limit int, callerI
 }
 
 func (r *ProblemRepository) ListPending(ctx context.Context, offset, limit int) ([]types.Problem, int, error) {
+	defer metrics.ObserveQuery("problem", "ListPending")()
 	if offset < 0 {
 		offset = 0
 	}
@@ -111,7 +121,7 @@ func (r *ProblemRepository) ListPending(ctx context.Context, offset, limit int)
 	}
 
 	const listQuery = `
-		SELECT id, title, description, difficulty, time_limit, memory_limit, tags, creator_id, approval_status, visibility, created_at, updated_at
+		SELECT id, title, description, difficulty, time_limit, memory_limit, output_limit, max_processes, cpus, time_accounting, type, input_file, output_file, tags, creator_id, approval_status, visibility, created_at, updated_at
 		FROM problems
 		WHERE approval_status = 'pending'
 		ORDER BY id
@@ -134,6 +144,13 @@ func (r *ProblemRepository) ListPending(ctx context.Context, offset, limit int)
 			&problem.Difficulty,
 			&problem.TimeLimit,
 			&problem.MemoryLimit,
+			&problem.OutputLimit,
+			&problem.MaxProcesses,
+			&problem.CPUs,
+			&problem.TimeAccounting,
+			&problem.Type,
+			&problem.InputFile,
+			&problem.OutputFile,
 			&tagsJSON,
 			&creatorID,
 			&problem.ApprovalStatus,
@@ -158,6 +175,7 @@ func (r *ProblemRepository) ListPending(ctx context.Context, offset, limit int)
 }
 
 func (r *ProblemRepository) ListByCreator(ctx context.Context, creatorID, offset, limit int) ([]types.Problem, int, error) {
+	defer metrics.ObserveQuery("problem", "ListByCreator")()
 	if offset < 0 {
 		offset = 0
 	}
@@ -172,7 +190,7 @@ func (r *ProblemRepository) ListByCreator(ctx context.Context, creatorID, offset
 	}
 
 	const listQuery = `
-		SELECT id, title, description, difficulty, time_limit, memory_limit, tags, creator_id, approval_status, visibility, created_at, updated_at
+		SELECT id, title, description, difficulty, time_limit, memory_limit, output_limit, max_processes, cpus, time_accounting, type, input_file, output_file, tags, creator_id, approval_status, visibility, created_at, updated_at
 		FROM problems
 		WHERE creator_id = $1
 		ORDER BY id
@@ -195,6 +213,13 @@ func (r *ProblemRepository) ListByCreator(ctx context.Context, creatorID, offset
 			&problem.Difficulty,
 			&problem.TimeLimit,
 			&problem.MemoryLimit,
+			&problem.OutputLimit,
+			&problem.MaxProcesses,
+			&problem.CPUs,
+			&problem.TimeAccounting,
+			&problem.Type,
+			&problem.InputFile,
+			&problem.OutputFile,
 			&tagsJSON,
 			&cID,
 			&problem.ApprovalStatus,
@@ -219,8 +244,9 @@ func (r *ProblemRepository) ListByCreator(ctx context.Context, creatorID, offset
 }
 
 func (r *ProblemRepository) Get(ctx context.Context, id int) (types.Problem, error) {
+	defer metrics.ObserveQuery("problem", "Get")()
 	const query = `
-		SELECT id, title, description, difficulty, time_limit, memory_limit, tags, creator_id, approval_status, visibility, created_at, updated_at
+		SELECT id, title, description, difficulty, time_limit, memory_limit, output_limit, max_processes, cpus, time_accounting, type, input_file, output_file, tags, creator_id, approval_status, visibility, created_at, updated_at
 		FROM problems
 		WHERE id = $1`
 	var problem types.Problem
@@ -233,6 +259,13 @@ func (r *ProblemRepository) Get(ctx context.Context, id int) (types.Problem, err
 		&problem.Difficulty,
 		&problem.TimeLimit,
 		&problem.MemoryLimit,
+		&problem.OutputLimit,
+		&problem.MaxProcesses,
+		&problem.CPUs,
+		&problem.TimeAccounting,
+		&problem.Type,
+		&problem.InputFile,
+		&problem.OutputFile,
 		&tagsJSON,
 		&creatorID,
 		&problem.ApprovalStatus,
@@ -255,6 +288,7 @@ func (r *ProblemRepository) Get(ctx context.Context, id int) (types.Problem, err
 }
 
 func (r *ProblemRepository) GetWithTestcases(ctx context.Context, id int) (types.Problem, error) {
+	defer metrics.ObserveQuery("problem", "GetWithTestcases")()
 	problem, err := r.Get(ctx, id)
 	if err != nil {
 		return types.Problem{}, err
@@ -341,10 +375,16 @@ func (r *ProblemRepository) GetWithTestcases(ctx context.Context, id int) (types
 	}
 
 	problem.TestcaseGroups = groups
+
+	problem.GraderFiles, err = r.ListGraderFiles(ctx, problem.ID)
+	if err != nil {
+		return types.Problem{}, err
+	}
 	return problem, nil
 }
 
 func (r *ProblemRepository) Create(ctx context.Context, problem types.Problem) (types.Problem, error) {
+	defer metrics.ObserveQuery("problem", "Create")()
 	now := time.Now()
 	problem.CreatedAt = now
 	problem.UpdatedAt = now
@@ -358,6 +398,14 @@ func (r *ProblemRepository) Create(ctx context.Context, problem types.Problem) (
 		problem.Visibility = "public"
 	}
 
+	if problem.Type == "" {
+		problem.Type = types.ProblemTypeBatch
+	}
+
+	if problem.TimeAccounting == "" {
+		problem.TimeAccounting = types.TimeAccountingCPU
+	}
+
 	if problem.ApprovalStatus == "" {
 		problem.ApprovalStatus = "approved"
 	}
@@ -368,8 +416,8 @@ func (r *ProblemRepository) Create(ctx context.Context, problem types.Problem) (
 	}
 
 	const query = `
-		INSERT INTO problems (title, description, difficulty, time_limit, memory_limit, tags, creator_id, approval_status, visibility, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		INSERT INTO problems (title, description, difficulty, time_limit, memory_limit, output_limit, type, input_file, output_file, tags, creator_id, approval_status, visibility, created_at, updated_at, max_processes, cpus, time_accounting)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
 		RETURNING id`
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -389,12 +437,19 @@ func (r *ProblemRepository) Create(ctx context.Context, problem types.Problem) (
 		problem.Difficulty,
 		problem.TimeLimit,
 		problem.MemoryLimit,
+		problem.OutputLimit,
+		problem.Type,
+		problem.InputFile,
+		problem.OutputFile,
 		tagsJSON,
 		creatorID,
 		problem.ApprovalStatus,
 		problem.Visibility,
 		problem.CreatedAt,
 		problem.UpdatedAt,
+		problem.MaxProcesses,
+		problem.CPUs,
+		problem.TimeAccounting,
 	).Scan(&problem.ID); err != nil {
 		return types.Problem{}, err
 	}
@@ -407,6 +462,7 @@ func (r *ProblemRepository) Create(ctx context.Context, problem types.Problem) (
 }
 
 func (r *ProblemRepository) Update(ctx context.Context, problem types.Problem) (types.Problem, error) {
+	defer metrics.ObserveQuery("problem", "Update")()
 	problem.UpdatedAt = time.Now()
 
 	tagsJSON, err := json.Marshal(problem.Tags)
@@ -418,6 +474,14 @@ func (r *ProblemRepository) Update(ctx context.Context, problem types.Problem) (
 		problem.Visibility = "public"
 	}
 
+	if problem.Type == "" {
+		problem.Type = types.ProblemTypeBatch
+	}
+
+	if problem.TimeAccounting == "" {
+		problem.TimeAccounting = types.TimeAccountingCPU
+	}
+
 	if problem.ApprovalStatus == "" {
 		problem.ApprovalStatus = "approved"
 	}
@@ -429,11 +493,18 @@ func (r *ProblemRepository) Update(ctx context.Context, problem types.Problem) (
 			difficulty = $3,
 			time_limit = $4,
 			memory_limit = $5,
-			tags = $6,
-			visibility = $7,
-			approval_status = $8,
-			updated_at = $9
-		WHERE id = $10`
+			output_limit = $6,
+			type = $7,
+			input_file = $8,
+			output_file = $9,
+			tags = $10,
+			visibility = $11,
+			approval_status = $12,
+			updated_at = $13,
+			max_processes = $14,
+			cpus = $15,
+			time_accounting = $16
+		WHERE id = $17`
 	result, err := r.db.ExecContext(
 		ctx,
 		query,
@@ -442,10 +513,17 @@ func (r *ProblemRepository) Update(ctx context.Context, problem types.Problem) (
 		problem.Difficulty,
 		problem.TimeLimit,
 		problem.MemoryLimit,
+		problem.OutputLimit,
+		problem.Type,
+		problem.InputFile,
+		problem.OutputFile,
 		tagsJSON,
 		problem.Visibility,
 		problem.ApprovalStatus,
 		problem.UpdatedAt,
+		problem.MaxProcesses,
+		problem.CPUs,
+		problem.TimeAccounting,
 		problem.ID,
 	)
 	if err != nil {
@@ -463,6 +541,7 @@ func (r *ProblemRepository) Update(ctx context.Context, problem types.Problem) (
 }
 
 func (r *ProblemRepository) Delete(ctx context.Context, id int) error {
+	defer metrics.ObserveQuery("problem", "Delete")()
 	const query = `DELETE FROM problems WHERE id = $1`
 	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
@@ -479,6 +558,7 @@ func (r *ProblemRepository) Delete(ctx context.Context, id int) error {
 }
 
 func (r *ProblemRepository) Approve(ctx context.Context, id int) error {
+	defer metrics.ObserveQuery("problem", "Approve")()
 	const query = `UPDATE problems SET approval_status = 'approved', updated_at = $1 WHERE id = $2`
 	result, err := r.db.ExecContext(ctx, query, time.Now(), id)
 	if err != nil {
@@ -495,6 +575,7 @@ func (r *ProblemRepository) Approve(ctx context.Context, id int) error {
 }
 
 func (r *ProblemRepository) Reject(ctx context.Context, id int) error {
+	defer metrics.ObserveQuery("problem", "Reject")()
 	const query = `UPDATE problems SET approval_status = 'rejected', updated_at = $1 WHERE id = $2`
 	result, err := r.db.ExecContext(ctx, query, time.Now(), id)
 	if err != nil {
@@ -513,6 +594,7 @@ func (r *ProblemRepository) Reject(ctx context.Context, id int) error {
 // SaveTestcaseGroups saves testcase groups and their testcases for a problem.
 // It replaces all existing testcase groups for the problem.
 func (r *ProblemRepository) SaveTestcaseGroups(ctx context.Context, problemID int, groups []types.TestcaseGroup) error {
+	defer metrics.ObserveQuery("problem", "SaveTestcaseGroups")()
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
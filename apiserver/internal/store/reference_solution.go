@@ -0,0 +1,232 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/metrics"
+)
+
+// ReferenceSolutionRepository handles persistence for reference solutions.
+type ReferenceSolutionRepository struct {
+	db *sql.DB
+}
+
+func NewReferenceSolutionRepository(db *sql.DB) *ReferenceSolutionRepository {
+	return &ReferenceSolutionRepository{db: db}
+}
+
+const referenceSolutionColumns = `
+	id, problem_id, name, code, language, expected_verdict, verdict,
+	cpu_time, memory, message, tests_passed, tests_total, testcase_results,
+	revision, created_at, updated_at`
+
+func scanReferenceSolution(row interface{ Scan(...any) error }) (types.ReferenceSolution, error) {
+	var rs types.ReferenceSolution
+	var resultsJSON []byte
+	if err := row.Scan(
+		&rs.ID,
+		&rs.ProblemID,
+		&rs.Name,
+		&rs.Code,
+		&rs.Language,
+		&rs.ExpectedVerdict,
+		&rs.Verdict,
+		&rs.CPUTime,
+		&rs.Memory,
+		&rs.Message,
+		&rs.TestsPassed,
+		&rs.TestsTotal,
+		&resultsJSON,
+		&rs.Revision,
+		&rs.CreatedAt,
+		&rs.UpdatedAt,
+	); err != nil {
+		return types.ReferenceSolution{}, err
+	}
+	_ = json.Unmarshal(resultsJSON, &rs.TestcaseResults)
+	return rs, nil
+}
+
+func (r *ReferenceSolutionRepository) Get(ctx context.Context, id int64) (types.ReferenceSolution, error) {
+	defer metrics.ObserveQuery("reference_solution", "Get")()
+	query := `SELECT` + referenceSolutionColumns + ` FROM reference_solutions WHERE id = $1`
+	rs, err := scanReferenceSolution(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.ReferenceSolution{}, ErrNotFound
+		}
+		return types.ReferenceSolution{}, err
+	}
+	return rs, nil
+}
+
+func (r *ReferenceSolutionRepository) ListByProblem(ctx context.Context, problemID int) ([]types.ReferenceSolution, error) {
+	defer metrics.ObserveQuery("reference_solution", "ListByProblem")()
+	query := `SELECT` + referenceSolutionColumns + ` FROM reference_solutions WHERE problem_id = $1 ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query, problemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	solutions := make([]types.ReferenceSolution, 0)
+	for rows.Next() {
+		rs, err := scanReferenceSolution(rows)
+		if err != nil {
+			return nil, err
+		}
+		solutions = append(solutions, rs)
+	}
+	return solutions, rows.Err()
+}
+
+func (r *ReferenceSolutionRepository) Create(ctx context.Context, rs types.ReferenceSolution) (types.ReferenceSolution, error) {
+	defer metrics.ObserveQuery("reference_solution", "Create")()
+	now := time.Now()
+	rs.CreatedAt = now
+	rs.UpdatedAt = now
+	if rs.TestcaseResults == nil {
+		rs.TestcaseResults = []types.TestcaseResult{}
+	}
+
+	resultsJSON, err := json.Marshal(rs.TestcaseResults)
+	if err != nil {
+		return types.ReferenceSolution{}, err
+	}
+
+	const query = `
+		INSERT INTO reference_solutions (
+			problem_id, name, code, language, expected_verdict, verdict,
+			cpu_time, memory, message, tests_passed, tests_total,
+			testcase_results, revision, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id`
+	if err := r.db.QueryRowContext(
+		ctx,
+		query,
+		rs.ProblemID,
+		rs.Name,
+		rs.Code,
+		rs.Language,
+		rs.ExpectedVerdict,
+		rs.Verdict,
+		rs.CPUTime,
+		rs.Memory,
+		rs.Message,
+		rs.TestsPassed,
+		rs.TestsTotal,
+		resultsJSON,
+		rs.Revision,
+		rs.CreatedAt,
+		rs.UpdatedAt,
+	).Scan(&rs.ID); err != nil {
+		return types.ReferenceSolution{}, err
+	}
+	return rs, nil
+}
+
+// UpdateResult stores the judging outcome of a reference solution. Results
+// carrying an outdated revision match no row and yield ErrNotFound.
+func (r *ReferenceSolutionRepository) UpdateResult(ctx context.Context, rs types.ReferenceSolution) (types.ReferenceSolution, error) {
+	defer metrics.ObserveQuery("reference_solution", "UpdateResult")()
+	rs.UpdatedAt = time.Now()
+
+	resultsJSON, err := json.Marshal(rs.TestcaseResults)
+	if err != nil {
+		return types.ReferenceSolution{}, err
+	}
+
+	const query = `
+		UPDATE reference_solutions
+		SET verdict = $1,
+			cpu_time = $2,
+			memory = $3,
+			message = $4,
+			tests_passed = $5,
+			tests_total = $6,
+			testcase_results = $7,
+			updated_at = $8
+		WHERE id = $9 AND revision = $10`
+	result, err := r.db.ExecContext(
+		ctx,
+		query,
+		rs.Verdict,
+		rs.CPUTime,
+		rs.Memory,
+		rs.Message,
+		rs.TestsPassed,
+		rs.TestsTotal,
+		resultsJSON,
+		rs.UpdatedAt,
+		rs.ID,
+		rs.Revision,
+	)
+	if err != nil {
+		return types.ReferenceSolution{}, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return types.ReferenceSolution{}, err
+	}
+	if affected == 0 {
+		return types.ReferenceSolution{}, ErrNotFound
+	}
+	return rs, nil
+}
+
+// ResetResults clears the results of every reference solution of a problem,
+// bumps their revision and returns them ready to be re-queued.
+func (r *ReferenceSolutionRepository) ResetResults(ctx context.Context, problemID int) ([]types.ReferenceSolution, error) {
+	defer metrics.ObserveQuery("reference_solution", "ResetResults")()
+	query := `
+		UPDATE reference_solutions
+		SET verdict = $1,
+			cpu_time = 0,
+			memory = 0,
+			message = '',
+			tests_passed = 0,
+			tests_total = 0,
+			testcase_results = '[]'::jsonb,
+			revision = revision + 1,
+			updated_at = $2
+		WHERE problem_id = $3
+		RETURNING` + referenceSolutionColumns
+	rows, err := r.db.QueryContext(ctx, query, types.VerdictPending, time.Now(), problemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	solutions := make([]types.ReferenceSolution, 0)
+	for rows.Next() {
+		rs, err := scanReferenceSolution(rows)
+		if err != nil {
+			return nil, err
+		}
+		solutions = append(solutions, rs)
+	}
+	return solutions, rows.Err()
+}
+
+func (r *ReferenceSolutionRepository) Delete(ctx context.Context, id int64) error {
+	defer metrics.ObserveQuery("reference_solution", "Delete")()
+	const query = `DELETE FROM reference_solutions WHERE id = $1`
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/metrics"
+)
+
+// RunRepository handles persistence for custom invocations.
+type RunRepository struct {
+	db *sql.DB
+}
+
+func NewRunRepository(db *sql.DB) *RunRepository {
+	return &RunRepository{db: db}
+}
+
+func (r *RunRepository) Get(ctx context.Context, id int64) (types.Run, error) {
+	defer metrics.ObserveQuery("run", "Get")()
+	const query = `
+		SELECT id, user_id, problem_id, language, code, stdin, time_limit, memory_limit,
+		       status, stdout, stderr, exit_code, cpu_time, wall_time, memory, message,
+		       created_at, updated_at
+		FROM runs
+		WHERE id = $1`
+	var run types.Run
+	var problemID sql.NullInt64
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&run.ID,
+		&run.UserID,
+		&problemID,
+		&run.Language,
+		&run.Code,
+		&run.Stdin,
+		&run.TimeLimit,
+		&run.MemoryLimit,
+		&run.Status,
+		&run.Stdout,
+		&run.Stderr,
+		&run.ExitCode,
+		&run.CPUTime,
+		&run.WallTime,
+		&run.Memory,
+		&run.Message,
+		&run.CreatedAt,
+		&run.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.Run{}, ErrNotFound
+		}
+		return types.Run{}, err
+	}
+	run.ProblemID = int(problemID.Int64)
+	return run, nil
+}
+
+func (r *RunRepository) Create(ctx context.Context, run types.Run) (types.Run, error) {
+	defer metrics.ObserveQuery("run", "Create")()
+	now := time.Now()
+	run.CreatedAt = now
+	run.UpdatedAt = now
+
+	var problemID any
+	if run.ProblemID > 0 {
+		problemID = run.ProblemID
+	}
+
+	const query = `
+		INSERT INTO runs (
+			user_id, problem_id, language, code, stdin, time_limit, memory_limit,
+			status, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`
+	if err := r.db.QueryRowContext(
+		ctx,
+		query,
+		run.UserID,
+		problemID,
+		run.Language,
+		run.Code,
+		run.Stdin,
+		run.TimeLimit,
+		run.MemoryLimit,
+		run.Status,
+		run.CreatedAt,
+		run.UpdatedAt,
+	).Scan(&run.ID); err != nil {
+		return types.Run{}, err
+	}
+	return run, nil
+}
+
+// UpdateResult stores the status and output of a run.
+func (r *RunRepository) UpdateResult(ctx context.Context, run types.Run) (types.Run, error) {
+	defer metrics.ObserveQuery("run", "UpdateResult")()
+	run.UpdatedAt = time.Now()
+
+	const query = `
+		UPDATE runs
+		SET status = $1,
+			stdout = $2,
+			stderr = $3,
+			exit_code = $4,
+			cpu_time = $5,
+			wall_time = $6,
+			memory = $7,
+			message = $8,
+			updated_at = $9
+		WHERE id = $10`
+	result, err := r.db.ExecContext(
+		ctx,
+		query,
+		run.Status,
+		run.Stdout,
+		run.Stderr,
+		run.ExitCode,
+		run.CPUTime,
+		run.WallTime,
+		run.Memory,
+		run.Message,
+		run.UpdatedAt,
+		run.ID,
+	)
+	if err != nil {
+		return types.Run{}, dataError(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return types.Run{}, err
+	}
+	if affected == 0 {
+		return types.Run{}, ErrNotFound
+	}
+	return run, nil
+}
+
+func (r *RunRepository) Delete(ctx context.Context, id int64) error {
+	defer metrics.ObserveQuery("run", "Delete")()
+	const query = `DELETE FROM runs WHERE id = $1`
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/metrics"
 )
 
 // SubmissionRepository handles persistence for submissions.
@@ -21,15 +22,16 @@ func NewSubmissionRepository(db *sql.DB) *SubmissionRepository {
 }
 
 func (r *SubmissionRepository) Get(ctx context.Context, id int64) (types.Submission, error) {
+	defer metrics.ObserveQuery("submission", "Get")()
 	const query = `
 		SELECT s.id, s.problem_id, s.user_id, u.username, s.code, s.language, s.verdict, s.score,
-		       s.cpu_time, s.memory, s.message, s.tests_passed, s.tests_total,
-		       s.created_at, s.updated_at, s.testcase_results
+		       s.cpu_time, s.memory, s.message, s.tests_passed, s.tests_total, s.sample_only,
+		       s.created_at, s.updated_at, s.testcase_results, s.files, s.judge
 		FROM submissions s
 		LEFT JOIN users u ON u.id = s.user_id
 		WHERE s.id = $1`
 	var submission types.Submission
-	var resultsJSON []byte
+	var resultsJSON, filesJSON, judgeJSON []byte
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
 		&submission.ID,
 		&submission.ProblemID,
@@ -44,9 +46,12 @@ func (r *SubmissionRepository) Get(ctx context.Context, id int64) (types.Submiss
 		&submission.Message,
 		&submission.TestsPassed,
 		&submission.TestsTotal,
+		&submission.SampleOnly,
 		&submission.CreatedAt,
 		&submission.UpdatedAt,
 		&resultsJSON,
+		&filesJSON,
+		&judgeJSON,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -56,10 +61,50 @@ func (r *SubmissionRepository) Get(ctx context.Context, id int64) (types.Submiss
 	}
 
 	_ = json.Unmarshal(resultsJSON, &submission.TestcaseResults)
+	_ = json.Unmarshal(filesJSON, &submission.Files)
+	_ = json.Unmarshal(judgeJSON, &submission.Judge)
 	return submission, nil
 }
 
 func (r *SubmissionRepository) Create(ctx context.Context, submission types.Submission) (types.Submission, error) {
+	defer metrics.ObserveQuery("submission", "Create")()
+	return insertSubmission(ctx, r.db, submission, "")
+}
+
+// CreateWithOutbox inserts submission, recording outputsKey as the key of its
+// output archive, and, in the same transaction, the outbox message enqueue
+// returns for the created submission. Nothing is stored if enqueue fails.
+func (r *SubmissionRepository) CreateWithOutbox(ctx context.Context, submission types.Submission, outputsKey string, enqueue func(types.Submission) (OutboxMessage, error)) (types.Submission, error) {
+	defer metrics.ObserveQuery("submission", "CreateWithOutbox")()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.Submission{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	created, err := insertSubmission(ctx, tx, submission, outputsKey)
+	if err != nil {
+		return types.Submission{}, err
+	}
+	msg, err := enqueue(created)
+	if err != nil {
+		return types.Submission{}, err
+	}
+	if err = insertOutbox(ctx, tx, msg); err != nil {
+		return types.Submission{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return types.Submission{}, err
+	}
+	return created, nil
+}
+
+// insertSubmission inserts submission through q, a database or transaction.
+func insertSubmission(ctx context.Context, q rowQuerier, submission types.Submission, outputsKey string) (types.Submission, error) {
 	now := time.Now()
 	submission.CreatedAt = now
 	submission.UpdatedAt = now
@@ -68,16 +113,24 @@ func (r *SubmissionRepository) Create(ctx context.Context, submission types.Subm
 	if err != nil {
 		return types.Submission{}, err
 	}
+	files := submission.Files
+	if files == nil {
+		files = []types.SourceFile{}
+	}
+	filesJSON, err := json.Marshal(files)
+	if err != nil {
+		return types.Submission{}, err
+	}
 
 	const query = `
 		INSERT INTO submissions (
 			problem_id, user_id, code, language, verdict, score,
-			cpu_time, memory, message, tests_passed, tests_total,
-			created_at, updated_at, testcase_results
+			cpu_time, memory, message, tests_passed, tests_total, sample_only,
+			created_at, updated_at, testcase_results, files, outputs_key
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
 		RETURNING id`
-	if err := r.db.QueryRowContext(
+	if err := q.QueryRowContext(
 		ctx,
 		query,
 		submission.ProblemID,
@@ -91,9 +144,12 @@ func (r *SubmissionRepository) Create(ctx context.Context, submission types.Subm
 		submission.Message,
 		submission.TestsPassed,
 		submission.TestsTotal,
+		submission.SampleOnly,
 		submission.CreatedAt,
 		submission.UpdatedAt,
 		resultsJSON,
+		filesJSON,
+		outputsKey,
 	).Scan(&submission.ID); err != nil {
 		return types.Submission{}, err
 	}
@@ -102,12 +158,17 @@ func (r *SubmissionRepository) Create(ctx context.Context, submission types.Subm
 }
 
 func (r *SubmissionRepository) Update(ctx context.Context, submission types.Submission) (types.Submission, error) {
+	defer metrics.ObserveQuery("submission", "Update")()
 	submission.UpdatedAt = time.Now()
 
 	resultsJSON, err := json.Marshal(submission.TestcaseResults)
 	if err != nil {
 		return types.Submission{}, err
 	}
+	judgeJSON, err := json.Marshal(submission.Judge)
+	if err != nil {
+		return types.Submission{}, err
+	}
 
 	const query = `
 		UPDATE submissions
@@ -119,8 +180,9 @@ func (r *SubmissionRepository) Update(ctx context.Context, submission types.Subm
 			tests_passed = $6,
 			tests_total = $7,
 			updated_at = $8,
-			testcase_results = $9
-		WHERE id = $10`
+			testcase_results = $9,
+			judge = $10
+		WHERE id = $11`
 	result, err := r.db.ExecContext(
 		ctx,
 		query,
@@ -133,6 +195,7 @@ func (r *SubmissionRepository) Update(ctx context.Context, submission types.Subm
 		submission.TestsTotal,
 		submission.UpdatedAt,
 		resultsJSON,
+		judgeJSON,
 		submission.ID,
 	)
 	if err != nil {
@@ -149,8 +212,9 @@ func (r *SubmissionRepository) Update(ctx context.Context, submission types.Subm
 }
 
 func (r *SubmissionRepository) List(ctx context.Context, problemID, userID int) ([]types.Submission, error) {
+	defer metrics.ObserveQuery("submission", "List")()
 	query := `SELECT s.id, s.problem_id, s.user_id, u.username, s.code, s.language, s.verdict, s.score,
-	                 s.cpu_time, s.memory, s.message, s.tests_passed, s.tests_total,
+	                 s.cpu_time, s.memory, s.message, s.tests_passed, s.tests_total, s.sample_only,
 	                 s.created_at, s.updated_at, p.title
 	          FROM submissions s
 	          LEFT JOIN users u ON u.id = s.user_id
@@ -184,7 +248,7 @@ func (r *SubmissionRepository) List(ctx context.Context, problemID, userID int)
 		if err := rows.Scan(
 			&s.ID, &s.ProblemID, &s.UserID, &s.Username, &s.Code, &s.Language,
 			&s.Verdict, &s.Score, &s.CPUTime, &s.Memory, &s.Message,
-			&s.TestsPassed, &s.TestsTotal, &s.CreatedAt, &s.UpdatedAt, &s.ProblemTitle,
+			&s.TestsPassed, &s.TestsTotal, &s.SampleOnly, &s.CreatedAt, &s.UpdatedAt, &s.ProblemTitle,
 		); err != nil {
 			return nil, err
 		}
@@ -194,6 +258,7 @@ func (r *SubmissionRepository) List(ctx context.Context, problemID, userID int)
 }
 
 func (r *SubmissionRepository) Delete(ctx context.Context, id int64) error {
+	defer metrics.ObserveQuery("submission", "Delete")()
 	const query = `DELETE FROM submissions WHERE id = $1`
 	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
@@ -208,3 +273,127 @@ func (r *SubmissionRepository) Delete(ctx context.Context, id int64) error {
 	}
 	return nil
 }
+
+// StaleSubmission is an unfinished submission that has not progressed for
+// too long, with the number of times it was already re-enqueued.
+type StaleSubmission struct {
+	Submission types.Submission
+	Requeues   int
+	// OutputsKey is the stored key of the output archive; empty for
+	// submissions that are not output-only or predate the key.
+	OutputsKey string
+}
+
+// ListStale returns up to limit submissions PENDING since before
+// pendingBefore or JUDGING since before judgingBefore, oldest first. PENDING
+// submissions whose job is still in the outbox are not stale: they have not
+// reached the queue yet. Only the fields needed to judge them again are
+// loaded.
+func (r *SubmissionRepository) ListStale(ctx context.Context, pendingBefore, judgingBefore time.Time, limit int) ([]StaleSubmission, error) {
+	defer metrics.ObserveQuery("submission", "ListStale")()
+	const query = `
+		SELECT id, problem_id, user_id, code, language, verdict, sample_only,
+		       created_at, updated_at, files, judge_requeues, outputs_key
+		FROM submissions
+		WHERE (verdict = $1 AND updated_at < $2 AND NOT EXISTS (
+		           SELECT 1 FROM outbox WHERE attributes->>'submission_id' = submissions.id::text))
+		   OR (verdict = $3 AND updated_at < $4)
+		ORDER BY updated_at
+		LIMIT $5`
+	rows, err := r.db.QueryContext(ctx, query,
+		types.VerdictPending, pendingBefore, types.VerdictJudging, judgingBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stale []StaleSubmission
+	for rows.Next() {
+		var s StaleSubmission
+		var filesJSON []byte
+		if err := rows.Scan(
+			&s.Submission.ID,
+			&s.Submission.ProblemID,
+			&s.Submission.UserID,
+			&s.Submission.Code,
+			&s.Submission.Language,
+			&s.Submission.Verdict,
+			&s.Submission.SampleOnly,
+			&s.Submission.CreatedAt,
+			&s.Submission.UpdatedAt,
+			&filesJSON,
+			&s.Requeues,
+			&s.OutputsKey,
+		); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal(filesJSON, &s.Submission.Files)
+		stale = append(stale, s)
+	}
+	return stale, rows.Err()
+}
+
+// RequeueWithOutbox resets a stale submission to PENDING, counts the
+// requeue and, in the same transaction, adds the outbox message enqueue
+// returns for the reset submission. It reports false, changing nothing, if
+// the submission progressed since it was listed, so concurrent reapers
+// requeue it only once.
+func (r *SubmissionRepository) RequeueWithOutbox(ctx context.Context, submission types.Submission, enqueue func(types.Submission) (OutboxMessage, error)) (types.Submission, bool, error) {
+	defer metrics.ObserveQuery("submission", "RequeueWithOutbox")()
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return types.Submission{}, false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now()
+	const query = `
+		UPDATE submissions
+		SET verdict = $1, message = '', judge_requeues = judge_requeues + 1, updated_at = $2
+		WHERE id = $3 AND verdict = $4 AND updated_at = $5`
+	result, err := tx.ExecContext(ctx, query,
+		types.VerdictPending, now, submission.ID, submission.Verdict, submission.UpdatedAt)
+	if err != nil {
+		return types.Submission{}, false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return types.Submission{}, false, err
+	}
+	submission.Verdict = types.VerdictPending
+	submission.Message = ""
+	submission.UpdatedAt = now
+
+	msg, err := enqueue(submission)
+	if err != nil {
+		return types.Submission{}, false, err
+	}
+	if err := insertOutbox(ctx, tx, msg); err != nil {
+		return types.Submission{}, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return types.Submission{}, false, err
+	}
+	return submission, true, nil
+}
+
+// FailStale gives a stale submission the verdict INTERNAL_ERROR with
+// message. Like Requeue, it reports false if the submission progressed since
+// it was listed.
+func (r *SubmissionRepository) FailStale(ctx context.Context, submission types.Submission, message string) (bool, error) {
+	defer metrics.ObserveQuery("submission", "FailStale")()
+	const query = `
+		UPDATE submissions
+		SET verdict = $1, message = $2, updated_at = $3
+		WHERE id = $4 AND verdict = $5 AND updated_at = $6`
+	result, err := r.db.ExecContext(ctx, query,
+		types.VerdictInternalError, message, time.Now(), submission.ID, submission.Verdict, submission.UpdatedAt)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/metrics"
 )
 
 // UserRepository handles persistence for users.
@@ -19,6 +20,7 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 }
 
 func (r *UserRepository) GetByID(ctx context.Context, id int) (types.User, error) {
+	defer metrics.ObserveQuery("user", "GetByID")()
 	const query = `
 		SELECT id, username, email, name, role, password_hash, created_at, updated_at,
 		       bio, github, codeforces, atcoder, website, avatar_url
@@ -51,6 +53,7 @@ func (r *UserRepository) GetByID(ctx context.Context, id int) (types.User, error
 }
 
 func (r *UserRepository) GetByUsername(ctx context.Context, username string) (types.User, error) {
+	defer metrics.ObserveQuery("user", "GetByUsername")()
 	const query = `
 		SELECT id, username, email, name, role, password_hash, created_at, updated_at,
 		       bio, github, codeforces, atcoder, website, avatar_url
@@ -83,6 +86,7 @@ func (r *UserRepository) GetByUsername(ctx context.Context, username string) (ty
 }
 
 func (r *UserRepository) Create(ctx context.Context, user types.User) (types.User, error) {
+	defer metrics.ObserveQuery("user", "Create")()
 	now := time.Now()
 	user.CreatedAt = now
 	user.UpdatedAt = now
@@ -115,6 +119,7 @@ func (r *UserRepository) Create(ctx context.Context, user types.User) (types.Use
 }
 
 func (r *UserRepository) Update(ctx context.Context, user types.User) (types.User, error) {
+	defer metrics.ObserveQuery("user", "Update")()
 	user.UpdatedAt = time.Now()
 
 	const query = `
@@ -163,6 +168,7 @@ func (r *UserRepository) Update(ctx context.Context, user types.User) (types.Use
 }
 
 func (r *UserRepository) List(ctx context.Context, offset, limit int) ([]types.User, int, error) {
+	defer metrics.ObserveQuery("user", "List")()
 	const countQuery = `SELECT COUNT(*) FROM users`
 	var total int
 	if err := r.db.QueryRowContext(ctx, countQuery).Scan(&total); err != nil {
@@ -200,6 +206,7 @@ func (r *UserRepository) List(ctx context.Context, offset, limit int) ([]types.U
 }
 
 func (r *UserRepository) Delete(ctx context.Context, id int) error {
+	defer metrics.ObserveQuery("user", "Delete")()
 	const query = `DELETE FROM users WHERE id = $1`
 	result, err := r.db.ExecContext(ctx, query, id)
 	if err != nil {
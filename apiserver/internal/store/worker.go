@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/apiserver/internal/metrics"
+)
+
+// WorkerRepository handles persistence for the judge worker registry.
+type WorkerRepository struct {
+	db *sql.DB
+}
+
+func NewWorkerRepository(db *sql.DB) *WorkerRepository {
+	return &WorkerRepository{db: db}
+}
+
+const workerColumns = `
+	id, host, version, queue, languages, slots, free_slots, speed_factor,
+	state, jobs, started_at, last_seen_at`
+
+// Upsert stores a worker's latest heartbeat.
+func (r *WorkerRepository) Upsert(ctx context.Context, worker types.Worker) error {
+	defer metrics.ObserveQuery("worker", "Upsert")()
+	languages := worker.Languages
+	if languages == nil {
+		languages = []string{}
+	}
+	languagesJSON, err := json.Marshal(languages)
+	if err != nil {
+		return err
+	}
+	jobs := worker.Jobs
+	if jobs == nil {
+		jobs = []types.WorkerJob{}
+	}
+	jobsJSON, err := json.Marshal(jobs)
+	if err != nil {
+		return err
+	}
+
+	const query = `
+		INSERT INTO workers (` + workerColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (id) DO UPDATE
+		SET host = EXCLUDED.host,
+			version = EXCLUDED.version,
+			queue = EXCLUDED.queue,
+			languages = EXCLUDED.languages,
+			slots = EXCLUDED.slots,
+			free_slots = EXCLUDED.free_slots,
+			speed_factor = EXCLUDED.speed_factor,
+			state = EXCLUDED.state,
+			jobs = EXCLUDED.jobs,
+			started_at = EXCLUDED.started_at,
+			last_seen_at = EXCLUDED.last_seen_at`
+	_, err = r.db.ExecContext(
+		ctx,
+		query,
+		worker.ID,
+		worker.Host,
+		worker.Version,
+		worker.Queue,
+		languagesJSON,
+		worker.Slots,
+		worker.FreeSlots,
+		worker.SpeedFactor,
+		worker.State,
+		jobsJSON,
+		worker.StartedAt,
+		worker.LastSeenAt,
+	)
+	return err
+}
+
+func (r *WorkerRepository) Get(ctx context.Context, id string) (types.Worker, error) {
+	defer metrics.ObserveQuery("worker", "Get")()
+	query := `SELECT ` + workerColumns + ` FROM workers WHERE id = $1`
+	worker, err := scanWorker(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.Worker{}, ErrNotFound
+		}
+		return types.Worker{}, err
+	}
+	return worker, nil
+}
+
+// List returns all registered workers ordered by ID.
+func (r *WorkerRepository) List(ctx context.Context) ([]types.Worker, error) {
+	defer metrics.ObserveQuery("worker", "List")()
+	query := `SELECT ` + workerColumns + ` FROM workers ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	workers := []types.Worker{}
+	for rows.Next() {
+		worker, err := scanWorker(rows)
+		if err != nil {
+			return nil, err
+		}
+		workers = append(workers, worker)
+	}
+	return workers, rows.Err()
+}
+
+// Delete removes a worker from the registry. A worker that is still running
+// registers again with its next heartbeat.
+func (r *WorkerRepository) Delete(ctx context.Context, id string) error {
+	defer metrics.ObserveQuery("worker", "Delete")()
+	const query = `DELETE FROM workers WHERE id = $1`
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanWorker(row interface{ Scan(...any) error }) (types.Worker, error) {
+	var worker types.Worker
+	var languagesJSON, jobsJSON []byte
+	err := row.Scan(
+		&worker.ID,
+		&worker.Host,
+		&worker.Version,
+		&worker.Queue,
+		&languagesJSON,
+		&worker.Slots,
+		&worker.FreeSlots,
+		&worker.SpeedFactor,
+		&worker.State,
+		&jobsJSON,
+		&worker.StartedAt,
+		&worker.LastSeenAt,
+	)
+	if err != nil {
+		return types.Worker{}, err
+	}
+	_ = json.Unmarshal(languagesJSON, &worker.Languages)
+	_ = json.Unmarshal(jobsJSON, &worker.Jobs)
+	return worker, nil
+}
@@ -2,6 +2,7 @@ import Link from "next/link";
 import { notFound } from "next/navigation";
 
 import { api } from "@/lib/api";
+import { formatTermination, type Termination } from "@/lib/termination";
 
 type TestcaseResult = {
 	submission_id?: number;
@@ -13,6 +14,7 @@ type TestcaseResult = {
 	expected_output?: string;
 	actual_output?: string;
 	error_message?: string;
+	termination?: Termination;
 };
 
 type ContestSubmission = {
@@ -44,6 +46,9 @@ const verdictStyles: Record<string, string> = {
 	WA: "border-amber-500/50 bg-amber-500/10 text-amber-700",
 	TLE: "border-sky-500/40 bg-sky-500/10 text-sky-700",
 	MLE: "border-purple-500/40 bg-purple-500/10 text-purple-700",
+	OLE: "border-fuchsia-500/40 bg-fuchsia-500/10 text-fuchsia-700",
+	ILE: "border-indigo-500/40 bg-indigo-500/10 text-indigo-700",
+	SV: "border-red-500/40 bg-red-500/10 text-red-700",
 	RE: "border-rose-500/40 bg-rose-500/10 text-rose-700",
 	CE: "border-orange-500/40 bg-orange-500/10 text-orange-700",
 	SE: "border-red-500/40 bg-red-500/10 text-red-700",
@@ -189,6 +194,11 @@ export default async function ContestSubmissionPage({
 												<span className={`inline-flex border px-2 py-0.5 text-xs font-semibold uppercase ${tcClass}`}>
 													{tcVerdict}
 												</span>
+												{tr.termination && (
+													<span className="ml-2 text-xs text-muted-foreground">
+														{formatTermination(tr.termination)}
+													</span>
+												)}
 											</td>
 											<td className="px-4 py-3 text-muted-foreground">
 												{tr.cpu_time != null ? `${tr.cpu_time} ms` : "—"}
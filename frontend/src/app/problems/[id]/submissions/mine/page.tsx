@@ -34,6 +34,9 @@ const verdictStyles: Record<string, string> = {
 	WA: "border-amber-500/50 bg-amber-500/10 text-amber-700",
 	TLE: "border-sky-500/40 bg-sky-500/10 text-sky-700",
 	MLE: "border-purple-500/40 bg-purple-500/10 text-purple-700",
+	OLE: "border-fuchsia-500/40 bg-fuchsia-500/10 text-fuchsia-700",
+	ILE: "border-indigo-500/40 bg-indigo-500/10 text-indigo-700",
+	SV: "border-red-500/40 bg-red-500/10 text-red-700",
 	RE: "border-rose-500/40 bg-rose-500/10 text-rose-700",
 	CE: "border-orange-500/40 bg-orange-500/10 text-orange-700",
 	SE: "border-red-500/40 bg-red-500/10 text-red-700",
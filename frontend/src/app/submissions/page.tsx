@@ -26,6 +26,9 @@ const verdictStyles: Record<string, string> = {
 	WA: "text-amber-600 border-amber-500/40 bg-amber-500/5",
 	TLE: "text-sky-600 border-sky-500/40 bg-sky-500/5",
 	MLE: "text-purple-600 border-purple-500/40 bg-purple-500/5",
+	OLE: "text-fuchsia-600 border-fuchsia-500/40 bg-fuchsia-500/5",
+	ILE: "text-indigo-600 border-indigo-500/40 bg-indigo-500/5",
+	SV: "text-red-600 border-red-500/40 bg-red-500/5",
 	RE: "text-rose-600 border-rose-500/40 bg-rose-500/5",
 	CE: "text-orange-600 border-orange-500/40 bg-orange-500/5",
 	SE: "text-red-600 border-red-500/40 bg-red-500/5",
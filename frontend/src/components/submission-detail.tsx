@@ -4,6 +4,7 @@ import { useCallback, useEffect, useRef, useState } from "react";
 import { ChevronDown, ChevronRight } from "lucide-react";
 
 import { api } from "@/lib/api";
+import { formatTermination, type Termination } from "@/lib/termination";
 
 type TestcaseResult = {
 	testcase_id: number;
@@ -14,6 +15,7 @@ type TestcaseResult = {
 	expected_output?: string;
 	actual_output?: string;
 	error_message?: string;
+	termination?: Termination;
 };
 
 type Submission = {
@@ -40,6 +42,9 @@ const verdictStyles: Record<string, string> = {
 	WA: "text-amber-600 border-amber-500/40 bg-amber-500/5",
 	TLE: "text-sky-600 border-sky-500/40 bg-sky-500/5",
 	MLE: "text-purple-600 border-purple-500/40 bg-purple-500/5",
+	OLE: "text-fuchsia-600 border-fuchsia-500/40 bg-fuchsia-500/5",
+	ILE: "text-indigo-600 border-indigo-500/40 bg-indigo-500/5",
+	SV: "text-red-600 border-red-500/40 bg-red-500/5",
 	RE: "text-rose-600 border-rose-500/40 bg-rose-500/5",
 	CE: "text-orange-600 border-orange-500/40 bg-orange-500/5",
 	SE: "text-red-600 border-red-500/40 bg-red-500/5",
@@ -237,6 +242,9 @@ export function SubmissionDetail({ initialSubmission }: SubmissionDetailProps) {
 											</span>
 											<span className="font-mono text-xs text-muted-foreground">{formatCpuTime(tc.cpu_time)}</span>
 											<span className="font-mono text-xs text-muted-foreground">{formatMemory(tc.memory)}</span>
+											{tc.termination && (
+												<span className="shrink-0 text-[11px] font-mono text-muted-foreground">{formatTermination(tc.termination)}</span>
+											)}
 											{tc.error_message && (
 												<span className="text-[11px] text-muted-foreground truncate">{tc.error_message}</span>
 											)}
@@ -0,0 +1,28 @@
+export type Termination = {
+	reason: string;
+	signal?: string;
+	exit_code?: number;
+	syscall?: string;
+};
+
+export function formatTermination(t?: Termination) {
+	if (!t) return "";
+	switch (t.reason) {
+		case "cpu_time_limit":
+			return "CPU time limit exceeded";
+		case "wall_time_limit":
+			return "Wall time limit exceeded";
+		case "memory_limit":
+			return "Memory limit exceeded";
+		case "output_limit":
+			return "Output limit exceeded";
+		case "signal":
+			return `Runtime error (${t.signal ?? "signal"})`;
+		case "nonzero_exit":
+			return `Runtime error (exit code ${t.exit_code ?? 0})`;
+		case "seccomp_violation":
+			return t.syscall ? `Security violation (blocked ${t.syscall})` : "Security violation (forbidden system call)";
+		default:
+			return t.reason;
+	}
+}
@@ -2,6 +2,7 @@
 #include <string.h>
 
 #include "run.h"
+#include "serve.h"
 
 const char *VERSION = "0.1.0";
 const char *AUTHORS = "Joshua James";
@@ -13,6 +14,8 @@ static void print_usage(const char *prog) {
 int main(int argc, char **argv) {
     if (argc > 1 && strcmp(argv[1], "run") == 0) {
         return handle_run(argc, argv);
+    } else if(argc > 1 && strcmp(argv[1], "serve") == 0) {
+        return handle_serve(argc, argv);
     } else if(argc > 1 && strcmp(argv[1], "version") == 0) {
         printf("Lime v%s by %s\n", VERSION, AUTHORS);
         return 0;
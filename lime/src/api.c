@@ -31,6 +31,8 @@ void free_exec_request(ExecRequest *req) {
         free(req->bind_mounts);
     }
 
+    free_seccomp_policy(req->seccomp_policy);
+
     free(req);
 }
 
@@ -40,6 +42,7 @@ void free_exec_response(ExecResponse *resp) {
     free(resp->id);
     free(resp->stdout);
     free(resp->stderr);
+    free(resp->blocked_syscall);
 
     free(resp);
 }
@@ -2,11 +2,15 @@
 
 #include "cgroup.h"
 
+#include <errno.h>
 #include <fcntl.h>
 #include <inttypes.h>
 #include <stdbool.h>
 #include <stdio.h>
 #include <stdlib.h>
+#include <string.h>
+#include <sys/stat.h>
+#include <unistd.h>
 
 #include "utils.h"
 
@@ -265,3 +269,116 @@ int get_cgroup_stats(const char *cgroup_root, const char *cgroup_name, struct cg
 
     return 0;
 }
+
+int cpuset_count(const char *cpus) {
+    if (!cpus) return 0;
+    int count = 0;
+    const char *p = cpus;
+    while (*p) {
+        char *end;
+        long first = strtol(p, &end, 10);
+        if (end == p) return -1;
+        long last = first;
+        p = end;
+        if (*p == '-') {
+            p++;
+            last = strtol(p, &end, 10);
+            if (end == p || last < first) return -1;
+            p = end;
+        }
+        count += (int)(last - first + 1);
+        if (*p == ',') {
+            p++;
+        } else if (*p != '\0') {
+            return -1;
+        }
+    }
+    return count;
+}
+
+int cgroup_exists(const char *cgroup_root, const char *cgroup_name) {
+    if(!cgroup_root) {
+        cgroup_root = CGROUP_ROOT;
+    }
+
+    char *cgroup_path = join_paths(cgroup_root, cgroup_name);
+    if (!cgroup_path) {
+        return 0;
+    }
+    struct stat sb;
+    int exists = stat(cgroup_path, &sb) == 0 && S_ISDIR(sb.st_mode);
+    free(cgroup_path);
+    return exists;
+}
+
+int open_memory_peak(const char *cgroup_root, const char *cgroup_name) {
+    if(!cgroup_root) {
+        cgroup_root = CGROUP_ROOT;
+    }
+
+    char *cgroup_path = join_paths(cgroup_root, cgroup_name);
+    if (!cgroup_path) {
+        fprintf(stderr, "Failed to build cgroup path\n");
+        return -1;
+    }
+
+    // Page cache left behind by earlier runs is still charged to the
+    // cgroup; reclaim it so the reset baseline is close to zero. EAGAIN
+    // only means some pages could not be reclaimed.
+    char *current_path = join_paths(cgroup_path, "memory.current");
+    char *reclaim_path = join_paths(cgroup_path, "memory.reclaim");
+    if (current_path && reclaim_path) {
+        FILE *current_file = fopen(current_path, "r");
+        uint64_t current = 0;
+        if (current_file) {
+            if (fscanf(current_file, "%" SCNu64, &current) != 1) {
+                current = 0;
+            }
+            fclose(current_file);
+        }
+        if (current > 0) {
+            int fd = open(reclaim_path, O_WRONLY | O_CLOEXEC);
+            if (fd >= 0) {
+                char value_buffer[32];
+                int n = snprintf(value_buffer, sizeof(value_buffer), "%" PRIu64, current);
+                if (write(fd, value_buffer, n) < 0 && errno != EAGAIN) {
+                    fprintf(stderr, "Failed to reclaim memory of cgroup %s: %m\n", cgroup_name);
+                }
+                close(fd);
+            }
+        }
+    }
+    free(current_path);
+    free(reclaim_path);
+
+    char *peak_path = join_paths(cgroup_path, "memory.peak");
+    free(cgroup_path);
+    if (!peak_path) {
+        fprintf(stderr, "Failed to build memory.peak path\n");
+        return -1;
+    }
+    int fd = open(peak_path, O_RDWR | O_CLOEXEC);
+    free(peak_path);
+    if (fd < 0) {
+        return -1;
+    }
+    // Kernels before 6.12 reject writes to memory.peak.
+    if (write(fd, "reset", strlen("reset")) < 0) {
+        close(fd);
+        return -1;
+    }
+    return fd;
+}
+
+int read_memory_peak(int fd, uint64_t *peak) {
+    char buf[32];
+    ssize_t n = pread(fd, buf, sizeof(buf) - 1, 0);
+    if (n <= 0) {
+        return -1;
+    }
+    buf[n] = '\0';
+    if (sscanf(buf, "%" SCNu64, peak) != 1) {
+        return -1;
+    }
+    return 0;
+}
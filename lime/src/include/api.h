@@ -5,6 +5,8 @@
 #include <stdlib.h>
 #include <sys/types.h>
 
+#include "seccomp.h"
+
 typedef struct {
     char *id;
 
@@ -23,6 +25,8 @@ typedef struct {
     uint64_t stack_limit_bytes;
 
     char *use_cpus; // e.g. "0-3,5"
+    /** CPUs the quota allows; 0 counts use_cpus, which is empty when unpinned */
+    uint32_t cpu_count;
     char *use_mems; // e.g. "0,2"
 
     char *stdin;
@@ -37,6 +41,9 @@ typedef struct {
 
     uid_t host_uid;
     gid_t host_gid;
+
+    /** syscall filter used with --use_seccomp_bpf; NULL selects the built-in allowlist */
+    SeccompPolicy *seccomp_policy;
 } ExecRequest;
 
 typedef struct {
@@ -51,6 +58,9 @@ typedef struct {
 
     char *stdout;
     char *stderr;
+
+    /** name of the syscall the seccomp filter blocked, NULL if none */
+    char *blocked_syscall;
 } ExecResponse;
 
 void free_exec_request(ExecRequest *req);
@@ -24,4 +24,23 @@ int put_process_in_cgroup(const char *cgroup_root, const char *cgroup_name, pid_
 int delete_cgroup(const char *cgroup_root, const char *cgroup_name);
 int get_cgroup_stats(const char *cgroup_root, const char *cgroup_name, struct cgroup_stats *stats);
 
+/**
+ * Returns the number of CPUs in a cpuset list such as "0-3,5", 0 for an
+ * empty list, or -1 if the list is malformed.
+ */
+int cpuset_count(const char *cpus);
+
+/** Returns 1 if the cgroup exists, 0 otherwise. */
+int cgroup_exists(const char *cgroup_root, const char *cgroup_name);
+
+/**
+ * Opens the cgroup's memory.peak and resets it, so reads through the
+ * returned fd report the peak since the reset. Returns -1 if the kernel
+ * does not support resetting (before Linux 6.12).
+ */
+int open_memory_peak(const char *cgroup_root, const char *cgroup_name);
+
+/** Reads the peak memory usage through an fd from open_memory_peak. */
+int read_memory_peak(int fd, uint64_t *peak);
+
 #endif
@@ -9,6 +9,9 @@ typedef struct {
 
     int stdout_fd;
     char *stdout_buf;
+    // stdout_limit caps the captured stdout; the rest is discarded. 0 keeps
+    // everything.
+    size_t stdout_limit;
 
     int stderr_fd;
     char *stderr_buf;
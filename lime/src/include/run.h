@@ -1,6 +1,23 @@
 #ifndef RUN_H
 #define RUN_H
 
+#include "api.h"
+
 int handle_run(int argc, char **argv);
 
+/**
+ * Parses an ExecRequest from JSON. If use_seccomp_bpf is non-NULL it is set
+ * from the optional "use_seccomp_bpf" field, which lime serve requests carry
+ * in place of the command-line flag.
+ */
+ExecRequest *parse_exec_request(const char *input, int *use_seccomp_bpf);
+
+/**
+ * Runs req in a container and stores the ExecResponse JSON in out_json.
+ * With a session name, the container directory and cgroup are named after
+ * the session and kept for the session's next run instead of being removed.
+ * Returns 0 on success.
+ */
+int execute_request(ExecRequest *req, int use_seccomp_bpf, const char *session, char **out_json);
+
 #endif
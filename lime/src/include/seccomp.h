@@ -1,3 +1,44 @@
 #pragma once
 
-int apply_seccomp_filter(void);
+#include <stddef.h>
+
+/**
+ * A syscall filter policy. Syscalls in deny are always blocked, syscalls in
+ * allow are permitted, and everything else falls back to the default action.
+ * Syscalls are identified by their x86_64 numbers.
+ */
+typedef struct {
+    int default_allow;
+
+    int *allow;
+    size_t allow_c;
+
+    int *deny;
+    size_t deny_c;
+} SeccompPolicy;
+
+/** Returns the syscall number for name, or -1 if lime does not know it. */
+int seccomp_syscall_nr(const char *name);
+
+/** Returns the name of syscall nr, or NULL if lime does not know it. */
+const char *seccomp_syscall_name(int nr);
+
+/** Returns the built-in allowlist used when a request carries no policy. */
+const SeccompPolicy *seccomp_default_policy(void);
+
+void free_seccomp_policy(SeccompPolicy *policy);
+
+/**
+ * Installs policy on the calling thread. Blocked syscalls are reported on
+ * the returned user notification listener fd instead of killing the process,
+ * so the caller can hand the listener to a supervisor that records the
+ * syscall. Returns the listener fd, or -1 on error.
+ */
+int apply_seccomp_filter(const SeccompPolicy *policy);
+
+/**
+ * Receives one notification from listener_fd and stores the blocked syscall
+ * number in nr. The notifying process stays blocked; the supervisor is
+ * expected to kill it. Returns 0 on success, -1 on error.
+ */
+int seccomp_receive_notification(int listener_fd, int *nr);
@@ -0,0 +1,6 @@
+#ifndef SERVE_H
+#define SERVE_H
+
+int handle_serve(int argc, char **argv);
+
+#endif
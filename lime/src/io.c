@@ -19,6 +19,7 @@ typedef struct {
 
 typedef struct {
     int fd;
+    size_t limit;
     char *buf;
     int error;
 } ReaderArgs;
@@ -65,7 +66,7 @@ static void *stdin_writer(void *arg) {
 static void *pipe_reader(void *arg) {
     ReaderArgs *a = arg;
  
-    a->buf = read_all_from_fd(a->fd);
+    a->buf = read_all_from_fd(a->fd, a->limit);
     if (!a->buf) {
         a->error = errno ? errno : EIO;
     }
@@ -103,7 +104,7 @@ int io_start(IOContext *ctx) {
     t->threads_started |= (1 << 0);
 
     // stdout
-    t->stdout_args = (ReaderArgs){ .fd = ctx->stdout_fd };
+    t->stdout_args = (ReaderArgs){ .fd = ctx->stdout_fd, .limit = ctx->stdout_limit };
     if (pthread_create(&t->stdout_tid, NULL, pipe_reader, &t->stdout_args) != 0) {
         perror("pthread_create stdout reader");
         /* stdin thread is running; join it before bailing */
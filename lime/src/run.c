@@ -39,8 +39,10 @@ static const int MB = 1048576;
 
 static ExecRequest* read_exec_request_from_stdin();
 static ExecRequest* parse_exec_request_from_json(cJSON *json);
+static SeccompPolicy* parse_seccomp_policy_from_json(cJSON *json);
+static int parse_syscall_list(cJSON *json, const char *field, int **out, size_t *out_c);
 static int setup_uid_gid_maps(pid_t pid, uid_t host_uid, gid_t host_gid);
-static int waitpid_with_timeout(pid_t pid, int *exit_code, int *signal, uint64_t *wall_time, uint64_t timeout_us);
+static int waitpid_with_timeout(pid_t pid, int notify_fd, int *blocked_nr, int *exit_code, int *signal, uint64_t *wall_time, uint64_t timeout_us);
 static int create_response_json(const ExecResponse *resp, char **out_json);
 
 // child bootstrap helpers
@@ -53,6 +55,8 @@ static void set_rlimit(int resource, rlim_t soft, rlim_t hard);
 // socket helpers
 static int write_byte(int fd, char b);
 static int read_byte(int fd, char *out);
+static int send_fd(int sock, int fd);
+static int recv_fd(int sock);
 
 static void print_usage(const char *prog) {
     fprintf(stderr, "Runs a containerized process.\n");
@@ -60,7 +64,8 @@ static void print_usage(const char *prog) {
     fprintf(stderr, "Usage:\n");
     fprintf(stderr, "  %s run [--use_seccomp_bpf]\n\n", prog);
     fprintf(stderr, "Options:\n");
-    fprintf(stderr, "  --use_seccomp_bpf  Apply a seccomp-BPF syscall allowlist filter to the child process.\n");
+    fprintf(stderr, "  --use_seccomp_bpf  Apply a seccomp-BPF syscall filter to the child process: the request's\n");
+    fprintf(stderr, "                     seccomp_policy, or a built-in allowlist when it has none.\n");
     fprintf(stderr, "\n");
     fprintf(stderr, "The container configuration is read as JSON from stdin. See src/include/api.h for the ExecRequest definition.\n");
     fprintf(stderr, "\n");
@@ -72,6 +77,7 @@ struct child_args {
     int out_fd;
     int err_fd;
     ExecRequest *cfg;
+    const char *ctr_name;
     int use_seccomp_bpf;
 };
 
@@ -107,23 +113,38 @@ int handle_run(int argc, char **argv) {
         return 1;
     }
 
-    // Create /tmp/lime/<id> in the parent while still running as real root,
+    char *out_json = NULL;
+    int rc = execute_request(req, use_seccomp_bpf, NULL, &out_json);
+    free_exec_request(req);
+    if (rc != 0) {
+        return 1;
+    }
+
+    printf("%s\n", out_json);
+    free(out_json);
+
+    return 0;
+}
+
+int execute_request(ExecRequest *req, int use_seccomp_bpf, const char *session, char **out_json) {
+    // Sessions name the container directory and cgroup so later runs find
+    // them again; one-shot runs use the request id.
+    const char *name = session ? session : req->id;
+
+    // Create /tmp/lime/<name> in the parent while still running as real root,
     // before clone() drops us into the user namespace as host_uid.
     if(create_directory_if_not_exists("/tmp/lime") != 0) {
         perror("create_directory_if_not_exists /tmp/lime");
-        free_exec_request(req);
         return 1;
     }
-    char *ctr_dir = join_paths("/tmp/lime", req->id);
+    char *ctr_dir = join_paths("/tmp/lime", name);
     if(!ctr_dir) {
         fprintf(stderr, "Failed to allocate ctr_dir\n");
-        free_exec_request(req);
         return 1;
     }
     if(create_directory_if_not_exists(ctr_dir) != 0) {
         perror("create_directory_if_not_exists ctr_dir");
         free(ctr_dir);
-        free_exec_request(req);
         return 1;
     }
     free(ctr_dir);
@@ -131,7 +152,6 @@ int handle_run(int argc, char **argv) {
     void *stack = malloc(CHILD_STACK_SIZE);
     if (!stack) {
         fprintf(stderr, "Failed to allocate stack for child\n");
-        free_exec_request(req);
         return 1;
     }
 
@@ -167,6 +187,7 @@ int handle_run(int argc, char **argv) {
         .out_fd = out_pipe[1],
         .err_fd = err_pipe[1],
         .cfg = req,
+        .ctr_name = name,
         .use_seccomp_bpf = use_seccomp_bpf,
     };
 
@@ -224,10 +245,16 @@ int handle_run(int argc, char **argv) {
         return 1;
     }
 
+    // The quota allows one full CPU per CPU the run was given, so the
+    // threads of a multi-CPU run are not throttled below them. Without
+    // cpu_count the cpuset tells, unless the run is not pinned.
+    int ncpus = req->cpu_count > 0 ? (int)req->cpu_count : cpuset_count(req->use_cpus);
+    if (ncpus < 1) ncpus = 1;
+
     struct cgroup_config cg_cfg = {
-        .name = req->id,
+        .name = (char *)name,
         .cpu_weight = 1000,
-        .cpu_quota_us = 100000,
+        .cpu_quota_us = 100000 * ncpus,
         .memory_limit_bytes = req->memory_limit_bytes,
         .pids_limit = req->max_processes,
         .use_cpus = req->use_cpus,
@@ -236,8 +263,28 @@ int handle_run(int argc, char **argv) {
 
     const char *cgroup_root = getenv("LIME_CGROUP_ROOT");
 
+    // A session's cgroup outlives its runs. It is reused when memory.peak
+    // can be reset for this run, and recreated otherwise so the stats
+    // cover this run only.
+    int peak_fd = -1;
+    uint64_t cpu_base_us = 0;
+    if (session && cgroup_exists(cgroup_root, name)) {
+        peak_fd = open_memory_peak(cgroup_root, name);
+        struct cgroup_stats base;
+        if (peak_fd >= 0 && get_cgroup_stats(cgroup_root, name, &base) == 0) {
+            cpu_base_us = base.cpu_usage_us;
+        } else {
+            if (peak_fd >= 0) {
+                close(peak_fd);
+                peak_fd = -1;
+            }
+            delete_cgroup(cgroup_root, name);
+        }
+    }
+
     if(create_cgroup(cgroup_root, &cg_cfg) != 0) {
         fprintf(stderr, "Failed to create cgroup\n");
+        if (peak_fd >= 0) close(peak_fd);
         kill(child_pid, SIGKILL);
         close(sv[0]);
         close(sv[1]);
@@ -245,9 +292,10 @@ int handle_run(int argc, char **argv) {
         return 1;
     }
 
-    if(put_process_in_cgroup(cgroup_root, req->id, child_pid) != 0) {
+    if(put_process_in_cgroup(cgroup_root, name, child_pid) != 0) {
         fprintf(stderr, "Failed to put process in cgroup\n");
-        delete_cgroup(cgroup_root, req->id);
+        if (peak_fd >= 0) close(peak_fd);
+        delete_cgroup(cgroup_root, name);
         kill(child_pid, SIGKILL);
         close(sv[0]);
         close(sv[1]);
@@ -258,71 +306,104 @@ int handle_run(int argc, char **argv) {
     // Start IO threads before unblocking the child to exec, so stdin is
     // written and stdout/stderr are drained concurrently with execution.
     // This prevents deadlock when input or output exceeds the 64 KB pipe buffer.
+    // RLIMIT_FSIZE does not apply to the stdout pipe, so stdout is capped
+    // here instead; one byte past the limit tells the caller it was exceeded.
     IOContext io_ctx = {
         .stdin_fd  = in_pipe[1],
         .stdin_buf = req->stdin,
         .stdin_len = strlen(req->stdin),
         .stdout_fd = out_pipe[0],
+        .stdout_limit = req->output_limit_bytes ? req->output_limit_bytes + 1 : 0,
         .stderr_fd = err_pipe[0],
     };
     if (io_start(&io_ctx) != 0) {
         fprintf(stderr, "Failed to start IO\n");
-        delete_cgroup(cgroup_root, req->id);
+        if (peak_fd >= 0) close(peak_fd);
+        delete_cgroup(cgroup_root, name);
         kill(child_pid, SIGKILL);
         close(sv[0]);
         close(sv[1]);
         free(stack);
-        free_exec_request(req);
         return 1;
     }
 
     // notify child to drop capabilities
     if(write_byte(sv[0], 'C') != 0) {
         perror("write_byte C");
-        delete_cgroup(cgroup_root, req->id);
+        if (peak_fd >= 0) close(peak_fd);
+        delete_cgroup(cgroup_root, name);
         kill(child_pid, SIGKILL);
         close(sv[0]);
         close(sv[1]);
         free(stack);
         io_wait(&io_ctx);
         io_free(&io_ctx);
-        free_exec_request(req);
         return 1;
     }
 
-    int exit_code = 0, signal = 0;
+    // With seccomp the child hands over the filter's notification listener
+    // so blocked syscalls can be recorded here.
+    int listener_fd = -1;
+    if (use_seccomp_bpf) {
+        listener_fd = recv_fd(sv[0]);
+        if (listener_fd < 0) {
+            fprintf(stderr, "Failed to receive seccomp listener from child\n");
+            if (peak_fd >= 0) close(peak_fd);
+            delete_cgroup(cgroup_root, name);
+            kill(child_pid, SIGKILL);
+            close(sv[0]);
+            close(sv[1]);
+            free(stack);
+            io_wait(&io_ctx);
+            io_free(&io_ctx);
+            return 1;
+        }
+    }
+
+    int exit_code = 0, signal = 0, blocked_nr = -1;
     uint64_t wall_time = 0;
-    if(waitpid_with_timeout(child_pid, &exit_code, &signal, &wall_time, req->wall_time_limit_us) != 0) {
+    if(waitpid_with_timeout(child_pid, listener_fd, &blocked_nr, &exit_code, &signal, &wall_time, req->wall_time_limit_us) != 0) {
         if(errno != ETIMEDOUT) {
             fprintf(stderr, "waitpid_with_timeout failed: %m (errno=%d)\n", errno);
             kill(child_pid, SIGKILL);
-            delete_cgroup(cgroup_root, req->id);
+            if (peak_fd >= 0) close(peak_fd);
+            delete_cgroup(cgroup_root, name);
+            if (listener_fd >= 0) close(listener_fd);
             close(sv[0]);
             close(sv[1]);
             free(stack);
             io_wait(&io_ctx);
             io_free(&io_ctx);
-            free_exec_request(req);
             return 1;
         }
     }
+    if (listener_fd >= 0) close(listener_fd);
     fprintf(stderr, "Child process exited with exit code %d and signal %d\n", exit_code, signal);
 
     close(sv[0]);
     close(sv[1]);
-    // delete_cgroup(cgroup_root, req->id);
+    // delete_cgroup(cgroup_root, name);
     free(stack);
 
     struct cgroup_stats stats;
-    if(get_cgroup_stats(cgroup_root, req->id, &stats) != 0) {
+    if(get_cgroup_stats(cgroup_root, name, &stats) != 0) {
         fprintf(stderr, "Failed to get cgroup stats\n");
-        delete_cgroup(cgroup_root, req->id);
+        if (peak_fd >= 0) close(peak_fd);
+        delete_cgroup(cgroup_root, name);
         io_wait(&io_ctx);
         io_free(&io_ctx);
-        free_exec_request(req);
         return 1;
     }
 
+    if (peak_fd >= 0) {
+        stats.cpu_usage_us -= cpu_base_us;
+        if (read_memory_peak(peak_fd, &stats.memory_usage_bytes) != 0) {
+            fprintf(stderr, "Failed to read memory.peak\n");
+        }
+        close(peak_fd);
+        peak_fd = -1;
+    }
+
     io_wait(&io_ctx);
     char *stdout_output = io_ctx.stdout_buf;
     char *stderr_output = io_ctx.stderr_buf;
@@ -330,10 +411,9 @@ int handle_run(int argc, char **argv) {
     ExecResponse *resp = malloc(sizeof(ExecResponse));
     if (!resp) {
         fprintf(stderr, "Failed to allocate ExecResponse\n");
-        delete_cgroup(cgroup_root, req->id);
+        delete_cgroup(cgroup_root, name);
         free(stdout_output);
         free(stderr_output);
-        free_exec_request(req);
         return 1;
     }
 
@@ -345,21 +425,30 @@ int handle_run(int argc, char **argv) {
     resp->memory_bytes = stats.memory_usage_bytes;
     resp->stdout = stdout_output;
     resp->stderr = stderr_output;
+    resp->blocked_syscall = NULL;
+    if (blocked_nr >= 0) {
+        // lime kills the container itself, but report it the way a
+        // SECCOMP_RET_KILL_PROCESS filter would.
+        resp->exit_code = 0;
+        resp->term_signal = SIGSYS;
+        const char *sys_name = seccomp_syscall_name(blocked_nr);
+        if (sys_name) {
+            resp->blocked_syscall = strdup(sys_name);
+        } else if (asprintf(&resp->blocked_syscall, "syscall_%d", blocked_nr) < 0) {
+            resp->blocked_syscall = NULL;
+        }
+    }
 
-    char *out_json; 
-    if(create_response_json(resp, &out_json) != 0) {
+    if(create_response_json(resp, out_json) != 0) {
         fprintf(stderr, "Failed to create response JSON\n");
         free_exec_response(resp);
-        delete_cgroup(cgroup_root, req->id);
-        free_exec_request(req);
+        delete_cgroup(cgroup_root, name);
         return 1;
     }
 
-    printf("%s\n", out_json);
-
-    free(out_json);
-    delete_cgroup(cgroup_root, req->id);
-    free_exec_request(req);
+    if (!session) {
+        delete_cgroup(cgroup_root, name);
+    }
     free_exec_response(resp);
 
     return 0;
@@ -369,15 +458,19 @@ static ExecRequest* read_exec_request_from_stdin() {
     char *input = read_all_from_stdin();
     if (!input) {
         fprintf(stderr, "Failed to read ExecRequest from stdin\n");
-        free(input);
         return NULL;
     }
 
-    cJSON *json = cJSON_Parse(input);
+    ExecRequest *req = parse_exec_request(input, NULL);
     free(input);
 
+    return req;
+}
+
+ExecRequest *parse_exec_request(const char *input, int *use_seccomp_bpf) {
+    cJSON *json = cJSON_Parse(input);
     if(!json) {
-        fprintf(stderr, "Failed to parse ExecRequest JSON from stdin\n");
+        fprintf(stderr, "Failed to parse ExecRequest JSON\n");
         return NULL;
     }
 
@@ -387,6 +480,10 @@ static ExecRequest* read_exec_request_from_stdin() {
         return NULL;
     }
 
+    if (use_seccomp_bpf) {
+        *use_seccomp_bpf = cJSON_IsTrue(cJSON_GetObjectItemCaseSensitive(json, "use_seccomp_bpf"));
+    }
+
     ExecRequest *req = parse_exec_request_from_json(json);
     cJSON_Delete(json);
 
@@ -586,6 +683,21 @@ static ExecRequest* parse_exec_request_from_json(cJSON *json) {
         return NULL;
     }
 
+    cJSON *cpu_count = cJSON_GetObjectItemCaseSensitive(json, "cpu_count");
+    if (cpu_count && !cJSON_IsNull(cpu_count)) {
+        if(!cJSON_IsNumber(cpu_count)) {
+            fprintf(stderr, "ExecRequest.cpu_count is not a number\n");
+            free_exec_request(req);
+            return NULL;
+        }
+        if(cpu_count->valuedouble < 0) {
+            fprintf(stderr, "ExecRequest.cpu_count is negative\n");
+            free_exec_request(req);
+            return NULL;
+        }
+        req->cpu_count = (uint32_t)cpu_count->valuedouble;
+    }
+
     cJSON *use_mems = cJSON_GetObjectItemCaseSensitive(json, "use_mems");
     if(!cJSON_IsString(use_mems)) {
         fprintf(stderr, "ExecRequest.use_mems is not a string\n");
@@ -681,9 +793,96 @@ static ExecRequest* parse_exec_request_from_json(cJSON *json) {
     }
     req->host_gid = (gid_t)cJSON_GetNumberValue(host_gid);
 
+    cJSON *seccomp_policy = cJSON_GetObjectItemCaseSensitive(json, "seccomp_policy");
+    if (seccomp_policy && !cJSON_IsNull(seccomp_policy)) {
+        req->seccomp_policy = parse_seccomp_policy_from_json(seccomp_policy);
+        if (!req->seccomp_policy) {
+            free_exec_request(req);
+            return NULL;
+        }
+    }
+
     return req;
 }
 
+static SeccompPolicy* parse_seccomp_policy_from_json(cJSON *json) {
+    if (!cJSON_IsObject(json)) {
+        fprintf(stderr, "ExecRequest.seccomp_policy is not an object\n");
+        return NULL;
+    }
+
+    SeccompPolicy *policy = calloc(1, sizeof(SeccompPolicy));
+    if (!policy) {
+        fprintf(stderr, "Failed to allocate SeccompPolicy\n");
+        return NULL;
+    }
+
+    cJSON *default_action = cJSON_GetObjectItemCaseSensitive(json, "default_action");
+    if (!cJSON_IsString(default_action)) {
+        fprintf(stderr, "ExecRequest.seccomp_policy.default_action is not a string\n");
+        free_seccomp_policy(policy);
+        return NULL;
+    }
+    if (strcmp(default_action->valuestring, "allow") == 0) {
+        policy->default_allow = 1;
+    } else if (strcmp(default_action->valuestring, "kill") == 0) {
+        policy->default_allow = 0;
+    } else {
+        fprintf(stderr, "ExecRequest.seccomp_policy.default_action must be \"allow\" or \"kill\"\n");
+        free_seccomp_policy(policy);
+        return NULL;
+    }
+
+    if (parse_syscall_list(json, "allow", &policy->allow, &policy->allow_c) != 0 ||
+        parse_syscall_list(json, "deny", &policy->deny, &policy->deny_c) != 0) {
+        free_seccomp_policy(policy);
+        return NULL;
+    }
+
+    return policy;
+}
+
+// Parses the optional array of syscall names json[field] into numbers.
+static int parse_syscall_list(cJSON *json, const char *field, int **out, size_t *out_c) {
+    cJSON *list = cJSON_GetObjectItemCaseSensitive(json, field);
+    if (!list || cJSON_IsNull(list)) {
+        return 0;
+    }
+    if (!cJSON_IsArray(list)) {
+        fprintf(stderr, "ExecRequest.seccomp_policy.%s is not an array\n", field);
+        return -1;
+    }
+
+    int list_c = cJSON_GetArraySize(list);
+    if (list_c == 0) {
+        return 0;
+    }
+    int *nrs = calloc(list_c, sizeof(int));
+    if (!nrs) {
+        fprintf(stderr, "Failed to allocate ExecRequest.seccomp_policy.%s\n", field);
+        return -1;
+    }
+
+    for (int i = 0; i < list_c; i++) {
+        cJSON *name = cJSON_GetArrayItem(list, i);
+        if (!cJSON_IsString(name)) {
+            fprintf(stderr, "ExecRequest.seccomp_policy.%s[%d] is not a string\n", field, i);
+            free(nrs);
+            return -1;
+        }
+        nrs[i] = seccomp_syscall_nr(name->valuestring);
+        if (nrs[i] < 0) {
+            fprintf(stderr, "ExecRequest.seccomp_policy.%s[%d]: unknown syscall %s\n", field, i, name->valuestring);
+            free(nrs);
+            return -1;
+        }
+    }
+
+    *out = nrs;
+    *out_c = (size_t)list_c;
+    return 0;
+}
+
 static int setup_uid_gid_maps(pid_t pid, uid_t host_uid, gid_t host_gid) {
     char pid_s[32];
     snprintf(pid_s, sizeof(pid_s), "%d", pid);
@@ -758,11 +957,14 @@ static inline uint64_t now_us(void) {
     return (uint64_t)ts.tv_sec * 1000000ULL + (uint64_t)ts.tv_nsec / 1000ULL;
 }
 
-static int waitpid_with_timeout(pid_t pid, int *exit_code, int *signal, uint64_t *wall_time, uint64_t timeout_us) {
-    if (!exit_code || !signal || !wall_time) {
+// Waits for pid for at most timeout_us. When notify_fd is a seccomp listener,
+// the first blocked syscall is stored in blocked_nr and the process is killed.
+static int waitpid_with_timeout(pid_t pid, int notify_fd, int *blocked_nr, int *exit_code, int *signal, uint64_t *wall_time, uint64_t timeout_us) {
+    if (!blocked_nr || !exit_code || !signal || !wall_time) {
         errno = EINVAL;
         return -1;
     }
+    *blocked_nr = -1;
 
     uint64_t start_time = now_us();
 
@@ -792,24 +994,42 @@ static int waitpid_with_timeout(pid_t pid, int *exit_code, int *signal, uint64_t
         return -1;
     }
 
-    struct pollfd fds = {
-        .fd = pfd,
-        .events = POLLIN,
-        .revents = 0
+    // poll ignores the listener entry while its fd is negative.
+    struct pollfd fds[2] = {
+        { .fd = pfd, .events = POLLIN, .revents = 0 },
+        { .fd = notify_fd, .events = POLLIN, .revents = 0 },
     };
 
-    int timeout_ms;
-    if (timeout_us >= (uint64_t)INT32_MAX * 1000ULL) timeout_ms = INT32_MAX;
-    else timeout_ms = (int)((timeout_us + 999) / 1000); // use ceil
-
     int ready;
-    do {
-        if(now_us() - start_time >= timeout_us) {
+    for (;;) {
+        uint64_t elapsed = now_us() - start_time;
+        if (elapsed >= timeout_us) {
             ready = 0;
             break;
         }
-        ready = poll(&fds, 1, timeout_ms);
-    } while (ready == -1 && errno == EINTR);
+        uint64_t remaining_us = timeout_us - elapsed;
+        int timeout_ms;
+        if (remaining_us >= (uint64_t)INT32_MAX * 1000ULL) timeout_ms = INT32_MAX;
+        else timeout_ms = (int)((remaining_us + 999) / 1000); // use ceil
+
+        ready = poll(fds, 2, timeout_ms);
+        if (ready == -1 && errno == EINTR) continue;
+        if (ready <= 0) break;
+
+        if (fds[1].revents & POLLIN) {
+            int nr;
+            if (seccomp_receive_notification(notify_fd, &nr) == 0 && *blocked_nr < 0) {
+                *blocked_nr = nr;
+            }
+            // The blocked process waits for a reply that never comes; tear
+            // the whole container down instead.
+            kill(pid, SIGKILL);
+        }
+        if (fds[1].revents & (POLLHUP | POLLERR | POLLNVAL)) {
+            fds[1].fd = -1;
+        }
+        if (fds[0].revents) break;
+    }
 
     if (ready == -1) {
         perror("poll");
@@ -839,9 +1059,9 @@ static int waitpid_with_timeout(pid_t pid, int *exit_code, int *signal, uint64_t
         return -1;
     }
 
-    if (!(fds.revents & (POLLIN | POLLHUP))) {
+    if (!(fds[0].revents & (POLLIN | POLLHUP))) {
         // Something odd (POLLNVAL, etc.)
-        fprintf(stderr, "poll returned unexpected revents: 0x%x\n", fds.revents);
+        fprintf(stderr, "poll returned unexpected revents: 0x%x\n", fds[0].revents);
         close(pfd);
         errno = EIO;
         return -1;
@@ -891,6 +1111,9 @@ static int create_response_json(const ExecResponse *resp, char **out_json) {
     cJSON_AddNumberToObject(json, "memory_bytes", resp->memory_bytes);
     cJSON_AddStringToObject(json, "stdout", resp->stdout);
     cJSON_AddStringToObject(json, "stderr", resp->stderr);
+    if (resp->blocked_syscall) {
+        cJSON_AddStringToObject(json, "blocked_syscall", resp->blocked_syscall);
+    }
 
     char *json_str = cJSON_PrintUnformatted(json);
     cJSON_Delete(json);
@@ -939,7 +1162,7 @@ static int child_fn(void *arg) {
         _exit(1);
     }
 
-    char *dir = join_paths("/tmp/lime", cfg->id);
+    char *dir = join_paths("/tmp/lime", args->ctr_name);
     if(!dir) {
         perror("join_paths");
         write_byte(sync_fd, 'X');
@@ -1099,10 +1322,20 @@ static int child_fn(void *arg) {
         _exit(1);
     }
 
-    if (use_seccomp_bpf && apply_seccomp_filter() != 0) {
-        fprintf(stderr, "Failed to apply seccomp filter\n");
-        write_byte(sync_fd, 'X');
-        _exit(1);
+    if (use_seccomp_bpf) {
+        const SeccompPolicy *policy = cfg->seccomp_policy ? cfg->seccomp_policy : seccomp_default_policy();
+        int listener_fd = apply_seccomp_filter(policy);
+        if (listener_fd < 0) {
+            fprintf(stderr, "Failed to apply seccomp filter\n");
+            write_byte(sync_fd, 'X');
+            _exit(1);
+        }
+        // The filter is active from here on. Only the syscalls it always
+        // allows may be used, so failures exit without reporting.
+        if (send_fd(sync_fd, listener_fd) != 0) {
+            _exit(1);
+        }
+        close(listener_fd);
     }
 
     close(sync_fd);
@@ -1467,3 +1700,69 @@ static int read_byte(int fd, char *out) {
         return -1;
     }
 }
+
+// Sends fd over the unix socket sock along with a single 'S' byte.
+static int send_fd(int sock, int fd) {
+    char b = 'S';
+    struct iovec iov = { .iov_base = &b, .iov_len = 1 };
+    union {
+        char buf[CMSG_SPACE(sizeof(int))];
+        struct cmsghdr align;
+    } u;
+    memset(&u, 0, sizeof(u));
+
+    struct msghdr msg = {
+        .msg_iov = &iov,
+        .msg_iovlen = 1,
+        .msg_control = u.buf,
+        .msg_controllen = sizeof(u.buf),
+    };
+    struct cmsghdr *cmsg = CMSG_FIRSTHDR(&msg);
+    cmsg->cmsg_level = SOL_SOCKET;
+    cmsg->cmsg_type = SCM_RIGHTS;
+    cmsg->cmsg_len = CMSG_LEN(sizeof(int));
+    memcpy(CMSG_DATA(cmsg), &fd, sizeof(int));
+
+    for (;;) {
+        ssize_t n = sendmsg(sock, &msg, 0);
+        if (n == 1) return 0;
+        if (n < 0 && errno == EINTR) continue;
+        return -1;
+    }
+}
+
+// Receives an fd sent with send_fd. Returns -1 if the peer sent anything
+// else, e.g. an 'X' error byte, or closed the socket.
+static int recv_fd(int sock) {
+    char b = 0;
+    struct iovec iov = { .iov_base = &b, .iov_len = 1 };
+    union {
+        char buf[CMSG_SPACE(sizeof(int))];
+        struct cmsghdr align;
+    } u;
+
+    struct msghdr msg = {
+        .msg_iov = &iov,
+        .msg_iovlen = 1,
+        .msg_control = u.buf,
+        .msg_controllen = sizeof(u.buf),
+    };
+
+    ssize_t n;
+    do {
+        n = recvmsg(sock, &msg, MSG_CMSG_CLOEXEC);
+    } while (n < 0 && errno == EINTR);
+    if (n != 1 || b != 'S') {
+        if (n == 0) errno = EPIPE;
+        return -1;
+    }
+
+    struct cmsghdr *cmsg = CMSG_FIRSTHDR(&msg);
+    if (!cmsg || cmsg->cmsg_level != SOL_SOCKET || cmsg->cmsg_type != SCM_RIGHTS) {
+        errno = EPROTO;
+        return -1;
+    }
+    int fd;
+    memcpy(&fd, CMSG_DATA(cmsg), sizeof(int));
+    return fd;
+}
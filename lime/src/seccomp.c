@@ -8,227 +8,751 @@
 #include <linux/seccomp.h>
 #include <stddef.h>
 #include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/ioctl.h>
 #include <sys/prctl.h>
 #include <sys/syscall.h>
+#include <unistd.h>
 
-#define ALLOW_SYSCALL(nr) BPF_JUMP(BPF_JMP | BPF_JEQ | BPF_K, (nr), 0, 1), BPF_STMT(BPF_RET | BPF_K, SECCOMP_RET_ALLOW)
+struct syscall_entry {
+    const char *name;
+    int nr;
+};
 
-int apply_seccomp_filter(void) {
-    if (prctl(PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0) != 0) {
-        perror("prctl(PR_SET_NO_NEW_PRIVS)");
-        return -1;
+#define SYSCALL(name) { #name, __NR_##name }
+
+// Syscalls that may appear in a policy, by name.
+static const struct syscall_entry syscall_table[] = {
+    SYSCALL(read),
+    SYSCALL(write),
+    SYSCALL(open),
+    SYSCALL(close),
+    SYSCALL(stat),
+    SYSCALL(fstat),
+    SYSCALL(lstat),
+    SYSCALL(poll),
+    SYSCALL(lseek),
+    SYSCALL(mmap),
+    SYSCALL(mprotect),
+    SYSCALL(munmap),
+    SYSCALL(brk),
+    SYSCALL(rt_sigaction),
+    SYSCALL(rt_sigprocmask),
+    SYSCALL(rt_sigreturn),
+    SYSCALL(ioctl),
+    SYSCALL(pread64),
+    SYSCALL(pwrite64),
+    SYSCALL(readv),
+    SYSCALL(writev),
+    SYSCALL(access),
+    SYSCALL(pipe),
+    SYSCALL(select),
+    SYSCALL(sched_yield),
+    SYSCALL(mremap),
+    SYSCALL(msync),
+    SYSCALL(mincore),
+    SYSCALL(madvise),
+    SYSCALL(shmget),
+    SYSCALL(shmat),
+    SYSCALL(shmctl),
+    SYSCALL(dup),
+    SYSCALL(dup2),
+    SYSCALL(pause),
+    SYSCALL(nanosleep),
+    SYSCALL(getitimer),
+    SYSCALL(alarm),
+    SYSCALL(setitimer),
+    SYSCALL(getpid),
+    SYSCALL(sendfile),
+    SYSCALL(socket),
+    SYSCALL(connect),
+    SYSCALL(accept),
+    SYSCALL(sendto),
+    SYSCALL(recvfrom),
+    SYSCALL(sendmsg),
+    SYSCALL(recvmsg),
+    SYSCALL(shutdown),
+    SYSCALL(bind),
+    SYSCALL(listen),
+    SYSCALL(getsockname),
+    SYSCALL(getpeername),
+    SYSCALL(socketpair),
+    SYSCALL(setsockopt),
+    SYSCALL(getsockopt),
+    SYSCALL(clone),
+    SYSCALL(fork),
+    SYSCALL(vfork),
+    SYSCALL(execve),
+    SYSCALL(exit),
+    SYSCALL(wait4),
+    SYSCALL(kill),
+    SYSCALL(uname),
+    SYSCALL(semget),
+    SYSCALL(semop),
+    SYSCALL(semctl),
+    SYSCALL(shmdt),
+    SYSCALL(msgget),
+    SYSCALL(msgsnd),
+    SYSCALL(msgrcv),
+    SYSCALL(msgctl),
+    SYSCALL(fcntl),
+    SYSCALL(flock),
+    SYSCALL(fsync),
+    SYSCALL(fdatasync),
+    SYSCALL(truncate),
+    SYSCALL(ftruncate),
+    SYSCALL(getdents),
+    SYSCALL(getcwd),
+    SYSCALL(chdir),
+    SYSCALL(fchdir),
+    SYSCALL(rename),
+    SYSCALL(mkdir),
+    SYSCALL(rmdir),
+    SYSCALL(creat),
+    SYSCALL(link),
+    SYSCALL(unlink),
+    SYSCALL(symlink),
+    SYSCALL(readlink),
+    SYSCALL(chmod),
+    SYSCALL(fchmod),
+    SYSCALL(chown),
+    SYSCALL(fchown),
+    SYSCALL(lchown),
+    SYSCALL(umask),
+    SYSCALL(gettimeofday),
+    SYSCALL(getrlimit),
+    SYSCALL(getrusage),
+    SYSCALL(sysinfo),
+    SYSCALL(times),
+    SYSCALL(ptrace),
+    SYSCALL(getuid),
+    SYSCALL(syslog),
+    SYSCALL(getgid),
+    SYSCALL(setuid),
+    SYSCALL(setgid),
+    SYSCALL(geteuid),
+    SYSCALL(getegid),
+    SYSCALL(setpgid),
+    SYSCALL(getppid),
+    SYSCALL(getpgrp),
+    SYSCALL(setsid),
+    SYSCALL(setreuid),
+    SYSCALL(setregid),
+    SYSCALL(getgroups),
+    SYSCALL(setgroups),
+    SYSCALL(setresuid),
+    SYSCALL(getresuid),
+    SYSCALL(setresgid),
+    SYSCALL(getresgid),
+    SYSCALL(getpgid),
+    SYSCALL(setfsuid),
+    SYSCALL(setfsgid),
+    SYSCALL(getsid),
+    SYSCALL(capget),
+    SYSCALL(capset),
+    SYSCALL(rt_sigpending),
+    SYSCALL(rt_sigtimedwait),
+    SYSCALL(rt_sigqueueinfo),
+    SYSCALL(rt_sigsuspend),
+    SYSCALL(sigaltstack),
+    SYSCALL(utime),
+    SYSCALL(mknod),
+    SYSCALL(personality),
+    SYSCALL(statfs),
+    SYSCALL(fstatfs),
+    SYSCALL(getpriority),
+    SYSCALL(setpriority),
+    SYSCALL(sched_setparam),
+    SYSCALL(sched_getparam),
+    SYSCALL(sched_setscheduler),
+    SYSCALL(sched_getscheduler),
+    SYSCALL(sched_get_priority_max),
+    SYSCALL(sched_get_priority_min),
+    SYSCALL(sched_rr_get_interval),
+    SYSCALL(mlock),
+    SYSCALL(munlock),
+    SYSCALL(mlockall),
+    SYSCALL(munlockall),
+    SYSCALL(vhangup),
+    SYSCALL(modify_ldt),
+    SYSCALL(pivot_root),
+    SYSCALL(prctl),
+    SYSCALL(arch_prctl),
+    SYSCALL(adjtimex),
+    SYSCALL(setrlimit),
+    SYSCALL(chroot),
+    SYSCALL(sync),
+    SYSCALL(acct),
+    SYSCALL(settimeofday),
+    SYSCALL(mount),
+    SYSCALL(umount2),
+    SYSCALL(swapon),
+    SYSCALL(swapoff),
+    SYSCALL(reboot),
+    SYSCALL(sethostname),
+    SYSCALL(setdomainname),
+    SYSCALL(iopl),
+    SYSCALL(ioperm),
+    SYSCALL(init_module),
+    SYSCALL(delete_module),
+    SYSCALL(quotactl),
+    SYSCALL(gettid),
+    SYSCALL(readahead),
+    SYSCALL(setxattr),
+    SYSCALL(lsetxattr),
+    SYSCALL(fsetxattr),
+    SYSCALL(getxattr),
+    SYSCALL(lgetxattr),
+    SYSCALL(fgetxattr),
+    SYSCALL(listxattr),
+    SYSCALL(llistxattr),
+    SYSCALL(flistxattr),
+    SYSCALL(removexattr),
+    SYSCALL(lremovexattr),
+    SYSCALL(fremovexattr),
+    SYSCALL(tkill),
+    SYSCALL(time),
+    SYSCALL(futex),
+    SYSCALL(sched_setaffinity),
+    SYSCALL(sched_getaffinity),
+    SYSCALL(io_setup),
+    SYSCALL(io_destroy),
+    SYSCALL(io_getevents),
+    SYSCALL(io_submit),
+    SYSCALL(io_cancel),
+    SYSCALL(epoll_create),
+    SYSCALL(getdents64),
+    SYSCALL(set_tid_address),
+    SYSCALL(restart_syscall),
+    SYSCALL(semtimedop),
+    SYSCALL(fadvise64),
+    SYSCALL(timer_create),
+    SYSCALL(timer_settime),
+    SYSCALL(timer_gettime),
+    SYSCALL(timer_getoverrun),
+    SYSCALL(timer_delete),
+    SYSCALL(clock_settime),
+    SYSCALL(clock_gettime),
+    SYSCALL(clock_getres),
+    SYSCALL(clock_nanosleep),
+    SYSCALL(exit_group),
+    SYSCALL(epoll_wait),
+    SYSCALL(epoll_ctl),
+    SYSCALL(tgkill),
+    SYSCALL(utimes),
+    SYSCALL(mbind),
+    SYSCALL(set_mempolicy),
+    SYSCALL(get_mempolicy),
+    SYSCALL(mq_open),
+    SYSCALL(mq_unlink),
+    SYSCALL(mq_timedsend),
+    SYSCALL(mq_timedreceive),
+    SYSCALL(mq_notify),
+    SYSCALL(mq_getsetattr),
+    SYSCALL(kexec_load),
+    SYSCALL(waitid),
+    SYSCALL(add_key),
+    SYSCALL(request_key),
+    SYSCALL(keyctl),
+    SYSCALL(ioprio_set),
+    SYSCALL(ioprio_get),
+    SYSCALL(inotify_init),
+    SYSCALL(inotify_add_watch),
+    SYSCALL(inotify_rm_watch),
+    SYSCALL(migrate_pages),
+    SYSCALL(openat),
+    SYSCALL(mkdirat),
+    SYSCALL(mknodat),
+    SYSCALL(fchownat),
+    SYSCALL(futimesat),
+    SYSCALL(newfstatat),
+    SYSCALL(unlinkat),
+    SYSCALL(renameat),
+    SYSCALL(linkat),
+    SYSCALL(symlinkat),
+    SYSCALL(readlinkat),
+    SYSCALL(fchmodat),
+    SYSCALL(faccessat),
+    SYSCALL(pselect6),
+    SYSCALL(ppoll),
+    SYSCALL(unshare),
+    SYSCALL(set_robust_list),
+    SYSCALL(get_robust_list),
+    SYSCALL(splice),
+    SYSCALL(tee),
+    SYSCALL(sync_file_range),
+    SYSCALL(vmsplice),
+    SYSCALL(move_pages),
+    SYSCALL(utimensat),
+    SYSCALL(epoll_pwait),
+    SYSCALL(signalfd),
+    SYSCALL(timerfd_create),
+    SYSCALL(eventfd),
+    SYSCALL(fallocate),
+    SYSCALL(timerfd_settime),
+    SYSCALL(timerfd_gettime),
+    SYSCALL(accept4),
+    SYSCALL(signalfd4),
+    SYSCALL(eventfd2),
+    SYSCALL(epoll_create1),
+    SYSCALL(dup3),
+    SYSCALL(pipe2),
+    SYSCALL(inotify_init1),
+    SYSCALL(preadv),
+    SYSCALL(pwritev),
+    SYSCALL(rt_tgsigqueueinfo),
+    SYSCALL(perf_event_open),
+    SYSCALL(recvmmsg),
+    SYSCALL(fanotify_init),
+    SYSCALL(fanotify_mark),
+    SYSCALL(prlimit64),
+    SYSCALL(name_to_handle_at),
+    SYSCALL(open_by_handle_at),
+    SYSCALL(clock_adjtime),
+    SYSCALL(syncfs),
+    SYSCALL(sendmmsg),
+    SYSCALL(setns),
+    SYSCALL(getcpu),
+    SYSCALL(process_vm_readv),
+    SYSCALL(process_vm_writev),
+    SYSCALL(kcmp),
+    SYSCALL(finit_module),
+    SYSCALL(sched_setattr),
+    SYSCALL(sched_getattr),
+    SYSCALL(renameat2),
+    SYSCALL(seccomp),
+    SYSCALL(getrandom),
+    SYSCALL(memfd_create),
+    SYSCALL(kexec_file_load),
+    SYSCALL(bpf),
+    SYSCALL(execveat),
+    SYSCALL(userfaultfd),
+    SYSCALL(membarrier),
+    SYSCALL(mlock2),
+#ifdef __NR_copy_file_range
+    SYSCALL(copy_file_range),
+#endif
+#ifdef __NR_preadv2
+    SYSCALL(preadv2),
+#endif
+#ifdef __NR_pwritev2
+    SYSCALL(pwritev2),
+#endif
+#ifdef __NR_pkey_mprotect
+    SYSCALL(pkey_mprotect),
+#endif
+#ifdef __NR_pkey_alloc
+    SYSCALL(pkey_alloc),
+#endif
+#ifdef __NR_pkey_free
+    SYSCALL(pkey_free),
+#endif
+#ifdef __NR_statx
+    SYSCALL(statx),
+#endif
+#ifdef __NR_io_pgetevents
+    SYSCALL(io_pgetevents),
+#endif
+#ifdef __NR_rseq
+    SYSCALL(rseq),
+#endif
+#ifdef __NR_pidfd_send_signal
+    SYSCALL(pidfd_send_signal),
+#endif
+#ifdef __NR_io_uring_setup
+    SYSCALL(io_uring_setup),
+#endif
+#ifdef __NR_io_uring_enter
+    SYSCALL(io_uring_enter),
+#endif
+#ifdef __NR_io_uring_register
+    SYSCALL(io_uring_register),
+#endif
+#ifdef __NR_open_tree
+    SYSCALL(open_tree),
+#endif
+#ifdef __NR_move_mount
+    SYSCALL(move_mount),
+#endif
+#ifdef __NR_fsopen
+    SYSCALL(fsopen),
+#endif
+#ifdef __NR_fsconfig
+    SYSCALL(fsconfig),
+#endif
+#ifdef __NR_fsmount
+    SYSCALL(fsmount),
+#endif
+#ifdef __NR_fspick
+    SYSCALL(fspick),
+#endif
+#ifdef __NR_pidfd_open
+    SYSCALL(pidfd_open),
+#endif
+#ifdef __NR_clone3
+    SYSCALL(clone3),
+#endif
+#ifdef __NR_close_range
+    SYSCALL(close_range),
+#endif
+#ifdef __NR_openat2
+    SYSCALL(openat2),
+#endif
+#ifdef __NR_pidfd_getfd
+    SYSCALL(pidfd_getfd),
+#endif
+#ifdef __NR_faccessat2
+    SYSCALL(faccessat2),
+#endif
+#ifdef __NR_process_madvise
+    SYSCALL(process_madvise),
+#endif
+#ifdef __NR_epoll_pwait2
+    SYSCALL(epoll_pwait2),
+#endif
+#ifdef __NR_mount_setattr
+    SYSCALL(mount_setattr),
+#endif
+#ifdef __NR_landlock_create_ruleset
+    SYSCALL(landlock_create_ruleset),
+#endif
+#ifdef __NR_landlock_add_rule
+    SYSCALL(landlock_add_rule),
+#endif
+#ifdef __NR_landlock_restrict_self
+    SYSCALL(landlock_restrict_self),
+#endif
+#ifdef __NR_memfd_secret
+    SYSCALL(memfd_secret),
+#endif
+#ifdef __NR_process_mrelease
+    SYSCALL(process_mrelease),
+#endif
+#ifdef __NR_futex_waitv
+    SYSCALL(futex_waitv),
+#endif
+};
+
+#undef SYSCALL
+
+static const size_t syscall_table_c = sizeof(syscall_table) / sizeof(syscall_table[0]);
+
+int seccomp_syscall_nr(const char *name) {
+    if (!name) return -1;
+    for (size_t i = 0; i < syscall_table_c; i++) {
+        if (strcmp(syscall_table[i].name, name) == 0) {
+            return syscall_table[i].nr;
+        }
+    }
+    return -1;
+}
+
+const char *seccomp_syscall_name(int nr) {
+    for (size_t i = 0; i < syscall_table_c; i++) {
+        if (syscall_table[i].nr == nr) {
+            return syscall_table[i].name;
+        }
     }
+    return NULL;
+}
+
+static int default_allow[] = {
+    // I/O
+    __NR_read,
+    __NR_write,
+    __NR_readv,
+    __NR_writev,
+    __NR_pread64,
+    __NR_pwrite64,
+    __NR_open,
+    __NR_openat,
+    __NR_close,
+    __NR_lseek,
+    __NR_stat,
+    __NR_fstat,
+    __NR_lstat,
+    __NR_newfstatat,
+    __NR_access,
+    __NR_faccessat,
+    __NR_getcwd,
+    __NR_readlink,
+    __NR_readlinkat,
+    __NR_dup,
+    __NR_dup2,
+    __NR_dup3,
+    __NR_fcntl,
+    __NR_ioctl,
+    __NR_pipe,
+    __NR_pipe2,
+    __NR_getdents,
+    __NR_getdents64,
+    __NR_truncate,
+    __NR_ftruncate,
+    __NR_rename,
+    __NR_renameat,
+    __NR_mkdir,
+    __NR_mkdirat,
+    __NR_rmdir,
+    __NR_unlink,
+    __NR_unlinkat,
+    __NR_symlink,
+    __NR_symlinkat,
+    __NR_link,
+    __NR_linkat,
+    __NR_chmod,
+    __NR_fchmod,
+    __NR_fchmodat,
+    __NR_sendfile,
+    __NR_chdir,
+    __NR_umask,
+
+    // Memory management
+    __NR_brk,
+    __NR_mmap,
+    __NR_munmap,
+    __NR_mprotect,
+    __NR_mremap,
+    __NR_madvise,
+    __NR_msync,
+    __NR_mincore,
+    __NR_memfd_create,
+    __NR_mlock,
+    __NR_munlock,
+
+    // Process and threads
+    __NR_execve,
+    __NR_execveat,
+    __NR_clone,
+    __NR_fork,
+    __NR_vfork,
+    __NR_exit,
+    __NR_exit_group,
+    __NR_wait4,
+    __NR_waitid,
+    __NR_getpid,
+    __NR_gettid,
+    __NR_getuid,
+    __NR_getgid,
+    __NR_geteuid,
+    __NR_getegid,
+    __NR_getppid,
+    __NR_getpgrp,
+    __NR_getpgid,
+    __NR_setpgid,
+    __NR_setsid,
+    __NR_getsid,
+    __NR_getgroups,
+    __NR_getresuid,
+    __NR_getresgid,
+
+    __NR_set_tid_address,
+    __NR_set_robust_list,
+    __NR_get_robust_list,
+    __NR_arch_prctl,
+
+    // Futex
+    __NR_futex,
+
+    // Signal handling
+    __NR_rt_sigaction,
+    __NR_rt_sigprocmask,
+    __NR_rt_sigreturn,
+    __NR_rt_sigpending,
+    __NR_rt_sigsuspend,
+    __NR_rt_sigtimedwait,
+    __NR_sigaltstack,
+    __NR_kill,
+    __NR_tgkill,
+    __NR_tkill,
+
+    // Time
+    __NR_clock_gettime,
+    __NR_clock_getres,
+    __NR_clock_nanosleep,
+    __NR_gettimeofday,
+    __NR_time,
+    __NR_nanosleep,
+
+    __NR_prctl,
+    __NR_uname,
+    __NR_sysinfo,
+    __NR_getrlimit,
+    __NR_setrlimit,
+    __NR_prlimit64,
+
+    __NR_getrandom,
+
+    __NR_poll,
+    __NR_ppoll,
+    __NR_select,
+    __NR_pselect6,
+    __NR_epoll_create,
+    __NR_epoll_create1,
+    __NR_epoll_ctl,
+    __NR_epoll_wait,
+    __NR_epoll_pwait,
+
+    __NR_sched_yield,
+    __NR_sched_getaffinity,
+    __NR_sched_getscheduler,
+    __NR_sched_getparam,
+
+    __NR_eventfd,
+    __NR_eventfd2,
+    __NR_timerfd_create,
+    __NR_timerfd_settime,
+    __NR_timerfd_gettime,
 
-    struct sock_filter filter[] = {
-        BPF_STMT(BPF_LD | BPF_W | BPF_ABS,
-                 offsetof(struct seccomp_data, arch)),
-        BPF_JUMP(BPF_JMP | BPF_JEQ | BPF_K, AUDIT_ARCH_X86_64, 1, 0),
-        BPF_STMT(BPF_RET | BPF_K, SECCOMP_RET_KILL_PROCESS),
-
-        BPF_STMT(BPF_LD | BPF_W | BPF_ABS,
-                 offsetof(struct seccomp_data, nr)),
-
-        // I/O
-        ALLOW_SYSCALL(__NR_read),
-        ALLOW_SYSCALL(__NR_write),
-        ALLOW_SYSCALL(__NR_readv),
-        ALLOW_SYSCALL(__NR_writev),
-        ALLOW_SYSCALL(__NR_pread64),
-        ALLOW_SYSCALL(__NR_pwrite64),
-        ALLOW_SYSCALL(__NR_open),
-        ALLOW_SYSCALL(__NR_openat),
-        ALLOW_SYSCALL(__NR_close),
-        ALLOW_SYSCALL(__NR_lseek),
-        ALLOW_SYSCALL(__NR_stat),
-        ALLOW_SYSCALL(__NR_fstat),
-        ALLOW_SYSCALL(__NR_lstat),
-        ALLOW_SYSCALL(__NR_newfstatat),
-        ALLOW_SYSCALL(__NR_access),
-        ALLOW_SYSCALL(__NR_faccessat),
-        ALLOW_SYSCALL(__NR_getcwd),
-        ALLOW_SYSCALL(__NR_readlink),
-        ALLOW_SYSCALL(__NR_readlinkat),
-        ALLOW_SYSCALL(__NR_dup),
-        ALLOW_SYSCALL(__NR_dup2),
-        ALLOW_SYSCALL(__NR_dup3),
-        ALLOW_SYSCALL(__NR_fcntl),
-        ALLOW_SYSCALL(__NR_ioctl),
-        ALLOW_SYSCALL(__NR_pipe),
-        ALLOW_SYSCALL(__NR_pipe2),
-        ALLOW_SYSCALL(__NR_getdents),
-        ALLOW_SYSCALL(__NR_getdents64),
-        ALLOW_SYSCALL(__NR_truncate),
-        ALLOW_SYSCALL(__NR_ftruncate),
-        ALLOW_SYSCALL(__NR_rename),
-        ALLOW_SYSCALL(__NR_renameat),
-        ALLOW_SYSCALL(__NR_mkdir),
-        ALLOW_SYSCALL(__NR_mkdirat),
-        ALLOW_SYSCALL(__NR_rmdir),
-        ALLOW_SYSCALL(__NR_unlink),
-        ALLOW_SYSCALL(__NR_unlinkat),
-        ALLOW_SYSCALL(__NR_symlink),
-        ALLOW_SYSCALL(__NR_symlinkat),
-        ALLOW_SYSCALL(__NR_link),
-        ALLOW_SYSCALL(__NR_linkat),
-        ALLOW_SYSCALL(__NR_chmod),
-        ALLOW_SYSCALL(__NR_fchmod),
-        ALLOW_SYSCALL(__NR_fchmodat),
-        ALLOW_SYSCALL(__NR_sendfile),
-        ALLOW_SYSCALL(__NR_chdir),
-        ALLOW_SYSCALL(__NR_umask),
-
-        // Memory management
-        ALLOW_SYSCALL(__NR_brk),
-        ALLOW_SYSCALL(__NR_mmap),
-        ALLOW_SYSCALL(__NR_munmap),
-        ALLOW_SYSCALL(__NR_mprotect),
-        ALLOW_SYSCALL(__NR_mremap),
-        ALLOW_SYSCALL(__NR_madvise),
-        ALLOW_SYSCALL(__NR_msync),
-        ALLOW_SYSCALL(__NR_mincore),
-        ALLOW_SYSCALL(__NR_memfd_create),
-        ALLOW_SYSCALL(__NR_mlock),
-        ALLOW_SYSCALL(__NR_munlock),
-
-        // Process and threads
-        ALLOW_SYSCALL(__NR_execve),
-        ALLOW_SYSCALL(__NR_execveat),
-        ALLOW_SYSCALL(__NR_clone),
-        ALLOW_SYSCALL(__NR_fork),
-        ALLOW_SYSCALL(__NR_vfork),
-        ALLOW_SYSCALL(__NR_exit),
-        ALLOW_SYSCALL(__NR_exit_group),
-        ALLOW_SYSCALL(__NR_wait4),
-        ALLOW_SYSCALL(__NR_waitid),
-        ALLOW_SYSCALL(__NR_getpid),
-        ALLOW_SYSCALL(__NR_gettid),
-        ALLOW_SYSCALL(__NR_getuid),
-        ALLOW_SYSCALL(__NR_getgid),
-        ALLOW_SYSCALL(__NR_geteuid),
-        ALLOW_SYSCALL(__NR_getegid),
-        ALLOW_SYSCALL(__NR_getppid),
-        ALLOW_SYSCALL(__NR_getpgrp),
-        ALLOW_SYSCALL(__NR_getpgid),
-        ALLOW_SYSCALL(__NR_setpgid),
-        ALLOW_SYSCALL(__NR_setsid),
-        ALLOW_SYSCALL(__NR_getsid),
-        ALLOW_SYSCALL(__NR_getgroups),
-        ALLOW_SYSCALL(__NR_getresuid),
-        ALLOW_SYSCALL(__NR_getresgid),
-
-        ALLOW_SYSCALL(__NR_set_tid_address),
-        ALLOW_SYSCALL(__NR_set_robust_list),
-        ALLOW_SYSCALL(__NR_get_robust_list),
-        ALLOW_SYSCALL(__NR_arch_prctl),
-
-        // Futex
-        ALLOW_SYSCALL(__NR_futex),
-
-        // Signal handling
-        ALLOW_SYSCALL(__NR_rt_sigaction),
-        ALLOW_SYSCALL(__NR_rt_sigprocmask),
-        ALLOW_SYSCALL(__NR_rt_sigreturn),
-        ALLOW_SYSCALL(__NR_rt_sigpending),
-        ALLOW_SYSCALL(__NR_rt_sigsuspend),
-        ALLOW_SYSCALL(__NR_rt_sigtimedwait),
-        ALLOW_SYSCALL(__NR_sigaltstack),
-        ALLOW_SYSCALL(__NR_kill),
-        ALLOW_SYSCALL(__NR_tgkill),
-        ALLOW_SYSCALL(__NR_tkill),
-
-        // Time
-        ALLOW_SYSCALL(__NR_clock_gettime),
-        ALLOW_SYSCALL(__NR_clock_getres),
-        ALLOW_SYSCALL(__NR_clock_nanosleep),
-        ALLOW_SYSCALL(__NR_gettimeofday),
-        ALLOW_SYSCALL(__NR_time),
-        ALLOW_SYSCALL(__NR_nanosleep),
-
-        ALLOW_SYSCALL(__NR_prctl),
-        ALLOW_SYSCALL(__NR_uname),
-        ALLOW_SYSCALL(__NR_sysinfo),
-        ALLOW_SYSCALL(__NR_getrlimit),
-        ALLOW_SYSCALL(__NR_setrlimit),
-        ALLOW_SYSCALL(__NR_prlimit64),
-
-        ALLOW_SYSCALL(__NR_getrandom),
-
-        ALLOW_SYSCALL(__NR_poll),
-        ALLOW_SYSCALL(__NR_ppoll),
-        ALLOW_SYSCALL(__NR_select),
-        ALLOW_SYSCALL(__NR_pselect6),
-        ALLOW_SYSCALL(__NR_epoll_create),
-        ALLOW_SYSCALL(__NR_epoll_create1),
-        ALLOW_SYSCALL(__NR_epoll_ctl),
-        ALLOW_SYSCALL(__NR_epoll_wait),
-        ALLOW_SYSCALL(__NR_epoll_pwait),
-
-        ALLOW_SYSCALL(__NR_sched_yield),
-        ALLOW_SYSCALL(__NR_sched_getaffinity),
-        ALLOW_SYSCALL(__NR_sched_getscheduler),
-        ALLOW_SYSCALL(__NR_sched_getparam),
-
-        ALLOW_SYSCALL(__NR_eventfd),
-        ALLOW_SYSCALL(__NR_eventfd2),
-        ALLOW_SYSCALL(__NR_timerfd_create),
-        ALLOW_SYSCALL(__NR_timerfd_settime),
-        ALLOW_SYSCALL(__NR_timerfd_gettime),
-
-        // Sockets — Python import machinery touches these even without
-        // explicit networking code (e.g. ssl, hashlib, locale, site.py)
-        ALLOW_SYSCALL(__NR_socket),
-        ALLOW_SYSCALL(__NR_connect),
-        ALLOW_SYSCALL(__NR_bind),
-        ALLOW_SYSCALL(__NR_listen),
-        ALLOW_SYSCALL(__NR_accept),
-        ALLOW_SYSCALL(__NR_accept4),
-        ALLOW_SYSCALL(__NR_shutdown),
-        ALLOW_SYSCALL(__NR_socketpair),
-        ALLOW_SYSCALL(__NR_getsockname),
-        ALLOW_SYSCALL(__NR_getpeername),
-        ALLOW_SYSCALL(__NR_getsockopt),
-        ALLOW_SYSCALL(__NR_setsockopt),
-        ALLOW_SYSCALL(__NR_sendto),
-        ALLOW_SYSCALL(__NR_sendmsg),
-        ALLOW_SYSCALL(__NR_recvfrom),
-        ALLOW_SYSCALL(__NR_recvmsg),
-
-        // Newer syscalls
+    // Sockets — Python import machinery touches these even without
+    // explicit networking code (e.g. ssl, hashlib, locale, site.py)
+    __NR_socket,
+    __NR_connect,
+    __NR_bind,
+    __NR_listen,
+    __NR_accept,
+    __NR_accept4,
+    __NR_shutdown,
+    __NR_socketpair,
+    __NR_getsockname,
+    __NR_getpeername,
+    __NR_getsockopt,
+    __NR_setsockopt,
+    __NR_sendto,
+    __NR_sendmsg,
+    __NR_recvfrom,
+    __NR_recvmsg,
+
+    // Newer syscalls
 #ifdef __NR_clone3
-        ALLOW_SYSCALL(__NR_clone3),
+    __NR_clone3,
 #endif
 #ifdef __NR_futex_waitv
-        ALLOW_SYSCALL(__NR_futex_waitv),
+    __NR_futex_waitv,
 #endif
 #ifdef __NR_faccessat2
-        ALLOW_SYSCALL(__NR_faccessat2),
+    __NR_faccessat2,
 #endif
 #ifdef __NR_statx
-        ALLOW_SYSCALL(__NR_statx),
+    __NR_statx,
 #endif
 #ifdef __NR_copy_file_range
-        ALLOW_SYSCALL(__NR_copy_file_range),
+    __NR_copy_file_range,
 #endif
 #ifdef __NR_openat2
-        ALLOW_SYSCALL(__NR_openat2),
+    __NR_openat2,
 #endif
 #ifdef __NR_rseq
-        ALLOW_SYSCALL(__NR_rseq),
+    __NR_rseq,
 #endif
+};
 
-        // unknown syscall -> kill
-        BPF_STMT(BPF_RET | BPF_K, SECCOMP_RET_KILL_PROCESS),
-    };
+static const SeccompPolicy default_policy = {
+    .default_allow = 0,
+    .allow = default_allow,
+    .allow_c = sizeof(default_allow) / sizeof(default_allow[0]),
+};
+
+const SeccompPolicy *seccomp_default_policy(void) {
+    return &default_policy;
+}
+
+void free_seccomp_policy(SeccompPolicy *policy) {
+    if (!policy || policy == &default_policy) return;
+
+    free(policy->allow);
+    free(policy->deny);
+    free(policy);
+}
+
+// Syscalls lime itself makes between installing the filter and exec'ing
+// the program. They are allowed whatever the policy says.
+static const int lime_required[] = {
+    __NR_sendmsg,
+    __NR_close,
+    __NR_execve,
+    __NR_exit,
+    __NR_exit_group,
+};
+
+static const size_t lime_required_c = sizeof(lime_required) / sizeof(lime_required[0]);
+
+// Appends "if nr matches, return action" to filter at index i and returns the
+// next free index.
+static size_t match_syscall(struct sock_filter *filter, size_t i, int nr, unsigned int action) {
+    filter[i++] = (struct sock_filter)BPF_JUMP(BPF_JMP | BPF_JEQ | BPF_K, (unsigned int)nr, 0, 1);
+    filter[i++] = (struct sock_filter)BPF_STMT(BPF_RET | BPF_K, action);
+    return i;
+}
+
+int apply_seccomp_filter(const SeccompPolicy *policy) {
+    if (!policy) {
+        errno = EINVAL;
+        return -1;
+    }
+
+    if (prctl(PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0) != 0) {
+        perror("prctl(PR_SET_NO_NEW_PRIVS)");
+        return -1;
+    }
+
+    size_t len = 4 + 2 * (lime_required_c + policy->deny_c + policy->allow_c) + 1;
+    if (len > BPF_MAXINSNS) {
+        fprintf(stderr, "seccomp policy is too large\n");
+        errno = E2BIG;
+        return -1;
+    }
+
+    struct sock_filter *filter = calloc(len, sizeof(struct sock_filter));
+    if (!filter) {
+        return -1;
+    }
+
+    size_t i = 0;
+    filter[i++] = (struct sock_filter)BPF_STMT(BPF_LD | BPF_W | BPF_ABS, offsetof(struct seccomp_data, arch));
+    filter[i++] = (struct sock_filter)BPF_JUMP(BPF_JMP | BPF_JEQ | BPF_K, AUDIT_ARCH_X86_64, 1, 0);
+    filter[i++] = (struct sock_filter)BPF_STMT(BPF_RET | BPF_K, SECCOMP_RET_KILL_PROCESS);
+    filter[i++] = (struct sock_filter)BPF_STMT(BPF_LD | BPF_W | BPF_ABS, offsetof(struct seccomp_data, nr));
+
+    for (size_t j = 0; j < lime_required_c; j++) {
+        i = match_syscall(filter, i, lime_required[j], SECCOMP_RET_ALLOW);
+    }
+    // Denials are checked before allowances so a deny entry always wins.
+    for (size_t j = 0; j < policy->deny_c; j++) {
+        i = match_syscall(filter, i, policy->deny[j], SECCOMP_RET_USER_NOTIF);
+    }
+    for (size_t j = 0; j < policy->allow_c; j++) {
+        i = match_syscall(filter, i, policy->allow[j], SECCOMP_RET_ALLOW);
+    }
+    filter[i++] = (struct sock_filter)BPF_STMT(BPF_RET | BPF_K, policy->default_allow ? SECCOMP_RET_ALLOW : SECCOMP_RET_USER_NOTIF);
 
     struct sock_fprog prog = {
-        .len = (unsigned short)(sizeof(filter) / sizeof(filter[0])),
+        .len = (unsigned short)i,
         .filter = filter,
     };
 
-    if (prctl(PR_SET_SECCOMP, SECCOMP_MODE_FILTER, &prog) != 0) {
-        perror("prctl(PR_SET_SECCOMP)");
+    int listener_fd = (int)syscall(SYS_seccomp, SECCOMP_SET_MODE_FILTER, SECCOMP_FILTER_FLAG_NEW_LISTENER, &prog);
+    free(filter);
+    if (listener_fd < 0) {
+        perror("seccomp(SECCOMP_SET_MODE_FILTER)");
+        return -1;
+    }
+
+    return listener_fd;
+}
+
+int seccomp_receive_notification(int listener_fd, int *nr) {
+    if (!nr) {
+        errno = EINVAL;
+        return -1;
+    }
+
+    struct seccomp_notif notif;
+    memset(&notif, 0, sizeof(notif));
+    if (ioctl(listener_fd, SECCOMP_IOCTL_NOTIF_RECV, &notif) != 0) {
         return -1;
     }
 
+    *nr = notif.data.nr;
     return 0;
 }
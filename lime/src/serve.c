@@ -0,0 +1,317 @@
+#define _GNU_SOURCE
+
+#include "serve.h"
+
+#include <arpa/inet.h>
+#include <errno.h>
+#include <getopt.h>
+#include <signal.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/socket.h>
+#include <sys/stat.h>
+#include <sys/un.h>
+#include <sys/wait.h>
+#include <unistd.h>
+
+#include "cgroup.h"
+#include "run.h"
+#include "utils.h"
+
+/** Frames larger than this are rejected; requests carry stdin inline. */
+static const uint32_t MAX_FRAME_BYTES = 256u * 1024 * 1024;
+
+static volatile sig_atomic_t stopping = 0;
+
+static int serve_connection(int conn);
+static int serve_request(int conn, const char *payload, const char *session);
+static void close_session(const char *session);
+static int read_frame(int fd, char **out);
+static int write_frame(int fd, const char *payload, uint32_t len);
+static int write_error_frame(int fd, const char *message);
+static int read_full(int fd, void *buf, size_t len);
+static int write_full(int fd, const void *buf, size_t len);
+
+static void print_usage(const char *prog) {
+    fprintf(stderr, "Serves container runs over a Unix socket.\n");
+    fprintf(stderr, "\n");
+    fprintf(stderr, "Usage:\n");
+    fprintf(stderr, "  %s serve --socket <path>\n\n", prog);
+    fprintf(stderr, "Options:\n");
+    fprintf(stderr, "  --socket <path>  Unix socket to listen on. An existing file at path is replaced.\n");
+    fprintf(stderr, "\n");
+    fprintf(stderr, "Each request and response is a frame: a 4-byte big-endian length followed by that\n");
+    fprintf(stderr, "many bytes of JSON. Requests are ExecRequest objects with an optional boolean\n");
+    fprintf(stderr, "\"use_seccomp_bpf\" field; responses are ExecResponse objects, or {\"error\": \"...\"}.\n");
+    fprintf(stderr, "Requests on one connection run one at a time and share a container directory and\n");
+    fprintf(stderr, "cgroup, which are set up by the first run and removed when the connection closes.\n");
+    fprintf(stderr, "\n");
+}
+
+static void handle_stop(int sig) {
+    (void)sig;
+    stopping = 1;
+}
+
+int handle_serve(int argc, char **argv) {
+    static struct option long_opts[] = {
+        {"help",   no_argument,       NULL, 'h'},
+        {"socket", required_argument, NULL, 'S'},
+        {0, 0, 0, 0},
+    };
+
+    opterr = 0;
+    optind = 2;
+    const char *socket_path = NULL;
+    int opt;
+    while((opt = getopt_long(argc, argv, "", long_opts, NULL)) != -1) {
+        switch(opt) {
+            case 'h':
+                print_usage(argv[0]);
+                return 0;
+            case 'S':
+                socket_path = optarg;
+                break;
+            case '?':
+            default:
+                fprintf(stderr, "Unknown option\n");
+                print_usage(argv[0]);
+                return 1;
+        }
+    }
+    if (!socket_path) {
+        fprintf(stderr, "--socket is required\n");
+        print_usage(argv[0]);
+        return 1;
+    }
+
+    struct sockaddr_un addr = {.sun_family = AF_UNIX};
+    if (strlen(socket_path) >= sizeof(addr.sun_path)) {
+        fprintf(stderr, "Socket path too long: %s\n", socket_path);
+        return 1;
+    }
+    strcpy(addr.sun_path, socket_path);
+
+    // Without SA_RESTART, accept() returns EINTR so the loop sees stopping.
+    struct sigaction sa = {.sa_handler = handle_stop};
+    sigemptyset(&sa.sa_mask);
+    sigaction(SIGTERM, &sa, NULL);
+    sigaction(SIGINT, &sa, NULL);
+    // Connection handlers are not waited for.
+    signal(SIGCHLD, SIG_IGN);
+    // A client hanging up mid-response must not kill the handler.
+    signal(SIGPIPE, SIG_IGN);
+
+    int listen_fd = socket(AF_UNIX, SOCK_STREAM | SOCK_CLOEXEC, 0);
+    if (listen_fd < 0) {
+        perror("socket");
+        return 1;
+    }
+    unlink(socket_path);
+    if (bind(listen_fd, (struct sockaddr *)&addr, sizeof(addr)) != 0) {
+        fprintf(stderr, "Failed to bind %s: %m\n", socket_path);
+        close(listen_fd);
+        return 1;
+    }
+    if (chmod(socket_path, 0600) != 0) {
+        fprintf(stderr, "Failed to chmod %s: %m\n", socket_path);
+        close(listen_fd);
+        unlink(socket_path);
+        return 1;
+    }
+    if (listen(listen_fd, 64) != 0) {
+        perror("listen");
+        close(listen_fd);
+        unlink(socket_path);
+        return 1;
+    }
+    fprintf(stderr, "Listening on %s\n", socket_path);
+
+    while (!stopping) {
+        int conn = accept4(listen_fd, NULL, NULL, SOCK_CLOEXEC);
+        if (conn < 0) {
+            if (errno == EINTR || errno == ECONNABORTED) {
+                continue;
+            }
+            perror("accept4");
+            break;
+        }
+
+        // Each connection is served by its own process so a failing run
+        // cannot take the daemon down with it.
+        pid_t pid = fork();
+        if (pid < 0) {
+            perror("fork");
+            close(conn);
+            continue;
+        }
+        if (pid == 0) {
+            close(listen_fd);
+            signal(SIGCHLD, SIG_DFL);
+            signal(SIGTERM, SIG_DFL);
+            signal(SIGINT, SIG_DFL);
+            _exit(serve_connection(conn));
+        }
+        close(conn);
+    }
+
+    close(listen_fd);
+    unlink(socket_path);
+    return 0;
+}
+
+static int serve_connection(int conn) {
+    char session[64];
+    snprintf(session, sizeof(session), "serve-%d", getpid());
+
+    int rc = 0;
+    for (;;) {
+        char *payload = NULL;
+        int n = read_frame(conn, &payload);
+        if (n <= 0) {
+            rc = n < 0;
+            break;
+        }
+
+        // Run each request in a child: execute_request is written for a
+        // process that exits afterwards, and the session state it reuses
+        // lives in the filesystem, not in this process.
+        pid_t pid = fork();
+        if (pid < 0) {
+            perror("fork");
+            free(payload);
+            if (write_error_frame(conn, "fork failed") != 0) {
+                rc = 1;
+                break;
+            }
+            continue;
+        }
+        if (pid == 0) {
+            _exit(serve_request(conn, payload, session));
+        }
+        free(payload);
+
+        int status = 0;
+        while (waitpid(pid, &status, 0) < 0 && errno == EINTR) {
+        }
+        // The request process only exits 0 after writing its response.
+        if (!WIFEXITED(status) || WEXITSTATUS(status) != 0) {
+            if (write_error_frame(conn, "run failed, see lime serve log") != 0) {
+                rc = 1;
+                break;
+            }
+        }
+    }
+
+    close(conn);
+    close_session(session);
+    return rc;
+}
+
+static int serve_request(int conn, const char *payload, const char *session) {
+    int use_seccomp_bpf = 0;
+    ExecRequest *req = parse_exec_request(payload, &use_seccomp_bpf);
+    if (!req) {
+        return 1;
+    }
+
+    char *out_json = NULL;
+    int rc = execute_request(req, use_seccomp_bpf, session, &out_json);
+    free_exec_request(req);
+    if (rc != 0) {
+        return 1;
+    }
+
+    // A failed write may leave a partial frame behind, so it is not
+    // reported to the parent, which would append an error frame to it; the
+    // client sees the broken connection instead.
+    if (write_frame(conn, out_json, strlen(out_json)) != 0) {
+        perror("write_frame");
+    }
+    free(out_json);
+    return 0;
+}
+
+static void close_session(const char *session) {
+    const char *cgroup_root = getenv("LIME_CGROUP_ROOT");
+    if (cgroup_exists(cgroup_root, session)) {
+        delete_cgroup(cgroup_root, session);
+    }
+    char *ctr_dir = join_paths("/tmp/lime", session);
+    if (ctr_dir) {
+        rmdir(ctr_dir);
+        free(ctr_dir);
+    }
+}
+
+/** Reads one frame into *out. Returns 1 on success, 0 on EOF, -1 on error. */
+static int read_frame(int fd, char **out) {
+    uint32_t len_be;
+    int n = read_full(fd, &len_be, sizeof(len_be));
+    if (n <= 0) {
+        return n;
+    }
+    uint32_t len = ntohl(len_be);
+    if (len > MAX_FRAME_BYTES) {
+        fprintf(stderr, "Frame of %u bytes exceeds limit\n", len);
+        return -1;
+    }
+    char *buf = malloc((size_t)len + 1);
+    if (!buf) {
+        fprintf(stderr, "Failed to allocate frame\n");
+        return -1;
+    }
+    if (read_full(fd, buf, len) != 1) {
+        free(buf);
+        return -1;
+    }
+    buf[len] = '\0';
+    *out = buf;
+    return 1;
+}
+
+static int write_frame(int fd, const char *payload, uint32_t len) {
+    uint32_t len_be = htonl(len);
+    if (write_full(fd, &len_be, sizeof(len_be)) != 0) {
+        return -1;
+    }
+    return write_full(fd, payload, len);
+}
+
+static int write_error_frame(int fd, const char *message) {
+    char buf[256];
+    int n = snprintf(buf, sizeof(buf), "{\"error\":\"%s\"}", message);
+    return write_frame(fd, buf, (uint32_t)n);
+}
+
+/** Returns 1 when len bytes were read, 0 on EOF before any byte, -1 on error. */
+static int read_full(int fd, void *buf, size_t len) {
+    size_t off = 0;
+    while (off < len) {
+        ssize_t n = read(fd, (char *)buf + off, len - off);
+        if (n < 0) {
+            if (errno == EINTR) continue;
+            return -1;
+        }
+        if (n == 0) {
+            return off == 0 ? 0 : -1;
+        }
+        off += (size_t)n;
+    }
+    return 1;
+}
+
+static int write_full(int fd, const void *buf, size_t len) {
+    size_t off = 0;
+    while (off < len) {
+        ssize_t n = write(fd, (const char *)buf + off, len - off);
+        if (n < 0) {
+            if (errno == EINTR) continue;
+            return -1;
+        }
+        off += (size_t)n;
+    }
+    return 0;
+}
@@ -70,7 +70,9 @@ char *read_all_from_stdin() {
     return buffer;
 }
 
-char *read_all_from_fd(int fd) {
+// Reads fd to EOF and returns at most limit bytes of it, NUL-terminated.
+// A limit of 0 keeps everything.
+char *read_all_from_fd(int fd, size_t limit) {
     size_t capacity = 4096;
     size_t length = 0;
     char *buffer = malloc(capacity);
@@ -78,17 +80,31 @@ char *read_all_from_fd(int fd) {
         return NULL;
     }
 
+    // Past the limit, reads go to a scratch buffer and are discarded, so
+    // the writer is never blocked on a full pipe.
+    char discard[4096];
     ssize_t n;
-    while ((n = read(fd, buffer + length, capacity - length - 1)) > 0) {
-        length += n;
-        if (length + 1 >= capacity) {
-            capacity *= 2;
-            char *new_buffer = realloc(buffer, capacity);
-            if (!new_buffer) {
-                free(buffer);
-                return NULL;
+    for (;;) {
+        if (limit == 0 || length < limit) {
+            size_t want = capacity - length - 1;
+            if (limit != 0 && want > limit - length) {
+                want = limit - length;
             }
-            buffer = new_buffer;
+            n = read(fd, buffer + length, want);
+            if (n <= 0) break;
+            length += n;
+            if (length + 1 >= capacity) {
+                capacity *= 2;
+                char *new_buffer = realloc(buffer, capacity);
+                if (!new_buffer) {
+                    free(buffer);
+                    return NULL;
+                }
+                buffer = new_buffer;
+            }
+        } else {
+            n = read(fd, discard, sizeof(discard));
+            if (n <= 0) break;
         }
     }
 
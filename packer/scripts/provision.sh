@@ -53,6 +53,9 @@ chown -R 1000:1000 /tmp/judge
 mkdir -p /rootfs
 chown 1000:1000 /rootfs
 
+mkdir -p /var/lib/judge/images
+chown -R 1000:1000 /var/lib/judge
+
 echo "==> provision: configuring subuid/subgid..."
 grep -qF 'ubuntu:100000:65536' /etc/subuid 2>/dev/null || \
     echo 'ubuntu:100000:65536' >> /etc/subuid
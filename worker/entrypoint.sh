@@ -6,6 +6,11 @@
 # with all required controllers enabled. We simply create a lime subdirectory
 # within LIME_CGROUP_ROOT — no SYS_ADMIN or privileged container needed.
 
+# Image management (`worker image ...`) needs neither the rootfs nor cgroups.
+if [ "$1" = "image" ]; then
+    exec /usr/local/bin/worker "$@"
+fi
+
 # ── Rootfs installation ──────────────────────────────────────────────────────
 _ROOTFS_DIR="${JUDGE_ROOTFS_DIR:-/rootfs}"
 
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jjudge-oj/worker/config"
+	"github.com/jjudge-oj/worker/internal/images"
+	"github.com/jjudge-oj/worker/internal/worker"
+)
+
+const imageUsage = `usage: worker image <command> [arguments]
+
+commands:
+  import <name> <tarball>  install a docker save or OCI image tarball as <name>
+  verify [<name>...]       check images provide the binaries their languages run
+                           (default: every image a language uses)
+  list                     list installed images
+  rm <name>                remove an installed image
+
+Images are stored under JUDGE_IMAGES_DIR.
+`
+
+// runImageCommand runs the image management subcommand and returns the
+// process exit code.
+func runImageCommand(cfg *config.Config, args []string) int {
+	store := images.NewStore(cfg.Judge.ImagesDir)
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, imageUsage)
+		return 2
+	}
+
+	var err error
+	switch cmd, args := args[0], args[1:]; {
+	case cmd == "import" && len(args) == 2:
+		err = importImage(store, args[0], args[1])
+	case cmd == "verify":
+		err = verifyImages(store, args)
+	case cmd == "list" && len(args) == 0:
+		err = listImages(store)
+	case cmd == "rm" && len(args) == 1:
+		err = store.Remove(args[0])
+	default:
+		fmt.Fprint(os.Stderr, imageUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "worker image: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func importImage(store *images.Store, name, tarball string) error {
+	img, err := store.Import(name, tarball)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("imported %s: %d layers, %s\n", img.Name, len(img.Layers), formatSize(img.Size))
+	binaries, ok := worker.ImageBinaries()[name]
+	if !ok {
+		fmt.Printf("warning: no language uses image %s\n", name)
+		return nil
+	}
+	return store.Verify(name, binaries)
+}
+
+func verifyImages(store *images.Store, names []string) error {
+	required := worker.ImageBinaries()
+	if len(names) == 0 {
+		for name := range required {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	failed := 0
+	for _, name := range names {
+		if err := store.Verify(name, required[name]); err != nil {
+			fmt.Printf("FAIL %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s\n", name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images failed verification", failed, len(names))
+	}
+	return nil
+}
+
+func listImages(store *images.Store) error {
+	imgs, err := store.List()
+	if err != nil {
+		return err
+	}
+	langs := make(map[string][]string)
+	for lang, name := range worker.LanguageImages() {
+		langs[name] = append(langs[name], lang)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tLANGUAGES\tSIZE\tLAYERS\tIMPORTED\tSOURCE")
+	for _, img := range imgs {
+		slices.Sort(langs[img.Name])
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", img.Name, strings.Join(langs[img.Name], ","), formatSize(img.Size), len(img.Layers), img.ImportedAt.Format("2006-01-02 15:04"), img.Source)
+	}
+	return tw.Flush()
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,141 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jjudge-oj/worker/config"
+)
+
+// localTmpDir holds partial writes under the storage directory, so they are
+// renamed into place on the same filesystem.
+const localTmpDir = ".tmp"
+
+// LocalClient stores objects as files in a local directory, for single-node
+// installs where the API server and workers share a volume, and for tests.
+// An object lives at <dir>/<aa>/<bb>/<escaped key>, where aabb are the first
+// bytes of the SHA-256 of its key, so no directory grows too large. Writes
+// go to a temporary file that is renamed into place, so readers never see a
+// partial object. Content types are not stored.
+type LocalClient struct {
+	dir string
+}
+
+// NewLocalClient constructs a local directory client from config.
+func NewLocalClient(cfg *config.LocalStorageConfig) (*LocalClient, error) {
+	if strings.TrimSpace(cfg.Dir) == "" {
+		return nil, errors.New("local storage dir is required")
+	}
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalClient{dir: dir}, nil
+}
+
+// EnsureBucket creates the storage directory unless it exists.
+func (l *LocalClient) EnsureBucket(ctx context.Context) error {
+	return os.MkdirAll(filepath.Join(l.dir, localTmpDir), 0o755)
+}
+
+// Put writes an object atomically, replacing any previous version. A
+// non-negative size must match the length of r.
+func (l *LocalClient) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmpDir := filepath.Join(l.dir, localTmpDir)
+	if err := os.MkdirAll(tmpDir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(tmpDir, "put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	n, err := io.Copy(tmp, r)
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("object %q: wrote %d bytes, expected %d", key, n, size)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get opens an object. A missing object yields an error wrapping
+// os.ErrNotExist.
+func (l *LocalClient) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("object %q: %w", key, os.ErrNotExist)
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// Delete removes an object. Deleting a missing object is not an error.
+func (l *LocalClient) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Bucket returns the storage directory.
+func (l *LocalClient) Bucket() string {
+	return l.dir
+}
+
+// path returns the file of the object key. The key is escaped into a single
+// file name, so it cannot point outside the storage directory.
+func (l *LocalClient) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	sum := sha256.Sum256([]byte(key))
+	shard := hex.EncodeToString(sum[:2])
+	return filepath.Join(l.dir, shard[:2], shard[2:], url.PathEscape(key)), nil
+}
@@ -0,0 +1,120 @@
+package blob_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jjudge-oj/worker/config"
+	"github.com/jjudge-oj/worker/internal/blob"
+)
+
+func newLocalStorage(t *testing.T) (*blob.Storage, string) {
+	t.Helper()
+	dir := t.TempDir()
+	client, err := blob.NewLocalClient(&config.LocalStorageConfig{Dir: dir})
+	if err != nil {
+		t.Fatalf("NewLocalClient: %v", err)
+	}
+	s := blob.NewStorage(client)
+	if err := s.EnsureBucket(context.Background()); err != nil {
+		t.Fatalf("EnsureBucket: %v", err)
+	}
+	return s, dir
+}
+
+func put(t *testing.T, s *blob.Storage, key, data string) {
+	t.Helper()
+	if err := s.Put(context.Background(), key, strings.NewReader(data), int64(len(data)), "text/plain"); err != nil {
+		t.Fatalf("Put(%q): %v", key, err)
+	}
+}
+
+func get(t *testing.T, s *blob.Storage, key string) string {
+	t.Helper()
+	rc, err := s.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("read %q: %v", key, err)
+	}
+	return string(data)
+}
+
+func TestLocalPutGetDelete(t *testing.T) {
+	s, _ := newLocalStorage(t)
+	ctx := context.Background()
+
+	put(t, s, "problems/1/testcases/1.in", "1 2\n")
+	put(t, s, "problems/1/testcases/1.out", "3\n")
+	if got := get(t, s, "problems/1/testcases/1.in"); got != "1 2\n" {
+		t.Errorf("got %q, want %q", got, "1 2\n")
+	}
+
+	put(t, s, "problems/1/testcases/1.in", "4 5\n")
+	if got := get(t, s, "problems/1/testcases/1.in"); got != "4 5\n" {
+		t.Errorf("after overwrite got %q, want %q", got, "4 5\n")
+	}
+
+	if err := s.Delete(ctx, "problems/1/testcases/1.in"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(ctx, "problems/1/testcases/1.in"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get after Delete: got %v, want os.ErrNotExist", err)
+	}
+	if err := s.Delete(ctx, "problems/1/testcases/1.in"); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+	if got := get(t, s, "problems/1/testcases/1.out"); got != "3\n" {
+		t.Errorf("other object got %q, want %q", got, "3\n")
+	}
+}
+
+func TestLocalPutSizeMismatch(t *testing.T) {
+	s, dir := newLocalStorage(t)
+	ctx := context.Background()
+
+	err := s.Put(ctx, "short", strings.NewReader("abc"), 10, "text/plain")
+	if err == nil {
+		t.Fatal("Put with a wrong size succeeded")
+	}
+	if _, err := s.Get(ctx, "short"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get after failed Put: got %v, want os.ErrNotExist", err)
+	}
+	leftovers, err := os.ReadDir(filepath.Join(dir, ".tmp"))
+	if err != nil {
+		t.Fatalf("read temp dir: %v", err)
+	}
+	if len(leftovers) != 0 {
+		t.Errorf("failed Put left %d temporary files", len(leftovers))
+	}
+}
+
+func TestLocalKeysStayInDir(t *testing.T) {
+	s, dir := newLocalStorage(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"../escape", "/etc/escape", "a/../../escape"} {
+		put(t, s, key, key)
+		if got := get(t, s, key); got != key {
+			t.Errorf("Get(%q) = %q", key, got)
+		}
+	}
+	for _, key := range []string{"", ".", ".."} {
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+
+	parent := filepath.Dir(dir)
+	if _, err := os.Stat(filepath.Join(parent, "escape")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("object written outside the storage directory")
+	}
+}
@@ -30,6 +30,16 @@ func NewStorage(backend ObjectStorage) *Storage {
 
 // NewStorageFromConfig selects an object storage backend based on config.
 func NewStorageFromConfig(ctx context.Context, cfg *config.Config) (*Storage, error) {
+	// A local directory is chosen explicitly, so it takes precedence over
+	// the MinIO defaults.
+	if strings.TrimSpace(cfg.LocalStorage.Dir) != "" {
+		client, err := NewLocalClient(cfg.LocalStorage)
+		if err != nil {
+			return nil, err
+		}
+		return NewStorage(client), nil
+	}
+
 	if strings.TrimSpace(cfg.GCS.Bucket) != "" {
 		client, err := NewGCSClient(ctx, cfg.GCS)
 		if err != nil {
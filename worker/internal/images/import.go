@@ -0,0 +1,434 @@
+package images
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+
+	mediaTypeOCIIndex        = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerManifests = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// layer is a layer blob of an unpacked image archive. digest is empty when
+// the archive does not name the blob by its digest.
+type layer struct {
+	path   string
+	digest string
+}
+
+// Import installs the image archive at tarball under name, replacing any
+// image of the same name. The archive is either a `docker save` tarball or
+// an OCI image layout tarball, optionally gzip-compressed. Layers are
+// checked against their digests and applied in order, honouring whiteouts.
+func (s *Store) Import(name, tarball string) (*Image, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	tarball, err := filepath.Abs(tarball)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(s.dir, ".import-"+name+"-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	archiveDir := filepath.Join(tmp, "archive")
+	if err := unpackArchive(tarball, archiveDir); err != nil {
+		return nil, fmt.Errorf("unpack %s: %w", tarball, err)
+	}
+	layers, tags, err := readLayout(archiveDir)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", tarball, err)
+	}
+
+	imageDir := filepath.Join(tmp, "image")
+	root := filepath.Join(imageDir, rootfsDir)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	img := &Image{
+		Name:       name,
+		Source:     tarball,
+		RepoTags:   tags,
+		ImportedAt: time.Now().UTC(),
+	}
+	for _, l := range layers {
+		digest, err := fileDigest(l.path)
+		if err != nil {
+			return nil, err
+		}
+		if l.digest != "" && l.digest != digest {
+			return nil, fmt.Errorf("layer %s: digest mismatch (got %s)", l.digest, digest)
+		}
+		size, err := applyLayerFile(root, l.path)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %w", digest, err)
+		}
+		img.Layers = append(img.Layers, digest)
+		img.Size += size
+	}
+
+	if err := os.WriteFile(filepath.Join(root, installedFile), nil, 0644); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(img, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(imageDir, manifestFile), data, 0644); err != nil {
+		return nil, err
+	}
+
+	// Swap the new image in; the old one goes to tmp and is removed with it.
+	dest := filepath.Join(s.dir, name)
+	if _, err := os.Lstat(dest); err == nil {
+		if err := os.Rename(dest, filepath.Join(tmp, "old")); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.Rename(imageDir, dest); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// unpackArchive extracts the regular files of the image archive at src
+// into dir.
+func unpackArchive(src, dir string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := decompress(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		rel := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if rel == "" {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := writeFile(target, tr, 0644); err != nil {
+			return err
+		}
+	}
+}
+
+// readLayout returns the layers of the single image in an unpacked archive,
+// bottom first, and the tags it was saved under. OCI layouts are preferred
+// over the legacy manifest.json since they name layers by digest.
+func readLayout(dir string) ([]layer, []string, error) {
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+		return readOCILayout(dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "manifest.json")); err == nil {
+		return readDockerLayout(dir)
+	}
+	return nil, nil, errors.New("neither index.json nor manifest.json found; not an image archive")
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform,omitempty"`
+}
+
+type ociIndex struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+func readOCILayout(dir string) ([]layer, []string, error) {
+	var index ociIndex
+	if err := readJSON(filepath.Join(dir, "index.json"), &index); err != nil {
+		return nil, nil, err
+	}
+	if len(index.Manifests) != 1 {
+		return nil, nil, fmt.Errorf("archive holds %d images, want 1", len(index.Manifests))
+	}
+	desc := index.Manifests[0]
+	var tags []string
+	for _, key := range []string{"io.containerd.image.name", "org.opencontainers.image.ref.name"} {
+		if tag := desc.Annotations[key]; tag != "" {
+			tags = append(tags, tag)
+			break
+		}
+	}
+
+	// Multi-platform images nest another index; pick linux/amd64.
+	for desc.MediaType == mediaTypeOCIIndex || desc.MediaType == mediaTypeDockerManifests {
+		var nested ociIndex
+		if err := readJSON(blobPath(dir, desc.Digest), &nested); err != nil {
+			return nil, nil, err
+		}
+		found := false
+		for _, m := range nested.Manifests {
+			if m.Platform != nil && m.Platform.OS == "linux" && m.Platform.Architecture == "amd64" {
+				desc, found = m, true
+				break
+			}
+		}
+		if !found {
+			return nil, nil, errors.New("no linux/amd64 manifest in image index")
+		}
+	}
+
+	var manifest ociManifest
+	if err := readJSON(blobPath(dir, desc.Digest), &manifest); err != nil {
+		return nil, nil, err
+	}
+	layers := make([]layer, 0, len(manifest.Layers))
+	for _, l := range manifest.Layers {
+		layers = append(layers, layer{path: blobPath(dir, l.Digest), digest: l.Digest})
+	}
+	return layers, tags, nil
+}
+
+type dockerManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+func readDockerLayout(dir string) ([]layer, []string, error) {
+	var manifests []dockerManifest
+	if err := readJSON(filepath.Join(dir, "manifest.json"), &manifests); err != nil {
+		return nil, nil, err
+	}
+	if len(manifests) != 1 {
+		return nil, nil, fmt.Errorf("archive holds %d images, want 1", len(manifests))
+	}
+	m := manifests[0]
+	layers := make([]layer, 0, len(m.Layers))
+	for _, p := range m.Layers {
+		l := layer{path: filepath.Join(dir, filepath.FromSlash(path.Clean("/"+p)))}
+		// Newer docker versions store layers as blobs/sha256/<hex>.
+		if hexDigest, ok := strings.CutPrefix(path.Clean(p), "blobs/sha256/"); ok {
+			l.digest = "sha256:" + hexDigest
+		}
+		layers = append(layers, l)
+	}
+	return layers, m.RepoTags, nil
+}
+
+func blobPath(dir, digest string) string {
+	algo, hexDigest, _ := strings.Cut(digest, ":")
+	return filepath.Join(dir, "blobs", filepath.Base(algo), filepath.Base(hexDigest))
+}
+
+func readJSON(file string, v any) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(file), err)
+	}
+	return nil
+}
+
+func fileDigest(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// decompress wraps r in a gzip or zstd reader when its content is
+// compressed, detected by magic number.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return io.NopCloser(br), nil
+	}
+}
+
+func applyLayerFile(root, file string) (int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r, err := decompress(f)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return applyLayer(root, r)
+}
+
+// applyLayer extracts the layer tarball r over root and returns the bytes
+// of regular file content written. Device nodes are skipped since the
+// worker runs unprivileged and lime provides its own /dev; ownership is
+// dropped for the same reason. Directories are kept owner-writable so later
+// layers can modify them.
+func applyLayer(root string, r io.Reader) (int64, error) {
+	var size int64
+	// added tracks the paths of this layer, which opaque whiteouts keep.
+	added := make(map[string]bool)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+		rel := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if rel == "" {
+			continue
+		}
+		dir, base := path.Split(rel)
+		parent, err := resolveInRoot(root, dir, true)
+		if err != nil {
+			return size, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+
+		if base == whiteoutOpaque {
+			entries, err := os.ReadDir(parent)
+			if err != nil {
+				return size, err
+			}
+			for _, e := range entries {
+				if !added[path.Join(dir, e.Name())] {
+					if err := os.RemoveAll(filepath.Join(parent, e.Name())); err != nil {
+						return size, err
+					}
+				}
+			}
+			continue
+		}
+		if hidden, ok := strings.CutPrefix(base, whiteoutPrefix); ok {
+			if err := os.RemoveAll(filepath.Join(parent, hidden)); err != nil {
+				return size, err
+			}
+			continue
+		}
+
+		target := filepath.Join(parent, base)
+		mode := os.FileMode(hdr.Mode).Perm()
+		if fi, err := os.Lstat(target); err == nil && !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+			if err := os.RemoveAll(target); err != nil {
+				return size, err
+			}
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.Mkdir(target, 0755); err != nil && !os.IsExist(err) {
+				return size, err
+			}
+			if err := os.Chmod(target, mode|0700); err != nil {
+				return size, err
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, tr, mode); err != nil {
+				return size, err
+			}
+			size += hdr.Size
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return size, err
+			}
+		case tar.TypeLink:
+			linkDir, linkBase := path.Split(strings.TrimPrefix(path.Clean("/"+hdr.Linkname), "/"))
+			linkParent, err := resolveInRoot(root, linkDir, false)
+			if err != nil {
+				return size, fmt.Errorf("%s: link target: %w", hdr.Name, err)
+			}
+			if err := os.Link(filepath.Join(linkParent, linkBase), target); err != nil {
+				return size, err
+			}
+		default:
+			continue
+		}
+		added[rel] = true
+	}
+}
+
+func writeFile(target string, r io.Reader, mode os.FileMode) error {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// Apply the exact mode regardless of the umask.
+	return os.Chmod(target, mode)
+}
@@ -0,0 +1,257 @@
+package images_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/jjudge-oj/worker/internal/images"
+)
+
+// entry is a tar entry of a test layer.
+type entry struct {
+	name     string
+	typeflag byte
+	body     string
+	linkname string
+}
+
+func file(name, body string) entry {
+	return entry{name: name, typeflag: tar.TypeReg, body: body}
+}
+
+func dir(name string) entry {
+	return entry{name: name, typeflag: tar.TypeDir}
+}
+
+func symlink(name, target string) entry {
+	return entry{name: name, typeflag: tar.TypeSymlink, linkname: target}
+}
+
+func hardlink(name, target string) entry {
+	return entry{name: name, typeflag: tar.TypeLink, linkname: target}
+}
+
+func tarball(t *testing.T, entries []entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.linkname, Mode: 0644}
+		if e.typeflag == tar.TypeDir {
+			hdr.Mode = 0755
+		}
+		if e.typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.body))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// importLayers saves layers, bottom first, as a `docker save` archive and
+// imports it as image "test".
+func importLayers(t *testing.T, layers ...[]entry) (string, error) {
+	t.Helper()
+	manifest := []map[string]any{{"Config": "config.json", "Layers": []string{}}}
+	var archive []entry
+	for i, l := range layers {
+		name := fmt.Sprintf("layer%d.tar", i)
+		manifest[0]["Layers"] = append(manifest[0]["Layers"].([]string), name)
+		archive = append(archive, file(name, string(tarball(t, l))))
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive = append(archive, file("manifest.json", string(data)))
+
+	src := filepath.Join(t.TempDir(), "image.tar")
+	if err := os.WriteFile(src, tarball(t, archive), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store := images.NewStore(filepath.Join(t.TempDir(), "images"))
+	if _, err := store.Import("test", src); err != nil {
+		return "", err
+	}
+	return store.Path("test")
+}
+
+func mustImport(t *testing.T, layers ...[]entry) string {
+	t.Helper()
+	root, err := importLayers(t, layers...)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	return root
+}
+
+// listTree returns the paths under root, without the install marker.
+func listTree(t *testing.T, root string) []string {
+	t.Helper()
+	var paths []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == root {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if rel != ".installed" {
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestImportDotDotStaysInRoot(t *testing.T) {
+	root := mustImport(t, []entry{
+		file("../../escape", "x"),
+		file("bin/../../../escape2", "y"),
+	})
+	if got, want := listTree(t, root), []string{"escape", "escape2"}; !slices.Equal(got, want) {
+		t.Errorf("rootfs = %v, want %v", got, want)
+	}
+	for _, name := range []string{"escape", "escape2"} {
+		if _, err := os.Lstat(filepath.Join(root, "..", "..", name)); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s written outside the rootfs", name)
+		}
+	}
+}
+
+func TestImportSymlinksStayInRoot(t *testing.T) {
+	outside := t.TempDir()
+	root := mustImport(t,
+		[]entry{
+			symlink("abs", outside),
+			symlink("rel", "../../../../../../../.."+outside),
+		},
+		[]entry{
+			file("abs/pwned", "a"),
+			file("rel/pwned", "b"),
+		},
+	)
+
+	entries, err := os.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("layer wrote %d files through a symlink outside the rootfs", len(entries))
+	}
+	// Both links resolve to the same directory inside the rootfs.
+	if got := readFile(t, filepath.Join(root, outside, "pwned")); got != "b" {
+		t.Errorf("pwned = %q, want the file from rel/", got)
+	}
+
+	if _, err := importLayers(t, []entry{symlink("loop", "loop")}, []entry{file("loop/x", "")}); err == nil {
+		t.Error("writing through a symlink loop succeeded")
+	}
+}
+
+func TestImportWhiteouts(t *testing.T) {
+	root := mustImport(t,
+		[]entry{
+			dir("etc"),
+			file("etc/keep", "keep"),
+			file("etc/gone", "gone"),
+			dir("var/cache"),
+			file("var/cache/a", ""),
+			file("var/cache/b", ""),
+		},
+		[]entry{
+			file("etc/.wh.gone", ""),
+			file("etc/.wh.never-existed", ""),
+			dir("var/.wh.cache"),
+		},
+	)
+	if got, want := listTree(t, root), []string{"etc", "etc/keep", "var"}; !slices.Equal(got, want) {
+		t.Errorf("rootfs = %v, want %v", got, want)
+	}
+}
+
+func TestImportOpaqueWhiteout(t *testing.T) {
+	layers := [][]entry{{
+		dir("opt"),
+		file("opt/old1", ""),
+		dir("opt/olddir"),
+		file("opt/olddir/x", ""),
+		file("other", "kept"),
+	}}
+	// The marker may come before or after the layer's own entries in the
+	// directory; either way only the latter survive.
+	for _, upper := range [][]entry{
+		{file("opt/.wh..wh..opq", ""), file("opt/new", "")},
+		{file("opt/new", ""), file("opt/.wh..wh..opq", "")},
+	} {
+		root := mustImport(t, append(layers, upper)...)
+		if got, want := listTree(t, root), []string{"opt", "opt/new", "other"}; !slices.Equal(got, want) {
+			t.Errorf("rootfs = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestImportHardlinks(t *testing.T) {
+	root := mustImport(t, []entry{
+		file("bin/tool", "tool"),
+		hardlink("bin/alias", "bin/tool"),
+		hardlink("bin/alias2", "/../bin/tool"),
+	})
+	for _, name := range []string{"bin/alias", "bin/alias2"} {
+		if got := readFile(t, filepath.Join(root, name)); got != "tool" {
+			t.Errorf("%s = %q, want %q", name, got, "tool")
+		}
+	}
+
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for name, layers := range map[string][][]entry{
+		"dot-dot":  {{hardlink("h", "../../../../../../.."+secret)}},
+		"absolute": {{hardlink("h", secret)}},
+		"through symlink": {
+			{symlink("s", outside)},
+			{hardlink("h", "s/secret")},
+		},
+	} {
+		if _, err := importLayers(t, layers...); err == nil {
+			t.Errorf("%s: hardlink to a file outside the rootfs succeeded", name)
+		}
+	}
+	fi, err := os.Stat(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := fi.Sys().(*syscall.Stat_t).Nlink; n != 1 {
+		t.Errorf("outside file has %d links, want 1", n)
+	}
+}
@@ -0,0 +1,208 @@
+package images
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	manifestFile  = "image.json"
+	rootfsDir     = "rootfs"
+	installedFile = ".installed"
+
+	// maxSymlinkHops bounds symlink resolution inside an image, matching
+	// the kernel's limit.
+	maxSymlinkHops = 40
+)
+
+// ErrNotInstalled is returned when an image is not present in the store.
+var ErrNotInstalled = errors.New("image not installed")
+
+var nameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+// Image describes an installed rootfs image.
+type Image struct {
+	Name       string    `json:"name"`
+	Source     string    `json:"source"`
+	RepoTags   []string  `json:"repo_tags,omitempty"`
+	Layers     []string  `json:"layers"`
+	Size       int64     `json:"size"`
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+// Store manages named rootfs images in a directory. Each image lives in
+// <dir>/<name>, holding its manifest and the extracted rootfs that lime
+// mounts as the lower OverlayFS layer.
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// ValidateName reports whether name can be used as an image name.
+func ValidateName(name string) error {
+	if !nameRe.MatchString(name) {
+		return fmt.Errorf("invalid image name %q", name)
+	}
+	return nil
+}
+
+// Path returns the rootfs path of the named image.
+func (s *Store) Path(name string) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	root := filepath.Join(s.dir, name, rootfsDir)
+	if _, err := os.Stat(filepath.Join(root, installedFile)); err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%s: %w", name, ErrNotInstalled)
+		}
+		return "", err
+	}
+	return root, nil
+}
+
+// Get returns the manifest of the named image.
+func (s *Store) Get(name string) (*Image, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, name, manifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%s: %w", name, ErrNotInstalled)
+		}
+		return nil, err
+	}
+	var img Image
+	if err := json.Unmarshal(data, &img); err != nil {
+		return nil, fmt.Errorf("image %s: invalid manifest: %w", name, err)
+	}
+	return &img, nil
+}
+
+// List returns the installed images sorted by name. Leftovers of
+// interrupted imports are skipped.
+func (s *Store) List() ([]*Image, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var imgs []*Image
+	for _, e := range entries {
+		if !e.IsDir() || ValidateName(e.Name()) != nil {
+			continue
+		}
+		img, err := s.Get(e.Name())
+		if errors.Is(err, ErrNotInstalled) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		imgs = append(imgs, img)
+	}
+	sort.Slice(imgs, func(i, j int) bool { return imgs[i].Name < imgs[j].Name })
+	return imgs, nil
+}
+
+// Remove deletes the named image.
+func (s *Store) Remove(name string) error {
+	if _, err := s.Get(name); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(s.dir, name))
+}
+
+// Verify checks that the named image is completely installed and that each
+// of binaries, given as absolute paths inside the sandbox, resolves to an
+// executable file within the image.
+func (s *Store) Verify(name string, binaries []string) error {
+	if _, err := s.Get(name); err != nil {
+		return err
+	}
+	root, err := s.Path(name)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, bin := range binaries {
+		resolved, err := resolveInRoot(root, bin, false)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", bin, err))
+			continue
+		}
+		fi, err := os.Stat(resolved)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", bin, err))
+			continue
+		}
+		if !fi.Mode().IsRegular() || fi.Mode().Perm()&0111 == 0 {
+			errs = append(errs, fmt.Errorf("%s: not an executable file", bin))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("image %s: %w", name, errors.Join(errs...))
+	}
+	return nil
+}
+
+// resolveInRoot resolves the absolute path p as if root were /, following
+// symlinks without letting them escape root. With create, missing
+// directories along p are created instead of failing the lookup.
+func resolveInRoot(root, p string, create bool) (string, error) {
+	rest := strings.Split(strings.Trim(filepath.Clean("/"+p), "/"), "/")
+	resolved := "/"
+	hops := 0
+	for len(rest) > 0 {
+		part := rest[0]
+		rest = rest[1:]
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, part)
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if create && os.IsNotExist(err) {
+			if err := os.Mkdir(filepath.Join(root, next), 0755); err != nil {
+				return "", err
+			}
+			resolved = next
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if hops++; hops > maxSymlinkHops {
+			return "", errors.New("too many levels of symbolic links")
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return filepath.Join(root, resolved), nil
+}
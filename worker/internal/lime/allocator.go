@@ -2,23 +2,43 @@ package lime
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 )
 
+// ErrTooManyCPUs is returned by AllocateN when a run needs more CPUs than the
+// pool has slots. The run can never be scheduled on this worker.
+var ErrTooManyCPUs = errors.New("more cpus requested than the worker has")
+
 type Slot struct {
+	ID   int
 	CPUs string
 	Mems string
 	UID  int
 	GID  int
+
+	// SpeedFactor is the slot's calibrated speed relative to the reference
+	// machine; zero until the pool is calibrated.
+	SpeedFactor float64
 }
 
 type SlotPool struct {
 	ch      chan Slot
 	uidBase int
+
+	// daemon runs requests when set; otherwise lime is started per run.
+	daemon *Daemon
+
+	// multi serializes multi-slot allocations, so two of them never each
+	// hold part of the slots the other is waiting for.
+	multi sync.Mutex
 }
 
 type SlotPoolOption func(*SlotPool)
@@ -45,6 +65,14 @@ func WithSlotUIDs(base int) SlotPoolOption {
 	}
 }
 
+// WithDaemon runs the pool's requests through a lime daemon, one session
+// per slot.
+func WithDaemon(d *Daemon) SlotPoolOption {
+	return func(sp *SlotPool) {
+		sp.daemon = d
+	}
+}
+
 // WithCPUs configures the slot pool from a CPU set string (e.g. "0-3", "0,2,4").
 // One slot is created per CPU in the set, each pinned to its CPU.
 // An empty string means no pinning; the number of slots equals runtime.NumCPU().
@@ -73,6 +101,7 @@ func WithCPUs(cpuSet string) SlotPoolOption {
 				gid = sp.uidBase + i
 			}
 			sp.ch <- Slot{
+				ID:   i,
 				CPUs: cpu,
 				Mems: mems[i%len(mems)],
 				UID:  uid,
@@ -92,8 +121,21 @@ func CPUCount(cpuSet string) int {
 	return len(cpus)
 }
 
+// Size returns the number of slots in the pool.
+func (sp *SlotPool) Size() int {
+	return cap(sp.ch)
+}
+
+// InUse returns the number of slots currently allocated.
+func (sp *SlotPool) InUse() int {
+	return cap(sp.ch) - len(sp.ch)
+}
+
 type Allocation struct {
-	pool     *SlotPool
+	pool *SlotPool
+	// slots are the pool slots held; slot combines them into the slot the
+	// run uses.
+	slots    []Slot
 	slot     Slot
 	released atomic.Bool
 }
@@ -101,12 +143,66 @@ type Allocation struct {
 func (sp *SlotPool) Allocate(ctx context.Context) (*Allocation, error) {
 	select {
 	case r := <-sp.ch:
-		return &Allocation{pool: sp, slot: r}, nil
+		return &Allocation{pool: sp, slots: []Slot{r}, slot: r}, nil
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	}
 }
 
+// AllocateN allocates n slots for a run that uses n CPUs. The run uses the
+// identity (ID, UID and GID) of the lowest-numbered slot and the CPUs and
+// memory nodes of all of them.
+func (sp *SlotPool) AllocateN(ctx context.Context, n int) (*Allocation, error) {
+	if n <= 1 {
+		return sp.Allocate(ctx)
+	}
+	if n > cap(sp.ch) {
+		return nil, fmt.Errorf("%w: %d requested, pool has %d slots", ErrTooManyCPUs, n, cap(sp.ch))
+	}
+
+	sp.multi.Lock()
+	defer sp.multi.Unlock()
+
+	a := &Allocation{pool: sp}
+	for len(a.slots) < n {
+		select {
+		case r := <-sp.ch:
+			a.slots = append(a.slots, r)
+		case <-ctx.Done():
+			a.Release()
+			return nil, ctx.Err()
+		}
+	}
+	a.slot = combineSlots(a.slots)
+	return a, nil
+}
+
+func combineSlots(slots []Slot) Slot {
+	slices.SortFunc(slots, func(a, b Slot) int { return a.ID - b.ID })
+	combined := slots[0]
+	var cpus, mems []string
+	var speed float64
+	calibrated := true
+	for _, s := range slots {
+		if s.CPUs != "" {
+			cpus = append(cpus, s.CPUs)
+		}
+		if s.Mems != "" && !slices.Contains(mems, s.Mems) {
+			mems = append(mems, s.Mems)
+		}
+		speed += s.SpeedFactor
+		calibrated = calibrated && s.SpeedFactor > 0
+	}
+	combined.CPUs = strings.Join(cpus, ",")
+	combined.Mems = strings.Join(mems, ",")
+	// An uncalibrated slot leaves the combined speed unknown.
+	combined.SpeedFactor = 0
+	if calibrated {
+		combined.SpeedFactor = speed / float64(len(slots))
+	}
+	return combined
+}
+
 func (a *Allocation) Slot() Slot {
 	return a.slot
 }
@@ -118,7 +214,9 @@ func (a *Allocation) Release() {
 	if !a.released.CompareAndSwap(false, true) {
 		return
 	}
-	a.pool.ch <- a.slot
+	for _, s := range a.slots {
+		a.pool.ch <- s
+	}
 }
 
 func parseCPUSet(value string) []string {
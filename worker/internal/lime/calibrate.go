@@ -0,0 +1,198 @@
+package lime
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// benchmarkIterations sizes the calibration workload, which takes
+	// referenceBenchmarkTime of CPU time on the reference machine.
+	benchmarkIterations    = 50_000_000
+	referenceBenchmarkTime = 200 * time.Millisecond
+	benchmarkRounds        = 5
+
+	// UnstableSpread is the round-to-round variation above which a slot's
+	// measurements are considered unreliable, e.g. because of frequency
+	// scaling or a noisy neighbour on the CPU.
+	UnstableSpread = 0.05
+)
+
+// Calibration is the outcome of benchmarking one slot.
+type Calibration struct {
+	Slot int
+	CPUs string
+
+	// SpeedFactor is the slot's speed relative to the reference machine:
+	// 2 means the benchmark took half the reference CPU time.
+	SpeedFactor float64
+
+	// Spread is the coefficient of variation of the benchmark rounds.
+	Spread float64
+}
+
+// Unstable reports whether the slot's timings varied too much to trust.
+func (c Calibration) Unstable() bool {
+	return c.Spread > UnstableSpread
+}
+
+// Calibrate benchmarks every slot of the pool, in parallel once all slots
+// are free, and records each slot's speed factor for the reports of later
+// runs.
+func (sp *SlotPool) Calibrate(ctx context.Context) ([]Calibration, error) {
+	// Taking every slot is a multi-slot allocation: without the lock it
+	// could hold part of the slots an AllocateN is waiting for, and wait
+	// for the ones that AllocateN holds.
+	sp.multi.Lock()
+	defer sp.multi.Unlock()
+
+	n := cap(sp.ch)
+	allocations := make([]*Allocation, 0, n)
+	defer func() {
+		for _, a := range allocations {
+			a.Release()
+		}
+	}()
+	for i := 0; i < n; i++ {
+		a, err := sp.Allocate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, a)
+	}
+
+	results := make([]Calibration, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i, a := range allocations {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = benchmarkSlot(a.slot)
+			if errs[i] == nil {
+				a.slots[0].SpeedFactor = results[i].SpeedFactor
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Slot < results[j].Slot })
+	return results, nil
+}
+
+// benchmarkSlot runs the calibration workload on the slot's CPU and
+// measures the CPU time of each round.
+func benchmarkSlot(slot Slot) (Calibration, error) {
+	type outcome struct {
+		times []time.Duration
+		err   error
+	}
+	ch := make(chan outcome, 1)
+	go func() {
+		// The thread is pinned to the slot's CPU and exits with the
+		// goroutine, since it is never unlocked.
+		runtime.LockOSThread()
+		if slot.CPUs != "" {
+			cpu, err := strconv.Atoi(slot.CPUs)
+			if err != nil {
+				ch <- outcome{err: fmt.Errorf("slot %d: cpu %q: %w", slot.ID, slot.CPUs, err)}
+				return
+			}
+			var set unix.CPUSet
+			set.Set(cpu)
+			if err := unix.SchedSetaffinity(0, &set); err != nil {
+				ch <- outcome{err: fmt.Errorf("slot %d: pin to cpu %d: %w", slot.ID, cpu, err)}
+				return
+			}
+		}
+
+		times := make([]time.Duration, 0, benchmarkRounds)
+		for i := 0; i < benchmarkRounds; i++ {
+			start, err := threadCPUTime()
+			if err != nil {
+				ch <- outcome{err: err}
+				return
+			}
+			benchmarkWorkload(benchmarkIterations)
+			end, err := threadCPUTime()
+			if err != nil {
+				ch <- outcome{err: err}
+				return
+			}
+			times = append(times, end-start)
+		}
+		ch <- outcome{times: times}
+	}()
+
+	out := <-ch
+	if out.err != nil {
+		return Calibration{}, out.err
+	}
+
+	sorted := append([]time.Duration(nil), out.times...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	median := sorted[len(sorted)/2]
+
+	var mean float64
+	for _, t := range out.times {
+		mean += float64(t)
+	}
+	mean /= float64(len(out.times))
+	var variance float64
+	for _, t := range out.times {
+		variance += (float64(t) - mean) * (float64(t) - mean)
+	}
+	variance /= float64(len(out.times))
+
+	return Calibration{
+		Slot:        slot.ID,
+		CPUs:        slot.CPUs,
+		SpeedFactor: float64(referenceBenchmarkTime) / float64(median),
+		Spread:      math.Sqrt(variance) / mean,
+	}, nil
+}
+
+func threadCPUTime() (time.Duration, error) {
+	var ts unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_THREAD_CPUTIME_ID, &ts); err != nil {
+		return 0, fmt.Errorf("read thread cpu time: %w", err)
+	}
+	return time.Duration(ts.Nano()), nil
+}
+
+// benchmarkSink keeps the workload's result alive so it is not optimised
+// away.
+var benchmarkSink atomic.Uint32
+
+// benchmarkWorkload mixes integer arithmetic with cache-resident memory
+// accesses, roughly like a typical accepted solution.
+func benchmarkWorkload(n int) {
+	const size = 1 << 16
+	buf := make([]uint32, size)
+	x := uint64(88172645463325252)
+	for i := 0; i < n; i++ {
+		x ^= x << 13
+		x ^= x >> 7
+		x ^= x << 17
+		buf[x&(size-1)] += uint32(x >> 32)
+	}
+	var sum uint32
+	for _, v := range buf {
+		sum += v
+	}
+	benchmarkSink.Store(sum)
+}
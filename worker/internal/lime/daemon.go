@@ -0,0 +1,245 @@
+package lime
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	daemonStartTimeout  = 5 * time.Second
+	daemonRestartDelay  = time.Second
+	maxDaemonFrameBytes = 256 << 20
+)
+
+// Daemon runs requests through a long-running `lime serve` process instead
+// of starting lime per run. It keeps one connection per slot; the daemon
+// treats a connection as a session, so consecutive runs in a slot reuse the
+// container directory and cgroup set up by the first one.
+type Daemon struct {
+	socketPath string
+
+	mu    sync.Mutex
+	conns map[int]net.Conn
+
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+// daemonRequest carries the seccomp flag that `lime run` takes on its
+// command line.
+type daemonRequest struct {
+	ExecRequest
+	UseSeccompBPF bool `json:"use_seccomp_bpf"`
+}
+
+type daemonResponse struct {
+	ExecResponse
+	Error string `json:"error,omitempty"`
+}
+
+// StartDaemon starts `lime serve` listening on socketPath and waits for it
+// to accept connections. The daemon is restarted if it exits, until ctx is
+// cancelled or Close is called.
+func StartDaemon(ctx context.Context, socketPath string) (*Daemon, error) {
+	d := &Daemon{
+		socketPath: socketPath,
+		conns:      make(map[int]net.Conn),
+		done:       make(chan struct{}),
+	}
+	if err := d.start(); err != nil {
+		return nil, err
+	}
+	go d.supervise(ctx)
+	return d, nil
+}
+
+func (d *Daemon) start() error {
+	cmd := exec.Command("lime", "serve", "--socket", d.socketPath)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start lime serve: %w", err)
+	}
+
+	deadline := time.Now().Add(daemonStartTimeout)
+	for {
+		conn, err := net.Dial("unix", d.socketPath)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return fmt.Errorf("lime serve did not listen on %s: %w", d.socketPath, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	d.mu.Lock()
+	d.cmd = cmd
+	d.mu.Unlock()
+	return nil
+}
+
+// supervise restarts the daemon whenever it exits.
+func (d *Daemon) supervise(ctx context.Context) {
+	for {
+		d.mu.Lock()
+		cmd := d.cmd
+		d.mu.Unlock()
+
+		err := cmd.Wait()
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.done:
+			return
+		default:
+		}
+		log.Printf("lime: daemon exited (%v), restarting", err)
+		d.dropConns()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-d.done:
+				return
+			case <-time.After(daemonRestartDelay):
+			}
+			if err := d.start(); err != nil {
+				log.Printf("lime: %v", err)
+				continue
+			}
+			break
+		}
+	}
+}
+
+// Run executes req on the daemon session of slot.
+func (d *Daemon) Run(ctx context.Context, slot Slot, req ExecRequest) (ExecResponse, error) {
+	conn, err := d.conn(slot.ID)
+	if err != nil {
+		return ExecResponse{}, err
+	}
+
+	timeout := time.Duration(req.WallTimeLimitUs)*time.Microsecond + 10*time.Second
+	deadline := time.Now().Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	// Abort the exchange when ctx is cancelled; the broken connection is
+	// dropped and the daemon tears the session down.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	resp, err := exchange(conn, daemonRequest{ExecRequest: req, UseSeccompBPF: req.UseSeccompBPF})
+	if err != nil {
+		d.dropConn(slot.ID, conn)
+		if ctx.Err() != nil {
+			return ExecResponse{}, ctx.Err()
+		}
+		return ExecResponse{}, fmt.Errorf("lime daemon: %w", err)
+	}
+	if resp.Error != "" {
+		return ExecResponse{}, fmt.Errorf("lime daemon: %s", resp.Error)
+	}
+	return resp.ExecResponse, nil
+}
+
+func exchange(conn net.Conn, req daemonRequest) (daemonResponse, error) {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return daemonResponse{}, fmt.Errorf("marshal request: %w", err)
+	}
+	frame := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[4:], payload)
+	if _, err := conn.Write(frame); err != nil {
+		return daemonResponse{}, err
+	}
+
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return daemonResponse{}, err
+	}
+	n := binary.BigEndian.Uint32(header[:])
+	if n > maxDaemonFrameBytes {
+		return daemonResponse{}, fmt.Errorf("response frame of %d bytes exceeds limit", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return daemonResponse{}, err
+	}
+
+	var resp daemonResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return daemonResponse{}, fmt.Errorf("unmarshal response: %w", err)
+	}
+	return resp, nil
+}
+
+func (d *Daemon) conn(slotID int) (net.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if conn, ok := d.conns[slotID]; ok {
+		return conn, nil
+	}
+	conn, err := net.Dial("unix", d.socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("lime daemon: %w", err)
+	}
+	d.conns[slotID] = conn
+	return conn, nil
+}
+
+func (d *Daemon) dropConn(slotID int, conn net.Conn) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	conn.Close()
+	if d.conns[slotID] == conn {
+		delete(d.conns, slotID)
+	}
+}
+
+func (d *Daemon) dropConns() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, conn := range d.conns {
+		conn.Close()
+		delete(d.conns, id)
+	}
+}
+
+// Close disconnects all sessions and stops the daemon.
+func (d *Daemon) Close() error {
+	select {
+	case <-d.done:
+		return nil
+	default:
+		close(d.done)
+	}
+	d.dropConns()
+
+	d.mu.Lock()
+	cmd := d.cmd
+	d.mu.Unlock()
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package lime
+
+import "net"
+
+// ReportFromResponse exposes reportFromResponse to the external tests. The
+// run's time is judged against timeLimitUs, as Run sets it.
+func ReportFromResponse(resp ExecResponse, req ExecRequest, timeLimitUs uint64) *Report {
+	req.timeLimitUs = timeLimitUs
+	return reportFromResponse(resp, req)
+}
+
+// CombineSlots exposes combineSlots to the external tests.
+func CombineSlots(slots []Slot) Slot {
+	return combineSlots(slots)
+}
+
+// NewTestDaemon returns a Daemon talking to a server already listening on
+// socketPath, without starting `lime serve`.
+func NewTestDaemon(socketPath string) *Daemon {
+	return &Daemon{
+		socketPath: socketPath,
+		conns:      make(map[int]net.Conn),
+		done:       make(chan struct{}),
+	}
+}
+
+// CloseSessions disconnects all sessions of d.
+func (d *Daemon) CloseSessions() {
+	d.dropConns()
+}
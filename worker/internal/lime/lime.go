@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -27,6 +28,7 @@ type ExecRequest struct {
 	MaxOpenFiles     uint32   `json:"max_open_files"`
 	StackLimitBytes  uint64   `json:"stack_limit_bytes"`
 	UseCPUs          string   `json:"use_cpus"`
+	CPUCount         uint32   `json:"cpu_count"` // CPUs the quota allows; UseCPUs is empty on an unpinned pool
 	UseMems          string   `json:"use_mems"`
 	Stdin            string   `json:"stdin"`
 	RootfsPath       string   `json:"rootfs_path"`
@@ -35,6 +37,15 @@ type ExecRequest struct {
 	HostUID          uint32   `json:"host_uid"`
 	HostGID          uint32   `json:"host_gid"`
 	UseSeccompBPF    bool     `json:"-"` // passed as CLI flag, not JSON
+
+	SeccompPolicy *SeccompPolicy `json:"seccomp_policy,omitempty"`
+
+	// cpuCount is the number of slots the run needs, and timeLimitUs the
+	// limit the run's time is judged against: CPU time summed over all
+	// threads, or wall time with wallClockTime.
+	cpuCount      int
+	timeLimitUs   uint64
+	wallClockTime bool
 }
 
 type ExecResponse struct {
@@ -46,6 +57,8 @@ type ExecResponse struct {
 	MemoryBytes uint64 `json:"memory_bytes"`
 	Stdout      string `json:"stdout"`
 	Stderr      string `json:"stderr"`
+
+	BlockedSyscall string `json:"blocked_syscall,omitempty"`
 }
 
 const (
@@ -54,12 +67,64 @@ const (
 	defaultMaxOpenFiles     = 16
 )
 
-func Run(ctx context.Context, runtimeCfg *config.Config, sp *SlotPool, workDir, rootfsPath string, args []string, stdin string, timeLimitUs uint64, memoryLimitBytes uint64, maxProcs uint32, useSeccompBPF bool) (*Report, error) {
+// ErrSandbox wraps errors from this worker's sandbox setup: a missing
+// rootfs, preparing the work directory, or starting lime and its daemon.
+// Another worker may well run the same job, unlike a job asking for more
+// CPUs than the worker has.
+var ErrSandbox = errors.New("sandbox failed")
+
+// RunOption adjusts the ExecRequest built by Run.
+type RunOption func(*ExecRequest)
+
+// WithOutputLimit caps the bytes the program may write to stdout. Zero keeps
+// the default limit.
+func WithOutputLimit(limit uint64) RunOption {
+	return func(req *ExecRequest) {
+		if limit > 0 {
+			req.OutputLimitBytes = limit
+		}
+	}
+}
+
+// WithCPUCount runs the program on n CPUs of the slot pool instead of one.
+func WithCPUCount(n int) RunOption {
+	return func(req *ExecRequest) {
+		req.cpuCount = n
+	}
+}
+
+// WithWallClockTime judges the run's time limit against elapsed wall time
+// instead of CPU time, so multi-threaded programs may use up to the time
+// limit on each of their CPUs.
+func WithWallClockTime() RunOption {
+	return func(req *ExecRequest) {
+		req.wallClockTime = true
+	}
+}
+
+func Run(ctx context.Context, runtimeCfg *config.Config, sp *SlotPool, workDir, rootfsPath string, args []string, stdin string, timeLimitUs uint64, memoryLimitBytes uint64, maxProcs uint32, useSeccompBPF bool, opts ...RunOption) (*Report, error) {
 	if sp == nil {
 		return nil, fmt.Errorf("slot pool is nil")
 	}
 
-	allocation, err := sp.Allocate(ctx)
+	req := ExecRequest{
+		ID:               uuid.NewString(),
+		Args:             args,
+		Envp:             []string{"PATH=/usr/bin:/usr/local/bin:/bin"},
+		MemoryLimitBytes: memoryLimitBytes,
+		MaxProcesses:     maxProcs,
+		OutputLimitBytes: defaultOutputLimitBytes,
+		MaxOpenFiles:     defaultMaxOpenFiles,
+		StackLimitBytes:  defaultStackLimitBytes,
+		Stdin:            stdin,
+		UseOverlayfs:     true,
+		UseSeccompBPF:    useSeccompBPF,
+	}
+	for _, opt := range opts {
+		opt(&req)
+	}
+
+	allocation, err := sp.AllocateN(ctx, req.cpuCount)
 	if err != nil {
 		return nil, fmt.Errorf("failed to allocate slot: %w", err)
 	}
@@ -75,7 +140,7 @@ func Run(ctx context.Context, runtimeCfg *config.Config, sp *SlotPool, workDir,
 		return nil, fmt.Errorf("resolve rootfs path: %w", err)
 	}
 	if _, err := os.Stat(absRootfs); err != nil {
-		return nil, fmt.Errorf("rootfs path not found: %w", err)
+		return nil, fmt.Errorf("%w: rootfs path not found: %w", ErrSandbox, err)
 	}
 
 	absWorkDir, err := filepath.Abs(workDir)
@@ -83,43 +148,54 @@ func Run(ctx context.Context, runtimeCfg *config.Config, sp *SlotPool, workDir,
 		return nil, fmt.Errorf("resolve work dir: %w", err)
 	}
 
-	wallTimeUs := timeLimitUs * 2
+	// With normalization, limits are expressed in reference machine time
+	// and the program gets the equivalent time on this slot.
+	factor := allocation.slot.SpeedFactor
+	normalize := runtimeCfg.Judge.NormalizeCPUTime && factor > 0
+	if normalize {
+		timeLimitUs = uint64(float64(timeLimitUs) / factor)
+	}
+	req.timeLimitUs = timeLimitUs
+	req.CPUTimeLimitUs = timeLimitUs
+	req.WallTimeLimitUs = timeLimitUs * 2
+	if req.wallClockTime {
+		// Every CPU may be busy for the whole time limit.
+		req.CPUTimeLimitUs = timeLimitUs * uint64(max(req.cpuCount, 1))
+	}
 
 	if allocation.slot.UID != 0 {
 		if err := os.Chown(absWorkDir, allocation.slot.UID, allocation.slot.GID); err != nil {
-			return nil, fmt.Errorf("chown work dir to slot uid: %w", err)
+			return nil, fmt.Errorf("%w: chown work dir to slot uid: %w", ErrSandbox, err)
 		}
 		defer os.Chown(absWorkDir, 0, 0)
 	}
 
-	req := ExecRequest{
-		ID:               uuid.NewString(),
-		Args:             args,
-		Envp:             []string{"PATH=/usr/bin:/usr/local/bin:/bin"},
-		CPUTimeLimitUs:   timeLimitUs,
-		WallTimeLimitUs:  wallTimeUs,
-		MemoryLimitBytes: memoryLimitBytes,
-		MaxProcesses:     maxProcs,
-		OutputLimitBytes: defaultOutputLimitBytes,
-		MaxOpenFiles:     defaultMaxOpenFiles,
-		StackLimitBytes:  defaultStackLimitBytes,
-		UseCPUs:          allocation.slot.CPUs,
-		UseMems:          allocation.slot.Mems,
-		Stdin:            stdin,
-		RootfsPath:       absRootfs,
-		BindMounts:       []string{fmt.Sprintf("%s:/work", absWorkDir)},
-		UseOverlayfs:     true,
-		HostUID:          uint32(allocation.slot.UID),
-		HostGID:          uint32(allocation.slot.GID),
-		UseSeccompBPF:    useSeccompBPF,
-	}
+	req.UseCPUs = allocation.slot.CPUs
+	req.CPUCount = uint32(max(req.cpuCount, 1))
+	req.UseMems = allocation.slot.Mems
+	req.RootfsPath = absRootfs
+	req.BindMounts = []string{fmt.Sprintf("%s:/work", absWorkDir)}
+	req.HostUID = uint32(allocation.slot.UID)
+	req.HostGID = uint32(allocation.slot.GID)
 
-	resp, err := RunContext(ctx, req)
+	var resp ExecResponse
+	if sp.daemon != nil {
+		resp, err = sp.daemon.Run(ctx, allocation.slot, req)
+	} else {
+		resp, err = RunContext(ctx, req)
+	}
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrSandbox, err)
 	}
 
-	report := reportFromResponse(resp, req.CPUTimeLimitUs, req.MemoryLimitBytes)
+	report := reportFromResponse(resp, req)
+	report.Slot = allocation.slot.ID
+	report.SpeedFactor = factor
+	if normalize {
+		report.CPUTime = uint64(float64(report.CPUTime) * factor)
+		report.WallTime = uint64(float64(report.WallTime) * factor)
+		report.Normalized = true
+	}
 	return report, nil
 }
 
@@ -1,17 +1,24 @@
 package lime_test
 
 import (
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/jjudge-oj/worker/config"
 	"github.com/jjudge-oj/worker/internal/lime"
 )
 
@@ -291,6 +298,500 @@ func TestLimeConcurrency(t *testing.T) {
 	tc.Run(t, rootfsPath)
 }
 
+func TestCalibrateWithAllocateN(t *testing.T) {
+	// The slots share CPU 0 so the test runs on any machine.
+	sp := lime.NewSlotPool(lime.WithCPUs("0,0,0"))
+	ctx, cancel := context.WithTimeout(t.Context(), 15*time.Second)
+	defer cancel()
+
+	// Three single-slot runs are in progress while a recalibration and a
+	// two-CPU run wait for slots. As the runs finish, the two waiters take
+	// turns at the freed slots; unless they are serialized, each ends up
+	// holding a slot the other needs.
+	var running []*lime.Allocation
+	for range sp.Size() {
+		a, err := sp.Allocate(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		running = append(running, a)
+	}
+
+	calibrateDone := make(chan error, 1)
+	go func() {
+		_, err := sp.Calibrate(ctx)
+		calibrateDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	multiDone := make(chan error, 1)
+	go func() {
+		a, err := sp.AllocateN(ctx, 2)
+		if err == nil {
+			a.Release()
+		}
+		multiDone <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	for _, a := range running {
+		a.Release()
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	for _, done := range []chan error{calibrateDone, multiDone} {
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("allocation failed: %v", err)
+			}
+		case <-ctx.Done():
+			t.Fatal("Calibrate and AllocateN deadlocked")
+		}
+	}
+	if got := sp.InUse(); got != 0 {
+		t.Errorf("%d slots still in use", got)
+	}
+}
+
+func TestAllocateNTooManyCPUs(t *testing.T) {
+	sp := lime.NewSlotPool(lime.WithCPUs("0,0"))
+	_, err := sp.AllocateN(t.Context(), 3)
+	if !errors.Is(err, lime.ErrTooManyCPUs) {
+		t.Fatalf("AllocateN(3) on 2 slots: got %v, want ErrTooManyCPUs", err)
+	}
+	if got := sp.InUse(); got != 0 {
+		t.Errorf("%d slots in use after the failed allocation", got)
+	}
+
+	a, err := sp.AllocateN(t.Context(), 2)
+	if err != nil {
+		t.Fatalf("AllocateN(2) on 2 slots: %v", err)
+	}
+	a.Release()
+}
+
+func TestCombineSlots(t *testing.T) {
+	tests := []struct {
+		name  string
+		slots []lime.Slot
+		want  lime.Slot
+	}{
+		{
+			name: "identity of the lowest slot",
+			slots: []lime.Slot{
+				{ID: 3, CPUs: "3", Mems: "0", UID: 1003, GID: 1003, SpeedFactor: 1.5},
+				{ID: 1, CPUs: "1", Mems: "0", UID: 1001, GID: 1001, SpeedFactor: 0.5},
+			},
+			want: lime.Slot{ID: 1, CPUs: "1,3", Mems: "0", UID: 1001, GID: 1001, SpeedFactor: 1},
+		},
+		{
+			name: "distinct memory nodes",
+			slots: []lime.Slot{
+				{ID: 0, CPUs: "0", Mems: "0"},
+				{ID: 1, CPUs: "8", Mems: "1"},
+				{ID: 2, CPUs: "1", Mems: "0"},
+			},
+			want: lime.Slot{ID: 0, CPUs: "0,8,1", Mems: "0,1"},
+		},
+		{
+			name: "unpinned slots",
+			slots: []lime.Slot{
+				{ID: 1, Mems: "0"},
+				{ID: 0, Mems: "0"},
+			},
+			want: lime.Slot{ID: 0, Mems: "0"},
+		},
+		{
+			name: "uncalibrated slot",
+			slots: []lime.Slot{
+				{ID: 0, CPUs: "0", Mems: "0", SpeedFactor: 1.2},
+				{ID: 1, CPUs: "1", Mems: "0"},
+			},
+			want: lime.Slot{ID: 0, CPUs: "0,1", Mems: "0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lime.CombineSlots(tt.slots); got != tt.want {
+				t.Errorf("CombineSlots() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunErrorKinds(t *testing.T) {
+	cfg := &config.Config{Judge: &config.JudgeConfig{}}
+	sp := lime.NewSlotPool(lime.WithCPUs("0"))
+	workDir := t.TempDir()
+
+	// A missing rootfs is local to this worker; another may have it.
+	_, err := lime.Run(t.Context(), cfg, sp, workDir, filepath.Join(workDir, "missing"), []string{"/bin/true"}, "", 1000000, 64<<20, 1, false)
+	if !errors.Is(err, lime.ErrSandbox) {
+		t.Errorf("missing rootfs: got %v, want ErrSandbox", err)
+	}
+
+	_, err = lime.Run(t.Context(), cfg, sp, workDir, workDir, []string{"/bin/true"}, "", 1000000, 64<<20, 1, false, lime.WithCPUCount(2))
+	if !errors.Is(err, lime.ErrTooManyCPUs) || errors.Is(err, lime.ErrSandbox) {
+		t.Errorf("too many cpus: got %v, want ErrTooManyCPUs", err)
+	}
+
+	// Without lime on the PATH the sandbox cannot start.
+	t.Setenv("PATH", t.TempDir())
+	_, err = lime.Run(t.Context(), cfg, sp, workDir, workDir, []string{"/bin/true"}, "", 1000000, 64<<20, 1, false)
+	if !errors.Is(err, lime.ErrSandbox) {
+		t.Errorf("lime not found: got %v, want ErrSandbox", err)
+	}
+}
+
+// The CPU quota follows the requested CPU count, which lime cannot derive
+// from the cpuset of an unpinned pool.
+func TestRunCPUCount(t *testing.T) {
+	bin := t.TempDir()
+	request := filepath.Join(t.TempDir(), "request.json")
+	script := "#!/bin/sh\ncat > \"$LIME_TEST_REQUEST\"\necho '{\"id\":\"cpus\"}'\n"
+	if err := os.WriteFile(filepath.Join(bin, "lime"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("LIME_TEST_REQUEST", request)
+
+	cfg := &config.Config{Judge: &config.JudgeConfig{}}
+	sp := lime.NewSlotPool(lime.WithCPUs("0,0"))
+	workDir := t.TempDir()
+	for _, n := range []int{0, 2} {
+		if _, err := lime.Run(t.Context(), cfg, sp, workDir, workDir, []string{"/bin/true"}, "", 1000000, 64<<20, 2, false, lime.WithCPUCount(n)); err != nil {
+			t.Fatalf("Run with %d cpus: %v", n, err)
+		}
+		data, err := os.ReadFile(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var req lime.ExecRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			t.Fatal(err)
+		}
+		if want := uint32(max(n, 1)); req.CPUCount != want {
+			t.Errorf("WithCPUCount(%d): cpu_count %d, want %d", n, req.CPUCount, want)
+		}
+	}
+}
+
+func TestReportPrecedence(t *testing.T) {
+	req := lime.ExecRequest{
+		CPUTimeLimitUs:   1000000,
+		MemoryLimitBytes: 64 << 20,
+		OutputLimitBytes: 4,
+	}
+	for _, tc := range []struct {
+		name        string
+		resp        lime.ExecResponse
+		timeLimitUs uint64
+		status      lime.Status
+		reason      lime.Reason
+	}{
+		{
+			name:   "ok",
+			resp:   lime.ExecResponse{CPUTimeUs: 500000, WallTimeUs: 600000},
+			status: lime.STATUS_OK,
+		},
+		{
+			name: "seccomp beats cpu and wall limits",
+			resp: lime.ExecResponse{
+				BlockedSyscall: "socket", TermSignal: int(syscall.SIGKILL),
+				CPUTimeUs: 2000000, WallTimeUs: 3000000,
+			},
+			status: lime.STATUS_SECURITY_VIOLATION,
+			reason: lime.REASON_SECCOMP_VIOLATION,
+		},
+		{
+			name:   "SIGSYS without a recorded syscall",
+			resp:   lime.ExecResponse{TermSignal: int(syscall.SIGSYS)},
+			status: lime.STATUS_SECURITY_VIOLATION,
+			reason: lime.REASON_SECCOMP_VIOLATION,
+		},
+		{
+			name:   "cpu limit beats wall limit",
+			resp:   lime.ExecResponse{TermSignal: int(syscall.SIGKILL), CPUTimeUs: 1500000, WallTimeUs: 4000000},
+			status: lime.STATUS_TIME_LIMIT_EXCEEDED,
+			reason: lime.REASON_CPU_TIME_LIMIT,
+		},
+		{
+			name:   "busy past the wall limit",
+			resp:   lime.ExecResponse{TermSignal: int(syscall.SIGKILL), CPUTimeUs: 900000, WallTimeUs: 1200000},
+			status: lime.STATUS_TIME_LIMIT_EXCEEDED,
+			reason: lime.REASON_WALL_TIME_LIMIT,
+		},
+		{
+			name:   "idle past the wall limit",
+			resp:   lime.ExecResponse{TermSignal: int(syscall.SIGKILL), CPUTimeUs: 1000, WallTimeUs: 3000000},
+			status: lime.STATUS_TERMINATED,
+			reason: lime.REASON_WALL_TIME_LIMIT,
+		},
+		{
+			// With wall time accounting the run's limit is a wall limit
+			// and CPU time summed over threads may exceed it.
+			name:        "wall accounting ignores the cpu limit",
+			resp:        lime.ExecResponse{CPUTimeUs: 3500000, WallTimeUs: 900000},
+			timeLimitUs: 1000000,
+			status:      lime.STATUS_OK,
+		},
+		{
+			name:   "wall limit beats memory",
+			resp:   lime.ExecResponse{CPUTimeUs: 900000, WallTimeUs: 1100000, MemoryBytes: 128 << 20},
+			status: lime.STATUS_TIME_LIMIT_EXCEEDED,
+			reason: lime.REASON_WALL_TIME_LIMIT,
+		},
+		{
+			name:   "memory beats output and signal",
+			resp:   lime.ExecResponse{TermSignal: int(syscall.SIGSEGV), MemoryBytes: 128 << 20, Stdout: "12345"},
+			status: lime.STATUS_MEMORY_LIMIT_EXCEEDED,
+			reason: lime.REASON_MEMORY_LIMIT,
+		},
+		{
+			name:   "output beats signal",
+			resp:   lime.ExecResponse{TermSignal: int(syscall.SIGPIPE), Stdout: "12345"},
+			status: lime.STATUS_OUTPUT_LIMIT_EXCEEDED,
+			reason: lime.REASON_OUTPUT_LIMIT,
+		},
+		{
+			name:   "signal beats exit code",
+			resp:   lime.ExecResponse{TermSignal: int(syscall.SIGSEGV), ExitCode: 1},
+			status: lime.STATUS_RUNTIME_ERROR,
+			reason: lime.REASON_SIGNAL,
+		},
+		{
+			name:   "nonzero exit",
+			resp:   lime.ExecResponse{ExitCode: 3},
+			status: lime.STATUS_RUNTIME_ERROR,
+			reason: lime.REASON_NONZERO_EXIT,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := req
+			timeLimitUs := r.CPUTimeLimitUs
+			if tc.timeLimitUs != 0 {
+				// Run gives each of the run's CPUs the whole limit for wall
+				// time accounting; this run has four.
+				r.CPUTimeLimitUs = 4 * tc.timeLimitUs
+				timeLimitUs = tc.timeLimitUs
+			}
+			report := lime.ReportFromResponse(tc.resp, r, timeLimitUs)
+			if report.Status != tc.status || report.Reason != tc.reason {
+				t.Errorf("got %s/%q, want %s/%q", report.Status, report.Reason, tc.status, tc.reason)
+			}
+		})
+	}
+}
+
+func TestReportOutputLimit(t *testing.T) {
+	const limit = 16
+	req := lime.ExecRequest{CPUTimeLimitUs: 1000000, OutputLimitBytes: limit}
+	for _, tc := range []struct {
+		name   string
+		stdout int
+		want   lime.Status
+	}{
+		{"below limit", limit - 1, lime.STATUS_OK},
+		{"exactly limit", limit, lime.STATUS_OK},
+		{"one byte over", limit + 1, lime.STATUS_OUTPUT_LIMIT_EXCEEDED},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := lime.ExecResponse{Stdout: strings.Repeat("x", tc.stdout)}
+			report := lime.ReportFromResponse(resp, req, req.CPUTimeLimitUs)
+			if report.Status != tc.want {
+				t.Errorf("status = %s, want %s", report.Status, tc.want)
+			}
+		})
+	}
+
+	resp := lime.ExecResponse{TermSignal: int(syscall.SIGXFSZ)}
+	if report := lime.ReportFromResponse(resp, req, req.CPUTimeLimitUs); report.Status != lime.STATUS_OUTPUT_LIMIT_EXCEEDED {
+		t.Errorf("SIGXFSZ: status = %s, want %s", report.Status, lime.STATUS_OUTPUT_LIMIT_EXCEEDED)
+	}
+}
+
+// fakeDaemon serves the `lime serve` framing on a unix socket: each request
+// and response is a 4-byte big-endian length followed by JSON. It numbers
+// connections as sessions and answers each run with its session and run
+// count in Stdout. The first argument of a request picks a misbehaviour:
+// "fail" answers with an error, "hang" never answers, "hangup" closes the
+// connection and "huge" announces an oversized frame.
+type fakeDaemon struct {
+	socketPath string
+	listener   net.Listener
+
+	mu       sync.Mutex
+	sessions int
+	requests []map[string]any
+}
+
+func startFakeDaemon(t *testing.T) *fakeDaemon {
+	t.Helper()
+	// Unix socket paths are short; t.TempDir() may exceed the limit.
+	dir, err := os.MkdirTemp("", "lime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	f := &fakeDaemon{socketPath: filepath.Join(dir, "lime.sock")}
+	f.listener, err = net.Listen("unix", f.socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.listener.Close() })
+	go func() {
+		for {
+			conn, err := f.listener.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.sessions++
+			session := f.sessions
+			f.mu.Unlock()
+			go f.serve(conn, session)
+		}
+	}()
+	return f
+}
+
+func (f *fakeDaemon) serve(conn net.Conn, session int) {
+	defer conn.Close()
+	for run := 1; ; run++ {
+		var header [4]byte
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			return
+		}
+		body := make([]byte, binary.BigEndian.Uint32(header[:]))
+		if _, err := io.ReadFull(conn, body); err != nil {
+			return
+		}
+		var req map[string]any
+		if err := json.Unmarshal(body, &req); err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.requests = append(f.requests, req)
+		f.mu.Unlock()
+
+		resp := map[string]any{"id": req["id"], "stdout": fmt.Sprintf("session %d run %d", session, run)}
+		args, _ := req["args"].([]any)
+		var mode any
+		if len(args) > 0 {
+			mode = args[0]
+		}
+		switch mode {
+		case "fail":
+			resp = map[string]any{"error": "boom"}
+		case "hang":
+			io.Copy(io.Discard, conn)
+			return
+		case "hangup":
+			return
+		case "huge":
+			binary.BigEndian.PutUint32(header[:], 1<<31)
+			conn.Write(header[:])
+			return
+		}
+		payload, _ := json.Marshal(resp)
+		binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+		if _, err := conn.Write(append(header[:], payload...)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeDaemon) sessionCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sessions
+}
+
+func TestDaemonSessions(t *testing.T) {
+	f := startFakeDaemon(t)
+	d := lime.NewTestDaemon(f.socketPath)
+	t.Cleanup(d.CloseSessions)
+	ctx := t.Context()
+
+	run := func(slot int, args ...string) (lime.ExecResponse, error) {
+		return d.Run(ctx, lime.Slot{ID: slot}, lime.ExecRequest{
+			ID:              fmt.Sprintf("slot%d-%s", slot, strings.Join(args, "-")),
+			Args:            args,
+			WallTimeLimitUs: 1000000,
+			UseSeccompBPF:   true,
+		})
+	}
+	expect := func(slot int, want string, args ...string) {
+		t.Helper()
+		resp, err := run(slot, args...)
+		if err != nil {
+			t.Fatalf("slot %d: Run: %v", slot, err)
+		}
+		if resp.Stdout != want {
+			t.Errorf("slot %d: got %q, want %q", slot, resp.Stdout, want)
+		}
+	}
+
+	// Consecutive runs in a slot share its session; slots do not.
+	expect(0, "session 1 run 1", "ok")
+	expect(0, "session 1 run 2", "ok")
+	expect(1, "session 2 run 1", "ok")
+	expect(0, "session 1 run 3", "ok")
+
+	f.mu.Lock()
+	first := f.requests[0]
+	f.mu.Unlock()
+	if first["id"] != "slot0-ok" || first["use_seccomp_bpf"] != true {
+		t.Errorf("request = %v, want id slot0-ok and use_seccomp_bpf", first)
+	}
+
+	// An error reported by the daemon keeps the session.
+	if _, err := run(0, "fail"); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("failing run: got %v, want the daemon's error", err)
+	}
+	expect(0, "session 1 run 5", "ok")
+
+	// A broken session is dropped and the next run opens a new one.
+	if _, err := run(0, "hangup"); err == nil {
+		t.Error("run on a closed session succeeded")
+	}
+	expect(0, "session 3 run 1", "ok")
+	if _, err := run(1, "huge"); err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+		t.Errorf("oversized frame: got %v", err)
+	}
+	expect(1, "session 4 run 1", "ok")
+	if got := f.sessionCount(); got != 4 {
+		t.Errorf("daemon saw %d sessions, want 4", got)
+	}
+}
+
+func TestDaemonRunCancel(t *testing.T) {
+	f := startFakeDaemon(t)
+	d := lime.NewTestDaemon(f.socketPath)
+	t.Cleanup(d.CloseSessions)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := d.Run(ctx, lime.Slot{ID: 0}, lime.ExecRequest{Args: []string{"hang"}, WallTimeLimitUs: 60000000})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run: got %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run returned %v after cancellation", elapsed)
+	}
+
+	// The aborted session is not reused.
+	resp, err := d.Run(t.Context(), lime.Slot{ID: 0}, lime.ExecRequest{Args: []string{"ok"}, WallTimeLimitUs: 1000000})
+	if err != nil {
+		t.Fatalf("Run after cancellation: %v", err)
+	}
+	if resp.Stdout != "session 2 run 1" {
+		t.Errorf("got %q, want a new session", resp.Stdout)
+	}
+}
+
 func filepathJoin(name string) string {
 	return filepath.Join("test_files", name)
 }
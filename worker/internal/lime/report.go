@@ -1,5 +1,10 @@
 package lime
 
+import (
+	"fmt"
+	"syscall"
+)
+
 type Status string
 
 const (
@@ -9,39 +14,128 @@ const (
 	STATUS_MEMORY_LIMIT_EXCEEDED Status = "MEMORY_LIMIT_EXCEEDED"
 	STATUS_OUTPUT_LIMIT_EXCEEDED Status = "OUTPUT_LIMIT_EXCEEDED"
 	STATUS_TERMINATED            Status = "TERMINATED"
+	STATUS_SECURITY_VIOLATION    Status = "SECURITY_VIOLATION"
 	STATUS_UNKNOWN               Status = "UNKNOWN"
 	STATUS_SKIPPED               Status = "SKIPPED"
 )
 
+// Reason records why a run ended abnormally. It refines Status, e.g. a
+// TIME_LIMIT_EXCEEDED run hit either the CPU or the wall clock limit.
+type Reason string
+
+const (
+	REASON_NONE              Reason = ""
+	REASON_CPU_TIME_LIMIT    Reason = "CPU_TIME_LIMIT"
+	REASON_WALL_TIME_LIMIT   Reason = "WALL_TIME_LIMIT"
+	REASON_MEMORY_LIMIT      Reason = "MEMORY_LIMIT"
+	REASON_OUTPUT_LIMIT      Reason = "OUTPUT_LIMIT"
+	REASON_SIGNAL            Reason = "SIGNAL"
+	REASON_NONZERO_EXIT      Reason = "NONZERO_EXIT"
+	REASON_SECCOMP_VIOLATION Reason = "SECCOMP_VIOLATION"
+)
+
 type Report struct {
 	Status   Status
+	Reason   Reason
 	ExitCode int
 	Signal   int
-	Stdout   string
-	Stderr   string
-	CPUTime  uint64
-	Memory   uint64
-	WallTime uint64
+	// BlockedSyscall names the syscall the seccomp filter stopped.
+	BlockedSyscall string
+	Stdout         string
+	Stderr         string
+	CPUTime        uint64
+	Memory         uint64
+	WallTime       uint64
+
+	// Slot is the slot the run used and SpeedFactor its calibrated speed.
+	Slot        int
+	SpeedFactor float64
+	// Normalized reports whether CPUTime was scaled to the reference
+	// machine by SpeedFactor.
+	Normalized bool
 }
 
-func reportFromResponse(resp ExecResponse, timeLimitUs, memoryLimitBytes uint64) *Report {
-	status := STATUS_OK
-	if timeLimitUs > 0 && (resp.CPUTimeUs > timeLimitUs || resp.WallTimeUs > timeLimitUs) {
-		status = STATUS_TIME_LIMIT_EXCEEDED
-	} else if memoryLimitBytes > 0 && resp.MemoryBytes > memoryLimitBytes {
-		status = STATUS_MEMORY_LIMIT_EXCEEDED
-	} else if resp.ExitCode != 0 || resp.TermSignal != 0 {
-		status = STATUS_RUNTIME_ERROR
+// idleCPUPercent is the share of the wall time below which a run that hit
+// the wall clock is considered idle (sleeping or blocked on input) rather
+// than too slow.
+const idleCPUPercent = 50
+
+func reportFromResponse(resp ExecResponse, req ExecRequest) *Report {
+	timeLimitUs := req.CPUTimeLimitUs
+	wallLimitUs := req.timeLimitUs
+	if wallLimitUs == 0 {
+		wallLimitUs = timeLimitUs
+	}
+	status, reason := STATUS_OK, REASON_NONE
+	if resp.BlockedSyscall != "" || resp.TermSignal == int(syscall.SIGSYS) {
+		// The seccomp filter stopped the program on a forbidden syscall.
+		status, reason = STATUS_SECURITY_VIOLATION, REASON_SECCOMP_VIOLATION
+	} else if timeLimitUs > 0 && resp.CPUTimeUs > timeLimitUs {
+		status, reason = STATUS_TIME_LIMIT_EXCEEDED, REASON_CPU_TIME_LIMIT
+	} else if wallLimitUs > 0 && resp.WallTimeUs > wallLimitUs {
+		// The program ran out of wall time. If it barely used the CPU while
+		// doing so it was idle, which the judge reports separately from TLE.
+		reason = REASON_WALL_TIME_LIMIT
+		if resp.CPUTimeUs*100 < resp.WallTimeUs*idleCPUPercent {
+			status = STATUS_TERMINATED
+		} else {
+			status = STATUS_TIME_LIMIT_EXCEEDED
+		}
+	} else if req.MemoryLimitBytes > 0 && resp.MemoryBytes > req.MemoryLimitBytes {
+		status, reason = STATUS_MEMORY_LIMIT_EXCEEDED, REASON_MEMORY_LIMIT
+	} else if outputLimitExceeded(resp, req.OutputLimitBytes) {
+		status, reason = STATUS_OUTPUT_LIMIT_EXCEEDED, REASON_OUTPUT_LIMIT
+	} else if resp.TermSignal != 0 {
+		status, reason = STATUS_RUNTIME_ERROR, REASON_SIGNAL
+	} else if resp.ExitCode != 0 {
+		status, reason = STATUS_RUNTIME_ERROR, REASON_NONZERO_EXIT
 	}
 
 	return &Report{
-		Status:   status,
-		ExitCode: resp.ExitCode,
-		Signal:   resp.TermSignal,
-		Stdout:   resp.Stdout,
-		Stderr:   resp.Stderr,
-		CPUTime:  resp.CPUTimeUs,
-		Memory:   resp.MemoryBytes,
-		WallTime: resp.WallTimeUs,
+		Status:         status,
+		Reason:         reason,
+		ExitCode:       resp.ExitCode,
+		Signal:         resp.TermSignal,
+		BlockedSyscall: resp.BlockedSyscall,
+		Stdout:         resp.Stdout,
+		Stderr:         resp.Stderr,
+		CPUTime:        resp.CPUTimeUs,
+		Memory:         resp.MemoryBytes,
+		WallTime:       resp.WallTimeUs,
+	}
+}
+
+// outputLimitExceeded reports whether the program wrote more than limit bytes
+// to stdout, which lime captures up to one byte past the limit, or was killed
+// for exceeding a file size limit.
+func outputLimitExceeded(resp ExecResponse, limit uint64) bool {
+	if resp.TermSignal == int(syscall.SIGXFSZ) {
+		return true
+	}
+	return limit > 0 && uint64(len(resp.Stdout)) > limit
+}
+
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGSYS:  "SIGSYS",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGTRAP: "SIGTRAP",
+	syscall.SIGXCPU: "SIGXCPU",
+	syscall.SIGXFSZ: "SIGXFSZ",
+}
+
+// SignalName returns the conventional name of sig, such as "SIGSEGV".
+func SignalName(sig int) string {
+	if name, ok := signalNames[syscall.Signal(sig)]; ok {
+		return name
 	}
+	return fmt.Sprintf("signal %d", sig)
 }
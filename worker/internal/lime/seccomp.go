@@ -0,0 +1,30 @@
+package lime
+
+// SeccompAction is what the filter does with a syscall a policy does not list.
+type SeccompAction string
+
+const (
+	SECCOMP_ACTION_ALLOW SeccompAction = "allow"
+	SECCOMP_ACTION_KILL  SeccompAction = "kill"
+)
+
+// SeccompPolicy is the syscall filter lime installs in the sandbox. Syscalls
+// are named as in the x86_64 syscall table; Deny wins over Allow and anything
+// in neither list gets DefaultAction. A blocked syscall kills the sandbox and
+// is reported back as Report.BlockedSyscall.
+type SeccompPolicy struct {
+	DefaultAction SeccompAction `json:"default_action"`
+	Allow         []string      `json:"allow,omitempty"`
+	Deny          []string      `json:"deny,omitempty"`
+}
+
+// WithSeccompPolicy filters the run with policy instead of lime's built-in
+// allowlist. It turns seccomp on for the run; nil keeps the defaults.
+func WithSeccompPolicy(policy *SeccompPolicy) RunOption {
+	return func(req *ExecRequest) {
+		if policy != nil {
+			req.SeccompPolicy = policy
+			req.UseSeccompBPF = true
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package metrics defines the worker's Prometheus metrics. They are
+// registered with the default registry and served on /metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "jjudge_worker"
+
+// latencyBuckets span sandbox runs of a few milliseconds up to compilations
+// and queue waits of minutes.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+var (
+	// QueueWait is the time a job spent in the queue before the worker
+	// started it.
+	QueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_wait_seconds",
+		Help:      "Time from publishing a job to the worker starting it.",
+		Buckets:   latencyBuckets,
+	}, []string{"queue"})
+
+	// CompileDuration is the time spent compiling submissions.
+	CompileDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "compile_duration_seconds",
+		Help:      "Time spent compiling a submission, including sandbox setup.",
+		Buckets:   latencyBuckets,
+	}, []string{"language"})
+
+	// RunDuration is the time spent running a submission on one test case.
+	RunDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "run_duration_seconds",
+		Help:      "Time spent running a submission on one test case, including sandbox setup.",
+		Buckets:   latencyBuckets,
+	}, []string{"language"})
+
+	// GradeDuration is the time spent checking one test case's output.
+	GradeDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grade_duration_seconds",
+		Help:      "Time spent checking the output of one test case.",
+		Buckets:   latencyBuckets,
+	})
+
+	// JobDuration is the time from starting a job to publishing its result.
+	JobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Time from starting a job to publishing its final result.",
+		Buckets:   latencyBuckets,
+	}, []string{"language"})
+
+	// Verdicts counts final verdicts of judged submissions.
+	Verdicts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "verdicts_total",
+		Help:      "Final verdicts of judged submissions.",
+	}, []string{"language", "verdict"})
+
+	// LimeErrors counts sandbox runs that failed without a report.
+	LimeErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lime_exec_errors_total",
+		Help:      "Sandbox runs that failed to produce a report.",
+	})
+
+	// CacheHits, CacheMisses and CacheEvictions count testcase cache
+	// lookups and removals; CacheBytes is the size of the cached files.
+	CacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "testcase_cache_hits_total",
+		Help:      "Testcase files served from the local cache.",
+	})
+	CacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "testcase_cache_misses_total",
+		Help:      "Testcase files fetched from object storage.",
+	})
+	CacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "testcase_cache_evictions_total",
+		Help:      "Testcase files evicted from the local cache.",
+	})
+	CacheBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "testcase_cache_bytes",
+		Help:      "Size of the testcase files fetched into the local cache.",
+	})
+)
+
+// RegisterSlotPool exports the size and utilization of the sandbox slot
+// pool, read through size and inUse at scrape time.
+func RegisterSlotPool(size, inUse func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "slots",
+		Help:      "Sandbox slots in the pool.",
+	}, func() float64 { return float64(size()) })
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "slots_in_use",
+		Help:      "Sandbox slots allocated to runs.",
+	}, func() float64 { return float64(inUse()) })
+}
@@ -0,0 +1,182 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errMemoryClosed = errors.New("in-memory queue closed")
+
+// MemoryQueue implements Backend in process, for tests.
+// Each channel is a queue shared by its subscribers: a message goes to one
+// of them, and a handler error puts it back at the head of the queue marked
+// as redelivered. Messages are lost when the process exits. A transient
+// channel exists only while subscribed to.
+type MemoryQueue struct {
+	mu     sync.Mutex
+	queues map[string]*memoryChannel
+	closed chan struct{}
+	once   sync.Once
+}
+
+type memoryChannel struct {
+	messages []Message
+	// ready is closed when a message is added; it is then replaced.
+	ready chan struct{}
+}
+
+// NewMemoryQueue returns an empty in-memory queue for tests;
+// NewMQFromConfig never selects it.
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		queues: map[string]*memoryChannel{},
+		closed: make(chan struct{}),
+	}
+}
+
+// Health returns nil until the queue is closed.
+func (m *MemoryQueue) Health() error {
+	select {
+	case <-m.closed:
+		return errMemoryClosed
+	default:
+		return nil
+	}
+}
+
+// Publish appends a message to the channel's queue.
+func (m *MemoryQueue) Publish(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error) {
+	if strings.TrimSpace(channel) == "" {
+		return "", errors.New("in-memory queue channel is required")
+	}
+	if err := m.Health(); err != nil {
+		return "", err
+	}
+
+	message := Message{
+		ID:          newMessageID(),
+		Data:        append([]byte(nil), data...),
+		PublishedAt: time.Now(),
+	}
+	if len(attrs) > 0 {
+		message.Attributes = make(map[string]string, len(attrs))
+		for key, value := range attrs {
+			message.Attributes[key] = value
+		}
+	}
+	m.push(channel, message, false)
+	return message.ID, nil
+}
+
+// Subscribe handles messages from the channel's queue one at a time until
+// ctx is done or the queue is closed. A handler error requeues the message.
+func (m *MemoryQueue) Subscribe(ctx context.Context, channel string, handler Handler) error {
+	if strings.TrimSpace(channel) == "" {
+		return errors.New("in-memory queue channel is required")
+	}
+
+	for {
+		message, err := m.pop(ctx, channel)
+		if err != nil {
+			return err
+		}
+		if err := handler(ctx, message); err != nil {
+			message.Redelivered = true
+			m.push(channel, message, true)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// PublishTransient appends a message to the channel's queue if it exists,
+// and drops it otherwise.
+func (m *MemoryQueue) PublishTransient(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error) {
+	m.mu.Lock()
+	_, ok := m.queues[channel]
+	m.mu.Unlock()
+	if !ok {
+		return "", nil
+	}
+	return m.Publish(ctx, channel, data, attrs)
+}
+
+// SubscribeTransient subscribes to the channel like Subscribe and deletes
+// its queue when the subscription ends.
+func (m *MemoryQueue) SubscribeTransient(ctx context.Context, channel string, handler Handler) error {
+	m.mu.Lock()
+	m.channel(channel)
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.queues, channel)
+		m.mu.Unlock()
+	}()
+	return m.Subscribe(ctx, channel, handler)
+}
+
+// Close stops all subscriptions and rejects further publishes.
+func (m *MemoryQueue) Close() error {
+	m.once.Do(func() { close(m.closed) })
+	return nil
+}
+
+// channel returns the queue of name, creating it if needed. m.mu must be
+// held.
+func (m *MemoryQueue) channel(name string) *memoryChannel {
+	q, ok := m.queues[name]
+	if !ok {
+		q = &memoryChannel{ready: make(chan struct{})}
+		m.queues[name] = q
+	}
+	return q
+}
+
+// push adds message to the tail of the queue, or its head when requeued.
+func (m *MemoryQueue) push(name string, message Message, head bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := m.channel(name)
+	if head {
+		q.messages = append([]Message{message}, q.messages...)
+	} else {
+		q.messages = append(q.messages, message)
+	}
+	close(q.ready)
+	q.ready = make(chan struct{})
+}
+
+// pop removes the message at the head of the queue, waiting for one if the
+// queue is empty.
+func (m *MemoryQueue) pop(ctx context.Context, name string) (Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return Message{}, err
+		}
+		if err := m.Health(); err != nil {
+			return Message{}, err
+		}
+		m.mu.Lock()
+		q := m.channel(name)
+		if len(q.messages) > 0 {
+			message := q.messages[0]
+			q.messages = q.messages[1:]
+			m.mu.Unlock()
+			return message, nil
+		}
+		ready := q.ready
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		case <-m.closed:
+			return Message{}, errMemoryClosed
+		case <-ready:
+		}
+	}
+}
@@ -1,12 +1,34 @@
 package mq
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jjudge-oj/worker/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/jjudge-oj/worker/internal/mq")
 
 // Message represents a broker-agnostic payload delivered to subscribers.
 type Message struct {
 	ID         string
 	Data       []byte
 	Attributes map[string]string
+
+	// PublishedAt is when the message was published, if the publisher
+	// recorded it.
+	PublishedAt time.Time
+
+	// Redelivered reports whether the message was delivered before and
+	// returned to the queue without being acknowledged.
+	Redelivered bool
 }
 
 // Handler processes a message. Return an error to signal a retry/nack.
@@ -16,6 +38,16 @@ type Handler func(ctx context.Context, msg Message) error
 type Backend interface {
 	Publish(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error)
 	Subscribe(ctx context.Context, channel string, handler Handler) error
+	// PublishTransient sends a message to a channel consumed with
+	// SubscribeTransient. It is dropped while nobody subscribes.
+	PublishTransient(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error)
+	// SubscribeTransient consumes a channel read by one subscriber, whose
+	// broker resources go away with the subscription, e.g. a queue
+	// addressing a single worker.
+	SubscribeTransient(ctx context.Context, channel string, handler Handler) error
+	// Health returns nil while the backend can reach its broker, and
+	// otherwise why not.
+	Health() error
 	Close() error
 }
 
@@ -29,14 +61,96 @@ func New(backend Backend) *MQ {
 	return &MQ{backend: backend}
 }
 
-// Publish sends a message to the named channel.
+// NewMQFromConfig constructs an MQ wrapper for the backend selected by
+// cfg.MQBackend. The in-memory queue is not selectable: it cannot carry
+// messages between the API server and the workers.
+func NewMQFromConfig(ctx context.Context, cfg *config.Config) (*MQ, error) {
+	switch strings.ToLower(strings.TrimSpace(cfg.MQBackend)) {
+	case "", "rabbitmq":
+		client, err := NewRabbitMQClient(cfg.RabbitMQ)
+		if err != nil {
+			return nil, err
+		}
+		return New(client), nil
+	case "pubsub":
+		client, err := NewPubSubClient(ctx, cfg.PubSub)
+		if err != nil {
+			return nil, err
+		}
+		return New(client), nil
+	case "nats":
+		client, err := NewNATSClient(ctx, cfg.NATS)
+		if err != nil {
+			return nil, err
+		}
+		return New(client), nil
+	default:
+		return nil, fmt.Errorf("unknown message queue backend %q", cfg.MQBackend)
+	}
+}
+
+// Publish sends a message to the named channel. The trace context of ctx is
+// added to the message attributes so consumers continue the same trace.
 func (m *MQ) Publish(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error) {
-	return m.backend.Publish(ctx, channel, data, attrs)
+	ctx, span := tracer.Start(ctx, "publish "+channel,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("messaging.destination.name", channel)),
+	)
+	defer span.End()
+
+	carrier := make(propagation.MapCarrier, len(attrs)+2)
+	for key, value := range attrs {
+		carrier[key] = value
+	}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	id, err := m.backend.Publish(ctx, channel, data, carrier)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
+	}
+	span.SetAttributes(attribute.String("messaging.message.id", id))
+	return id, nil
 }
 
-// Subscribe consumes messages from the named channel.
+// Subscribe consumes messages from the named channel. Each message is
+// handled in a span that continues the trace carried in its attributes.
 func (m *MQ) Subscribe(ctx context.Context, channel string, handler Handler) error {
-	return m.backend.Subscribe(ctx, channel, handler)
+	return m.backend.Subscribe(ctx, channel, traced(channel, handler))
+}
+
+// SubscribeTransient consumes messages from a transient channel, handling
+// each in a span like Subscribe.
+func (m *MQ) SubscribeTransient(ctx context.Context, channel string, handler Handler) error {
+	return m.backend.SubscribeTransient(ctx, channel, traced(channel, handler))
+}
+
+// traced wraps handler so each message is handled in a span that continues
+// the trace carried in its attributes.
+func traced(channel string, handler Handler) Handler {
+	return func(ctx context.Context, msg Message) error {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(msg.Attributes))
+		ctx, span := tracer.Start(ctx, "process "+channel,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(
+				attribute.String("messaging.destination.name", channel),
+				attribute.String("messaging.message.id", msg.ID),
+				attribute.Bool("messaging.rabbitmq.redelivered", msg.Redelivered),
+			),
+		)
+		defer span.End()
+
+		if err := handler(ctx, msg); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+		return nil
+	}
+}
+
+// Health returns nil while the broker is reachable, and otherwise why not.
+func (m *MQ) Health() error {
+	return m.backend.Health()
 }
 
 // Close closes the underlying backend.
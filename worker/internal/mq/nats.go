@@ -0,0 +1,273 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jjudge-oj/worker/config"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// natsAckWait is how long JetStream waits for a message to be acked before
+// redelivering it. Handlers running longer keep their message with
+// progress acks.
+const natsAckWait = 30 * time.Second
+
+// NATSClient implements Backend with NATS JetStream. All channels share one
+// work-queue stream; a channel is the subject "<stream>.<channel>" and is
+// consumed through a durable consumer named after it, shared by all its
+// subscribers. The stream and consumers are created on first use, and the
+// connection reconnects on its own. Transient channels bypass JetStream and
+// use plain NATS subjects, so nothing is stored for them.
+type NATSClient struct {
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	stream string
+}
+
+// NewNATSClient connects to NATS from config and creates the stream unless
+// it exists.
+func NewNATSClient(ctx context.Context, cfg *config.NATSConfig) (*NATSClient, error) {
+	if strings.TrimSpace(cfg.URL) == "" {
+		return nil, errors.New("nats url is required")
+	}
+	if strings.TrimSpace(cfg.Stream) == "" {
+		return nil, errors.New("nats stream is required")
+	}
+
+	conn, err := nats.Connect(cfg.URL, nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	_, err = js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:      cfg.Stream,
+		Subjects:  []string{cfg.Stream + ".>"},
+		Retention: jetstream.WorkQueuePolicy,
+		Storage:   jetstream.FileStorage,
+	})
+	if err != nil && !errors.Is(err, jetstream.ErrStreamNameAlreadyInUse) {
+		conn.Close()
+		return nil, fmt.Errorf("nats: create stream %q: %w", cfg.Stream, err)
+	}
+
+	return &NATSClient{conn: conn, js: js, stream: cfg.Stream}, nil
+}
+
+// Health returns nil while the client is connected, and otherwise why not.
+func (n *NATSClient) Health() error {
+	if n.conn.IsConnected() {
+		return nil
+	}
+	if err := n.conn.LastError(); err != nil {
+		return fmt.Errorf("nats %s: %w", strings.ToLower(n.conn.Status().String()), err)
+	}
+	return fmt.Errorf("nats %s", strings.ToLower(n.conn.Status().String()))
+}
+
+// Publish stores a message on the channel's subject and waits for
+// JetStream to acknowledge it.
+func (n *NATSClient) Publish(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error) {
+	if strings.TrimSpace(channel) == "" {
+		return "", errors.New("nats channel is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultPublishTimeout)
+	defer cancel()
+
+	msg := nats.NewMsg(n.subject(channel))
+	msg.Data = data
+	for key, value := range attrs {
+		msg.Header.Set(key, value)
+	}
+	messageID := newMessageID()
+	if _, err := n.js.PublishMsg(ctx, msg, jetstream.WithMsgID(messageID)); err != nil {
+		return "", fmt.Errorf("nats: publish to %q: %w", channel, err)
+	}
+	return messageID, nil
+}
+
+// Subscribe consumes messages from the channel until ctx is done. Messages
+// are fetched and handled one at a time; a handler error naks the message
+// so that it is redelivered.
+func (n *NATSClient) Subscribe(ctx context.Context, channel string, handler Handler) error {
+	if strings.TrimSpace(channel) == "" {
+		return errors.New("nats channel is required")
+	}
+
+	consumer, err := n.js.CreateOrUpdateConsumer(ctx, n.stream, jetstream.ConsumerConfig{
+		Durable:       consumerName(channel),
+		FilterSubject: n.subject(channel),
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       natsAckWait,
+	})
+	if err != nil {
+		return fmt.Errorf("nats: create consumer for %q: %w", channel, err)
+	}
+
+	for {
+		msg, err := consumer.Next(jetstream.FetchContext(ctx))
+		if ctx.Err() != nil {
+			if msg != nil {
+				_ = msg.Nak()
+			}
+			return ctx.Err()
+		}
+		if err != nil {
+			// Timeouts end an idle pull; errors while disconnected are
+			// retried until the connection is back.
+			if !errors.Is(err, nats.ErrTimeout) {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(reconnectMinBackoff):
+				}
+			}
+			continue
+		}
+		n.handle(ctx, msg, handler)
+	}
+}
+
+// PublishTransient sends a message to the channel's plain NATS subject,
+// outside the stream. It reaches only the subscribers present at the time.
+func (n *NATSClient) PublishTransient(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error) {
+	if strings.TrimSpace(channel) == "" {
+		return "", errors.New("nats channel is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultPublishTimeout)
+	defer cancel()
+
+	msg := nats.NewMsg(n.transientSubject(channel))
+	msg.Data = data
+	for key, value := range attrs {
+		msg.Header.Set(key, value)
+	}
+	messageID := newMessageID()
+	msg.Header.Set(jetstream.MsgIDHeader, messageID)
+	if err := n.conn.PublishMsg(msg); err != nil {
+		return "", fmt.Errorf("nats: publish to %q: %w", channel, err)
+	}
+	if err := n.conn.FlushWithContext(ctx); err != nil {
+		return "", fmt.Errorf("nats: publish to %q: %w", channel, err)
+	}
+	return messageID, nil
+}
+
+// SubscribeTransient handles messages from the channel's plain NATS
+// subject until ctx is done. Nothing is kept on the server, so messages
+// are neither acked nor redelivered: a handler error drops the message.
+func (n *NATSClient) SubscribeTransient(ctx context.Context, channel string, handler Handler) error {
+	if strings.TrimSpace(channel) == "" {
+		return errors.New("nats channel is required")
+	}
+
+	msgs := make(chan *nats.Msg, 64)
+	sub, err := n.conn.ChanSubscribe(n.transientSubject(channel), msgs)
+	if err != nil {
+		return fmt.Errorf("nats: subscribe to %q: %w", channel, err)
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg := <-msgs:
+			message := Message{
+				ID:         msg.Header.Get(jetstream.MsgIDHeader),
+				Data:       msg.Data,
+				Attributes: headerAttributes(msg.Header),
+			}
+			if err := handler(ctx, message); err != nil {
+				log.Printf("nats: dropping message %s on transient %q: %v", message.ID, channel, err)
+			}
+		}
+	}
+}
+
+// handle runs handler on msg, marking the message in progress while the
+// handler runs, and acks or naks it.
+func (n *NATSClient) handle(ctx context.Context, msg jetstream.Msg, handler Handler) {
+	message := Message{
+		ID:         msg.Headers().Get(jetstream.MsgIDHeader),
+		Data:       msg.Data(),
+		Attributes: headerAttributes(msg.Headers()),
+	}
+	if meta, err := msg.Metadata(); err == nil {
+		message.PublishedAt = meta.Timestamp
+		message.Redelivered = meta.NumDelivered > 1
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- handler(ctx, message)
+	}()
+	ticker := time.NewTicker(natsAckWait / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				_ = msg.Nak()
+			} else {
+				_ = msg.Ack()
+			}
+			return
+		case <-ticker.C:
+			_ = msg.InProgress()
+		}
+	}
+}
+
+// Close drains the connection, so in-flight acks are sent before it
+// closes.
+func (n *NATSClient) Close() error {
+	return n.conn.Drain()
+}
+
+func (n *NATSClient) subject(channel string) string {
+	return n.stream + "." + channel
+}
+
+// transientSubject is the plain subject of a transient channel. It is
+// outside the stream's subjects, so JetStream does not store it.
+func (n *NATSClient) transientSubject(channel string) string {
+	return n.stream + "-transient." + channel
+}
+
+// consumerName turns a channel into a valid durable consumer name.
+func consumerName(channel string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, channel)
+}
+
+func headerAttributes(header nats.Header) map[string]string {
+	attrs := make(map[string]string, len(header))
+	for key, values := range header {
+		if key == jetstream.MsgIDHeader || len(values) == 0 {
+			continue
+		}
+		attrs[key] = values[0]
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+	return attrs
+}
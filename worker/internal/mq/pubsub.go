@@ -0,0 +1,412 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub/v2"
+	"cloud.google.com/go/pubsub/v2/apiv1/pubsubpb"
+	"github.com/jjudge-oj/worker/config"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+var errPubSubClosed = errors.New("pubsub client closed")
+
+const (
+	// deadLetterSuffix is appended to a channel to name the topic its
+	// undeliverable messages are moved to. The topic has a subscription of
+	// its own, so they are kept for inspection.
+	deadLetterSuffix = "-dead-letter"
+
+	// pubsubMaxDeliveryAttempts is how often a message is delivered before
+	// it is dead-lettered, the most Pub/Sub allows. Pub/Sub only counts
+	// deliveries on subscriptions with a dead-letter policy, so the policy
+	// is what sets Redelivered.
+	pubsubMaxDeliveryAttempts = 100
+
+	// pubsubTransientExpiration is how long a transient subscription may
+	// go unused before Pub/Sub deletes it, the shortest it allows. It only
+	// matters when the subscriber dies without deleting it.
+	pubsubTransientExpiration = 24 * time.Hour
+)
+
+// PubSubClient implements Backend with Google Cloud Pub/Sub. Each channel is
+// a topic of the same name with one subscription, named after the channel
+// plus the configured suffix, shared by all its consumers. The subscription
+// moves messages nacked too often to a dead-letter topic. Topics and
+// subscriptions are created on first use; those of transient channels are
+// deleted when their subscriber stops. Set PUBSUB_EMULATOR_HOST to use the
+// Pub/Sub emulator.
+type PubSubClient struct {
+	client             *pubsub.Client
+	subscriptionSuffix string
+
+	mu         sync.Mutex
+	publishers map[string]*pubsub.Publisher
+	ensured    map[string]bool // channels whose topic and subscription exist
+	lastErr    error
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPubSubClient constructs a Pub/Sub client from config.
+func NewPubSubClient(ctx context.Context, cfg *config.PubSubConfig) (*PubSubClient, error) {
+	if strings.TrimSpace(cfg.ProjectID) == "" {
+		return nil, errors.New("pubsub project id is required")
+	}
+	if strings.TrimSpace(cfg.SubscriptionSuffix) == "" {
+		return nil, errors.New("pubsub subscription suffix is required")
+	}
+
+	var opts []option.ClientOption
+	if strings.TrimSpace(cfg.CredentialsFile) != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+
+	client, err := pubsub.NewClient(ctx, cfg.ProjectID, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PubSubClient{
+		client:             client,
+		subscriptionSuffix: cfg.SubscriptionSuffix,
+		publishers:         map[string]*pubsub.Publisher{},
+		ensured:            map[string]bool{},
+		closed:             make(chan struct{}),
+	}, nil
+}
+
+// Health returns nil unless the latest publish or subscription attempt
+// failed. Pub/Sub has no connection to watch, so a failure is only noticed
+// when the broker is used.
+func (p *PubSubClient) Health() error {
+	select {
+	case <-p.closed:
+		return errPubSubClosed
+	default:
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.lastErr != nil {
+		return fmt.Errorf("pubsub unavailable: %w", p.lastErr)
+	}
+	return nil
+}
+
+// Publish sends a message to the topic named channel and waits for the
+// broker to accept it. The channel's subscription is created first, so
+// messages published before any consumer subscribes are kept as they are in
+// a RabbitMQ queue.
+func (p *PubSubClient) Publish(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error) {
+	if strings.TrimSpace(channel) == "" {
+		return "", errors.New("pubsub channel is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultPublishTimeout)
+	defer cancel()
+	publisher, err := p.publisher(ctx, channel)
+	if err != nil {
+		return "", p.track(err)
+	}
+
+	id, err := publisher.Publish(ctx, &pubsub.Message{
+		Data:       data,
+		Attributes: attrs,
+	}).Get(ctx)
+	if err != nil {
+		return "", p.track(fmt.Errorf("pubsub: publish to %q: %w", channel, err))
+	}
+	p.track(nil)
+	return id, nil
+}
+
+// Subscribe receives messages from the channel's subscription until ctx is
+// done or the client is closed. Messages are handled one at a time, and a
+// handler error nacks the message so that it is redelivered. Receive errors
+// are retried with backoff.
+func (p *PubSubClient) Subscribe(ctx context.Context, channel string, handler Handler) error {
+	return p.subscribe(ctx, channel, handler, p.ensure)
+}
+
+// PublishTransient sends a message to the topic of a channel consumed with
+// SubscribeTransient. Nothing is created, so the message is dropped when
+// the channel has no subscriber.
+func (p *PubSubClient) PublishTransient(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error) {
+	if strings.TrimSpace(channel) == "" {
+		return "", errors.New("pubsub channel is required")
+	}
+	select {
+	case <-p.closed:
+		return "", errPubSubClosed
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultPublishTimeout)
+	defer cancel()
+	publisher := p.client.Publisher(channel)
+	defer publisher.Stop()
+
+	id, err := publisher.Publish(ctx, &pubsub.Message{
+		Data:       data,
+		Attributes: attrs,
+	}).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", p.track(fmt.Errorf("pubsub: publish to %q: %w", channel, err))
+	}
+	p.track(nil)
+	return id, nil
+}
+
+// SubscribeTransient receives messages like Subscribe from a subscription
+// without dead-letter policy, and deletes the subscription and topic when
+// it returns. Should the process die first, the unused subscription
+// expires after a day.
+func (p *PubSubClient) SubscribeTransient(ctx context.Context, channel string, handler Handler) error {
+	if strings.TrimSpace(channel) == "" {
+		return errors.New("pubsub channel is required")
+	}
+	defer p.deleteTransient(ctx, channel)
+	return p.subscribe(ctx, channel, handler, p.createTransient)
+}
+
+func (p *PubSubClient) subscribe(ctx context.Context, channel string, handler Handler, ensure func(context.Context, string) error) error {
+	if strings.TrimSpace(channel) == "" {
+		return errors.New("pubsub channel is required")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := reconnectMinBackoff
+	for {
+		receiving, err := p.receive(ctx, channel, handler, ensure)
+		select {
+		case <-p.closed:
+			return errPubSubClosed
+		default:
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		p.track(err)
+		if receiving {
+			backoff = reconnectMinBackoff
+		}
+		log.Printf("pubsub: subscription to %q stopped: %v; resubscribing in %s", channel, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, reconnectMaxBackoff)
+	}
+}
+
+// receive runs one Receive call on the channel's subscription, created by
+// ensure. It reports whether receiving started, and returns when ctx is
+// done or Receive fails.
+func (p *PubSubClient) receive(ctx context.Context, channel string, handler Handler, ensure func(context.Context, string) error) (bool, error) {
+	if err := ensure(ctx, channel); err != nil {
+		return false, err
+	}
+	p.track(nil)
+
+	subscriber := p.client.Subscriber(channel + p.subscriptionSuffix)
+	// One message at a time, like a RabbitMQ consumer; the library extends
+	// its ack deadline while the handler runs.
+	subscriber.ReceiveSettings.MaxOutstandingMessages = 1
+	subscriber.ReceiveSettings.NumGoroutines = 1
+
+	err := subscriber.Receive(ctx, func(msgCtx context.Context, msg *pubsub.Message) {
+		message := Message{
+			ID:          msg.ID,
+			Data:        msg.Data,
+			PublishedAt: msg.PublishTime,
+			Attributes:  msg.Attributes,
+			// Delivery attempts are counted thanks to the subscription's
+			// dead-letter policy.
+			Redelivered: msg.DeliveryAttempt != nil && *msg.DeliveryAttempt > 1,
+		}
+		// Receive waits for the handler before returning, and acks sent
+		// after ctx is done are still delivered.
+		if err := handler(msgCtx, message); err != nil {
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+	})
+	if err == nil && ctx.Err() == nil {
+		err = errors.New("pubsub receive returned")
+	}
+	return true, err
+}
+
+// publisher returns the cached publisher for channel, creating the topic
+// and subscription first if needed.
+func (p *PubSubClient) publisher(ctx context.Context, channel string) (*pubsub.Publisher, error) {
+	if err := p.ensure(ctx, channel); err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	select {
+	case <-p.closed:
+		return nil, errPubSubClosed
+	default:
+	}
+	publisher, ok := p.publishers[channel]
+	if !ok {
+		publisher = p.client.Publisher(channel)
+		p.publishers[channel] = publisher
+	}
+	return publisher, nil
+}
+
+// ensure creates the topic and subscription of channel unless they exist,
+// and gives the subscription its dead-letter policy.
+func (p *PubSubClient) ensure(ctx context.Context, channel string) error {
+	p.mu.Lock()
+	ok := p.ensured[channel]
+	p.mu.Unlock()
+	if ok {
+		return nil
+	}
+
+	deadLetterTopic, err := p.createTopic(ctx, channel+deadLetterSuffix, nil)
+	if err != nil {
+		return err
+	}
+	policy := &pubsubpb.DeadLetterPolicy{
+		DeadLetterTopic:     deadLetterTopic,
+		MaxDeliveryAttempts: pubsubMaxDeliveryAttempts,
+	}
+	if _, err := p.createTopic(ctx, channel, policy); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.ensured[channel] = true
+	p.mu.Unlock()
+	return nil
+}
+
+// createTopic creates the topic name and its subscription unless they exist
+// and returns the topic's resource name. A subscription created without
+// policy, e.g. by an older version, gets it added.
+func (p *PubSubClient) createTopic(ctx context.Context, name string, policy *pubsubpb.DeadLetterPolicy) (string, error) {
+	project := p.client.Project()
+	topic := fmt.Sprintf("projects/%s/topics/%s", project, name)
+	_, err := p.client.TopicAdminClient.CreateTopic(ctx, &pubsubpb.Topic{Name: topic})
+	if err != nil && status.Code(err) != codes.AlreadyExists {
+		return "", fmt.Errorf("pubsub: create topic %q: %w", name, err)
+	}
+
+	subscription := &pubsubpb.Subscription{
+		Name:             fmt.Sprintf("projects/%s/subscriptions/%s%s", project, name, p.subscriptionSuffix),
+		Topic:            topic,
+		DeadLetterPolicy: policy,
+	}
+	_, err = p.client.SubscriptionAdminClient.CreateSubscription(ctx, subscription)
+	if status.Code(err) == codes.AlreadyExists && policy != nil {
+		_, err = p.client.SubscriptionAdminClient.UpdateSubscription(ctx, &pubsubpb.UpdateSubscriptionRequest{
+			Subscription: subscription,
+			UpdateMask:   &fieldmaskpb.FieldMask{Paths: []string{"dead_letter_policy"}},
+		})
+	}
+	if err != nil && status.Code(err) != codes.AlreadyExists {
+		return "", fmt.Errorf("pubsub: create subscription %q: %w", name+p.subscriptionSuffix, err)
+	}
+	return topic, nil
+}
+
+// createTransient creates the topic and subscription of a transient
+// channel unless they exist. The subscription expires when left unused.
+func (p *PubSubClient) createTransient(ctx context.Context, channel string) error {
+	project := p.client.Project()
+	topic := fmt.Sprintf("projects/%s/topics/%s", project, channel)
+	_, err := p.client.TopicAdminClient.CreateTopic(ctx, &pubsubpb.Topic{Name: topic})
+	if err != nil && status.Code(err) != codes.AlreadyExists {
+		return fmt.Errorf("pubsub: create topic %q: %w", channel, err)
+	}
+
+	_, err = p.client.SubscriptionAdminClient.CreateSubscription(ctx, &pubsubpb.Subscription{
+		Name:             fmt.Sprintf("projects/%s/subscriptions/%s%s", project, channel, p.subscriptionSuffix),
+		Topic:            topic,
+		ExpirationPolicy: &pubsubpb.ExpirationPolicy{Ttl: durationpb.New(pubsubTransientExpiration)},
+	})
+	if err != nil && status.Code(err) != codes.AlreadyExists {
+		return fmt.Errorf("pubsub: create subscription %q: %w", channel+p.subscriptionSuffix, err)
+	}
+	return nil
+}
+
+// deleteTransient deletes the subscription and topic of a transient
+// channel. It runs as the subscription ends, so it outlives ctx.
+func (p *PubSubClient) deleteTransient(ctx context.Context, channel string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), defaultPublishTimeout)
+	defer cancel()
+
+	project := p.client.Project()
+	err := p.client.SubscriptionAdminClient.DeleteSubscription(ctx, &pubsubpb.DeleteSubscriptionRequest{
+		Subscription: fmt.Sprintf("projects/%s/subscriptions/%s%s", project, channel, p.subscriptionSuffix),
+	})
+	if err != nil && status.Code(err) != codes.NotFound {
+		log.Printf("pubsub: delete subscription %q: %v", channel+p.subscriptionSuffix, err)
+	}
+	err = p.client.TopicAdminClient.DeleteTopic(ctx, &pubsubpb.DeleteTopicRequest{
+		Topic: fmt.Sprintf("projects/%s/topics/%s", project, channel),
+	})
+	if err != nil && status.Code(err) != codes.NotFound {
+		log.Printf("pubsub: delete topic %q: %v", channel, err)
+	}
+}
+
+// track records err as the latest broker error, or clears it if nil, and
+// returns it.
+func (p *PubSubClient) track(err error) error {
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	p.mu.Lock()
+	p.lastErr = err
+	p.mu.Unlock()
+	return err
+}
+
+// Close stops the publishers and subscriptions and closes the client.
+func (p *PubSubClient) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		close(p.closed)
+		p.mu.Lock()
+		publishers := p.publishers
+		p.publishers = map[string]*pubsub.Publisher{}
+		p.mu.Unlock()
+		for _, publisher := range publishers {
+			publisher.Stop()
+		}
+		err = p.client.Close()
+	})
+	return err
+}
@@ -6,126 +6,403 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/jjudge-oj/worker/config"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-// RabbitMQClient wraps a RabbitMQ connection/channel pair.
+const (
+	// reconnectMinBackoff and reconnectMaxBackoff bound the delay between
+	// attempts to reconnect or resubscribe.
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = 30 * time.Second
+
+	defaultPublishTimeout = 10 * time.Second
+)
+
+var errClientClosed = errors.New("rabbitmq client closed")
+
+// publishedAtHeader carries the publish time in Unix milliseconds. The AMQP
+// timestamp property has only whole-second resolution, too coarse for queue
+// wait times.
+const publishedAtHeader = "x-published-at-ms"
+
+// RabbitMQClient wraps a RabbitMQ connection and its publishing channel.
+// When the connection is lost it reconnects with backoff, and subscriptions
+// resume on the new connection.
 type RabbitMQClient struct {
-	conn            *amqp.Connection
-	channel         *amqp.Channel
+	url             string
 	queueDurable    bool
 	queueAutoDelete bool
 	prefetchCount   int
+	publishTimeout  time.Duration
+
+	mu      sync.Mutex
+	conn    *amqp.Connection
+	channel *amqp.Channel // publishing channel, in confirm mode
+	// connected is closed while connected; it is replaced when the
+	// connection is lost so waiters see the next one.
+	connected chan struct{}
+	lastErr   error
+
+	closed    chan struct{}
+	closeOnce sync.Once
 }
 
-// NewRabbitMQClient constructs a RabbitMQ client from config.
+// NewRabbitMQClient constructs a RabbitMQ client from config. The first
+// connection must succeed; later ones are retried in the background.
 func NewRabbitMQClient(cfg *config.RabbitMQConfig) (*RabbitMQClient, error) {
 	if strings.TrimSpace(cfg.URL) == "" {
 		return nil, errors.New("rabbitmq url is required")
 	}
 
-	conn, err := amqp.Dial(cfg.URL)
-	if err != nil {
+	publishTimeout := cfg.PublishTimeout
+	if publishTimeout <= 0 {
+		publishTimeout = defaultPublishTimeout
+	}
+	r := &RabbitMQClient{
+		url:             cfg.URL,
+		queueDurable:    cfg.QueueDurable,
+		queueAutoDelete: cfg.QueueAutoDelete,
+		prefetchCount:   cfg.PrefetchCount,
+		publishTimeout:  publishTimeout,
+		connected:       make(chan struct{}),
+		closed:          make(chan struct{}),
+	}
+	if err := r.connect(); err != nil {
 		return nil, err
 	}
+	return r, nil
+}
+
+// connect dials the broker and opens the publishing channel in confirm
+// mode. A goroutine then watches the connection and reconnects once it is
+// lost.
+func (r *RabbitMQClient) connect() error {
+	conn, err := amqp.Dial(r.url)
+	if err != nil {
+		return err
+	}
 
 	ch, err := conn.Channel()
 	if err != nil {
 		_ = conn.Close()
-		return nil, err
+		return err
+	}
+	// Publisher confirms: Publish returns once the broker has taken
+	// responsibility for the message.
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		_ = conn.Close()
+		return err
+	}
+
+	connClosed := conn.NotifyClose(make(chan *amqp.Error, 1))
+	chClosed := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	r.mu.Lock()
+	select {
+	case <-r.closed:
+		r.mu.Unlock()
+		_ = conn.Close()
+		return errClientClosed
+	default:
 	}
+	r.conn = conn
+	r.channel = ch
+	r.lastErr = nil
+	close(r.connected)
+	r.mu.Unlock()
 
-	if cfg.PrefetchCount > 0 {
-		if err := ch.Qos(cfg.PrefetchCount, 0, false); err != nil {
-			_ = ch.Close()
-			_ = conn.Close()
-			return nil, err
+	go r.watch(conn, connClosed, chClosed)
+	return nil
+}
+
+// watch waits for the connection or its publishing channel to close and
+// reconnects with backoff, unless the client was closed.
+func (r *RabbitMQClient) watch(conn *amqp.Connection, connClosed, chClosed <-chan *amqp.Error) {
+	var cause *amqp.Error
+	select {
+	case cause = <-connClosed:
+	case cause = <-chClosed:
+		// A channel error leaves the connection open; replace both.
+		_ = conn.Close()
+	}
+	err := errors.New("connection closed")
+	if cause != nil {
+		err = cause
+	}
+
+	r.mu.Lock()
+	r.connected = make(chan struct{})
+	r.lastErr = err
+	r.mu.Unlock()
+
+	backoff := reconnectMinBackoff
+	for {
+		select {
+		case <-r.closed:
+			return
+		default:
+		}
+		log.Printf("rabbitmq: connection lost: %v; reconnecting in %s", err, backoff)
+		select {
+		case <-r.closed:
+			return
+		case <-time.After(backoff):
+		}
+		if err = r.connect(); err == nil {
+			log.Printf("rabbitmq: reconnected")
+			return
 		}
+		r.mu.Lock()
+		r.lastErr = err
+		r.mu.Unlock()
+		backoff = min(backoff*2, reconnectMaxBackoff)
 	}
+}
 
-	return &RabbitMQClient{
-		conn:            conn,
-		channel:         ch,
-		queueDurable:    cfg.QueueDurable,
-		queueAutoDelete: cfg.QueueAutoDelete,
-		prefetchCount:   cfg.PrefetchCount,
-	}, nil
+// session waits until the client is connected and returns the connection
+// and publishing channel.
+func (r *RabbitMQClient) session(ctx context.Context) (*amqp.Connection, *amqp.Channel, error) {
+	r.mu.Lock()
+	conn, ch, connected, lastErr := r.conn, r.channel, r.connected, r.lastErr
+	r.mu.Unlock()
+	select {
+	case <-connected:
+		return conn, ch, nil
+	case <-r.closed:
+		return nil, nil, errClientClosed
+	case <-ctx.Done():
+		if lastErr != nil {
+			return nil, nil, fmt.Errorf("rabbitmq not connected (%v): %w", lastErr, ctx.Err())
+		}
+		return nil, nil, ctx.Err()
+	}
 }
 
-// Publish sends a message to the named queue.
+// Health returns nil while the client is connected, and otherwise why not.
+func (r *RabbitMQClient) Health() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.closed:
+		return errClientClosed
+	case <-r.connected:
+		return nil
+	default:
+	}
+	if r.lastErr != nil {
+		return fmt.Errorf("rabbitmq disconnected: %w", r.lastErr)
+	}
+	return errors.New("rabbitmq disconnected")
+}
+
+// Publish sends a message to the named queue and waits for the broker to
+// confirm it. While the client is reconnecting it waits for the connection.
+// Waiting and confirming together take at most the publish timeout.
 func (r *RabbitMQClient) Publish(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error) {
+	return r.publish(ctx, channel, data, attrs, false)
+}
+
+// PublishTransient sends a message to a queue declared by
+// SubscribeTransient. The queue is not declared here, so the broker drops
+// the message while nobody subscribes.
+func (r *RabbitMQClient) PublishTransient(ctx context.Context, channel string, data []byte, attrs map[string]string) (string, error) {
+	return r.publish(ctx, channel, data, attrs, true)
+}
+
+func (r *RabbitMQClient) publish(ctx context.Context, channel string, data []byte, attrs map[string]string, transient bool) (string, error) {
 	if strings.TrimSpace(channel) == "" {
 		return "", errors.New("rabbitmq channel is required")
 	}
 
-	if _, err := r.declareQueue(channel); err != nil {
+	ctx, cancel := context.WithTimeout(ctx, r.publishTimeout)
+	defer cancel()
+	_, ch, err := r.session(ctx)
+	if err != nil {
 		return "", err
 	}
 
+	deliveryMode := uint8(amqp.Transient)
+	if !transient {
+		if _, err := r.declareQueue(ch, channel); err != nil {
+			return "", err
+		}
+		deliveryMode = r.deliveryMode()
+	}
+
+	now := time.Now()
 	headers := amqp.Table{}
 	for key, value := range attrs {
 		headers[key] = value
 	}
+	headers[publishedAtHeader] = now.UnixMilli()
 
 	messageID := newMessageID()
-	err := r.channel.PublishWithContext(ctx, "", channel, false, false, amqp.Publishing{
-		ContentType: "application/octet-stream",
-		MessageId:   messageID,
-		Headers:     headers,
-		Body:        data,
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", channel, false, false, amqp.Publishing{
+		ContentType:  "application/octet-stream",
+		MessageId:    messageID,
+		Timestamp:    now,
+		Headers:      headers,
+		Body:         data,
+		DeliveryMode: deliveryMode,
 	})
 	if err != nil {
 		return "", err
 	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("rabbitmq: waiting for confirm of message %s: %w", messageID, err)
+	}
+	if !acked {
+		return "", fmt.Errorf("rabbitmq: message %s on %q not confirmed by the broker", messageID, channel)
+	}
 	return messageID, nil
 }
 
-// Subscribe consumes messages from the named queue.
+// Subscribe consumes messages from the named queue until ctx is done or the
+// client is closed. When the connection is lost the subscription resumes
+// once the client has reconnected.
 func (r *RabbitMQClient) Subscribe(ctx context.Context, channel string, handler Handler) error {
+	return r.subscribe(ctx, channel, handler, r.declareQueue)
+}
+
+// SubscribeTransient consumes messages from an exclusive, auto-deleted
+// queue, which the broker removes when the subscription ends or the
+// connection is lost. It is declared again after a reconnect.
+func (r *RabbitMQClient) SubscribeTransient(ctx context.Context, channel string, handler Handler) error {
+	return r.subscribe(ctx, channel, handler, declareTransientQueue)
+}
+
+func (r *RabbitMQClient) subscribe(ctx context.Context, channel string, handler Handler, declare declareFunc) error {
 	if strings.TrimSpace(channel) == "" {
 		return errors.New("rabbitmq channel is required")
 	}
 
-	if _, err := r.declareQueue(channel); err != nil {
-		return err
+	backoff := reconnectMinBackoff
+	for {
+		consuming, err := r.consume(ctx, channel, handler, declare)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, errClientClosed) {
+			return err
+		}
+		if consuming {
+			backoff = reconnectMinBackoff
+		}
+		log.Printf("rabbitmq: consumer of %q stopped: %v; resubscribing in %s", channel, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-r.closed:
+			return errClientClosed
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, reconnectMaxBackoff)
+	}
+}
+
+// consume runs one subscription to queue on a channel of its own. It
+// reports whether the consumer was started, and returns when ctx is done or
+// the channel closes.
+func (r *RabbitMQClient) consume(ctx context.Context, queue string, handler Handler, declare declareFunc) (bool, error) {
+	conn, _, err := r.session(ctx)
+	if err != nil {
+		return false, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return false, fmt.Errorf("open channel for %q: %w", queue, err)
+	}
+	defer ch.Close()
+
+	if r.prefetchCount > 0 {
+		if err := ch.Qos(r.prefetchCount, 0, false); err != nil {
+			return false, fmt.Errorf("qos for %q: %w", queue, err)
+		}
+	}
+	if _, err := declare(ch, queue); err != nil {
+		return false, fmt.Errorf("declare queue %q: %w", queue, err)
 	}
 
 	consumerTag := fmt.Sprintf("consumer-%s", newMessageID())
-	deliveries, err := r.channel.Consume(channel, consumerTag, false, false, false, false, nil)
+	deliveries, err := ch.Consume(queue, consumerTag, false, false, false, false, nil)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer func() {
-		_ = r.channel.Cancel(consumerTag, false)
+		_ = ch.Cancel(consumerTag, false)
 	}()
 
+	// returnPrefetched cancels the consumer and returns the deliveries
+	// prefetched but not started to the queue, rather than holding them
+	// until the channel closes.
+	returnPrefetched := func() {
+		_ = ch.Cancel(consumerTag, false)
+		for delivery := range deliveries {
+			_ = delivery.Nack(false, true)
+		}
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			returnPrefetched()
+			return true, ctx.Err()
 		case delivery, ok := <-deliveries:
 			if !ok {
-				return errors.New("rabbitmq delivery channel closed")
+				return true, errors.New("rabbitmq delivery channel closed")
+			}
+			if ctx.Err() != nil {
+				_ = delivery.Nack(false, true)
+				returnPrefetched()
+				return true, ctx.Err()
 			}
 			message := Message{
-				ID:         delivery.MessageId,
-				Data:       delivery.Body,
-				Attributes: headersToAttributes(delivery.Headers),
+				ID:          delivery.MessageId,
+				Data:        delivery.Body,
+				PublishedAt: publishedAt(delivery),
+				Attributes:  headersToAttributes(delivery.Headers),
+				Redelivered: delivery.Redelivered,
+			}
+			// The handler may outlive ctx; the prefetched deliveries are
+			// returned as soon as ctx is done, not when the handler returns.
+			done := make(chan error, 1)
+			go func() {
+				done <- handler(ctx, message)
+			}()
+			var err error
+			select {
+			case err = <-done:
+			case <-ctx.Done():
+				returnPrefetched()
+				err = <-done
 			}
-			if err := handler(ctx, message); err != nil {
+			// After a reconnect the delivery belongs to a closed channel;
+			// the broker has already requeued it.
+			if err != nil {
 				_ = delivery.Nack(false, true)
-				continue
+			} else {
+				_ = delivery.Ack(false)
+			}
+			if ctx.Err() != nil {
+				return true, ctx.Err()
 			}
-			_ = delivery.Ack(false)
 		}
 	}
 }
 
-// Close closes the underlying channel and connection.
+// Close stops reconnecting and closes the connection.
 func (r *RabbitMQClient) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if r.channel != nil {
 		_ = r.channel.Close()
 	}
@@ -135,8 +412,11 @@ func (r *RabbitMQClient) Close() error {
 	return nil
 }
 
-func (r *RabbitMQClient) declareQueue(name string) (amqp.Queue, error) {
-	return r.channel.QueueDeclare(
+// declareFunc declares the queue a subscription consumes.
+type declareFunc func(ch *amqp.Channel, name string) (amqp.Queue, error)
+
+func (r *RabbitMQClient) declareQueue(ch *amqp.Channel, name string) (amqp.Queue, error) {
+	return ch.QueueDeclare(
 		name,
 		r.queueDurable,
 		r.queueAutoDelete,
@@ -146,12 +426,39 @@ func (r *RabbitMQClient) declareQueue(name string) (amqp.Queue, error) {
 	)
 }
 
+// declareTransientQueue declares a queue only ch's connection may use,
+// deleted once its consumer goes away.
+func declareTransientQueue(ch *amqp.Channel, name string) (amqp.Queue, error) {
+	return ch.QueueDeclare(name, false, true, true, false, nil)
+}
+
+// deliveryMode makes messages to durable queues persistent, so they survive
+// a broker restart like the queues do.
+func (r *RabbitMQClient) deliveryMode() uint8 {
+	if r.queueDurable {
+		return amqp.Persistent
+	}
+	return amqp.Transient
+}
+
+// publishedAt returns when delivery was published, to the millisecond if
+// the publisher set publishedAtHeader.
+func publishedAt(delivery amqp.Delivery) time.Time {
+	if ms, ok := delivery.Headers[publishedAtHeader].(int64); ok {
+		return time.UnixMilli(ms)
+	}
+	return delivery.Timestamp
+}
+
 func headersToAttributes(headers amqp.Table) map[string]string {
 	if len(headers) == 0 {
 		return nil
 	}
 	attrs := make(map[string]string, len(headers))
 	for key, value := range headers {
+		if key == publishedAtHeader {
+			continue
+		}
 		switch typed := value.(type) {
 		case string:
 			attrs[key] = typed
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 
 	"github.com/jjudge-oj/worker/internal/blob"
+	"github.com/jjudge-oj/worker/internal/metrics"
 )
 
 type TestcaseCache struct {
@@ -24,8 +25,14 @@ func NewTestcaseCache(capacity int, cacheDir string) (*TestcaseCache, error) {
 
 	onDelete := func(key string) {
 		tcPath := filepath.Join(tcCacheDir, filepath.FromSlash(key))
+		info, err := os.Stat(tcPath)
 		if err := os.Remove(tcPath); err != nil && !os.IsNotExist(err) {
 			fmt.Printf("failed to remove testcase file %s: %v\n", tcPath, err)
+			return
+		}
+		if err == nil {
+			metrics.CacheBytes.Sub(float64(info.Size()))
+			metrics.CacheEvictions.Inc()
 		}
 	}
 
@@ -51,8 +58,10 @@ func (tcc *TestcaseCache) SetBlobStorage(b *blob.Storage) {
 func (tcc *TestcaseCache) GetOrFetch(ctx context.Context, key string) (string, error) {
 	tcPath := filepath.Join(tcc.tcCacheDir, filepath.FromSlash(key))
 	if _, err := os.Stat(tcPath); err == nil {
+		metrics.CacheHits.Inc()
 		return tcPath, nil
 	}
+	metrics.CacheMisses.Inc()
 
 	r, err := tcc.blob.Get(ctx, key)
 	if err != nil {
@@ -70,9 +79,11 @@ func (tcc *TestcaseCache) GetOrFetch(ctx context.Context, key string) (string, e
 	}
 	defer f.Close()
 
-	if _, err := f.ReadFrom(r); err != nil {
+	n, err := f.ReadFrom(r)
+	if err != nil {
 		return "", fmt.Errorf("failed to write testcase to file: %w", err)
 	}
+	metrics.CacheBytes.Add(float64(n))
 
 	tcc.cache.Put(key, true)
 	return tcPath, nil
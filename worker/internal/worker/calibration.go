@@ -0,0 +1,58 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jjudge-oj/worker/internal/lime"
+)
+
+// calibrate benchmarks every slot and logs the speed factors under the
+// worker's identity. Failures are logged and leave the previous factors in
+// place.
+func (w *Worker) calibrate(ctx context.Context) {
+	results, err := w.slotPool.Calibrate(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("worker %s: calibration failed: %v", w.cfg.WorkerID, err)
+		}
+		return
+	}
+
+	w.calibrationMu.Lock()
+	w.calibrations = results
+	w.calibrationMu.Unlock()
+
+	for _, c := range results {
+		cpu := c.CPUs
+		if cpu == "" {
+			cpu = "any"
+		}
+		log.Printf("worker %s: slot %d (cpu %s) speed factor %.3f spread %.1f%%", w.cfg.WorkerID, c.Slot, cpu, c.SpeedFactor, c.Spread*100)
+		if c.Unstable() {
+			log.Printf("worker %s: warning: slot %d timings vary by %.1f%%, above %.1f%%; check for frequency scaling or other load on cpu %s", w.cfg.WorkerID, c.Slot, c.Spread*100, lime.UnstableSpread*100, cpu)
+		}
+	}
+}
+
+// calibrateEvery recalibrates the slots every interval until ctx is done.
+func (w *Worker) calibrateEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.calibrate(ctx)
+		}
+	}
+}
+
+// Calibrations returns the results of the most recent slot calibration.
+func (w *Worker) Calibrations() []lime.Calibration {
+	w.calibrationMu.Lock()
+	defer w.calibrationMu.Unlock()
+	return w.calibrations
+}
@@ -0,0 +1,203 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jjudge-oj/worker/internal/mq"
+)
+
+// DrainState is the worker's progress through a drain.
+type DrainState string
+
+const (
+	// DrainRunning means the worker is consuming jobs.
+	DrainRunning DrainState = "running"
+
+	// DrainDraining means the worker has stopped consuming and is waiting
+	// for in-flight jobs to finish.
+	DrainDraining DrainState = "draining"
+
+	// DrainDrained means no jobs are in flight and the worker is exiting.
+	DrainDrained DrainState = "drained"
+)
+
+// checkpointTimeout bounds publishing the reset of a job aborted by the
+// drain deadline.
+const checkpointTimeout = 5 * time.Second
+
+// drainedAttribute marks a job republished after the drain deadline aborted
+// it on its first delivery. The republished message is a new first
+// delivery, so the worker taking it next still returns it to the queue on a
+// sandbox error.
+const drainedAttribute = "drained"
+
+// errDraining is returned for deliveries that arrive after the drain began,
+// so they go back to the queue unstarted.
+var errDraining = errors.New("worker is draining")
+
+// DrainStatus is the body of the drain endpoint.
+type DrainStatus struct {
+	Worker   string     `json:"worker"`
+	State    DrainState `json:"state"`
+	InFlight int        `json:"in_flight"`
+	// Checkpointed counts jobs aborted at the deadline and returned to
+	// the queue.
+	Checkpointed int        `json:"checkpointed"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	Deadline     *time.Time `json:"deadline,omitempty"`
+}
+
+// drain tracks a graceful shutdown. stopping is closed when the drain
+// begins; abort cancels the context jobs run on and is called at the
+// deadline.
+type drain struct {
+	stopping chan struct{}
+	once     sync.Once
+
+	inFlight     atomic.Int32
+	checkpointed atomic.Int32
+
+	mu        sync.Mutex
+	state     DrainState
+	startedAt time.Time
+	deadline  time.Time
+	abort     context.CancelFunc
+	timer     *time.Timer
+}
+
+func newDrain() *drain {
+	return &drain{
+		stopping: make(chan struct{}),
+		state:    DrainRunning,
+	}
+}
+
+// setAbort registers the function that aborts in-flight jobs.
+func (d *drain) setAbort(abort context.CancelFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.abort = abort
+}
+
+// begin marks a job as started. It reports false once the drain has begun.
+func (d *drain) begin() bool {
+	d.inFlight.Add(1)
+	select {
+	case <-d.stopping:
+		d.inFlight.Add(-1)
+		return false
+	default:
+		return true
+	}
+}
+
+func (d *drain) end() {
+	d.inFlight.Add(-1)
+}
+
+// finish records that the drain is complete and stops the deadline timer.
+func (d *drain) finish() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.state != DrainDraining {
+		return
+	}
+	d.state = DrainDrained
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
+
+func (d *drain) status() DrainStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	status := DrainStatus{
+		State:        d.state,
+		InFlight:     int(d.inFlight.Load()),
+		Checkpointed: int(d.checkpointed.Load()),
+	}
+	if !d.startedAt.IsZero() {
+		startedAt, deadline := d.startedAt, d.deadline
+		status.StartedAt = &startedAt
+		status.Deadline = &deadline
+	}
+	return status
+}
+
+// Drain stops the worker from taking new jobs: subscriptions are cancelled
+// and prefetched deliveries returned to the queue. In-flight jobs may run
+// until timeout; any still running then are aborted, reset to pending and
+// requeued. Start returns once no job is in flight. Calling Drain again has
+// no effect.
+func (w *Worker) Drain(timeout time.Duration) {
+	w.drain.once.Do(func() {
+		d := w.drain
+		d.mu.Lock()
+		d.state = DrainDraining
+		d.startedAt = time.Now()
+		d.deadline = d.startedAt.Add(timeout)
+		d.timer = time.AfterFunc(timeout, func() {
+			d.mu.Lock()
+			abort := d.abort
+			d.mu.Unlock()
+			if n := d.inFlight.Load(); n > 0 {
+				log.Printf("worker %s: drain deadline reached, aborting %d in-flight jobs", w.cfg.WorkerID, n)
+			}
+			if abort != nil {
+				abort()
+			}
+		})
+		d.mu.Unlock()
+
+		log.Printf("worker %s: draining, %d jobs in flight, deadline %s", w.cfg.WorkerID, d.inFlight.Load(), timeout)
+		close(d.stopping)
+	})
+}
+
+// checkpoint runs reset for a job aborted by the drain deadline or a forced
+// shutdown, so it shows as pending rather than judging until another worker
+// takes it from the queue. reset gets a fresh context, as the job's own is
+// cancelled.
+func (w *Worker) checkpoint(ctx context.Context, what string, reset func(ctx context.Context) error) {
+	w.drain.checkpointed.Add(1)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), checkpointTimeout)
+	defer cancel()
+	if err := reset(ctx); err != nil {
+		log.Printf("worker %s: failed to reset aborted %s: %v", w.cfg.WorkerID, what, err)
+		return
+	}
+	log.Printf("worker %s: aborted %s, returning it to the queue", w.cfg.WorkerID, what)
+}
+
+// requeueAborted republishes a job aborted on its first delivery to queue,
+// marked with drainedAttribute. Returning it with a nack instead would make
+// it a redelivery, which fails on a sandbox error rather than being
+// requeued.
+func (w *Worker) requeueAborted(ctx context.Context, queue string, msg mq.Message) error {
+	attrs := make(map[string]string, len(msg.Attributes)+1)
+	for key, value := range msg.Attributes {
+		attrs[key] = value
+	}
+	attrs[drainedAttribute] = "true"
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), checkpointTimeout)
+	defer cancel()
+	_, err := w.mq.Publish(ctx, queue, msg.Data, attrs)
+	return err
+}
+
+// DrainHandler serves the worker's drain status as JSON.
+func (w *Worker) DrainHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		status := w.drain.status()
+		status.Worker = w.cfg.WorkerID
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(status)
+	})
+}
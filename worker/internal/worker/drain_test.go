@@ -0,0 +1,97 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jjudge-oj/worker/config"
+	"github.com/jjudge-oj/worker/internal/mq"
+	"github.com/jjudge-oj/worker/internal/worker"
+)
+
+// abortJob consumes queue on w and fails the first nacks deliveries, then
+// blocks the next one until its job is aborted. It returns the message
+// left on the queue afterwards.
+func abortJob(t *testing.T, backend mq.Backend, w *worker.Worker, queue string, nacks int) mq.Message {
+	t.Helper()
+	ctx, abort := context.WithCancel(t.Context())
+	defer abort()
+
+	deliveries := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Consume(ctx, queue, func(ctx context.Context, msg mq.Message) error {
+			deliveries++
+			if deliveries <= nacks {
+				return errors.New("sandbox error")
+			}
+			abort()
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("job was not aborted")
+	}
+
+	// Take the message left behind without the worker.
+	next := make(chan mq.Message, 1)
+	subCtx, stop := context.WithTimeout(t.Context(), 10*time.Second)
+	defer stop()
+	_ = backend.Subscribe(subCtx, queue, func(ctx context.Context, msg mq.Message) error {
+		next <- msg
+		stop()
+		return nil
+	})
+	select {
+	case msg := <-next:
+		return msg
+	default:
+		t.Fatal("aborted job was not returned to the queue")
+		return mq.Message{}
+	}
+}
+
+func TestDrainRequeuesAbortedJob(t *testing.T) {
+	tests := []struct {
+		name string
+		// nacks is how often the job failed before the aborted delivery.
+		nacks           int
+		wantDrained     bool
+		wantRedelivered bool
+	}{
+		// The job is republished, so its next worker may still return it
+		// to the queue on a sandbox error.
+		{name: "first delivery", nacks: 0, wantDrained: true},
+		// A redelivered job stays redelivered.
+		{name: "redelivery", nacks: 1, wantRedelivered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := mq.NewMemoryQueue()
+			t.Cleanup(func() { _ = backend.Close() })
+			cfg := &config.Config{WorkerID: "test", Judge: &config.JudgeConfig{}}
+			w := worker.New(cfg, mq.New(backend), nil, nil, nil, nil)
+
+			const queue = "submissions"
+			if _, err := backend.Publish(t.Context(), queue, []byte("job"), map[string]string{"job_type": "submission"}); err != nil {
+				t.Fatal(err)
+			}
+
+			msg := abortJob(t, backend, w, queue, tt.nacks)
+			if string(msg.Data) != "job" || msg.Attributes["job_type"] != "submission" {
+				t.Errorf("requeued job has data %q and attributes %v", msg.Data, msg.Attributes)
+			}
+			if drained := msg.Attributes["drained"] == "true"; drained != tt.wantDrained {
+				t.Errorf("drained = %v, want %v", drained, tt.wantDrained)
+			}
+			if msg.Redelivered != tt.wantRedelivered {
+				t.Errorf("Redelivered = %v, want %v", msg.Redelivered, tt.wantRedelivered)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/jjudge-oj/worker/config"
+	"github.com/jjudge-oj/worker/internal/mq"
+)
+
+// Health exposes the worker's health tracker to the external tests.
+type Health = health
+
+func NewHealth(threshold int) *Health {
+	return newHealth(threshold)
+}
+
+func (h *health) Failure(err error) HealthState { return h.failure(err) }
+
+func (h *health) Success() { h.success() }
+
+func (h *health) Status() HealthStatus { return h.status() }
+
+func (h *health) Serving() <-chan struct{} { return h.serving() }
+
+func (h *health) Stopped() <-chan struct{} { return h.stopped() }
+
+// ProbeWhileUnhealthy runs the worker's probe loop on h with probe in place
+// of a sandbox run.
+func ProbeWhileUnhealthy(ctx context.Context, h *Health, interval time.Duration, probe func(context.Context) error) {
+	w := &Worker{cfg: &config.Config{WorkerID: "test"}, health: h}
+	w.probeWhileUnhealthy(ctx, interval, probe)
+}
+
+// Consume exposes consume to the external tests.
+func (w *Worker) Consume(ctx context.Context, queue string, handler mq.Handler) error {
+	return w.consume(ctx, queue, handler)
+}
+
+// OutputArchive exposes the output archive reader to the external tests.
+type OutputArchive = outputArchive
+
+func OpenOutputArchive(archive []byte) (*OutputArchive, error) {
+	return openOutputArchive(archive)
+}
+
+func (a *outputArchive) Read(name string) (data string, ok, tooLarge bool, err error) {
+	return a.read(name)
+}
+
+const MaxOutputFileBytes = maxOutputFileBytes
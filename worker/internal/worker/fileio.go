@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/worker/internal/lime"
+)
+
+// defaultOutputLimitBytes is the output limit applied when a problem does not
+// set one; it matches the sandbox's default stdout limit.
+const defaultOutputLimitBytes = 8 << 20
+
+// outputLimit returns the per-test output limit of problem in bytes.
+func outputLimit(problem types.Problem) int64 {
+	if problem.OutputLimit > 0 {
+		return problem.OutputLimit
+	}
+	return defaultOutputLimitBytes
+}
+
+// prepareFileIO sets up the work directory for one test case of a problem
+// using file-based I/O. It writes the input to the problem's input file,
+// removes the output file left by the previous test case and returns the
+// stdin to feed the program.
+func prepareFileIO(workDir string, problem types.Problem, input string) (string, error) {
+	if problem.OutputFile != "" {
+		if err := os.Remove(filepath.Join(workDir, filepath.Base(problem.OutputFile))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("remove previous output file: %w", err)
+		}
+	}
+	if problem.InputFile == "" {
+		return input, nil
+	}
+	if err := os.WriteFile(filepath.Join(workDir, filepath.Base(problem.InputFile)), []byte(input), 0644); err != nil {
+		return "", fmt.Errorf("write input file: %w", err)
+	}
+	return "", nil
+}
+
+// collectFileOutput replaces the stdout of a successful run with the
+// contents of the problem's output file. An output file larger than limit
+// turns the report into an output limit exceeded one. It returns a message
+// explaining the wrong answer when the program did not leave a usable output
+// file.
+func collectFileOutput(workDir, outputFile string, limit int64, report *lime.Report) (string, error) {
+	if report.Status != lime.STATUS_OK {
+		return "", nil
+	}
+
+	path := filepath.Join(workDir, filepath.Base(outputFile))
+	// The file is written by the sandboxed program, so it must not be
+	// followed if it is anything but a regular file.
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Sprintf("output file %s not found", outputFile), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Sprintf("output file %s is not a regular file", outputFile), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > limit {
+		report.Status = lime.STATUS_OUTPUT_LIMIT_EXCEEDED
+		report.Reason = lime.REASON_OUTPUT_LIMIT
+		return "", nil
+	}
+	report.Stdout = string(data)
+	return "", nil
+}
@@ -0,0 +1,273 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/worker/internal/mq"
+)
+
+const (
+	heartbeatQueue = "worker-heartbeats"
+
+	// commandQueuePrefix is followed by the worker ID to name the transient
+	// queue a worker receives administrator commands on. It goes away with
+	// the worker, so scaled-down workers leave nothing on the broker.
+	commandQueuePrefix = "worker-commands-"
+
+	// maxCommandAge is how old a command may be when it arrives. Older ones
+	// were queued for an earlier run of the worker and are ignored.
+	maxCommandAge = time.Minute
+)
+
+// Version is the worker's build version, reported in heartbeats. Set it
+// with -ldflags "-X github.com/jjudge-oj/worker/internal/worker.Version=...";
+// otherwise the VCS revision recorded by the Go toolchain is used.
+var Version string
+
+// pause is an administrator's hold on consumption. resumed is closed while
+// the worker may consume and paused while it may not; the open one is
+// replaced on each transition so waiters see it.
+type pause struct {
+	mu      sync.Mutex
+	on      bool
+	resumed chan struct{}
+	paused  chan struct{}
+}
+
+func newPause() *pause {
+	resumed := make(chan struct{})
+	close(resumed)
+	return &pause{resumed: resumed, paused: make(chan struct{})}
+}
+
+// set pauses or resumes consumption and reports whether that changed it.
+func (p *pause) set(on bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.on == on {
+		return false
+	}
+	p.on = on
+	if on {
+		close(p.paused)
+		p.resumed = make(chan struct{})
+	} else {
+		close(p.resumed)
+		p.paused = make(chan struct{})
+	}
+	return true
+}
+
+func (p *pause) isOn() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.on
+}
+
+func (p *pause) whenResumed() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumed
+}
+
+func (p *pause) whenPaused() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
+
+// trackJob records job as in progress until the returned function is called.
+func (w *Worker) trackJob(job types.WorkerJob) func() {
+	job.StartedAt = time.Now()
+	w.jobsMu.Lock()
+	w.nextJobKey++
+	key := w.nextJobKey
+	w.jobs[key] = job
+	w.jobsMu.Unlock()
+	return func() {
+		w.jobsMu.Lock()
+		delete(w.jobs, key)
+		w.jobsMu.Unlock()
+	}
+}
+
+// currentJobs returns the jobs in progress, oldest first.
+func (w *Worker) currentJobs() []types.WorkerJob {
+	w.jobsMu.Lock()
+	jobs := make([]types.WorkerJob, 0, len(w.jobs))
+	for _, job := range w.jobs {
+		jobs = append(jobs, job)
+	}
+	w.jobsMu.Unlock()
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartedAt.Before(jobs[j].StartedAt) })
+	return jobs
+}
+
+// state summarizes the worker's state for heartbeats. Draining takes
+// precedence over an unhealthy sandbox, which takes precedence over a pause.
+func (w *Worker) state() types.WorkerState {
+	switch {
+	case w.drain.status().State != DrainRunning:
+		return types.WorkerDraining
+	case w.health.status().State == HealthUnhealthy:
+		return types.WorkerUnhealthy
+	case w.pause.isOn():
+		return types.WorkerPaused
+	default:
+		return types.WorkerRunning
+	}
+}
+
+// heartbeat describes the worker for the API server's registry.
+func (w *Worker) heartbeat(state types.WorkerState) types.Worker {
+	host, _ := os.Hostname()
+	langs := make([]string, 0, len(languages))
+	for name := range languages {
+		langs = append(langs, name)
+	}
+	sort.Strings(langs)
+
+	var speedSum float64
+	var speedN int
+	for _, c := range w.Calibrations() {
+		if c.SpeedFactor > 0 {
+			speedSum += c.SpeedFactor
+			speedN++
+		}
+	}
+	var speed float64
+	if speedN > 0 {
+		speed = speedSum / float64(speedN)
+	}
+
+	hb := types.Worker{
+		ID:          w.cfg.WorkerID,
+		Host:        host,
+		Version:     buildVersion(),
+		Queue:       w.cfg.RabbitMQ.Queue,
+		Languages:   langs,
+		SpeedFactor: speed,
+		State:       state,
+		Jobs:        w.currentJobs(),
+		StartedAt:   w.startedAt,
+	}
+	if w.slotPool != nil {
+		hb.Slots = w.slotPool.Size()
+		hb.FreeSlots = hb.Slots - w.slotPool.InUse()
+	}
+	return hb
+}
+
+func (w *Worker) publishHeartbeat(ctx context.Context, state types.WorkerState) error {
+	data, err := json.Marshal(w.heartbeat(state))
+	if err != nil {
+		return err
+	}
+	_, err = w.mq.Publish(ctx, heartbeatQueue, data, nil)
+	return err
+}
+
+// heartbeatEvery publishes a heartbeat every interval until ctx is done.
+func (w *Worker) heartbeatEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := w.publishHeartbeat(ctx, w.state()); err != nil && ctx.Err() == nil {
+			log.Printf("worker %s: failed to publish heartbeat: %v", w.cfg.WorkerID, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishFinalHeartbeat tells the registry the worker has stopped, so it is
+// not listed as running until its heartbeats time out.
+func (w *Worker) publishFinalHeartbeat(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), checkpointTimeout)
+	defer cancel()
+	if err := w.publishHeartbeat(ctx, types.WorkerStopped); err != nil {
+		log.Printf("worker %s: failed to publish final heartbeat: %v", w.cfg.WorkerID, err)
+	}
+}
+
+// consumeCommands applies administrator commands sent to the worker until
+// ctx is done.
+func (w *Worker) consumeCommands(ctx context.Context) {
+	queue := commandQueuePrefix + w.cfg.WorkerID
+	err := w.mq.SubscribeTransient(ctx, queue, func(ctx context.Context, msg mq.Message) error {
+		var cmd types.WorkerCommand
+		if err := json.Unmarshal(msg.Data, &cmd); err != nil {
+			log.Printf("worker %s: bad command, discarding: %v", w.cfg.WorkerID, err)
+			return nil // ack — malformed, retrying won't help
+		}
+		if age := time.Since(cmd.IssuedAt); age > maxCommandAge {
+			log.Printf("worker %s: ignoring %s command issued %s ago", w.cfg.WorkerID, cmd.Command, age.Round(time.Second))
+			return nil
+		}
+		w.applyCommand(cmd.Command)
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("worker %s: command consumer exited: %v", w.cfg.WorkerID, err)
+	}
+}
+
+func (w *Worker) applyCommand(cmd types.WorkerCommandType) {
+	switch cmd {
+	case types.WorkerPause:
+		if w.pause.set(true) {
+			log.Printf("worker %s: paused by administrator", w.cfg.WorkerID)
+		}
+	case types.WorkerResume:
+		if w.pause.set(false) {
+			log.Printf("worker %s: resumed by administrator", w.cfg.WorkerID)
+		}
+	case types.WorkerDrain:
+		log.Printf("worker %s: drain requested by administrator", w.cfg.WorkerID)
+		w.Drain(w.cfg.Judge.DrainTimeout)
+	default:
+		log.Printf("worker %s: unknown command %q", w.cfg.WorkerID, cmd)
+	}
+}
+
+// buildVersion returns Version, or the VCS revision of the build.
+func buildVersion() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	var revision string
+	var modified bool
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+	if revision == "" {
+		return info.Main.Version
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified {
+		revision += "-dirty"
+	}
+	return revision
+}
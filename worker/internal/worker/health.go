@@ -0,0 +1,327 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jjudge-oj/worker/internal/lime"
+	"github.com/jjudge-oj/worker/internal/metrics"
+	"github.com/jjudge-oj/worker/internal/mq"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HealthState is the worker's judgement of its own sandbox.
+type HealthState string
+
+const (
+	// HealthHealthy means the last sandbox run succeeded.
+	HealthHealthy HealthState = "healthy"
+
+	// HealthDegraded means recent sandbox runs failed, but fewer in a row
+	// than the failure threshold. The worker keeps consuming jobs.
+	HealthDegraded HealthState = "degraded"
+
+	// HealthUnhealthy means the sandbox failed too many times in a row. The
+	// worker stops consuming jobs until a probe run succeeds.
+	HealthUnhealthy HealthState = "unhealthy"
+)
+
+const defaultProbeInterval = 30 * time.Second
+
+// errSandbox marks job failures caused by the sandbox rather than by the
+// submission, which are returned to the queue for another worker.
+var errSandbox = errors.New("sandbox infrastructure failure")
+
+// HealthStatus is the body of the health endpoint.
+type HealthStatus struct {
+	Worker              string      `json:"worker"`
+	State               HealthState `json:"state"`
+	ConsecutiveFailures int         `json:"consecutive_failures"`
+	LastError           string      `json:"last_error,omitempty"`
+	Since               time.Time   `json:"since"`
+
+	// Broker is "connected" or "disconnected"; BrokerError says why the
+	// message queue connection is down.
+	Broker      string `json:"broker"`
+	BrokerError string `json:"broker_error,omitempty"`
+}
+
+// health tracks consecutive sandbox failures. up is closed while the worker
+// may consume jobs and down while it may not; the open one is replaced on
+// each transition so waiters see it.
+type health struct {
+	threshold int
+
+	mu        sync.Mutex
+	state     HealthState
+	failures  int
+	lastError string
+	since     time.Time
+	up        chan struct{}
+	down      chan struct{}
+}
+
+func newHealth(threshold int) *health {
+	up := make(chan struct{})
+	close(up)
+	return &health{
+		threshold: max(threshold, 1),
+		state:     HealthHealthy,
+		since:     time.Now(),
+		up:        up,
+		down:      make(chan struct{}),
+	}
+}
+
+// failure records a failed sandbox run and returns the resulting state.
+func (h *health) failure(err error) HealthState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures++
+	h.lastError = err.Error()
+	if h.failures >= h.threshold {
+		h.setLocked(HealthUnhealthy)
+	} else {
+		h.setLocked(HealthDegraded)
+	}
+	return h.state
+}
+
+// success records a successful sandbox run.
+func (h *health) success() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures = 0
+	h.lastError = ""
+	h.setLocked(HealthHealthy)
+}
+
+func (h *health) setLocked(state HealthState) {
+	if state == h.state {
+		return
+	}
+	prev := h.state
+	h.state = state
+	h.since = time.Now()
+	switch {
+	case state == HealthUnhealthy:
+		close(h.down)
+		h.up = make(chan struct{})
+	case prev == HealthUnhealthy:
+		close(h.up)
+		h.down = make(chan struct{})
+	}
+}
+
+// serving returns a channel that is closed while the worker may consume.
+func (h *health) serving() <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.up
+}
+
+// stopped returns a channel that is closed while the worker may not consume.
+func (h *health) stopped() <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.down
+}
+
+func (h *health) status() HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return HealthStatus{
+		State:               h.state,
+		ConsecutiveFailures: h.failures,
+		LastError:           h.lastError,
+		Since:               h.since,
+	}
+}
+
+// runSandbox runs a program through lime and records the outcome in the
+// worker's health. Only failures of the sandbox count, such as a missing
+// rootfs or lime failing; cancellation and errors caused by the job, such
+// as needing more CPUs than the worker has, leave the health unchanged.
+func (w *Worker) runSandbox(ctx context.Context, workDir, rootfs string, args []string, stdin string, timeLimitUs, memoryLimitBytes uint64, maxProcs uint32, useSeccompBPF bool, opts ...lime.RunOption) (*lime.Report, error) {
+	report, err := lime.Run(ctx, w.cfg, w.slotPool, workDir, rootfs, args, stdin, timeLimitUs, memoryLimitBytes, maxProcs, useSeccompBPF, opts...)
+	if err != nil {
+		if ctx.Err() != nil || !errors.Is(err, lime.ErrSandbox) {
+			return nil, err
+		}
+		metrics.LimeErrors.Inc()
+		if state := w.health.failure(err); state == HealthUnhealthy {
+			log.Printf("worker %s: sandbox unhealthy after %d failures, pausing consumption: %v", w.cfg.WorkerID, w.health.threshold, err)
+		}
+		return nil, err
+	}
+	w.health.success()
+	return report, nil
+}
+
+// sandboxError handles a failed sandbox run of a job. A job that may be
+// requeued is returned to the queue for another worker; otherwise, e.g. on
+// its second delivery, it fails with a system error like any other. Errors
+// the job itself causes fail it right away.
+func (w *Worker) sandboxError(ctx context.Context, what string, err error, requeue bool, fail func(message string) error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if requeue && errors.Is(err, lime.ErrSandbox) {
+		log.Printf("worker %s: %s, returning job to the queue: %v", w.cfg.WorkerID, what, err)
+		return errors.Join(errSandbox, err)
+	}
+	return fail(what + ": " + err.Error())
+}
+
+// consume subscribes handler to queue while the worker is healthy and not
+// paused. When the sandbox becomes unhealthy the subscription is dropped,
+// and it is resumed once a probe run succeeds; a pause likewise lasts until
+// the worker is resumed. When the worker drains, the subscription is
+// dropped for good and consume returns nil once in-flight handlers finish.
+func (w *Worker) consume(ctx context.Context, queue string, handler mq.Handler) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.drain.stopping:
+			return nil
+		case <-w.health.serving():
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.drain.stopping:
+			return nil
+		case <-w.pause.whenResumed():
+		}
+
+		subCtx, cancel := context.WithCancel(ctx)
+		stopped := w.health.stopped()
+		paused := w.pause.whenPaused()
+		go func() {
+			select {
+			case <-stopped:
+				cancel()
+			case <-paused:
+				cancel()
+			case <-w.drain.stopping:
+				cancel()
+			case <-subCtx.Done():
+			}
+		}()
+		// Handlers run on ctx, so a job in progress finishes and publishes
+		// its result even if the subscription is dropped meanwhile. Only the
+		// message's trace span is carried over.
+		err := w.mq.Subscribe(subCtx, queue, func(msgCtx context.Context, msg mq.Message) error {
+			if !w.drain.begin() {
+				return errDraining
+			}
+			defer w.drain.end()
+			if msg.Attributes[drainedAttribute] == "true" {
+				log.Printf("worker %s: resuming job %s aborted by a draining worker", w.cfg.WorkerID, msg.ID)
+			}
+			if !msg.PublishedAt.IsZero() {
+				metrics.QueueWait.WithLabelValues(queue).Observe(time.Since(msg.PublishedAt).Seconds())
+			}
+			err := handler(trace.ContextWithSpan(ctx, trace.SpanFromContext(msgCtx)), msg)
+			if err != nil && ctx.Err() != nil && !msg.Redelivered {
+				if rerr := w.requeueAborted(msgCtx, queue, msg); rerr != nil {
+					log.Printf("worker %s: failed to requeue aborted job, returning it unacked: %v", w.cfg.WorkerID, rerr)
+					return err
+				}
+				return nil
+			}
+			return err
+		})
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		select {
+		case <-w.drain.stopping:
+			return nil
+		case <-stopped:
+			log.Printf("worker %s: stopped consuming %q until the sandbox recovers", w.cfg.WorkerID, queue)
+		case <-paused:
+			log.Printf("worker %s: stopped consuming %q until resumed", w.cfg.WorkerID, queue)
+		default:
+			return err
+		}
+	}
+}
+
+// probeWhileUnhealthy calls probe every interval while the worker is
+// unhealthy; the first success makes it healthy again.
+func (w *Worker) probeWhileUnhealthy(ctx context.Context, interval time.Duration, probe func(context.Context) error) {
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.health.stopped():
+		}
+
+		ticker := time.NewTicker(interval)
+	probing:
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			case <-w.health.serving():
+				break probing
+			case <-ticker.C:
+				if err := probe(ctx); err != nil {
+					log.Printf("worker %s: sandbox probe failed: %v", w.cfg.WorkerID, err)
+					continue
+				}
+				w.health.success()
+				log.Printf("worker %s: sandbox probe succeeded, resuming consumption", w.cfg.WorkerID)
+			}
+		}
+		ticker.Stop()
+	}
+}
+
+// probe runs a trivial program in the sandbox.
+func (w *Worker) probe(ctx context.Context) error {
+	workDir, err := os.MkdirTemp(w.cfg.Judge.SubmissionsDir, "probe-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+	if err := os.Chmod(workDir, 0755); err != nil {
+		return err
+	}
+	_, err = w.runSandbox(ctx, workDir, "", []string{"/bin/true"}, "", probeTimeLimitUs, probeMemoryLimit, 1, false)
+	return err
+}
+
+// HealthHandler serves the worker's health as JSON, with status 503 while
+// the worker is unhealthy or disconnected from the message queue.
+func (w *Worker) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		status := w.health.status()
+		status.Worker = w.cfg.WorkerID
+		status.Broker = "connected"
+		if err := w.mq.Health(); err != nil {
+			status.Broker = "disconnected"
+			status.BrokerError = err.Error()
+		}
+		code := http.StatusOK
+		if status.State == HealthUnhealthy || status.BrokerError != "" {
+			code = http.StatusServiceUnavailable
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(code)
+		_ = json.NewEncoder(rw).Encode(status)
+	})
+}
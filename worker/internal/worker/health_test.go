@@ -0,0 +1,131 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jjudge-oj/worker/internal/worker"
+)
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestHealthTransitions(t *testing.T) {
+	errLime := errors.New("lime run error")
+
+	// Each step records a failure or a success and checks the state after it.
+	type step struct {
+		fail     bool
+		state    worker.HealthState
+		failures int
+	}
+	tests := []struct {
+		name      string
+		threshold int
+		steps     []step
+	}{
+		{
+			name:      "degraded below the threshold",
+			threshold: 3,
+			steps: []step{
+				{fail: true, state: worker.HealthDegraded, failures: 1},
+				{fail: true, state: worker.HealthDegraded, failures: 2},
+			},
+		},
+		{
+			name:      "unhealthy at the threshold",
+			threshold: 3,
+			steps: []step{
+				{fail: true, state: worker.HealthDegraded, failures: 1},
+				{fail: true, state: worker.HealthDegraded, failures: 2},
+				{fail: true, state: worker.HealthUnhealthy, failures: 3},
+				{fail: true, state: worker.HealthUnhealthy, failures: 4},
+			},
+		},
+		{
+			name:      "success resets the count",
+			threshold: 2,
+			steps: []step{
+				{fail: true, state: worker.HealthDegraded, failures: 1},
+				{state: worker.HealthHealthy},
+				{fail: true, state: worker.HealthDegraded, failures: 1},
+				{fail: true, state: worker.HealthUnhealthy, failures: 2},
+				{state: worker.HealthHealthy},
+			},
+		},
+		{
+			name:      "threshold of zero acts as one",
+			threshold: 0,
+			steps: []step{
+				{fail: true, state: worker.HealthUnhealthy, failures: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := worker.NewHealth(tt.threshold)
+			for i, s := range tt.steps {
+				if s.fail {
+					if got := h.Failure(errLime); got != s.state {
+						t.Fatalf("step %d: Failure() = %s, want %s", i, got, s.state)
+					}
+				} else {
+					h.Success()
+				}
+				status := h.Status()
+				if status.State != s.state || status.ConsecutiveFailures != s.failures {
+					t.Fatalf("step %d: state %s with %d failures, want %s with %d", i, status.State, status.ConsecutiveFailures, s.state, s.failures)
+				}
+				if s.fail && status.LastError != errLime.Error() {
+					t.Errorf("step %d: last error %q, want %q", i, status.LastError, errLime)
+				}
+				unhealthy := s.state == worker.HealthUnhealthy
+				if isClosed(h.Serving()) == unhealthy || isClosed(h.Stopped()) != unhealthy {
+					t.Errorf("step %d: serving=%v stopped=%v in state %s", i, isClosed(h.Serving()), isClosed(h.Stopped()), s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthProbeResumes(t *testing.T) {
+	h := worker.NewHealth(1)
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	// The probe fails twice before the sandbox recovers.
+	var probes atomic.Int32
+	go worker.ProbeWhileUnhealthy(ctx, h, 10*time.Millisecond, func(context.Context) error {
+		if probes.Add(1) <= 2 {
+			return errors.New("lime run error")
+		}
+		return nil
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	if n := probes.Load(); n != 0 {
+		t.Fatalf("%d probes while healthy", n)
+	}
+
+	h.Failure(errors.New("lime run error"))
+	select {
+	case <-h.Serving():
+	case <-ctx.Done():
+		t.Fatal("consumption did not resume after a successful probe")
+	}
+	if n := probes.Load(); n != 3 {
+		t.Errorf("%d probes, want 3", n)
+	}
+	if status := h.Status(); status.State != worker.HealthHealthy || status.ConsecutiveFailures != 0 {
+		t.Errorf("state %s with %d failures after recovery", status.State, status.ConsecutiveFailures)
+	}
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"log"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/jjudge-oj/worker/internal/images"
+)
+
+// SetImages installs the store of per-language rootfs images. Languages
+// whose image is not installed keep running in the shared rootfs, which is
+// logged once here; images imported later are picked up on the next job.
+func (w *Worker) SetImages(store *images.Store) {
+	w.images = store
+	for _, lang := range sortedLanguages() {
+		spec := languages[lang]
+		if spec.Image == "" {
+			continue
+		}
+		if _, err := store.Path(spec.Image); err != nil {
+			log.Printf("worker: %s: image %s unavailable (%v), using shared rootfs %s", lang, spec.Image, err, w.cfg.Judge.RootfsDir)
+		}
+	}
+}
+
+// rootfs returns the rootfs path spec runs in, or "" for the shared rootfs.
+func (w *Worker) rootfs(spec langSpec) string {
+	if w.images == nil || spec.Image == "" {
+		return ""
+	}
+	root, err := w.images.Path(spec.Image)
+	if err != nil {
+		return ""
+	}
+	return root
+}
+
+// ImageBinaries returns, per image name, the sandbox paths of the compilers
+// and interpreters the languages using that image invoke.
+func ImageBinaries() map[string][]string {
+	binaries := make(map[string][]string)
+	for _, lang := range sortedLanguages() {
+		spec := languages[lang]
+		if spec.Image == "" {
+			continue
+		}
+		for _, args := range [][]string{spec.CompileArgs, spec.ExecArgs, spec.GraderExecArgs} {
+			// Programs in /work are built from the submission itself.
+			if len(args) == 0 || strings.HasPrefix(args[0], "/work/") {
+				continue
+			}
+			bin := path.Clean(args[0])
+			if !slices.Contains(binaries[spec.Image], bin) {
+				binaries[spec.Image] = append(binaries[spec.Image], bin)
+			}
+		}
+		if _, ok := binaries[spec.Image]; !ok {
+			binaries[spec.Image] = nil
+		}
+	}
+	return binaries
+}
+
+// LanguageImages returns the image name of each language that has one.
+func LanguageImages() map[string]string {
+	m := make(map[string]string)
+	for lang, spec := range languages {
+		if spec.Image != "" {
+			m[lang] = spec.Image
+		}
+	}
+	return m
+}
+
+func sortedLanguages() []string {
+	langs := make([]string, 0, len(languages))
+	for lang := range languages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
@@ -0,0 +1,129 @@
+package worker
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/worker/internal/lime"
+)
+
+const (
+	maxOutputArchiveBytes = 64 << 20
+	maxOutputFileBytes    = 64 << 20
+)
+
+// outputArchive is the uploaded output archive of an output-only
+// submission. Files are decompressed one at a time as their test case is
+// graded, so memory use stays bounded by the archive and one file however
+// well the archive compresses.
+type outputArchive struct {
+	files map[string]*zip.File
+}
+
+// fetchOutputs downloads the output archive of an output-only submission
+// and indexes its files by "<subtask>_<testcase>". Files not named after a
+// test case were rejected on upload and are ignored here.
+func (w *Worker) fetchOutputs(ctx context.Context, key string) (*outputArchive, error) {
+	rc, err := w.blob.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	archive, err := io.ReadAll(io.LimitReader(rc, maxOutputArchiveBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(archive) > maxOutputArchiveBytes {
+		return nil, fmt.Errorf("output archive exceeds %d bytes", maxOutputArchiveBytes)
+	}
+	return openOutputArchive(archive)
+}
+
+// openOutputArchive indexes the files of an output archive.
+func openOutputArchive(archive []byte) (*outputArchive, error) {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid output archive: %w", err)
+	}
+
+	outputs := &outputArchive{files: make(map[string]*zip.File, len(zr.File))}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name, ok := outputName(path.Base(f.Name))
+		if !ok {
+			continue
+		}
+		outputs.files[name] = f
+	}
+	return outputs, nil
+}
+
+// read decompresses the output for a test case. ok is false when the
+// archive has no such file, and tooLarge is set when the file exceeds
+// maxOutputFileBytes.
+func (a *outputArchive) read(name string) (data string, ok, tooLarge bool, err error) {
+	f, ok := a.files[name]
+	if !ok {
+		return "", false, false, nil
+	}
+	r, err := f.Open()
+	if err != nil {
+		return "", true, false, fmt.Errorf("open %s: %w", f.Name, err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(io.LimitReader(r, maxOutputFileBytes+1))
+	if err != nil {
+		return "", true, false, fmt.Errorf("read %s: %w", f.Name, err)
+	}
+	if len(b) > maxOutputFileBytes {
+		return "", true, true, nil
+	}
+	return string(b), true, false, nil
+}
+
+// outputName parses "<subtask>_<testcase>.out" into "<subtask>_<testcase>".
+func outputName(filename string) (string, bool) {
+	base, ok := strings.CutSuffix(strings.ToLower(filename), ".out")
+	if !ok {
+		return "", false
+	}
+	subtask, testcase, ok := strings.Cut(base, "_")
+	if !ok {
+		return "", false
+	}
+	s, err1 := strconv.Atoi(subtask)
+	t, err2 := strconv.Atoi(testcase)
+	if err1 != nil || err2 != nil || s < 0 || t < 0 {
+		return "", false
+	}
+	return fmt.Sprintf("%d_%d", s, t), true
+}
+
+// gradeOutput judges the uploaded output for a test case with the checker.
+// The returned report stands in for an execution report. The message
+// explains wrong answers that never reached the checker.
+func (w *Worker) gradeOutput(ctx context.Context, outputs *outputArchive, name, expectedOutput string) (*lime.Report, types.Verdict, string, error) {
+	data, ok, tooLarge, err := outputs.read(name)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	report := &lime.Report{Status: lime.STATUS_OK, Stdout: data}
+	switch {
+	case !ok:
+		return report, types.VerdictWrongAnswer, fmt.Sprintf("missing output file %s.out", name), nil
+	case tooLarge:
+		return report, types.VerdictWrongAnswer, fmt.Sprintf("output file %s.out exceeds %d bytes", name, maxOutputFileBytes), nil
+	default:
+		return report, w.mapStatusToVerdict(ctx, report, expectedOutput), "", nil
+	}
+}
@@ -0,0 +1,52 @@
+package worker_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jjudge-oj/worker/internal/worker"
+)
+
+func TestOutputArchiveRead(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, size := range map[string]int{"1_1.out": 3, "1_2.out": worker.MaxOutputFileBytes + 1} {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(f, strings.NewReader(strings.Repeat("7", size))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := worker.OpenOutputArchive(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		data     string
+		ok       bool
+		tooLarge bool
+	}{
+		{name: "1_1", data: "777", ok: true},
+		{name: "1_2", ok: true, tooLarge: true},
+		{name: "1_3"},
+	}
+	for _, tt := range tests {
+		data, ok, tooLarge, err := archive.Read(tt.name)
+		if err != nil {
+			t.Fatalf("Read(%s): %v", tt.name, err)
+		}
+		if data != tt.data || ok != tt.ok || tooLarge != tt.tooLarge {
+			t.Errorf("Read(%s) = %q, %v, %v; want %q, %v, %v", tt.name, data, ok, tooLarge, tt.data, tt.ok, tt.tooLarge)
+		}
+	}
+}
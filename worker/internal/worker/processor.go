@@ -6,11 +6,15 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"time"
 
 	"github.com/jjudge-oj/api/types"
 	"github.com/jjudge-oj/worker/internal/lime"
+	"github.com/jjudge-oj/worker/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -18,50 +22,134 @@ const (
 	compilationMemoryLimit = 512 * 1024 * 1024
 	compilationMaxProcs    = 32
 	defaultMaxProcs        = 1
+
+	// The health probe runs /bin/true within these limits.
+	probeTimeLimitUs = 1_000_000
+	probeMemoryLimit = 64 * 1024 * 1024
+
+	// Per-testcase diagnostics are cut to diagnosticsBytes, or to
+	// sampleDiagnosticsBytes for sample-only checks, which exist to show the
+	// user exactly where their output differs.
+	diagnosticsBytes       = 200
+	sampleDiagnosticsBytes = 64 << 10
 )
 
 // langSpec describes how to write, compile, and execute a submission for a
 // given language. CompileArgs is nil for interpreted languages.
 type langSpec struct {
 	Filename    string   // source file written to the work directory
-	CompileArgs []string // compile command run inside the sandbox; nil = no compilation
+	CompileArgs []string // compile command run inside the sandbox, without sources; nil = no compilation
+	SourceExts  []string // extensions of the work directory files passed to the compiler
 	ExecArgs    []string // execution command run inside the sandbox
+
+	// GraderExecArgs replaces ExecArgs when the problem ships grader files
+	// for the language, for interpreted languages where the grader is the
+	// entry point that loads the submission.
+	GraderExecArgs []string
+
+	// SeccompProfile names the syscall filter executions run under.
+	SeccompProfile string
+
+	// Image names the rootfs image the language compiles and runs in.
+	Image string
+
+	// MaxProcs is the number of processes and threads executions may run,
+	// e.g. for a runtime's own threads. Zero means defaultMaxProcs. It is
+	// overridden by JUDGE_LANGUAGE_MAX_PROCS.
+	MaxProcs uint32
+}
+
+// language returns the spec of the named language, with its process limit
+// overridden by the configured one.
+func (w *Worker) language(name string) (langSpec, bool) {
+	spec, ok := languages[name]
+	if n := w.cfg.Judge.LanguageMaxProcs[name]; ok && n > 0 {
+		spec.MaxProcs = n
+	}
+	return spec, ok
+}
+
+// maxProcs returns the process limit for executions of a submission in the
+// language to problem: the larger of the language's limit, the problem's
+// limit and one thread per CPU of the problem.
+func (s langSpec) maxProcs(problem types.Problem) uint32 {
+	procs := uint32(defaultMaxProcs)
+	if s.MaxProcs > 0 {
+		procs = s.MaxProcs
+	}
+	return max(procs, uint32(problem.MaxProcesses), uint32(problem.CPUCount()))
 }
 
 var languages = map[string]langSpec{
 	"cpp": {
 		Filename:    "solution.cpp",
-		CompileArgs: []string{"/usr/bin/g++", "-std=c++20", "-O2", "-o", "/work/solution", "/work/solution.cpp"},
+		CompileArgs: []string{"/usr/bin/g++", "-std=c++20", "-O2", "-I/work", "-o", "/work/solution"},
+		SourceExts:  []string{".cpp", ".cc"},
 		ExecArgs:    []string{"/work/solution"},
+
+		SeccompProfile: "default",
+		Image:          "gcc-13",
 	},
 	"python": {
-		Filename:    "solution.py",
-		CompileArgs: nil,
-		ExecArgs:    []string{"/usr/bin/python3", "/work/solution.py"},
+		Filename:       "solution.py",
+		CompileArgs:    nil,
+		ExecArgs:       []string{"/usr/bin/python3", "/work/solution.py"},
+		GraderExecArgs: []string{"/usr/bin/python3", "/work/grader.py"},
+		SeccompProfile: "python",
+		Image:          "python-3.12",
 	},
 }
 
+// compileCommand returns the compile command for the given source files,
+// named relative to the work directory.
+func (s langSpec) compileCommand(sources []string) []string {
+	args := append([]string(nil), s.CompileArgs...)
+	for _, name := range sources {
+		args = append(args, "/work/"+name)
+	}
+	return args
+}
+
+// compiledSources lists the files of workDir the compiler takes, sorted.
+func (s langSpec) compiledSources(workDir string) ([]string, error) {
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		return nil, err
+	}
+	var sources []string
+	for _, e := range entries {
+		if e.IsDir() || !slices.Contains(s.SourceExts, filepath.Ext(e.Name())) {
+			continue
+		}
+		sources = append(sources, e.Name())
+	}
+	return sources, nil
+}
+
 type publishFunc func(ctx context.Context, submission types.Submission) error
 
-func (w *Worker) processJob(ctx context.Context, job types.SubmissionJob) error {
-	return w.processJobWithPublisher(ctx, job, w.publishResult)
+func (w *Worker) processJob(ctx context.Context, job types.SubmissionJob, requeue bool) error {
+	return w.processJobWithPublisher(ctx, job, fmt.Sprintf("%d", job.Submission.ID), requeue, w.publishResult)
 }
 
-func (w *Worker) processContestJob(ctx context.Context, job types.ContestSubmissionJob) error {
+func (w *Worker) processContestJob(ctx context.Context, job types.ContestSubmissionJob, requeue bool) error {
 	cs := job.ContestSubmission
 	// Convert to Submission so the shared processing logic can run unchanged.
 	syntheticJob := types.SubmissionJob{
 		Submission: types.Submission{
-			ID:        int(cs.ID),
-			ProblemID: cs.ProblemID,
-			UserID:    cs.UserID,
-			Code:      cs.Code,
-			Language:  cs.Language,
-			Verdict:   cs.Verdict,
+			ID:         int(cs.ID),
+			ProblemID:  cs.ProblemID,
+			UserID:     cs.UserID,
+			Code:       cs.Code,
+			Language:   cs.Language,
+			Files:      cs.Files,
+			Verdict:    cs.Verdict,
+			SampleOnly: cs.SampleOnly,
 		},
-		Problem: job.Problem,
+		Problem:    job.Problem,
+		OutputsKey: job.OutputsKey,
 	}
-	return w.processJobWithPublisher(ctx, syntheticJob, func(ctx context.Context, result types.Submission) error {
+	return w.processJobWithPublisher(ctx, syntheticJob, fmt.Sprintf("%d", cs.ID), requeue, func(ctx context.Context, result types.Submission) error {
 		// Copy judging outcome back onto the original ContestSubmission.
 		cs.Verdict = result.Verdict
 		cs.Score = result.Score
@@ -71,13 +159,68 @@ func (w *Worker) processContestJob(ctx context.Context, job types.ContestSubmiss
 		cs.TestsPassed = result.TestsPassed
 		cs.TestsTotal = result.TestsTotal
 		cs.TestcaseResults = result.TestcaseResults
+		cs.Judge = result.Judge
 		return w.publishContestResult(ctx, cs)
 	})
 }
 
-func (w *Worker) processJobWithPublisher(ctx context.Context, job types.SubmissionJob, publish publishFunc) error {
+func (w *Worker) processReferenceJob(ctx context.Context, job types.ReferenceSolutionJob, requeue bool) error {
+	rs := job.ReferenceSolution
+	// Reference solutions go through the same pipeline as submissions; the
+	// work directory is prefixed so it cannot clash with a submission ID.
+	syntheticJob := types.SubmissionJob{
+		Submission: types.Submission{
+			ID:        int(rs.ID),
+			ProblemID: rs.ProblemID,
+			Code:      rs.Code,
+			Language:  rs.Language,
+			Verdict:   rs.Verdict,
+		},
+		Problem: job.Problem,
+	}
+	return w.processJobWithPublisher(ctx, syntheticJob, fmt.Sprintf("ref-%d", rs.ID), requeue, func(ctx context.Context, result types.Submission) error {
+		rs.Verdict = result.Verdict
+		rs.CPUTime = result.CPUTime
+		rs.Memory = result.Memory
+		rs.Message = result.Message
+		rs.TestsPassed = result.TestsPassed
+		rs.TestsTotal = result.TestsTotal
+		rs.TestcaseResults = result.TestcaseResults
+		return w.publishReferenceResult(ctx, rs)
+	})
+}
+
+// processJobWithPublisher judges job in a work directory named workName under
+// the submissions directory and reports progress through publish.
+// With requeue, a job the sandbox fails to run is returned to the queue
+// instead of failing with a system error.
+func (w *Worker) processJobWithPublisher(ctx context.Context, job types.SubmissionJob, workName string, requeue bool, publish publishFunc) (err error) {
 	submission := job.Submission
 	problem := job.Problem
+	// The reset of an aborted job bypasses observeResult, as the job has
+	// no outcome yet.
+	publishReset := publish
+	publish = observeResult(submission.Language, time.Now(), publish)
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			reset := job.Submission
+			reset.Verdict = types.VerdictPending
+			w.checkpoint(ctx, "job "+workName, func(ctx context.Context) error {
+				return publishReset(ctx, reset)
+			})
+		}
+	}()
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("jjudge.submission.id", submission.ID),
+		attribute.Int("jjudge.problem.id", problem.ID),
+		attribute.String("jjudge.language", submission.Language),
+		attribute.String("jjudge.worker", w.cfg.WorkerID),
+	)
+
+	submission.Judge = &types.JudgeInfo{
+		Worker:         w.cfg.WorkerID,
+		NormalizedTime: w.cfg.Judge.NormalizeCPUTime,
+	}
 
 	// Publish JUDGING status
 	submission.Verdict = types.VerdictJudging
@@ -86,36 +229,84 @@ func (w *Worker) processJobWithPublisher(ctx context.Context, job types.Submissi
 	}
 
 	// Create work directory
-	workDir := filepath.Join(w.cfg.Judge.SubmissionsDir, fmt.Sprintf("%d", submission.ID))
+	workDir := filepath.Join(w.cfg.Judge.SubmissionsDir, workName)
 	if err := os.MkdirAll(workDir, 0755); err != nil {
 		return w.failWithSystemError(ctx, submission, fmt.Sprintf("failed to create work dir: %v", err), publish)
 	}
 	defer os.RemoveAll(workDir)
 
-	// Write source code
-	spec, ok := languages[submission.Language]
-	if !ok {
-		return w.failWithSystemError(ctx, submission, fmt.Sprintf("unsupported language: %s", submission.Language), publish)
-	}
+	// Output-only submissions have nothing to compile or run; their
+	// uploaded outputs are graded as they are.
+	var (
+		execArgs []string
+		rootfs   string
+		seccomp  *lime.SeccompPolicy
+		procs    uint32
+		outputs  *outputArchive
+	)
+	if job.OutputsKey != "" {
+		var err error
+		outputs, err = w.fetchOutputs(ctx, job.OutputsKey)
+		if err != nil {
+			return w.failWithSystemError(ctx, submission, fmt.Sprintf("failed to fetch outputs %s: %v", job.OutputsKey, err), publish)
+		}
+	} else {
+		// Write source code
+		spec, ok := w.language(submission.Language)
+		if !ok {
+			return w.failWithSystemError(ctx, submission, fmt.Sprintf("unsupported language: %s", submission.Language), publish)
+		}
 
-	// Write source file
-	filePath := filepath.Join(workDir, spec.Filename)
-	if err := os.WriteFile(filePath, []byte(submission.Code), 0644); err != nil {
-		return w.failWithSystemError(ctx, submission, fmt.Sprintf("failed to write source: %v", err), publish)
-	}
+		// A problem needing more CPUs than this worker has can never run
+		// here; fail before spending time on compilation.
+		if n := problem.CPUCount(); n > w.slotPool.Size() {
+			return w.failWithSystemError(ctx, submission, fmt.Sprintf("problem needs %d CPUs, this worker has %d", n, w.slotPool.Size()), publish)
+		}
 
-	// Compile if the language requires it
-	if spec.CompileArgs != nil {
-		compiled, compileErr := w.compile(ctx, workDir, spec.CompileArgs, submission, publish)
-		if compileErr != nil {
-			return w.failWithSystemError(ctx, submission, fmt.Sprintf("compilation system error: %v", compileErr), publish)
+		// Write source files
+		if err := writeSources(workDir, spec, submission); err != nil {
+			return w.failWithSystemError(ctx, submission, fmt.Sprintf("failed to write source: %v", err), publish)
+		}
+
+		// Place the problem's grader files next to the submission
+		graderFiles := problem.GraderFilesFor(submission.Language)
+		for _, f := range graderFiles {
+			if err := w.placeGraderFile(ctx, workDir, f); err != nil {
+				return w.failWithSystemError(ctx, submission, fmt.Sprintf("failed to fetch grader file %s: %v", f.Name, err), publish)
+			}
+		}
+
+		rootfs = w.rootfs(spec)
+
+		// Compile if the language requires it
+		if spec.CompileArgs != nil {
+			sources, err := spec.compiledSources(workDir)
+			if err != nil {
+				return w.failWithSystemError(ctx, submission, fmt.Sprintf("failed to list sources: %v", err), publish)
+			}
+			compiled, compileErr := w.compile(ctx, workDir, rootfs, spec.compileCommand(sources), submission, publish)
+			if compileErr != nil {
+				return w.sandboxError(ctx, "compilation system error", compileErr, requeue, func(message string) error {
+					return w.failWithSystemError(ctx, submission, message, publish)
+				})
+			}
+			if !compiled {
+				return nil // CE already published
+			}
 		}
-		if !compiled {
-			return nil // CE already published
+
+		execArgs = spec.ExecArgs
+		seccomp = w.seccompPolicy(spec.SeccompProfile)
+		procs = spec.maxProcs(problem)
+		if len(graderFiles) > 0 && spec.GraderExecArgs != nil {
+			execArgs = spec.GraderExecArgs
 		}
 	}
 
-	execArgs := spec.ExecArgs
+	diagLimit := diagnosticsBytes
+	if submission.SampleOnly {
+		diagLimit = sampleDiagnosticsBytes
+	}
 
 	// Sort testcase groups by ordinal
 	groups := make([]types.TestcaseGroup, len(problem.TestcaseGroups))
@@ -133,6 +324,11 @@ func (w *Worker) processJobWithPublisher(ctx context.Context, job types.Submissi
 		testsTotal   int
 		score        int
 		worstVerdict types.Verdict = types.VerdictAccepted
+
+		// speedSum accumulates the speed factors of calibrated slots to
+		// report their mean on the submission.
+		speedSum  float64
+		speedRuns int
 	)
 
 	for _, group := range groups {
@@ -171,22 +367,63 @@ func (w *Worker) processJobWithPublisher(ctx context.Context, job types.Submissi
 				return w.failWithSystemError(ctx, submission, fmt.Sprintf("failed to read expected output: %v", err), publish)
 			}
 
-			// Execute
-			timeLimitUs := uint64(problem.TimeLimit) * 1000 // ms → μs
-			memoryLimitBytes := uint64(problem.MemoryLimit)
+			var (
+				report    *lime.Report
+				tcVerdict types.Verdict
+				tcMessage string
+				executed  bool
+			)
+			if outputs != nil {
+				name := fmt.Sprintf("%d_%d", group.Ordinal, tc.Ordinal)
+				report, tcVerdict, tcMessage, err = w.gradeOutput(ctx, outputs, name, string(expectedOutput))
+				if err != nil {
+					return w.failWithSystemError(ctx, submission, fmt.Sprintf("failed to read outputs: %v", err), publish)
+				}
+			} else {
+				// Execute
+				timeLimitUs := uint64(problem.TimeLimit) * 1000 // ms → μs
+				memoryLimitBytes := uint64(problem.MemoryLimit)
 
-			report, err := lime.Run(ctx, w.cfg, w.slotPool, workDir, "", execArgs, string(inputContent), timeLimitUs, memoryLimitBytes, defaultMaxProcs, true)
-			if err != nil {
-				return w.failWithSystemError(ctx, submission, fmt.Sprintf("execution error: %v", err), publish)
-			}
+				stdin, err := prepareFileIO(workDir, problem, string(inputContent))
+				if err != nil {
+					return w.failWithSystemError(ctx, submission, err.Error(), publish)
+				}
+
+				start := time.Now()
+				report, err = w.runSandbox(ctx, workDir, rootfs, execArgs, stdin, timeLimitUs, memoryLimitBytes, procs, true, execOptions(problem, seccomp)...)
+				metrics.RunDuration.WithLabelValues(submission.Language).Observe(time.Since(start).Seconds())
+				if err != nil {
+					return w.sandboxError(ctx, "execution error", err, requeue, func(message string) error {
+						return w.failWithSystemError(ctx, submission, message, publish)
+					})
+				}
+
+				executed = true
+
+				log.Printf("worker: testcase %d report: slot=%d status=%s reason=%s exitCode=%d signal=%d cpuTime=%d memory=%d stderr=%q", tc.ID, report.Slot, report.Status, report.Reason, report.ExitCode, report.Signal, report.CPUTime, report.Memory, report.Stderr)
 
-			log.Printf("worker: testcase %d report: status=%s exitCode=%d signal=%d cpuTime=%d memory=%d stderr=%q", tc.ID, report.Status, report.ExitCode, report.Signal, report.CPUTime, report.Memory, report.Stderr)
+				// Read the output back from the problem's output file
+				if problem.OutputFile != "" {
+					tcMessage, err = collectFileOutput(workDir, problem.OutputFile, outputLimit(problem), report)
+					if err != nil {
+						return w.failWithSystemError(ctx, submission, fmt.Sprintf("failed to read output file: %v", err), publish)
+					}
+				}
 
-			// Map report status to verdict
-			tcVerdict := w.mapStatusToVerdict(ctx, report, string(expectedOutput))
+				// Map report status to verdict
+				if tcMessage != "" {
+					tcVerdict = types.VerdictWrongAnswer
+				} else {
+					tcVerdict = w.mapStatusToVerdict(ctx, report, string(expectedOutput))
+				}
+			}
 
 			// Track results
-			cpuTimeMs := int64(report.CPUTime / 1000) // μs → ms
+			timeUs := report.CPUTime
+			if problem.TimeAccounting == types.TimeAccountingWall && executed {
+				timeUs = report.WallTime
+			}
+			cpuTimeMs := int64(timeUs / 1000) // μs → ms
 			if cpuTimeMs > maxCPUTime {
 				maxCPUTime = cpuTimeMs
 			}
@@ -210,14 +447,27 @@ func (w *Worker) processJobWithPublisher(ctx context.Context, job types.Submissi
 				Verdict:      tcVerdict,
 				CPUTime:      cpuTimeMs,
 				Memory:       memBytes,
+				Termination:  terminationFromReport(report),
+			}
+			if executed {
+				slot := report.Slot
+				result.Slot = &slot
+				result.SpeedFactor = report.SpeedFactor
+				if report.SpeedFactor > 0 {
+					speedSum += report.SpeedFactor
+					speedRuns++
+				}
 			}
 			if !tc.IsHidden {
-				result.Input = truncate(string(inputContent), 200)
-				result.ExpectedOutput = truncate(string(expectedOutput), 200)
-				result.ActualOutput = truncate(report.Stdout, 200)
+				result.Input = truncate(string(inputContent), diagLimit)
+				result.ExpectedOutput = truncate(string(expectedOutput), diagLimit)
+				result.ActualOutput = truncate(report.Stdout, diagLimit)
+			}
+			if tcVerdict == types.VerdictRuntimeError || (submission.SampleOnly && report.Stderr != "") {
+				result.ErrorMessage = truncate(report.Stderr, diagLimit)
 			}
-			if tcVerdict == types.VerdictRuntimeError {
-				result.ErrorMessage = truncate(report.Stderr, 200)
+			if tcMessage != "" {
+				result.ErrorMessage = tcMessage
 			}
 
 			results = append(results, result)
@@ -228,6 +478,12 @@ func (w *Worker) processJobWithPublisher(ctx context.Context, job types.Submissi
 		}
 	}
 
+	// A job aborted while judging is requeued, not given a verdict: the
+	// checker calls of its last tests may have failed on the cancellation.
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
 	// Aggregate final verdict
 	finalVerdict := types.VerdictAccepted
 	if testsPassed < testsTotal {
@@ -241,12 +497,81 @@ func (w *Worker) processJobWithPublisher(ctx context.Context, job types.Submissi
 	submission.TestsPassed = testsPassed
 	submission.TestsTotal = testsTotal
 	submission.TestcaseResults = results
+	if speedRuns > 0 {
+		submission.Judge.SpeedFactor = speedSum / float64(speedRuns)
+	}
 
 	return publish(ctx, submission)
 }
 
-func (w *Worker) compile(ctx context.Context, workDir string, args []string, submission types.Submission, publish publishFunc) (bool, error) {
-	report, err := lime.Run(ctx, w.cfg, w.slotPool, workDir, "", args, "", compilationTimeLimitUs, compilationMemoryLimit, compilationMaxProcs, false)
+// observeResult wraps publish to record the final verdict of a job and the
+// time since start when the job's result is published. The verdict is also
+// added to the job's trace span.
+func observeResult(language string, start time.Time, publish publishFunc) publishFunc {
+	return func(ctx context.Context, result types.Submission) error {
+		if result.Verdict != types.VerdictPending && result.Verdict != types.VerdictJudging {
+			metrics.Verdicts.WithLabelValues(language, result.Verdict.String()).Inc()
+			metrics.JobDuration.WithLabelValues(language).Observe(time.Since(start).Seconds())
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("jjudge.verdict", result.Verdict.String()))
+		}
+		return publish(ctx, result)
+	}
+}
+
+// execOptions returns the run options for executing a submission to
+// problem on its test cases.
+func execOptions(problem types.Problem, seccomp *lime.SeccompPolicy) []lime.RunOption {
+	opts := []lime.RunOption{
+		lime.WithOutputLimit(uint64(outputLimit(problem))),
+		lime.WithSeccompPolicy(seccomp),
+		lime.WithCPUCount(problem.CPUCount()),
+	}
+	if problem.TimeAccounting == types.TimeAccountingWall {
+		opts = append(opts, lime.WithWallClockTime())
+	}
+	return opts
+}
+
+// writeSources writes the submission to workDir: every file of a multi-file
+// submission, or the code under the language's default file name.
+func writeSources(workDir string, spec langSpec, submission types.Submission) error {
+	if len(submission.Files) == 0 {
+		return os.WriteFile(filepath.Join(workDir, spec.Filename), []byte(submission.Code), 0644)
+	}
+	for _, f := range submission.Files {
+		if f.Name == "" || filepath.Base(f.Name) != f.Name || f.Name == "." || f.Name == ".." {
+			return fmt.Errorf("invalid file name %q", f.Name)
+		}
+		if err := os.WriteFile(filepath.Join(workDir, f.Name), []byte(f.Content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// placeGraderFile copies a grader file from the testcase cache into workDir,
+// replacing any submitted file of the same name.
+func (w *Worker) placeGraderFile(ctx context.Context, workDir string, f types.GraderFile) error {
+	if filepath.Base(f.Name) != f.Name {
+		return fmt.Errorf("invalid file name %q", f.Name)
+	}
+	cached, err := w.tccache.GetOrFetch(ctx, f.Key)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(cached)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(workDir, f.Name), data, 0644)
+}
+
+func (w *Worker) compile(ctx context.Context, workDir, rootfs string, args []string, submission types.Submission, publish publishFunc) (bool, error) {
+	start := time.Now()
+	defer func() {
+		metrics.CompileDuration.WithLabelValues(submission.Language).Observe(time.Since(start).Seconds())
+	}()
+	report, err := w.runSandbox(ctx, workDir, rootfs, args, "", compilationTimeLimitUs, compilationMemoryLimit, compilationMaxProcs, false, lime.WithSeccompPolicy(w.seccompPolicy(compileSeccompProfile)))
 	if err != nil {
 		return false, err
 	}
@@ -255,7 +580,7 @@ func (w *Worker) compile(ctx context.Context, workDir string, args []string, sub
 
 	if report.Status != lime.STATUS_OK || report.ExitCode != 0 {
 		submission.Verdict = types.VerdictCompilationError
-		submission.Message = report.Stderr
+		submission.Message = compileMessage(report)
 		_ = publish(ctx, submission)
 		return false, nil
 	}
@@ -269,12 +594,20 @@ func (w *Worker) mapStatusToVerdict(ctx context.Context, report *lime.Report, ex
 		return types.VerdictTimeLimitExceeded
 	case lime.STATUS_MEMORY_LIMIT_EXCEEDED:
 		return types.VerdictMemoryLimitExceeded
+	case lime.STATUS_OUTPUT_LIMIT_EXCEEDED:
+		return types.VerdictOutputLimitExceeded
+	case lime.STATUS_TERMINATED:
+		return types.VerdictIdlenessLimitExceeded
+	case lime.STATUS_SECURITY_VIOLATION:
+		return types.VerdictSecurityViolation
 	case lime.STATUS_RUNTIME_ERROR:
 		return types.VerdictRuntimeError
 	case lime.STATUS_OK:
 		gradeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 		defer cancel()
+		start := time.Now()
 		ok, err := w.grader.Grade(gradeCtx, report.Stdout, expectedOutput, "token")
+		metrics.GradeDuration.Observe(time.Since(start).Seconds())
 		if err != nil {
 			log.Printf("worker: grader error: %v", err)
 			return types.VerdictSystemError
@@ -288,6 +621,37 @@ func (w *Worker) mapStatusToVerdict(ctx context.Context, report *lime.Report, ex
 	}
 }
 
+// compileMessage is the message of a failed compilation.
+func compileMessage(report *lime.Report) string {
+	if report.Status == lime.STATUS_SECURITY_VIOLATION {
+		return fmt.Sprintf("compiler stopped for making a forbidden system call (%s)\n%s", report.BlockedSyscall, report.Stderr)
+	}
+	return report.Stderr
+}
+
+// terminationFromReport describes why the run behind report ended, or
+// returns nil when it exited normally.
+func terminationFromReport(report *lime.Report) *types.Termination {
+	switch report.Reason {
+	case lime.REASON_CPU_TIME_LIMIT:
+		return &types.Termination{Reason: types.TerminationCPUTimeLimit}
+	case lime.REASON_WALL_TIME_LIMIT:
+		return &types.Termination{Reason: types.TerminationWallTimeLimit}
+	case lime.REASON_MEMORY_LIMIT:
+		return &types.Termination{Reason: types.TerminationMemoryLimit}
+	case lime.REASON_OUTPUT_LIMIT:
+		return &types.Termination{Reason: types.TerminationOutputLimit}
+	case lime.REASON_SIGNAL:
+		return &types.Termination{Reason: types.TerminationSignal, Signal: lime.SignalName(report.Signal)}
+	case lime.REASON_NONZERO_EXIT:
+		return &types.Termination{Reason: types.TerminationNonZeroExit, ExitCode: report.ExitCode}
+	case lime.REASON_SECCOMP_VIOLATION:
+		return &types.Termination{Reason: types.TerminationSeccompViolation, Syscall: report.BlockedSyscall}
+	default:
+		return nil
+	}
+}
+
 func truncate(s string, max int) string {
 	if len(s) <= max {
 		return s
@@ -296,6 +660,9 @@ func truncate(s string, max int) string {
 }
 
 func (w *Worker) failWithSystemError(ctx context.Context, submission types.Submission, message string, publish publishFunc) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	log.Printf("worker: system error for submission %d: %s", submission.ID, message)
 	submission.Verdict = types.VerdictSystemError
 	submission.Message = message
@@ -0,0 +1,178 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jjudge-oj/api/types"
+	"github.com/jjudge-oj/worker/internal/lime"
+	"github.com/jjudge-oj/worker/internal/mq"
+)
+
+const (
+	// maxRunOutputBytes bounds the stdout and stderr returned for a run.
+	maxRunOutputBytes = 64 << 10
+
+	// Custom invocations wait while graded jobs are running, but no longer
+	// than maxRunDeferral so they cannot starve on a busy worker.
+	runDeferralPoll = 200 * time.Millisecond
+	maxRunDeferral  = 30 * time.Second
+)
+
+// consumeRuns processes custom invocations from queue until ctx is cancelled.
+func (w *Worker) consumeRuns(ctx context.Context, queue string) {
+	log.Printf("worker: subscribing to %q run queue", queue)
+	err := w.consume(ctx, queue, func(ctx context.Context, msg mq.Message) error {
+		var job types.RunJob
+		if err := json.Unmarshal(msg.Data, &job); err != nil {
+			log.Printf("worker: failed to unmarshal run job: %v", err)
+			return nil // ack bad messages
+		}
+		w.yieldToGradedJobs(ctx)
+		log.Printf("worker: processing run %d", job.Run.ID)
+		defer w.trackJob(types.WorkerJob{
+			Kind:      types.WorkerJobRun,
+			ID:        job.Run.ID,
+			ProblemID: job.Run.ProblemID,
+			Language:  job.Run.Language,
+		})()
+		if err := w.processRunJob(ctx, job, !msg.Redelivered); err != nil {
+			log.Printf("worker: failed to process run %d: %v", job.Run.ID, err)
+			return err
+		}
+		log.Printf("worker: finished run %d", job.Run.ID)
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("worker: run consumer exited: %v", err)
+	}
+}
+
+// yieldToGradedJobs blocks while graded jobs are in progress, up to maxRunDeferral.
+func (w *Worker) yieldToGradedJobs(ctx context.Context) {
+	deadline := time.Now().Add(maxRunDeferral)
+	for w.activeJobs.Load() > 0 && time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(runDeferralPoll):
+		}
+	}
+}
+
+// processRunJob compiles and executes a run once on its stdin and publishes
+// the raw outcome. No grading takes place.
+// With requeue, a run the sandbox fails to execute is returned to the
+// queue instead of failing.
+func (w *Worker) processRunJob(ctx context.Context, job types.RunJob, requeue bool) (err error) {
+	run := job.Run
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			reset := job.Run
+			reset.Status = types.RunPending
+			w.checkpoint(ctx, fmt.Sprintf("run %d", run.ID), func(ctx context.Context) error {
+				return w.publishRunResult(ctx, reset)
+			})
+		}
+	}()
+
+	run.Status = types.RunRunning
+	if err := w.publishRunResult(ctx, run); err != nil {
+		log.Printf("worker: failed to publish RUNNING status for run %d: %v", run.ID, err)
+	}
+
+	spec, ok := w.language(run.Language)
+	if !ok {
+		return w.failRun(ctx, run, fmt.Sprintf("unsupported language: %s", run.Language))
+	}
+
+	workDir := filepath.Join(w.cfg.Judge.SubmissionsDir, fmt.Sprintf("run-%d", run.ID))
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return w.failRun(ctx, run, fmt.Sprintf("failed to create work dir: %v", err))
+	}
+	defer os.RemoveAll(workDir)
+
+	if err := os.WriteFile(filepath.Join(workDir, spec.Filename), []byte(run.Code), 0644); err != nil {
+		return w.failRun(ctx, run, fmt.Sprintf("failed to write source: %v", err))
+	}
+
+	rootfs := w.rootfs(spec)
+	if spec.CompileArgs != nil {
+		report, err := w.runSandbox(ctx, workDir, rootfs, spec.compileCommand([]string{spec.Filename}), "", compilationTimeLimitUs, compilationMemoryLimit, compilationMaxProcs, false, lime.WithSeccompPolicy(w.seccompPolicy(compileSeccompProfile)))
+		if err != nil {
+			return w.sandboxError(ctx, "compilation system error", err, requeue, func(message string) error {
+				return w.failRun(ctx, run, message)
+			})
+		}
+		if report.Status != lime.STATUS_OK || report.ExitCode != 0 {
+			run.Status = types.RunCompilationError
+			run.Stderr = truncate(compileMessage(report), maxRunOutputBytes)
+			run.ExitCode = report.ExitCode
+			return w.publishRunResult(ctx, run)
+		}
+	}
+
+	timeLimitUs := uint64(run.TimeLimit) * 1000 // ms → μs
+	report, err := w.runSandbox(ctx, workDir, rootfs, spec.ExecArgs, run.Stdin, timeLimitUs, uint64(run.MemoryLimit), spec.maxProcs(types.Problem{}), true, lime.WithSeccompPolicy(w.seccompPolicy(spec.SeccompProfile)))
+	if err != nil {
+		return w.sandboxError(ctx, "execution error", err, requeue, func(message string) error {
+			return w.failRun(ctx, run, message)
+		})
+	}
+
+	switch report.Status {
+	case lime.STATUS_OK:
+		run.Status = types.RunOK
+	case lime.STATUS_TIME_LIMIT_EXCEEDED:
+		run.Status = types.RunTimeLimitExceeded
+	case lime.STATUS_MEMORY_LIMIT_EXCEEDED:
+		run.Status = types.RunMemoryLimitExceeded
+	case lime.STATUS_OUTPUT_LIMIT_EXCEEDED:
+		run.Status = types.RunOutputLimitExceeded
+	case lime.STATUS_TERMINATED:
+		run.Status = types.RunIdlenessLimitExceeded
+	case lime.STATUS_SECURITY_VIOLATION:
+		run.Status = types.RunSecurityViolation
+	case lime.STATUS_RUNTIME_ERROR:
+		run.Status = types.RunRuntimeError
+	default:
+		run.Status = types.RunSystemError
+		run.Message = fmt.Sprintf("unexpected sandbox status %s", report.Status)
+	}
+	if t := terminationFromReport(report); t != nil && run.Message == "" {
+		run.Message = t.String()
+	}
+	run.Stdout = truncate(report.Stdout, maxRunOutputBytes)
+	run.Stderr = truncate(report.Stderr, maxRunOutputBytes)
+	run.ExitCode = report.ExitCode
+	run.CPUTime = int64(report.CPUTime / 1000)   // μs → ms
+	run.WallTime = int64(report.WallTime / 1000) // μs → ms
+	run.Memory = int64(report.Memory)
+
+	return w.publishRunResult(ctx, run)
+}
+
+func (w *Worker) failRun(ctx context.Context, run types.Run, message string) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	log.Printf("worker: system error for run %d: %s", run.ID, message)
+	run.Status = types.RunSystemError
+	run.Message = message
+	return w.publishRunResult(ctx, run)
+}
+
+// publishRunResult publishes a run update to the run results queue.
+func (w *Worker) publishRunResult(ctx context.Context, run types.Run) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	_, err = w.mq.Publish(ctx, runResultQueue, data, nil)
+	return err
+}
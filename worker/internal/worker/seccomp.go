@@ -0,0 +1,153 @@
+package worker
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/jjudge-oj/worker/internal/lime"
+)
+
+// compileSeccompProfile is the profile compilers run under.
+const compileSeccompProfile = "compile"
+
+// defaultSeccompProfiles holds the profiles used when no profile directory
+// is configured. Each <name>.json file defines the profile <name>.
+//
+//go:embed seccomp/*.json
+var defaultSeccompProfiles embed.FS
+
+// seccompProfile is the on-disk form of a profile. A profile may extend
+// another one, adding to its allow and deny lists and optionally replacing
+// its default action.
+type seccompProfile struct {
+	Extends       string             `json:"extends,omitempty"`
+	DefaultAction lime.SeccompAction `json:"default_action,omitempty"`
+	Allow         []string           `json:"allow,omitempty"`
+	Deny          []string           `json:"deny,omitempty"`
+}
+
+// limeRequiredSyscalls are the syscalls lime makes between installing the
+// filter and exec'ing the program (lime_required in lime/src/seccomp.c). Lime
+// allows them whatever the policy says, so a profile denying them would not
+// be enforced as written.
+var limeRequiredSyscalls = []string{"sendmsg", "close", "execve", "exit", "exit_group"}
+
+// LoadSeccompProfiles reads the seccomp profiles in dir, or the built-in
+// profiles when dir is empty, and resolves their extends chains. It fails
+// unless every profile a language or the compiler runs under is present, so
+// that no run falls back to an unfiltered sandbox.
+func LoadSeccompProfiles(dir string) (map[string]*lime.SeccompPolicy, error) {
+	var fsys fs.FS
+	if dir == "" {
+		sub, err := fs.Sub(defaultSeccompProfiles, "seccomp")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	} else {
+		fsys = os.DirFS(dir)
+	}
+
+	names, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]seccompProfile, len(names))
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		var p seccompProfile
+		if err := json.Unmarshal(data, &p); err != nil {
+			return nil, fmt.Errorf("seccomp profile %s: %w", name, err)
+		}
+		raw[strings.TrimSuffix(name, path.Ext(name))] = p
+	}
+
+	policies := make(map[string]*lime.SeccompPolicy, len(raw))
+	for name := range raw {
+		policy, err := resolveSeccompProfile(raw, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		policies[name] = policy
+	}
+
+	for _, name := range requiredSeccompProfiles() {
+		if _, ok := policies[name]; !ok {
+			return nil, fmt.Errorf("seccomp profile %s not found", name)
+		}
+	}
+	return policies, nil
+}
+
+// requiredSeccompProfiles returns the profiles runs refer to, sorted.
+func requiredSeccompProfiles() []string {
+	names := []string{compileSeccompProfile}
+	for _, spec := range languages {
+		if !slices.Contains(names, spec.SeccompProfile) {
+			names = append(names, spec.SeccompProfile)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// resolveSeccompProfile flattens the profile name and the profiles it
+// extends into a single policy. seen guards against extends cycles.
+func resolveSeccompProfile(raw map[string]seccompProfile, name string, seen []string) (*lime.SeccompPolicy, error) {
+	for _, s := range seen {
+		if s == name {
+			return nil, fmt.Errorf("seccomp profile %s: extends cycle %s", seen[0], strings.Join(append(seen, name), " -> "))
+		}
+	}
+	p, ok := raw[name]
+	if !ok {
+		return nil, fmt.Errorf("seccomp profile %s not found", name)
+	}
+
+	policy := &lime.SeccompPolicy{}
+	if p.Extends != "" {
+		parent, err := resolveSeccompProfile(raw, p.Extends, append(seen, name))
+		if err != nil {
+			return nil, err
+		}
+		*policy = *parent
+	}
+	if p.DefaultAction != "" {
+		policy.DefaultAction = p.DefaultAction
+	}
+	switch policy.DefaultAction {
+	case lime.SECCOMP_ACTION_ALLOW, lime.SECCOMP_ACTION_KILL:
+	default:
+		return nil, fmt.Errorf("seccomp profile %s: invalid default_action %q", name, policy.DefaultAction)
+	}
+	policy.Allow = append(append([]string(nil), policy.Allow...), p.Allow...)
+	policy.Deny = append(append([]string(nil), policy.Deny...), p.Deny...)
+	for _, syscall := range policy.Deny {
+		if slices.Contains(limeRequiredSyscalls, syscall) {
+			return nil, fmt.Errorf("seccomp profile %s: cannot deny %s, which the sandbox always allows", name, syscall)
+		}
+	}
+	return policy, nil
+}
+
+// SetSeccompProfiles installs the seccomp profiles runs are filtered with.
+// Without profiles, executions use lime's built-in allowlist and
+// compilations run unfiltered.
+func (w *Worker) SetSeccompProfiles(profiles map[string]*lime.SeccompPolicy) {
+	w.seccompProfiles = profiles
+}
+
+// seccompPolicy returns the named profile. It is nil only when no profiles
+// are installed, since LoadSeccompProfiles requires every profile runs name.
+func (w *Worker) seccompPolicy(name string) *lime.SeccompPolicy {
+	return w.seccompProfiles[name]
+}
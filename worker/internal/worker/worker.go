@@ -4,11 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"log"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jjudge-oj/api/types"
 	"github.com/jjudge-oj/worker/config"
 	"github.com/jjudge-oj/worker/internal/blob"
 	"github.com/jjudge-oj/worker/internal/grader"
+	"github.com/jjudge-oj/worker/internal/images"
 	"github.com/jjudge-oj/worker/internal/lime"
 	"github.com/jjudge-oj/worker/internal/mq"
 	"github.com/jjudge-oj/worker/internal/tccache"
@@ -18,6 +22,9 @@ const (
 	resultQueue              = "submission-results"
 	contestSubmissionQueue   = "contest-submissions"
 	contestResultQueue       = "contest-submission-results"
+	runResultQueue           = "run-results"
+	referenceResultQueue     = "reference-solution-results"
+	referenceSolutionJobType = "reference_solution"
 )
 
 // Worker consumes submission jobs from the queue, judges them, and publishes results.
@@ -28,34 +35,135 @@ type Worker struct {
 	blob     *blob.Storage
 	tccache  *tccache.TestcaseCache
 	slotPool *lime.SlotPool
+
+	// seccompProfiles are the syscall filters by profile name.
+	seccompProfiles map[string]*lime.SeccompPolicy
+
+	// images holds the per-language rootfs images. Without it, every
+	// language runs in the shared rootfs.
+	images *images.Store
+
+	// activeJobs counts graded jobs in progress; custom invocations yield
+	// to them.
+	activeJobs atomic.Int32
+
+	calibrationMu sync.Mutex
+	calibrations  []lime.Calibration
+
+	// health tracks sandbox failures; while unhealthy the worker does not
+	// consume jobs.
+	health *health
+
+	// drain tracks a graceful shutdown started by Drain.
+	drain *drain
+
+	// pause holds consumption at an administrator's request.
+	pause *pause
+
+	// jobs are the jobs in progress, reported in heartbeats.
+	jobsMu     sync.Mutex
+	jobs       map[int64]types.WorkerJob
+	nextJobKey int64
+	startedAt  time.Time
 }
 
 // New constructs a Worker with all required dependencies.
 func New(cfg *config.Config, mqClient *mq.MQ, graderClient *grader.Client, blobStorage *blob.Storage, tc *tccache.TestcaseCache, sp *lime.SlotPool) *Worker {
 	return &Worker{
-		cfg:      cfg,
-		mq:       mqClient,
-		grader:   graderClient,
-		blob:     blobStorage,
-		tccache:  tc,
-		slotPool: sp,
+		cfg:       cfg,
+		mq:        mqClient,
+		grader:    graderClient,
+		blob:      blobStorage,
+		tccache:   tc,
+		slotPool:  sp,
+		health:    newHealth(cfg.Judge.MaxSandboxFailures),
+		drain:     newDrain(),
+		pause:     newPause(),
+		jobs:      make(map[int64]types.WorkerJob),
+		startedAt: time.Now(),
 	}
 }
 
-// Start subscribes to the configured queue and processes jobs until ctx is cancelled.
+// Start subscribes to the configured queue and processes jobs until ctx is
+// cancelled, or until a drain started by Drain completes.
 func (w *Worker) Start(ctx context.Context) error {
+	// Jobs run on a context of their own, so a drain can let them finish
+	// after consumption stops and abort them at its deadline.
+	ctx, abort := context.WithCancel(ctx)
+	if w.cfg.Judge.HeartbeatInterval > 0 {
+		defer w.publishFinalHeartbeat(ctx)
+	}
+	defer abort()
+	w.drain.setAbort(abort)
+
+	w.calibrate(ctx)
+	if interval := w.cfg.Judge.CalibrationInterval; interval > 0 {
+		go w.calibrateEvery(ctx, interval)
+	}
+	go w.probeWhileUnhealthy(ctx, w.cfg.Judge.HealthProbeInterval, w.probe)
+	if interval := w.cfg.Judge.HeartbeatInterval; interval > 0 {
+		go w.heartbeatEvery(ctx, interval)
+	}
+	// The command queue is deleted as its consumer stops, which must
+	// happen before the broker connection is closed.
+	commandsDone := make(chan struct{})
+	go func() {
+		defer close(commandsDone)
+		w.consumeCommands(ctx)
+	}()
+	defer func() {
+		abort()
+		<-commandsDone
+	}()
+
 	queue := w.cfg.RabbitMQ.Queue
 	log.Printf("worker: subscribing to %q queue", queue)
 
+	var wg sync.WaitGroup
+	if runQueue := w.cfg.RabbitMQ.RunQueue; runQueue != "" && runQueue != queue {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.consumeRuns(ctx, runQueue)
+		}()
+	}
+
+	err := w.consumeJobs(ctx, queue)
+	if err != nil {
+		abort()
+	}
+	wg.Wait()
+
+	select {
+	case <-w.drain.stopping:
+		w.drain.finish()
+		log.Printf("worker %s: drained", w.cfg.WorkerID)
+		return nil
+	default:
+		return err
+	}
+}
+
+// consumeJobs judges jobs from queue until ctx is cancelled or the worker
+// drains.
+func (w *Worker) consumeJobs(ctx context.Context, queue string) error {
 	if queue == contestSubmissionQueue {
-		return w.mq.Subscribe(ctx, queue, func(ctx context.Context, msg mq.Message) error {
+		return w.consume(ctx, queue, func(ctx context.Context, msg mq.Message) error {
 			var job types.ContestSubmissionJob
 			if err := json.Unmarshal(msg.Data, &job); err != nil {
 				log.Printf("worker: failed to unmarshal contest job: %v", err)
 				return nil // ack bad messages
 			}
 			log.Printf("worker: processing contest submission %d for problem %d", job.ContestSubmission.ID, job.Problem.ID)
-			if err := w.processContestJob(ctx, job); err != nil {
+			defer w.trackJob(types.WorkerJob{
+				Kind:      types.WorkerJobContestSubmission,
+				ID:        job.ContestSubmission.ID,
+				ProblemID: job.Problem.ID,
+				Language:  job.ContestSubmission.Language,
+			})()
+			w.activeJobs.Add(1)
+			defer w.activeJobs.Add(-1)
+			if err := w.processContestJob(ctx, job, !msg.Redelivered); err != nil {
 				log.Printf("worker: failed to process contest submission %d: %v", job.ContestSubmission.ID, err)
 				return err
 			}
@@ -64,14 +172,27 @@ func (w *Worker) Start(ctx context.Context) error {
 		})
 	}
 
-	return w.mq.Subscribe(ctx, queue, func(ctx context.Context, msg mq.Message) error {
+	return w.consume(ctx, queue, func(ctx context.Context, msg mq.Message) error {
+		w.activeJobs.Add(1)
+		defer w.activeJobs.Add(-1)
+
+		if msg.Attributes["job_type"] == referenceSolutionJobType {
+			return w.handleReferenceMessage(ctx, msg)
+		}
+
 		var job types.SubmissionJob
 		if err := json.Unmarshal(msg.Data, &job); err != nil {
 			log.Printf("worker: failed to unmarshal job: %v", err)
 			return nil // ack bad messages
 		}
 		log.Printf("worker: processing submission %d for problem %d", job.Submission.ID, job.Problem.ID)
-		if err := w.processJob(ctx, job); err != nil {
+		defer w.trackJob(types.WorkerJob{
+			Kind:      types.WorkerJobSubmission,
+			ID:        int64(job.Submission.ID),
+			ProblemID: job.Problem.ID,
+			Language:  job.Submission.Language,
+		})()
+		if err := w.processJob(ctx, job, !msg.Redelivered); err != nil {
 			log.Printf("worker: failed to process submission %d: %v", job.Submission.ID, err)
 			return err
 		}
@@ -80,6 +201,29 @@ func (w *Worker) Start(ctx context.Context) error {
 	})
 }
 
+// handleReferenceMessage judges a reference solution that was queued
+// alongside regular submissions.
+func (w *Worker) handleReferenceMessage(ctx context.Context, msg mq.Message) error {
+	var job types.ReferenceSolutionJob
+	if err := json.Unmarshal(msg.Data, &job); err != nil {
+		log.Printf("worker: failed to unmarshal reference solution job: %v", err)
+		return nil // ack bad messages
+	}
+	log.Printf("worker: processing reference solution %d for problem %d", job.ReferenceSolution.ID, job.Problem.ID)
+	defer w.trackJob(types.WorkerJob{
+		Kind:      types.WorkerJobReferenceSolution,
+		ID:        job.ReferenceSolution.ID,
+		ProblemID: job.Problem.ID,
+		Language:  job.ReferenceSolution.Language,
+	})()
+	if err := w.processReferenceJob(ctx, job, !msg.Redelivered); err != nil {
+		log.Printf("worker: failed to process reference solution %d: %v", job.ReferenceSolution.ID, err)
+		return err
+	}
+	log.Printf("worker: finished reference solution %d", job.ReferenceSolution.ID)
+	return nil
+}
+
 // publishResult publishes a submission update to the results queue.
 func (w *Worker) publishResult(ctx context.Context, submission types.Submission) error {
 	data, err := json.Marshal(submission)
@@ -99,3 +243,13 @@ func (w *Worker) publishContestResult(ctx context.Context, cs types.ContestSubmi
 	_, err = w.mq.Publish(ctx, contestResultQueue, data, nil)
 	return err
 }
+
+// publishReferenceResult publishes a reference solution update to the reference results queue.
+func (w *Worker) publishReferenceResult(ctx context.Context, rs types.ReferenceSolution) error {
+	data, err := json.Marshal(rs)
+	if err != nil {
+		return err
+	}
+	_, err = w.mq.Publish(ctx, referenceResultQueue, data, nil)
+	return err
+}
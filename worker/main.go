@@ -2,26 +2,48 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/jjudge-oj/worker/config"
 	"github.com/jjudge-oj/worker/internal/blob"
 	"github.com/jjudge-oj/worker/internal/grader"
+	"github.com/jjudge-oj/worker/internal/images"
 	"github.com/jjudge-oj/worker/internal/lime"
+	"github.com/jjudge-oj/worker/internal/metrics"
 	"github.com/jjudge-oj/worker/internal/mq"
 	"github.com/jjudge-oj/worker/internal/tccache"
+	"github.com/jjudge-oj/worker/internal/tracing"
 	"github.com/jjudge-oj/worker/internal/worker"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
 	cfg := config.LoadConfig()
 
+	if len(os.Args) > 1 && os.Args[1] == "image" {
+		os.Exit(runImageCommand(cfg, os.Args[2:]))
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	shutdownTracing, err := tracing.Setup(ctx)
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = shutdownTracing(shutdownCtx)
+	}()
+
 	// Init blob storage
 	blobStorage, err := blob.NewStorageFromConfig(ctx, cfg)
 	if err != nil {
@@ -45,11 +67,10 @@ func main() {
 	}
 
 	// Init MQ client
-	mqClient, err := mq.NewRabbitMQClient(cfg.RabbitMQ)
+	mqWrapper, err := mq.NewMQFromConfig(ctx, cfg)
 	if err != nil {
-		log.Fatalf("failed to init rabbitmq: %v", err)
+		log.Fatalf("failed to init message queue: %v", err)
 	}
-	mqWrapper := mq.New(mqClient)
 	defer mqWrapper.Close()
 
 	// Init grader gRPC client
@@ -59,18 +80,51 @@ func main() {
 	}
 	defer graderClient.Close()
 
-	// Init slot pool
-	slotPool := lime.NewSlotPool(lime.WithSlotUIDs(100000), lime.WithCPUs(cfg.Judge.CPUs))
+	// Init slot pool, running through a lime daemon if configured
+	slotOpts := []lime.SlotPoolOption{lime.WithSlotUIDs(100000), lime.WithCPUs(cfg.Judge.CPUs)}
+	if cfg.Judge.LimeSocket != "" {
+		daemon, err := lime.StartDaemon(ctx, cfg.Judge.LimeSocket)
+		if err != nil {
+			log.Fatalf("failed to start lime daemon: %v", err)
+		}
+		defer daemon.Close()
+		slotOpts = append(slotOpts, lime.WithDaemon(daemon))
+	}
+	slotPool := lime.NewSlotPool(slotOpts...)
+	metrics.RegisterSlotPool(slotPool.Size, slotPool.InUse)
 
 	// Create and start worker
 	w := worker.New(cfg, mqWrapper, graderClient, blobStorage, tc, slotPool)
 
+	seccompProfiles, err := worker.LoadSeccompProfiles(cfg.Judge.SeccompDir)
+	if err != nil {
+		log.Fatalf("failed to load seccomp profiles: %v", err)
+	}
+	w.SetSeccompProfiles(seccompProfiles)
+	w.SetImages(images.NewStore(cfg.Judge.ImagesDir))
+
+	// Serve the health, metrics and drain status endpoints
+	mux := http.NewServeMux()
+	mux.Handle("GET /healthz", w.HealthHandler())
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.Handle("GET /drain", w.DrainHandler())
+	server := &http.Server{Addr: fmt.Sprintf(":%d", cfg.ServerPort), Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("http server exited: %v", err)
+		}
+	}()
+	defer server.Close()
+
 	// Handle OS signals
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
 		sig := <-sigCh
-		log.Printf("received signal %v, shutting down", sig)
+		log.Printf("received signal %v, draining for up to %s", sig, cfg.Judge.DrainTimeout)
+		w.Drain(cfg.Judge.DrainTimeout)
+		sig = <-sigCh
+		log.Printf("received signal %v again, shutting down", sig)
 		cancel()
 	}()
 
@@ -0,0 +1,156 @@
+package tests_test
+
+// Seccomp profile loading tests. They need no sandbox: profiles are parsed
+// and resolved in the worker before they reach lime.
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jjudge-oj/worker/internal/lime"
+	"github.com/jjudge-oj/worker/internal/worker"
+)
+
+// writeProfiles writes the profiles every worker needs plus extra into a
+// temporary directory. Entries of extra replace the base profiles.
+func writeProfiles(t *testing.T, extra map[string]string) string {
+	t.Helper()
+	profiles := map[string]string{
+		"compile": `{"default_action": "allow", "deny": ["ptrace"]}`,
+		"default": `{"default_action": "kill", "allow": ["read", "write"]}`,
+		"python":  `{"extends": "default", "allow": ["socket"]}`,
+	}
+	for name, data := range extra {
+		profiles[name] = data
+	}
+	dir := t.TempDir()
+	for name, data := range profiles {
+		if data == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".json"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSeccompBuiltinProfiles(t *testing.T) {
+	profiles, err := worker.LoadSeccompProfiles("")
+	if err != nil {
+		t.Fatalf("LoadSeccompProfiles: %v", err)
+	}
+	for _, name := range []string{"compile", "default", "python"} {
+		if profiles[name] == nil {
+			t.Errorf("built-in profile %s missing", name)
+		}
+	}
+	python := profiles["python"]
+	if python.DefaultAction != lime.SECCOMP_ACTION_KILL {
+		t.Errorf("python default action = %q, want it inherited from default", python.DefaultAction)
+	}
+	if !slices.Contains(python.Allow, "read") {
+		t.Errorf("python allow list does not merge default's: %v", python.Allow)
+	}
+	for _, syscall := range []string{"socket", "connect", "bind", "sendto", "recvfrom"} {
+		if slices.Contains(python.Allow, syscall) {
+			t.Errorf("python allows %s", syscall)
+		}
+	}
+}
+
+func TestSeccompExtends(t *testing.T) {
+	dir := writeProfiles(t, map[string]string{
+		"base":  `{"default_action": "allow", "deny": ["ptrace"], "allow": ["read"]}`,
+		"child": `{"extends": "base", "deny": ["mount"]}`,
+		"leaf":  `{"extends": "child", "default_action": "kill", "allow": ["write"]}`,
+	})
+	profiles, err := worker.LoadSeccompProfiles(dir)
+	if err != nil {
+		t.Fatalf("LoadSeccompProfiles: %v", err)
+	}
+	leaf := profiles["leaf"]
+	if leaf.DefaultAction != lime.SECCOMP_ACTION_KILL {
+		t.Errorf("leaf default action = %q, want %q", leaf.DefaultAction, lime.SECCOMP_ACTION_KILL)
+	}
+	if want := []string{"read", "write"}; !slices.Equal(leaf.Allow, want) {
+		t.Errorf("leaf allow = %v, want %v", leaf.Allow, want)
+	}
+	if want := []string{"ptrace", "mount"}; !slices.Equal(leaf.Deny, want) {
+		t.Errorf("leaf deny = %v, want %v", leaf.Deny, want)
+	}
+	// Resolving a child must not change its parent.
+	if want := []string{"ptrace"}; !slices.Equal(profiles["base"].Deny, want) {
+		t.Errorf("base deny = %v, want %v", profiles["base"].Deny, want)
+	}
+}
+
+func TestSeccompInvalidProfiles(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		extra   map[string]string
+		wantErr string
+	}{
+		{
+			name:    "missing language profile",
+			extra:   map[string]string{"python": ""},
+			wantErr: "seccomp profile python not found",
+		},
+		{
+			name:    "missing compile profile",
+			extra:   map[string]string{"compile": ""},
+			wantErr: "seccomp profile compile not found",
+		},
+		{
+			name:    "missing parent",
+			extra:   map[string]string{"orphan": `{"extends": "nowhere"}`},
+			wantErr: "seccomp profile nowhere not found",
+		},
+		{
+			name: "extends cycle",
+			extra: map[string]string{
+				"a": `{"extends": "b", "default_action": "allow"}`,
+				"b": `{"extends": "a"}`,
+			},
+			wantErr: "extends cycle",
+		},
+		{
+			name:    "invalid default action",
+			extra:   map[string]string{"odd": `{"default_action": "log"}`},
+			wantErr: `invalid default_action "log"`,
+		},
+		{
+			name:    "no default action",
+			extra:   map[string]string{"bare": `{"allow": ["read"]}`},
+			wantErr: "invalid default_action",
+		},
+		{
+			name:    "malformed json",
+			extra:   map[string]string{"broken": `{"allow": [`},
+			wantErr: "seccomp profile broken.json",
+		},
+		{
+			name:    "denies a syscall lime needs",
+			extra:   map[string]string{"compile": `{"default_action": "allow", "deny": ["execve"]}`},
+			wantErr: "cannot deny execve",
+		},
+		{
+			name: "inherits a denied syscall lime needs",
+			extra: map[string]string{
+				"strict": `{"default_action": "allow", "deny": ["exit_group"]}`,
+				"loose":  `{"extends": "strict", "allow": ["read"]}`,
+			},
+			wantErr: "cannot deny exit_group",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := worker.LoadSeccompProfiles(writeProfiles(t, tc.extra))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("LoadSeccompProfiles: got %v, want an error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}